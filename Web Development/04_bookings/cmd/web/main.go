@@ -1,50 +1,169 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/gob"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/ashparshp/bookings"
 	"github.com/ashparshp/bookings/internal/config"
 	"github.com/ashparshp/bookings/internal/driver"
+	"github.com/ashparshp/bookings/internal/events"
 	"github.com/ashparshp/bookings/internal/handlers"
 	"github.com/ashparshp/bookings/internal/helpers"
+	"github.com/ashparshp/bookings/internal/jobs"
+	"github.com/ashparshp/bookings/internal/logger"
+	"github.com/ashparshp/bookings/internal/metrics"
 	"github.com/ashparshp/bookings/internal/models"
 	"github.com/ashparshp/bookings/internal/render"
+	"github.com/ashparshp/bookings/internal/scheduler"
+	"github.com/ashparshp/bookings/internal/sessionstore"
+	"github.com/ashparshp/bookings/internal/webhooks"
 
 	"github.com/alexedwards/scs/v2"
 )
 
+// mailQueueSize is how many notifications can be queued before handlers block on sending
+const mailQueueSize = 100
+
+// sessionCleanupInterval is how often expired sessions are deleted from the database
+const sessionCleanupInterval = 10 * time.Minute
+
 var app config.AppConfig
 var session *scs.SessionManager
-var infoLog *log.Logger
-var errorLog *log.Logger
+var sessionStore *sessionstore.Store
+var jobScheduler *scheduler.Scheduler
+var webhookDispatcher *webhooks.Dispatcher
+var eventBus *events.Bus
+
+// commands are run instead of the server when named as the first argument
+var commands = map[string]func(name string, args []string, out io.Writer) error{
+	"migrate": migrateCommand,
+	"seed":    seedCommand,
+}
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			err := command(os.Args[0]+" "+os.Args[1], os.Args[2:], os.Stdout)
+			if err != nil && !errors.Is(err, flag.ErrHelp) {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+	}
+
 	db, err := run()
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("cannot start application", "error", err)
+		os.Exit(1)
 	}
-	defer db.SQL.Close()
-	defer close(app.MailChan)
 
-	fmt.Println("Starting mail listener...")
-	listenForMail()
+	// SIGINT (Ctrl+C) and SIGTERM (sent by the platform on deploys) start a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	portNumber := getPort()
-	fmt.Println("Server running on port", portNumber)
+	go sessionStore.Cleanup(ctx, sessionCleanupInterval)
+
+	jobsDone := make(chan struct{})
+	go func() {
+		defer close(jobsDone)
+		webhooksDone := make(chan struct{})
+		go func() {
+			defer close(webhooksDone)
+			webhookDispatcher.Run(ctx)
+		}()
+		jobScheduler.Run(ctx)
+		<-webhooksDone
+	}()
 
 	srv := &http.Server{
-		Addr:    portNumber,
+		Addr:    fmt.Sprintf(":%d", app.Port),
 		Handler: routes(&app),
 	}
+	// the admin pages' event streams stay open until the bus closes, which must not hold up Shutdown
+	srv.RegisterOnShutdown(eventBus.Close)
+
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		db.SQL.Close()
+		app.Logger.Error("cannot listen", "addr", srv.Addr, "error", err)
+		os.Exit(1)
+	}
+
+	app.Logger.Info("starting notification listener")
+	stopMail := make(chan struct{})
+	mailDone := listenForNotifications(stopMail)
 
-	err = srv.ListenAndServe()
-	log.Fatal(err)
+	app.Logger.Info("server running", "port", app.Port)
+	if err := serve(ctx, srv, ln, jobsDone, stopMail, mailDone, db); err != nil {
+		app.Logger.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
+	app.Logger.Info("server stopped")
+}
+
+// serve handles requests on ln until ctx is cancelled and then shuts down in order: the server stops
+// accepting connections and waits for in-flight requests, running scheduled jobs and webhook deliveries
+// finish (jobsDone is closed once they have), the notification listener sends what is still queued, and
+// finally the database pool is closed. All of it must finish within app.ShutdownTimeout.
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, jobsDone <-chan struct{}, stopMail chan<- struct{}, mailDone <-chan struct{}, db *driver.DB) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+
+	var errs []error
+	select {
+	case err := <-serveErr:
+		errs = append(errs, err)
+	case <-ctx.Done():
+		app.Logger.Info("shutting down", "timeout", app.ShutdownTimeout)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), app.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("cannot finish in-flight requests: %w", err))
+	}
+
+	// jobs queue notifications, so they must be done before the listener stops
+	select {
+	case <-jobsDone:
+	case <-shutdownCtx.Done():
+		errs = append(errs, errors.New("scheduled jobs did not finish"))
+	}
+
+	close(stopMail)
+	select {
+	case <-mailDone:
+		app.Logger.Info("notification queue drained")
+	case <-shutdownCtx.Done():
+		errs = append(errs, fmt.Errorf("notification queue not drained, %d notifications left unsent", len(app.NotifyChan)))
+	}
+
+	if err := db.SQL.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("cannot close database: %w", err))
+	}
+
+	return errors.Join(errs...)
 }
 
 func run() (*driver.DB, error) {
@@ -55,54 +174,55 @@ func run() (*driver.DB, error) {
 	gob.Register(models.Restriction{})
 	gob.Register(map[string]int{})
 
-	// Read flags
-	inProduction := flag.Bool("production", true, "Run in production mode")
-	useCache := flag.Bool("cache", true, "Use template caching")
-	dbHost := flag.String("dbhost", "localhost", "Database host")
-	dbName := flag.String("dbname", "", "Database name")
-	dbUser := flag.String("dbuser", "", "Database user")
-	dbPassword := flag.String("dbpassword", "", "Database password")
-	dbPort := flag.String("dbport", "5432", "Database port")
-	dbSSL := flag.String("dbssl", "disable", "Database SSL setting (disable, prefer, require)")
-
-	// Email configuration flags
-    mailHost := flag.String("mailhost", "localhost", "SMTP host")
-    mailPort := flag.Int("mailport", 1025, "SMTP port")
-    mailUsername := flag.String("mailusername", "", "SMTP username")
-    mailPassword := flag.String("mailpassword", "", "SMTP password")
-    mailEncryption := flag.String("mailencryption", "none", "SMTP encryption (none, tls, ssl)")
-    mailFromAddress := flag.String("mailfrom", "noreply@bookings.com", "Mail from address")
-    mailFromName := flag.String("mailfromname", "Bookings", "Mail from name")
-
-	flag.Parse()
-
-	if *dbName == "" || *dbUser == "" {
-		log.Println("Database name and user must be provided")
-		os.Exit(1)
+	// Read configuration from defaults, the config file, the environment and flags
+	settings, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	if settings.PrintConfig {
+		if err := settings.Dump(os.Stdout); err != nil {
+			return nil, err
+		}
+		os.Exit(0)
 	}
 
-	mailChan := make(chan models.MailData)
-	app.MailChan = mailChan
+	level, err := logger.ParseLevel(settings.LogLevel)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", settings.LogLevel, err)
+	}
 
-	// Store email config in app
-    app.MailConfig = config.MailConfig{
-        Host:       *mailHost,
-        Port:       *mailPort,
-        Username:   *mailUsername,
-        Password:   *mailPassword,
-        Encryption: *mailEncryption,
-        FromAddress: *mailFromAddress,
-        FromName:   *mailFromName,
-    }
+	// JSON logs in production are picked up by the hosting platform, text is easier to read locally
+	app.Logger = logger.New(os.Stdout, level, settings.Production)
+	slog.SetDefault(app.Logger)
+	if settings.ConfigFile != "" {
+		app.Logger.Info("loaded config file", "path", settings.ConfigFile)
+	}
 
-	app.InProduction = *inProduction
-	app.UseCahce = *useCache
+	app.NotifyChan = make(chan models.Notification, mailQueueSize)
+	app.MailQueueThreshold = settings.Mail.QueueThreshold
 
-	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	app.InfoLog = infoLog
+	// Store email config in app
+	app.MailConfig = settings.Mail.MailConfig
 
-	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	app.ErrorLog = errorLog
+	app.InProduction = settings.Production
+	// dev mode reads the files from the working directory and always parses templates afresh
+	app.UseCahce = settings.Cache && !settings.Dev
+	app.DBDriver = settings.DB.Driver
+	app.DBTimeout = settings.DB.Timeout
+	app.Port = settings.Port
+	app.ShutdownTimeout = settings.ShutdownTimeout
+	app.BaseURL = strings.TrimRight(settings.BaseURL, "/")
+	app.Property = settings.Property
+	app.Security = settings.Security
+
+	app.SigningKey = []byte(settings.SigningKey)
+	if len(app.SigningKey) == 0 {
+		app.SigningKey = make([]byte, 32)
+		if _, err := rand.Read(app.SigningKey); err != nil {
+			return nil, fmt.Errorf("cannot generate signing key: %w", err)
+		}
+		app.Logger.Warn("no signing key configured, links in emails stop working when the server restarts")
+	}
 
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
@@ -112,37 +232,83 @@ func run() (*driver.DB, error) {
 	app.Session = session
 
 	// Database connection
-	log.Println("Connecting to database...")
-	connectionString := fmt.Sprintf(
-		"host=%s port=%s dbname=%s user=%s password=%s sslmode=%s",
-		*dbHost, *dbPort, *dbName, *dbUser, *dbPassword, *dbSSL,
-	)
-
-	db, err := driver.ConnectSQL(connectionString)
+	app.Logger.Info("connecting to database", "driver", app.DBDriver)
+	var db *driver.DB
+	if app.DBDriver == "sqlite" {
+		db, err = driver.ConnectSQLite(settings.DB.Name)
+	} else {
+		db, err = driver.ConnectSQL(settings.DB.ConnectionString())
+	}
 	if err != nil {
-		log.Fatal("Cannot connect to database:", err)
+		return nil, fmt.Errorf("cannot connect to database: %w", err)
+	}
+	app.Logger.Info("connected to database")
+
+	if settings.DB.Migrate {
+		if err := autoMigrate(db); err != nil {
+			db.SQL.Close()
+			return nil, err
+		}
+	}
+
+	metrics.RegisterDBStats(db.SQL)
+	metrics.Default.NewGaugeFunc("bookings_mail_queue_depth", "Number of emails and text messages waiting to be sent.", func() float64 {
+		return float64(len(app.NotifyChan))
+	})
+
+	assets := bookings.Load(settings.Dev, ".")
+	app.Templates = assets.Templates
+	app.MailTemplates = assets.MailTemplates
+	app.Static = assets.Static
+	if settings.Dev {
+		app.Logger.Info("dev mode, reading templates and static files from disk")
 	}
-	log.Println("Connected to database")
 
-	tc, err := render.CreateTemplateCache()
+	tc, err := render.CreateTemplateCache(app.Templates)
 	if err != nil {
-		log.Fatal("Cannot create template cache:", err)
-		return nil, err
+		return nil, fmt.Errorf("cannot create template cache: %w", err)
 	}
 	app.TemplateCache = tc
 
 	repo := handlers.NewRepo(&app, db)
 	handlers.NewHandler(repo)
+
+	// guests choose the channels of their notifications, which the dispatcher looks up as it sends them
+	dispatcher, err := newDispatcher(settings, repo.DB)
+	if err != nil {
+		return nil, fmt.Errorf("cannot set up notifications: %w", err)
+	}
+	sendNotification = func(n models.Notification) {
+		dispatcher.Send(context.Background(), n)
+	}
+
+	// sessions are kept in the database, so restarts and deploys do not log anyone out; tokens are
+	// stored hashed so the table cannot be used to take over a session
+	sessionStore = sessionstore.New(repo.DB, session.Codec)
+	session.Store = sessionStore
+	session.HashTokenInStore = true
+
+	// with postgres several instances may share the database, an advisory lock makes sure only one
+	// of them runs each job; a sqlite file belongs to a single instance
+	var locker scheduler.Locker = &scheduler.LocalLocker{}
+	if app.DBDriver != "sqlite" {
+		locker = scheduler.PostgresLocker{DB: db.SQL}
+	}
+	jobScheduler = scheduler.New(locker, app.Logger)
+	if settings.Jobs.Enabled {
+		reminders := jobs.NewReminders(&app, repo.DB, settings.Jobs.ReminderDays)
+		if err := reminders.Register(jobScheduler, settings.Jobs); err != nil {
+			return nil, err
+		}
+		app.Logger.Info("scheduled jobs enabled", "reminder_days", settings.Jobs.ReminderDays)
+	}
+
+	// webhook deliveries are claimed one at a time, so every instance delivers them
+	webhookDispatcher = repo.Webhooks
+	eventBus = repo.Events
+
 	render.NewRenderer(&app)
 	helpers.NewHelpers(&app)
 
 	return db, nil
 }
-
-func getPort() string {
-	port := os.Getenv("PORT")
-	if port == "" {
-		return ":8080"
-	}
-	return ":" + port
-}
\ No newline at end of file
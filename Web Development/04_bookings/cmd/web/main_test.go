@@ -1,10 +1,267 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/driver"
+	"github.com/ashparshp/bookings/internal/models"
+)
 
 func TestRun(t *testing.T) {
-	_, err := run()
+	os.Args = []string{os.Args[0], "-dbdriver=sqlite", "-dbname=" + filepath.Join(t.TempDir(), "bookings.db")}
+
+	db, err := run()
+	if err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	db.SQL.Close()
+}
+
+func TestServe_GracefulShutdown(t *testing.T) {
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldChan, oldTimeout, oldSender := app.NotifyChan, app.ShutdownTimeout, sendNotification
+	defer func() { app.NotifyChan, app.ShutdownTimeout, sendNotification = oldChan, oldTimeout, oldSender }()
+
+	app.NotifyChan = make(chan models.Notification, 10)
+	app.ShutdownTimeout = 5 * time.Second
+
+	// record sent emails, checking the database is still open while the queue drains
+	var mu sync.Mutex
+	var sent []string
+	sendNotification = func(m models.Notification) {
+		time.Sleep(20 * time.Millisecond)
+		if err := db.SQL.Ping(); err != nil {
+			t.Errorf("database closed before email to %s was sent", m.To)
+		}
+		mu.Lock()
+		sent = append(sent, m.To)
+		mu.Unlock()
+	}
+
+	started := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		app.NotifyChan <- models.Notification{To: "late@example.com"}
+		w.Write([]byte("done"))
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
-		t.Errorf("Failed to run")
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: mux}
+
+	for _, to := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		app.NotifyChan <- models.Notification{To: to}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopMail := make(chan struct{})
+	mailDone := listenForNotifications(stopMail)
+
+	// a scheduled job still running at shutdown gets its email out too
+	jobsDone := make(chan struct{})
+	go func() {
+		defer close(jobsDone)
+		<-ctx.Done()
+		time.Sleep(300 * time.Millisecond)
+		app.NotifyChan <- models.Notification{To: "job@example.com"}
+	}()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- serve(ctx, srv, ln, jobsDone, stopMail, mailDone, db)
+	}()
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	resp := make(chan result, 1)
+	go func() {
+		res, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			resp <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		resp <- result{status: res.StatusCode, body: string(body)}
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			t.Fatalf("expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("shutdown did not finish")
+	}
+
+	r := <-resp
+	if r.err != nil || r.status != http.StatusOK || r.body != "done" {
+		t.Errorf("expected the in-flight request to complete, got %+v", r)
+	}
+
+	mu.Lock()
+	if len(sent) != 5 {
+		t.Errorf("expected all 5 queued emails to be sent, got %v", sent)
+	}
+	mu.Unlock()
+
+	if err := db.SQL.Ping(); err == nil {
+		t.Error("expected the database to be closed after shutdown")
+	}
+
+	if _, err := http.Get("http://" + ln.Addr().String() + "/slow"); err == nil {
+		t.Error("expected new connections to be refused after shutdown")
+	}
+}
+
+func TestServe_ShutdownTimeout(t *testing.T) {
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldChan, oldTimeout := app.NotifyChan, app.ShutdownTimeout
+	defer func() { app.NotifyChan, app.ShutdownTimeout = oldChan, oldTimeout }()
+	app.NotifyChan = make(chan models.Notification, 1)
+	app.ShutdownTimeout = 50 * time.Millisecond
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stuck", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopMail := make(chan struct{})
+	mailDone := listenForNotifications(stopMail)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		jobsDone := make(chan struct{})
+		close(jobsDone)
+		serveErr <- serve(ctx, &http.Server{Handler: mux}, ln, jobsDone, stopMail, mailDone, db)
+	}()
+
+	go http.Get("http://" + ln.Addr().String() + "/stuck")
+	<-started
+	cancel()
+
+	select {
+	case err := <-serveErr:
+		if err == nil {
+			t.Error("expected an error when in-flight requests outlive the shutdown timeout")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not respect its timeout")
+	}
+}
+
+func TestMigrateCommand(t *testing.T) {
+	oldDir := migrationsDir
+	defer func() { migrationsDir = oldDir }()
+	migrationsDir = t.TempDir()
+
+	var out strings.Builder
+	if err := migrateCommand("bookings migrate", []string{"create", "add notes"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(out.String(), "created "); got != 2 {
+		t.Errorf("expected the up and down files created, got %q", out.String())
+	}
+	if files, _ := filepath.Glob(filepath.Join(migrationsDir, "*_add_notes.*.sql")); len(files) != 2 {
+		t.Errorf("expected two migration files, got %v", files)
+	}
+
+	for _, args := range [][]string{nil, {"sideways"}, {"create"}, {"down"}} {
+		if err := migrateCommand("bookings migrate", args, io.Discard); err != errMigrateUsage {
+			t.Errorf("%v: expected the usage, got %v", args, err)
+		}
+	}
+	if err := migrateCommand("bookings migrate", []string{"down", "0"}, io.Discard); err == nil {
+		t.Error("expected an error rolling back no migrations")
+	}
+
+	// a sqlite database takes the same commands
+	db := []string{"-dbdriver=sqlite", "-dbname=" + filepath.Join(t.TempDir(), "bookings.db")}
+	out.Reset()
+	if err := migrateCommand("bookings migrate", append([]string{"up"}, db...), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "applied 20250520093710_create_user_table") {
+		t.Errorf("expected the migrations applied, got %q", out.String())
+	}
+	out.Reset()
+	if err := migrateCommand("bookings migrate", append([]string{"down", "1"}, db...), &out); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := migrateCommand("bookings migrate", append([]string{"status"}, db...), &out); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); !strings.HasPrefix(lines[len(lines)-1], "pending") || !strings.HasPrefix(lines[1], "applied") {
+		t.Errorf("expected all but the latest migration applied, got %q", out.String())
+	}
+}
+
+func TestSeedCommand(t *testing.T) {
+	dbName := filepath.Join(t.TempDir(), "bookings.db")
+	args := []string{"-dbdriver=sqlite", "-rooms", "3", "-dbname=" + dbName, "-months=2", "-seed=7", "-today=2050-06-15"}
+
+	var out strings.Builder
+	if err := seedCommand("bookings seed", args, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "added 3 rooms, 5 users") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	db, err := driver.ConnectSQLite(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL.Close()
+	var reservations int
+	db.SQL.QueryRow("SELECT COUNT(*) FROM reservations").Scan(&reservations)
+	if reservations == 0 || !strings.Contains(out.String(), fmt.Sprintf("%d reservations", reservations)) {
+		t.Errorf("expected the reservations written, got %d", reservations)
+	}
+
+	if err := seedCommand("bookings seed", []string{"-dbdriver=sqlite", "-dbname=" + dbName, "-rooms=0"}, io.Discard); err == nil {
+		t.Error("expected an error seeding no rooms")
+	}
+	if err := seedCommand("bookings seed", []string{"-dbdriver=sqlite", "-dbname=" + dbName, "-today=tomorrow"}, io.Discard); err == nil {
+		t.Error("expected an error for an invalid day")
 	}
-}
\ No newline at end of file
+}
@@ -1,15 +1,27 @@
 package main
 
 import (
+	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/ashparshp/bookings/internal/helpers"
+	"github.com/ashparshp/bookings/internal/i18n"
+	"github.com/ashparshp/bookings/internal/logger"
+	"github.com/ashparshp/bookings/internal/metrics"
+	"github.com/ashparshp/bookings/internal/security"
+	"github.com/ashparshp/bookings/internal/sessionstore"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/justinas/nosurf"
 )
 
 // NoSurf adds CSFR protection to POST request
 func NoSurf(next http.Handler) http.Handler {
 	csfrHandler := nosurf.New(next)
+	// browsers post violation reports without a token
+	csfrHandler.ExemptPath(security.ReportPath)
 
 	csfrHandler.SetBaseCookie(http.Cookie{
 		HttpOnly: true,
@@ -20,9 +32,66 @@ func NoSurf(next http.Handler) http.Handler {
 	return csfrHandler
 }
 
-// SessionLoad loads and saves the session on every request
+// SecureHeaders sets the security headers of every response, and stores the nonce its inline scripts need
+// in the request context
+func SecureHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := security.NewNonce()
+		security.SetHeaders(w.Header(), app.Security, app.InProduction, nonce)
+		next.ServeHTTP(w, r.WithContext(security.NewContext(r.Context(), nonce)))
+	})
+}
+
+// languageCookieAge is how long a language chosen through a URL prefix is remembered
+const languageCookieAge = 365 * 24 * time.Hour
+
+// Locale picks the visitor's language and stores it in the request context. A URL prefix such as
+// /es/about wins and is remembered in a cookie, then the cookie, then the Accept-Language header.
+// The prefix is stripped so the routes match as usual.
+func Locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale := i18n.Default()
+
+		if code, rest, ok := i18n.SplitPath(r.URL.Path); ok {
+			locale, _ = i18n.Get(code)
+			r.URL.Path = rest
+			r.URL.RawPath = ""
+			http.SetCookie(w, &http.Cookie{
+				Name:     i18n.CookieName,
+				Value:    code,
+				Path:     "/",
+				MaxAge:   int(languageCookieAge.Seconds()),
+				HttpOnly: true,
+				Secure:   app.InProduction,
+				SameSite: http.SameSiteLaxMode,
+			})
+		} else if l, ok := cookieLocale(r); ok {
+			locale = l
+		} else if l, ok := i18n.Match(r.Header.Get("Accept-Language")); ok {
+			locale = l
+		}
+
+		w.Header().Set("Content-Language", locale.Code)
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(w, r.WithContext(i18n.NewContext(r.Context(), locale)))
+	})
+}
+
+// cookieLocale returns the locale remembered in the language cookie, if it is still supported
+func cookieLocale(r *http.Request) (*i18n.Locale, bool) {
+	c, err := r.Cookie(i18n.CookieName)
+	if err != nil {
+		return nil, false
+	}
+	return i18n.Get(c.Value)
+}
+
+// SessionLoad loads and saves the session on every request, telling the session store which client sent it
 func SessionLoad(next http.Handler) http.Handler {
-	return session.LoadAndSave(next)
+	load := session.LoadAndSave(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		load.ServeHTTP(w, r.WithContext(sessionstore.WithClient(r.Context(), r)))
+	})
 }
 
 // Auth checks if the user is authenticated
@@ -35,4 +104,57 @@ func Auth(next http.Handler) http.Handler {
 		}
 		next.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
+
+// RequestLogger assigns or propagates an X-Request-ID and stores a logger tagged with the
+// request ID, user ID and route in the request context. It must run after SessionLoad.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(logger.RequestIDHeader)
+		if !logger.ValidRequestID(requestID) {
+			requestID = logger.NewRequestID()
+		}
+		w.Header().Set(logger.RequestIDHeader, requestID)
+
+		ctx := logger.WithRequestID(r.Context(), requestID)
+		log := logger.WithDynamicAttrs(app.Logger.With("request_id", requestID), func() []slog.Attr {
+			// resolved per line, so a login during the request and the matched route are picked up
+			return []slog.Attr{
+				slog.Int("user_id", session.GetInt(ctx, "user_id")),
+				slog.String("route", chi.RouteContext(ctx).RoutePattern()),
+			}
+		})
+		r = r.WithContext(logger.NewContext(ctx, log))
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		log.Info("request completed",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", ww.Status(),
+			"bytes", ww.BytesWritten(),
+			"duration", time.Since(start),
+		)
+	})
+}
+
+// Metrics records request counts and latencies per chi route pattern
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		// label by pattern rather than path so ids in URLs don't create a series per request
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		method := metrics.Method(r.Method)
+		metrics.HTTPRequests.Inc(method, route, strconv.Itoa(ww.Status()))
+		metrics.HTTPRequestDuration.Observe(time.Since(start).Seconds(), method, route)
+	})
+}
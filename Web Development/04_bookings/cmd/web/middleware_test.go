@@ -1,8 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/i18n"
+	"github.com/ashparshp/bookings/internal/logger"
+	"github.com/ashparshp/bookings/internal/metrics"
+	"github.com/ashparshp/bookings/internal/security"
+	"github.com/go-chi/chi/v5"
 )
 
 func TestNoSurf(t *testing.T) {
@@ -18,6 +30,47 @@ func TestNoSurf(t *testing.T) {
 	}
 }
 
+func TestNoSurf_ExemptsCSPReport(t *testing.T) {
+	h := NoSurf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for path, want := range map[string]int{security.ReportPath: http.StatusNoContent, "/contact": http.StatusBadRequest} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("POST", path, strings.NewReader("{}")))
+		if rr.Code != want {
+			t.Errorf("POST %s without a token: expected status %d, got %d", path, want, rr.Code)
+		}
+	}
+}
+
+func TestSecureHeaders(t *testing.T) {
+	oldSecurity := app.Security
+	app.Security.CSP = config.CSPEnforce
+	defer func() { app.Security = oldSecurity }()
+
+	var nonces []string
+	h := SecureHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonces = append(nonces, security.NonceFromContext(r.Context()))
+	}))
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+		nonce := nonces[i]
+		if nonce == "" || !strings.Contains(rr.Header().Get("Content-Security-Policy"), "'nonce-"+nonce+"'") {
+			t.Errorf("expected the policy to allow the request's nonce %q, got %q", nonce, rr.Header().Get("Content-Security-Policy"))
+		}
+		if rr.Header().Get("X-Frame-Options") != "DENY" {
+			t.Error("expected X-Frame-Options to be set")
+		}
+	}
+	if nonces[0] == nonces[1] {
+		t.Error("expected a fresh nonce for every request")
+	}
+}
+
 func TestSessionLoad(t *testing.T) {
 	var myH myHandler
 
@@ -29,4 +82,139 @@ func TestSessionLoad(t *testing.T) {
 	default:
 		t.Errorf("Type is not http.Handler, but is %T", v)
 	}
-}
\ No newline at end of file
+}
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	oldLogger := app.Logger
+	app.Logger = logger.New(&buf, slog.LevelInfo, true)
+	defer func() { app.Logger = oldLogger }()
+
+	mux := chi.NewRouter()
+	mux.Use(SessionLoad)
+	mux.Use(RequestLogger)
+	mux.Get("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context()).Info("inside handler")
+	})
+
+	// an incoming request ID is propagated
+	req := httptest.NewRequest("GET", "/rooms/1", nil)
+	req.Header.Set(logger.RequestIDHeader, "abc-123")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get(logger.RequestIDHeader); got != "abc-123" {
+		t.Errorf("expected request ID to be propagated, got %q", got)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got %d: %s", len(lines), buf.String())
+	}
+
+	for _, line := range lines {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line is not JSON: %s", line)
+		}
+		if entry["request_id"] != "abc-123" {
+			t.Errorf("expected request_id abc-123, got %v", entry["request_id"])
+		}
+		if entry["route"] != "/rooms/{id}" {
+			t.Errorf("expected route /rooms/{id}, got %v", entry["route"])
+		}
+		if _, ok := entry["user_id"]; !ok {
+			t.Error("expected user_id in log line")
+		}
+	}
+
+	// an unsafe request ID is replaced with a generated one
+	req = httptest.NewRequest("GET", "/rooms/1", nil)
+	req.Header.Set(logger.RequestIDHeader, "bad id\nwith newline")
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	got := rr.Header().Get(logger.RequestIDHeader)
+	if got == "" || strings.Contains(got, " ") {
+		t.Errorf("expected a generated request ID, got %q", got)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	mux := chi.NewRouter()
+	mux.Use(Metrics)
+	mux.Get("/metrics-test/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	before := metrics.HTTPRequests.Value("GET", "/metrics-test/{id}", "418")
+
+	for _, id := range []string{"1", "2"} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics-test/"+id, nil))
+	}
+
+	if got := metrics.HTTPRequests.Value("GET", "/metrics-test/{id}", "418") - before; got != 2 {
+		t.Errorf("expected 2 requests counted under the route pattern, got %v", got)
+	}
+
+	// made-up methods share one series
+	before = metrics.HTTPRequests.Value("OTHER", "unmatched", "405")
+	for _, method := range []string{"BREW", "WHEN"} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(method, "/metrics-test/1", nil))
+	}
+	if got := metrics.HTTPRequests.Value("OTHER", "unmatched", "405") - before; got != 2 {
+		t.Errorf("expected 2 requests counted as OTHER, got %v", got)
+	}
+	if got := metrics.HTTPRequests.Value("BREW", "unmatched", "405"); got != 0 {
+		t.Errorf("expected no series for a made-up method, got %v", got)
+	}
+}
+
+func TestLocale(t *testing.T) {
+	var gotPath, gotLocale string
+	h := Locale(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotLocale = i18n.FromContext(r.Context()).Code
+	}))
+
+	tests := []struct {
+		name       string
+		path       string
+		cookie     string
+		accept     string
+		wantPath   string
+		wantLocale string
+		wantCookie bool
+	}{
+		{"default", "/about", "", "", "/about", "en", false},
+		{"url prefix", "/es/about", "", "en", "/about", "es", true},
+		{"cookie over header", "/about", "es", "en-US", "/about", "es", false},
+		{"unsupported cookie falls back to header", "/about", "xx", "es-MX,en;q=0.5", "/about", "es", false},
+		{"accept-language", "/about", "", "fr, es;q=0.8", "/about", "es", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: i18n.CookieName, Value: tt.cookie})
+		}
+		if tt.accept != "" {
+			req.Header.Set("Accept-Language", tt.accept)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if gotPath != tt.wantPath {
+			t.Errorf("%s: expected path %s, got %s", tt.name, tt.wantPath, gotPath)
+		}
+		if gotLocale != tt.wantLocale {
+			t.Errorf("%s: expected locale %s, got %s", tt.name, tt.wantLocale, gotLocale)
+		}
+		if got := rr.Header().Get("Content-Language"); got != tt.wantLocale {
+			t.Errorf("%s: expected Content-Language %s, got %s", tt.name, tt.wantLocale, got)
+		}
+		if got := strings.Contains(rr.Header().Get("Set-Cookie"), i18n.CookieName+"="+tt.wantLocale); got != tt.wantCookie {
+			t.Errorf("%s: expected language cookie set=%v, got %q", tt.name, tt.wantCookie, rr.Header().Get("Set-Cookie"))
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ashparshp/bookings"
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/driver"
+	"github.com/ashparshp/bookings/internal/migrate"
+)
+
+// errMigrateUsage is returned for a migrate command that cannot be understood
+var errMigrateUsage = errors.New(`usage: bookings migrate up [flags]
+       bookings migrate down N [flags]
+       bookings migrate status [flags]
+       bookings migrate create NAME
+
+The flags are the server's database settings, see bookings -h. create adds the files of a new
+migration to the migrations directory; the binary has to be rebuilt to carry it.`)
+
+// migrationsDir is where migrate create writes new migrations, relative to the source tree
+var migrationsDir = "migrations"
+
+// migrateCommand runs "bookings migrate"; args are the arguments that follow it
+func migrateCommand(name string, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+	action, args := args[0], args[1:]
+
+	n := 0
+	switch action {
+	case "create":
+		if len(args) != 1 {
+			return errMigrateUsage
+		}
+		paths, err := migrate.Create(migrationsDir, args[0], time.Now())
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			fmt.Fprintln(out, "created", p)
+		}
+		return nil
+	case "down":
+		if len(args) == 0 {
+			return errMigrateUsage
+		}
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			return fmt.Errorf("invalid number of migrations to roll back %q", args[0])
+		}
+		args = args[1:]
+	case "up", "status":
+	default:
+		return errMigrateUsage
+	}
+
+	settings, err := config.Load(name+" "+action, args, os.Getenv)
+	if err != nil {
+		return err
+	}
+
+	var db *driver.DB
+	if settings.DB.Driver == "sqlite" {
+		db, err = driver.OpenSQLite(settings.DB.Name)
+	} else {
+		db, err = driver.ConnectSQL(settings.DB.ConnectionString())
+	}
+	if err != nil {
+		return fmt.Errorf("cannot connect to database: %w", err)
+	}
+	defer db.SQL.Close()
+
+	m, err := newMigrator(db, settings.DB.Driver)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch action {
+	case "up":
+		done, err := m.Up(ctx)
+		for _, mg := range done {
+			fmt.Fprintf(out, "applied %s_%s\n", mg.Version, mg.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(out, "the database is up to date")
+		}
+		return err
+	case "down":
+		done, err := m.Down(ctx, n)
+		for _, mg := range done {
+			fmt.Fprintf(out, "rolled back %s_%s\n", mg.Version, mg.Name)
+		}
+		return err
+	default:
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printMigrationStatus(out, status)
+		return nil
+	}
+}
+
+// printMigrationStatus lists the migrations as a table
+func printMigrationStatus(out io.Writer, status []migrate.Status) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tVERSION\tNAME")
+	for _, s := range status {
+		state, name := "pending", s.Name
+		if s.Applied {
+			state = "applied"
+		}
+		if name == "" {
+			name = "(not in this binary)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", state, s.Version, name)
+	}
+	w.Flush()
+}
+
+// newMigrator returns a migrator with the migrations for the database driver
+func newMigrator(db *driver.DB, dbDriver string) (*migrate.Migrator, error) {
+	if dbDriver == "sqlite" {
+		migrations, err := migrate.Load(bookings.Migrations(), migrate.SQLite)
+		if err != nil {
+			return nil, err
+		}
+		return migrate.NewSQLite(db.SQL, migrations), nil
+	}
+	migrations, err := migrate.Load(bookings.Migrations(), migrate.Postgres)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db.SQL, migrations), nil
+}
+
+// autoMigrate applies pending migrations as the server starts. A sqlite database is brought up to date
+// when it is opened, so there is nothing to do for it.
+func autoMigrate(db *driver.DB) error {
+	if app.DBDriver == "sqlite" {
+		return nil
+	}
+
+	m, err := newMigrator(db, app.DBDriver)
+	if err != nil {
+		return err
+	}
+	done, err := m.Up(context.Background())
+	for _, mg := range done {
+		app.Logger.Info("applied migration", "version", mg.Version, "name", mg.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot migrate database: %w", err)
+	}
+	return nil
+}
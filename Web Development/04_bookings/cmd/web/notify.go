@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/notify"
+)
+
+// sendNotification delivers a single notification; run points it at the dispatcher and tests replace it
+// to avoid talking to an SMTP server or SMS provider
+var sendNotification = func(models.Notification) {}
+
+// listenForNotifications sends queued notifications in the background until stop is closed. It then sends
+// whatever is still queued and closes the returned channel.
+func listenForNotifications(stop <-chan struct{}) <-chan struct{} {
+	queue := app.NotifyChan
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case msg := <-queue:
+				sendNotification(msg)
+			case <-stop:
+				for {
+					select {
+					case msg := <-queue:
+						sendNotification(msg)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+	return done
+}
+
+// newDispatcher returns the dispatcher for the notifiers the settings ask for: files in the notify
+// directory, or email over SMTP and, when a provider is configured, text messages
+func newDispatcher(settings *config.Settings, prefs notify.PreferenceStore) (*notify.Dispatcher, error) {
+	if settings.NotifyDir != "" {
+		var sinks []notify.Notifier
+		for _, channel := range notify.Channels {
+			sink, err := notify.NewFileSink(settings.NotifyDir, channel, app.MailConfig, app.MailTemplates)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		}
+		app.Logger.Warn("notifications are written to files and not sent", "dir", settings.NotifyDir)
+		return notify.NewDispatcher(prefs, app.Logger, sinks...), nil
+	}
+
+	notifiers := []notify.Notifier{notify.NewSMTP(app.MailConfig, app.MailTemplates)}
+	if settings.SMS.URL != "" {
+		notifiers = append(notifiers, notify.NewSMS(settings.SMS))
+	} else {
+		app.Logger.Info("no SMS provider configured, text messages are not sent")
+	}
+	return notify.NewDispatcher(prefs, app.Logger, notifiers...), nil
+}
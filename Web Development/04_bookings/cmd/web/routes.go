@@ -5,6 +5,8 @@ import (
 
 	"github.com/ashparshp/bookings/internal/config"
 	"github.com/ashparshp/bookings/internal/handlers"
+	"github.com/ashparshp/bookings/internal/metrics"
+	"github.com/ashparshp/bookings/internal/security"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -22,8 +24,17 @@ func routes(_ *config.AppConfig) http.Handler {
 	mux := chi.NewRouter()
 
 	mux.Use(middleware.Recoverer)
+	mux.Use(SecureHeaders)
+	mux.Use(Locale)
+	mux.Use(Metrics)
 	mux.Use(NoSurf)
 	mux.Use(SessionLoad)
+	mux.Use(RequestLogger)
+
+	mux.Get("/healthz", handlers.Repo.Healthz)
+	mux.Get("/readyz", handlers.Repo.Readyz)
+	mux.Handle("/metrics", metrics.Default.Handler())
+	mux.Post(security.ReportPath, handlers.Repo.CSPReport)
 
 	mux.Get("/", handlers.Repo.HomePage)
 	mux.Get("/about", handlers.Repo.AboutPage)
@@ -39,6 +50,9 @@ func routes(_ *config.AppConfig) http.Handler {
 	mux.Post("/make-reservation", handlers.Repo.PostReservationPage)
 	mux.Get("/reservation-summary", handlers.Repo.ReservationSummaryPage)
 	mux.Post("/reservation-summary", handlers.Repo.ReservationSummaryPage)
+	mux.Get("/reviews/{token}", handlers.Repo.ReviewPage)
+	mux.Post("/reviews/{token}", handlers.Repo.PostReviewPage)
+	mux.Get("/reservations/{token}/{kind}", handlers.Repo.ReservationDocument)
 	mux.Get("/user/login", handlers.Repo.LoginPage)
 	mux.Post("/user/login", handlers.Repo.PostLoginPage)
 	mux.Get("/user/logout", handlers.Repo.LogoutPage)
@@ -54,9 +68,41 @@ func routes(_ *config.AppConfig) http.Handler {
 
 		mux.Get("/reservations/{src}/{id}/show", handlers.Repo.AdminShowReservationPage)
 		mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservationPage)
+
+		// these pages act on or record the logged in user, so they always need a login
+		mux.Group(func(mux chi.Router) {
+			mux.Use(Auth)
+			mux.Get("/reservations/{src}/{id}/documents/{kind}", handlers.Repo.AdminReservationDocument)
+			mux.Get("/guests", handlers.Repo.AdminGuestsPage)
+			mux.Get("/guests/{id}", handlers.Repo.AdminShowGuestPage)
+			mux.Post("/guests/{id}/notes", handlers.Repo.AdminPostGuestNotes)
+			mux.Post("/guests/{id}/notifications", handlers.Repo.AdminPostGuestNotifications)
+			mux.Get("/guests/{id}/export", handlers.Repo.AdminGuestExport)
+			mux.Post("/guests/{id}/anonymize", handlers.Repo.AdminPostAnonymizeGuest)
+			mux.Get("/reviews", handlers.Repo.AdminReviewsPage)
+			mux.Post("/reviews/{id}/status", handlers.Repo.AdminPostReviewStatus)
+			mux.Post("/reviews/{id}/reply", handlers.Repo.AdminPostReviewReply)
+			mux.Get("/promo-codes", handlers.Repo.AdminPromoCodesPage)
+			mux.Post("/promo-codes", handlers.Repo.AdminPostPromoCode)
+			mux.Post("/promo-codes/{id}/active", handlers.Repo.AdminPostPromoCodeActive)
+			mux.Post("/reservations/{src}/{id}/cancel", handlers.Repo.AdminPostCancelReservation)
+			mux.Get("/cancellation-policies", handlers.Repo.AdminCancellationPoliciesPage)
+			mux.Post("/cancellation-policies", handlers.Repo.AdminPostCancellationPolicy)
+			mux.Post("/rooms/{id}/cancellation-policy", handlers.Repo.AdminPostRoomCancellationPolicy)
+			mux.Get("/webhooks", handlers.Repo.AdminWebhooksPage)
+			mux.Post("/webhooks", handlers.Repo.AdminPostWebhookEndpoint)
+			mux.Post("/webhooks/{id}/active", handlers.Repo.AdminPostWebhookEndpointActive)
+			mux.Post("/webhooks/deliveries/{id}/redeliver", handlers.Repo.AdminPostRedeliverWebhook)
+			mux.Get("/events", handlers.Repo.AdminEvents)
+			mux.Get("/sessions", handlers.Repo.AdminSessionsPage)
+			mux.Post("/sessions/revoke", handlers.Repo.AdminPostRevokeSession)
+			mux.Post("/sessions/revoke-others", handlers.Repo.AdminPostRevokeOtherSessions)
+			mux.Get("/users", handlers.Repo.AdminUsersPage)
+			mux.Post("/users/{id}/revoke-sessions", handlers.Repo.AdminPostRevokeUserSessions)
+		})
 		
 	})
-	fileServer := http.FileServer(http.Dir("./static/"))
+	fileServer := http.FileServer(http.FS(app.Static))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
 	return mux
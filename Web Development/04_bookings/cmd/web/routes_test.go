@@ -1,9 +1,23 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/alexedwards/scs/v2"
 	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/driver"
+	"github.com/ashparshp/bookings/internal/handlers"
+	"github.com/ashparshp/bookings/internal/helpers"
+	"github.com/ashparshp/bookings/internal/models"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -18,4 +32,66 @@ func TestRoutes(t *testing.T) {
 			t.Errorf("Type is not *chi.Mux, type is %T", v)
 	}
 
-}
\ No newline at end of file
+}
+
+func TestRoutes_Static(t *testing.T) {
+	mux := routes(&app)
+
+	// static files are served from the embedded copy, whatever the working directory
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/static/admin/partials/_footer.html", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 for an embedded static file, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/static/missing.css", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing static file, got %d", rr.Code)
+	}
+}
+
+func TestRoutes_CancelNeedsLogin(t *testing.T) {
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL.Close()
+
+	oldRepo, oldDriver, oldSession := handlers.Repo, app.DBDriver, session
+	defer func() { handlers.Repo, app.DBDriver, session, app.Session = oldRepo, oldDriver, oldSession, oldSession }()
+	app.DBDriver = "sqlite"
+	// TestRun leaves the sessions in a database it has closed
+	session = scs.New()
+	app.Session = session
+	handlers.NewHandler(handlers.NewRepo(&app, db))
+	helpers.NewHelpers(&app)
+
+	id, err := handlers.Repo.DB.InsertReservation(context.Background(), models.Reservation{FirstName: "Ana", Email: "ana@example.com",
+		StartDate: time.Now().AddDate(0, 0, 10), EndDate: time.Now().AddDate(0, 0, 12), RoomID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a visitor with a valid CSRF token, as any public page hands out, but no login; the token in the form is
+	// masked with a pad of zeros
+	real := strings.Repeat("t", 32)
+	masked := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("\x00", 32) + real))
+	req := httptest.NewRequest("POST", "/admin/reservations/all/"+strconv.Itoa(id)+"/cancel",
+		strings.NewReader(url.Values{"csrf_token": {masked}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "csrf_token", Value: base64.StdEncoding.EncodeToString([]byte(real))})
+	rr := httptest.NewRecorder()
+	routes(&app).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/user/login" {
+		t.Errorf("expected a redirect to the login page, got %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+	res, err := handlers.Repo.DB.GetReservationByID(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.CancelledAt.IsZero() {
+		t.Error("expected the reservation not to be cancelled")
+	}
+}
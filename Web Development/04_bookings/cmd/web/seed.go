@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/driver"
+	"github.com/ashparshp/bookings/internal/seed"
+)
+
+// seedCommand runs "bookings seed": it fills the database with generated demo data. Its own flags can be
+// mixed with the server's database flags.
+func seedCommand(name string, args []string, out io.Writer) error {
+	o := seed.Options{Today: time.Now()}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Int64Var(&o.Seed, "seed", 1, "Seed of the generated data; the same seed on the same day generates the same data")
+	fs.IntVar(&o.Rooms, "rooms", 8, "Number of rooms")
+	fs.IntVar(&o.Admins, "admins", 1, "Number of admin users")
+	fs.IntVar(&o.Staff, "staff", 4, "Number of staff users")
+	fs.IntVar(&o.Months, "months", 6, "Months of past reservations, besides upcoming ones")
+	today := fs.String("today", "", "Day to generate the data around, as YYYY-MM-DD (default today)")
+
+	own, rest := splitFlags(fs, args)
+	if err := fs.Parse(own); err != nil {
+		return err
+	}
+	if *today != "" {
+		t, err := time.Parse("2006-01-02", *today)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for flag -today", *today)
+		}
+		o.Today = t
+	}
+	if o.Rooms < 1 || o.Admins < 0 || o.Staff < 0 || o.Months < 0 {
+		return fmt.Errorf("-rooms must be at least 1, and -admins, -staff and -months not negative")
+	}
+
+	settings, err := config.Load(name, rest, os.Getenv)
+	if err != nil {
+		return err
+	}
+
+	var db *driver.DB
+	if settings.DB.Driver == "sqlite" {
+		db, err = driver.ConnectSQLite(settings.DB.Name)
+	} else {
+		db, err = driver.ConnectSQL(settings.DB.ConnectionString())
+	}
+	if err != nil {
+		return fmt.Errorf("cannot connect to database: %w", err)
+	}
+	defer db.SQL.Close()
+
+	d := seed.Generate(o)
+	if err := seed.Write(context.Background(), db.SQL, settings.DB.Driver == "sqlite", d); err != nil {
+		return fmt.Errorf("cannot seed database: %w", err)
+	}
+
+	fmt.Fprintf(out, "added %d rooms, %d users, %d guests, %d reservations and %d blocks\n",
+		len(d.Rooms), len(d.Users), len(d.Guests), len(d.Reservations), len(d.Blocks))
+	fmt.Fprintf(out, "users log in as admin1@example.com, staff1@example.com and so on, with the password %q\n", seed.Password)
+	return nil
+}
+
+// splitFlags separates the arguments naming flags of fs from the rest
+func splitFlags(fs *flag.FlagSet, args []string) (own, rest []string) {
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		name, _, hasValue := strings.Cut(name, "=")
+		if !strings.HasPrefix(args[i], "-") || fs.Lookup(name) == nil {
+			rest = append(rest, args[i])
+			continue
+		}
+		own = append(own, args[i])
+		if !hasValue && i+1 < len(args) {
+			i++
+			own = append(own, args[i])
+		}
+	}
+	return own, rest
+}
@@ -1,12 +1,28 @@
 package main
 
 import (
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/ashparshp/bookings"
+	"github.com/ashparshp/bookings/internal/logger"
 )
 
 func TestMain(m *testing.M) {
+	app.Logger = logger.New(io.Discard, slog.LevelInfo, false)
+
+	assets := bookings.Load(false, "")
+	app.Templates = assets.Templates
+	app.MailTemplates = assets.MailTemplates
+	app.Static = assets.Static
+
+	session = scs.New()
+	app.Session = session
+
 	os.Exit(m.Run())
 }
 
@@ -17,4 +33,3 @@ type myHandler struct {
 func (mh *myHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	
 }
-
@@ -0,0 +1,51 @@
+// Package bookings holds the files the server ships with: page templates, email templates, static assets
+// and database migrations. They are embedded so the binary runs from any directory without a copy of the
+// source tree.
+package bookings
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+// all: keeps files starting with an underscore, such as the admin theme's partials, which http.Dir served
+//
+//go:embed templates email-templates all:static
+var embedded embed.FS
+
+//go:embed migrations/*.up.sql migrations/*.down.sql
+var migrations embed.FS
+
+// Migrations returns the database migrations embedded in the binary. Unlike the other assets they are never
+// read from disk: the schema must match the code it was built with.
+func Migrations() fs.FS {
+	return sub(migrations, "migrations")
+}
+
+// Assets are the file trees the server reads at runtime
+type Assets struct {
+	Templates     fs.FS
+	MailTemplates fs.FS
+	Static        fs.FS
+}
+
+// Load returns the assets embedded in the binary. In dev mode they are read from the directories under
+// dir on disk instead, so edits show up without rebuilding.
+func Load(dev bool, dir string) Assets {
+	var root fs.FS = embedded
+	if dev {
+		root = os.DirFS(dir)
+	}
+	return Assets{
+		Templates:     sub(root, "templates"),
+		MailTemplates: sub(root, "email-templates"),
+		Static:        sub(root, "static"),
+	}
+}
+
+// sub cannot fail here: fs.Sub only rejects invalid names, and ours are constants
+func sub(fsys fs.FS, dir string) fs.FS {
+	s, _ := fs.Sub(fsys, dir)
+	return s
+}
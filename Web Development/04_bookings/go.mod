@@ -13,8 +13,10 @@ require (
 	github.com/asaskevich/govalidator v0.0.0-20230301143203-a9d515a09cc2
 	github.com/jackc/pgconn v1.14.3
 	github.com/jackc/pgx/v4 v4.18.3
+	github.com/mattn/go-sqlite3 v1.14.24
 	github.com/xhit/go-simple-mail/v2 v2.16.0
 	golang.org/x/crypto v0.20.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
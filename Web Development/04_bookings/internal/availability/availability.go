@@ -0,0 +1,153 @@
+// Package availability finds free stays near the dates a guest asked for. It works on the restrictions of
+// every room over the whole search period, which the repository loads in one query, so trying every
+// possible check-in date costs no more database round trips than checking the exact dates.
+package availability
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+// Month is the flexible search for a stay of the same length anywhere in the month of arrival
+const Month = "month"
+
+// Days are the numbers of days earlier or later than asked that a flexible search can offer
+var Days = []int{1, 3, 7}
+
+// DefaultDays is how far from full dates the choose room page looks when the guest did not ask for
+// flexible dates
+const DefaultDays = 3
+
+// Window is a stay from check-in on Start to check-out on End
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Nights returns the length of the stay
+func (w Window) Nights() int {
+	return int(w.End.Sub(w.Start).Hours() / 24)
+}
+
+// Search looks for stays of Nights nights checking in between First and Last, both included. Stays
+// closest to Requested come first; Requested itself is not offered, the guest already knows about it.
+type Search struct {
+	Requested Window
+	Nights    int
+	First     time.Time
+	Last      time.Time
+}
+
+// Around returns a search for stays as long as the requested one, arriving up to days earlier or later
+func Around(requested Window, days int, today time.Time) Search {
+	return newSearch(requested, requested.Start.AddDate(0, 0, -days), requested.Start.AddDate(0, 0, days), today)
+}
+
+// InMonth returns a search for a stay as long as the requested one, arriving any day of the month of the
+// requested arrival
+func InMonth(requested Window, today time.Time) Search {
+	y, m, _ := requested.Start.Date()
+	first := time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	return newSearch(requested, first, first.AddDate(0, 1, -1), today)
+}
+
+// Flexible returns the search a guest chose on the search form: a number of Days either side, or Month.
+// ok is false for exact dates, which is also what an option not offered means.
+func Flexible(option string, requested Window, today time.Time) (s Search, ok bool) {
+	if option == Month {
+		return InMonth(requested, today), true
+	}
+	days, err := strconv.Atoi(option)
+	if err != nil {
+		return Search{}, false
+	}
+	for _, d := range Days {
+		if d == days {
+			return Around(requested, days, today), true
+		}
+	}
+	return Search{}, false
+}
+
+// newSearch returns a search between first and last that never arrives before today
+func newSearch(requested Window, first, last, today time.Time) Search {
+	if today = models.Day(today); first.Before(today) {
+		first = today
+	}
+	return Search{
+		Requested: Window{Start: models.Day(requested.Start), End: models.Day(requested.End)},
+		Nights:    requested.Nights(),
+		First:     models.Day(first),
+		Last:      models.Day(last),
+	}
+}
+
+// Span returns the period whose restrictions the search needs: from the first arrival to the last
+// departure
+func (s Search) Span() (from, to time.Time) {
+	return s.First, s.Last.AddDate(0, 0, s.Nights)
+}
+
+// Free returns up to limit free stays in a room with the given restrictions, closest to the requested
+// arrival first and the earlier of two equally close ones first
+func (s Search) Free(busy []models.RoomRestriction, limit int) []Window {
+	if s.Nights < 1 {
+		return nil
+	}
+
+	var free []Window
+	for start := s.First; !start.After(s.Last); start = start.AddDate(0, 0, 1) {
+		w := Window{Start: start, End: start.AddDate(0, 0, s.Nights)}
+		if w == s.Requested || overlaps(w, busy) {
+			continue
+		}
+		free = append(free, w)
+	}
+
+	sort.SliceStable(free, func(i, j int) bool {
+		return distance(free[i].Start, s.Requested.Start) < distance(free[j].Start, s.Requested.Start)
+	})
+	if len(free) > limit {
+		free = free[:limit]
+	}
+	sort.Slice(free, func(i, j int) bool { return free[i].Start.Before(free[j].Start) })
+	return free
+}
+
+// Alternative is a room with the free stays offered in it
+type Alternative struct {
+	Room  models.Room
+	Stays []Window
+}
+
+// Alternatives returns up to perRoom free stays in each room, leaving out the rooms with none
+func (s Search) Alternatives(rooms []models.RoomOccupancy, perRoom int) []Alternative {
+	var alternatives []Alternative
+	for _, o := range rooms {
+		if stays := s.Free(o.Busy, perRoom); len(stays) > 0 {
+			alternatives = append(alternatives, Alternative{Room: o.Room, Stays: stays})
+		}
+	}
+	return alternatives
+}
+
+// overlaps reports whether w shares a night with any restriction; like the exact search, a stay may
+// arrive on the day another leaves
+func overlaps(w Window, busy []models.RoomRestriction) bool {
+	for _, b := range busy {
+		if w.Start.Before(models.Day(b.EndDate)) && w.End.After(models.Day(b.StartDate)) {
+			return true
+		}
+	}
+	return false
+}
+
+func distance(a, b time.Time) time.Duration {
+	if d := a.Sub(b); d >= 0 {
+		return d
+	}
+	return b.Sub(a)
+}
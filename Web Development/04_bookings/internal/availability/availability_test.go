@@ -0,0 +1,137 @@
+package availability
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+func date(month time.Month, d int) time.Time {
+	return time.Date(2050, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func busy(from, to time.Time) models.RoomRestriction {
+	return models.RoomRestriction{StartDate: from, EndDate: to}
+}
+
+func starts(stays []Window) []int {
+	var days []int
+	for _, w := range stays {
+		days = append(days, w.Start.Day())
+	}
+	return days
+}
+
+func sameDays(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAround(t *testing.T) {
+	requested := Window{Start: date(3, 10), End: date(3, 12)}
+	s := Around(requested, 3, date(1, 1))
+
+	if s.Nights != 2 || !s.First.Equal(date(3, 7)) || !s.Last.Equal(date(3, 13)) {
+		t.Errorf("unexpected search %+v", s)
+	}
+	if from, to := s.Span(); !from.Equal(date(3, 7)) || !to.Equal(date(3, 15)) {
+		t.Errorf("unexpected span %s to %s", from, to)
+	}
+
+	// never earlier than today
+	s = Around(requested, 3, date(3, 9).Add(15*time.Hour))
+	if !s.First.Equal(date(3, 9)) {
+		t.Errorf("expected the search to start today, got %s", s.First)
+	}
+}
+
+func TestInMonth(t *testing.T) {
+	s := InMonth(Window{Start: date(2, 20), End: date(2, 23)}, date(1, 1))
+	if s.Nights != 3 || !s.First.Equal(date(2, 1)) || !s.Last.Equal(date(2, 28)) {
+		t.Errorf("unexpected search %+v", s)
+	}
+	if _, to := s.Span(); !to.Equal(date(3, 3)) {
+		t.Errorf("expected the last stay to leave on March 3, got %s", to)
+	}
+}
+
+func TestFlexible(t *testing.T) {
+	requested := Window{Start: date(3, 10), End: date(3, 12)}
+	tests := []struct {
+		option    string
+		wantOK    bool
+		wantFirst time.Time
+	}{
+		{"", false, time.Time{}},
+		{"7", true, date(3, 3)},
+		{Month, true, date(3, 1)},
+		{"30", false, time.Time{}},
+		{"soon", false, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		s, ok := Flexible(tt.option, requested, date(1, 1))
+		if ok != tt.wantOK || !s.First.Equal(tt.wantFirst) {
+			t.Errorf("%q: got %t from %s, wanted %t from %s", tt.option, ok, s.First, tt.wantOK, tt.wantFirst)
+		}
+	}
+}
+
+func TestSearch_Free(t *testing.T) {
+	requested := Window{Start: date(3, 10), End: date(3, 12)}
+	s := Around(requested, 3, date(1, 1))
+
+	tests := []struct {
+		name  string
+		busy  []models.RoomRestriction
+		limit int
+		want  []int
+	}{
+		{"closest first", nil, 2, []int{9, 11}},
+		{"ties go to the earlier day", nil, 3, []int{8, 9, 11}},
+		{"booked around the dates", []models.RoomRestriction{busy(date(3, 9), date(3, 13))}, 3, []int{7, 13}},
+		{"arrive on the day another stay leaves", []models.RoomRestriction{busy(date(3, 5), date(3, 11))}, 2, []int{11, 12}},
+		{"leave on the day another stay arrives", []models.RoomRestriction{busy(date(3, 10), date(3, 20))}, 5, []int{7, 8}},
+		{"fully booked", []models.RoomRestriction{busy(date(3, 1), date(3, 31))}, 3, nil},
+	}
+
+	for _, tt := range tests {
+		got := starts(s.Free(tt.busy, tt.limit))
+		if !sameDays(got, tt.want) {
+			t.Errorf("%s: expected stays arriving on %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	for _, w := range s.Free(nil, 10) {
+		if w == s.Requested {
+			t.Error("expected the requested stay not to be offered")
+		}
+		if w.Nights() != 2 {
+			t.Errorf("expected 2 night stays, got %d", w.Nights())
+		}
+	}
+}
+
+func TestSearch_Alternatives(t *testing.T) {
+	s := InMonth(Window{Start: date(3, 10), End: date(3, 12)}, date(1, 1))
+	rooms := []models.RoomOccupancy{
+		{Room: models.Room{ID: 1}, Busy: []models.RoomRestriction{busy(date(2, 25), date(4, 5))}},
+		{Room: models.Room{ID: 2}, Busy: []models.RoomRestriction{busy(date(3, 1), date(3, 20))}},
+	}
+
+	got := s.Alternatives(rooms, 2)
+	if len(got) != 1 || got[0].Room.ID != 2 {
+		t.Fatalf("expected only room 2 to have stays, got %+v", got)
+	}
+	if days := starts(got[0].Stays); !sameDays(days, []int{20, 21}) {
+		t.Errorf("expected stays arriving on the 20th and 21st, got %v", days)
+	}
+}
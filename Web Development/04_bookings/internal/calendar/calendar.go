@@ -0,0 +1,93 @@
+// Package calendar keeps saves of the admin reservations calendar from overwriting each other. Each room's
+// month on the calendar carries a version, a digest of the restrictions on it when the page was loaded, and
+// a save says which blocks it showed. A save from a page that has gone stale applies only the changes its
+// user made and reports the ones that no longer fit, rather than putting back the month as it was.
+package calendar
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+// DayLayout is how the calendar names days in its maps and form fields
+const DayLayout = "2006-01-2"
+
+// Month returns the period a room's calendar for month shows restrictions from: the first of the month up
+// to the first of the next, so that a block on the last day is included
+func Month(year int, month time.Month) (from, to time.Time) {
+	from = time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	return from, from.AddDate(0, 1, 0)
+}
+
+// Version returns the version of a room's month with the given restrictions. Any reservation or block
+// added, moved or removed changes it.
+func Version(restrictions []models.RoomRestriction) string {
+	sorted := make([]models.RoomRestriction, len(restrictions))
+	copy(sorted, restrictions)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	h := sha256.New()
+	for _, r := range sorted {
+		fmt.Fprintf(h, "%d %s %s %d\n", r.ID, r.StartDate.Format("2006-01-02"), r.EndDate.Format("2006-01-02"), r.ReservationID)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// Block is a day blocked by an administrator
+type Block struct {
+	ID   int
+	Date time.Time
+}
+
+// Plan is what a save changes in a room
+type Plan struct {
+	Add    []time.Time
+	Remove []Block
+	// Conflicts are the days the save blocks that have been booked since the page was loaded
+	Conflicts []time.Time
+}
+
+// Reconcile returns what a save that blocks the days in add and unblocks the blocks in remove changes in a
+// room with the current restrictions. Days blocked meanwhile are not blocked twice and blocks removed
+// meanwhile are not removed again; blocks the page did not show are never touched.
+func Reconcile(current []models.RoomRestriction, add []time.Time, remove []int) Plan {
+	var p Plan
+
+	for _, d := range add {
+		d = models.Day(d)
+		taken, blocked := false, false
+		for _, r := range current {
+			if d.Before(models.Day(r.EndDate)) && d.AddDate(0, 0, 1).After(models.Day(r.StartDate)) {
+				if r.ReservationID > 0 {
+					taken = true
+				} else {
+					blocked = true
+				}
+			}
+		}
+		switch {
+		case taken:
+			p.Conflicts = append(p.Conflicts, d)
+		case !blocked:
+			p.Add = append(p.Add, d)
+		}
+	}
+
+	for _, id := range remove {
+		for _, r := range current {
+			if r.ID == id && r.ReservationID == 0 {
+				p.Remove = append(p.Remove, Block{ID: id, Date: models.Day(r.StartDate)})
+				break
+			}
+		}
+	}
+
+	sort.Slice(p.Add, func(i, j int) bool { return p.Add[i].Before(p.Add[j]) })
+	sort.Slice(p.Conflicts, func(i, j int) bool { return p.Conflicts[i].Before(p.Conflicts[j]) })
+	return p
+}
@@ -0,0 +1,72 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+func date(d int) time.Time {
+	return time.Date(2050, 1, d, 0, 0, 0, 0, time.UTC)
+}
+
+func block(id, d int) models.RoomRestriction {
+	return models.RoomRestriction{ID: id, StartDate: date(d), EndDate: date(d + 1), RestrictionID: 2}
+}
+
+func reservation(id, from, to int) models.RoomRestriction {
+	return models.RoomRestriction{ID: id, StartDate: date(from), EndDate: date(to), ReservationID: 100 + id, RestrictionID: 1}
+}
+
+func TestMonth(t *testing.T) {
+	from, to := Month(2050, time.December)
+	if !from.Equal(time.Date(2050, 12, 1, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2051, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected month %s to %s", from, to)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	month := []models.RoomRestriction{reservation(1, 10, 12), block(2, 20)}
+	v := Version(month)
+
+	if Version([]models.RoomRestriction{block(2, 20), reservation(1, 10, 12)}) != v {
+		t.Error("expected the version not to depend on the order of the restrictions")
+	}
+	if Version(nil) == Version([]models.RoomRestriction{block(3, 5)}) {
+		t.Error("expected adding a block to change the version")
+	}
+	for _, changed := range [][]models.RoomRestriction{
+		{reservation(1, 10, 12)},
+		{reservation(1, 10, 12), block(2, 21)},
+		{reservation(1, 10, 13), block(2, 20)},
+		{reservation(1, 10, 12), block(3, 20)},
+	} {
+		if Version(changed) == v {
+			t.Errorf("expected %+v to change the version", changed)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	// since the page was loaded someone booked the 10th and 11th, blocked the 15th and removed block 4;
+	// the block on the 20th is still there
+	current := []models.RoomRestriction{reservation(1, 10, 12), block(2, 20), block(3, 15)}
+
+	p := Reconcile(current, []time.Time{date(11), date(14), date(15), date(12)}, []int{2, 4})
+
+	if len(p.Add) != 2 || !p.Add[0].Equal(date(12)) || !p.Add[1].Equal(date(14)) {
+		t.Errorf("expected the 12th and 14th blocked, got %v", p.Add)
+	}
+	if len(p.Conflicts) != 1 || !p.Conflicts[0].Equal(date(11)) {
+		t.Errorf("expected the booked 11th to conflict, got %v", p.Conflicts)
+	}
+	if len(p.Remove) != 1 || p.Remove[0].ID != 2 || !p.Remove[0].Date.Equal(date(20)) {
+		t.Errorf("expected only the block on the 20th removed, got %+v", p.Remove)
+	}
+
+	// a reservation is never removed as a block
+	if p := Reconcile(current, nil, []int{1}); len(p.Remove) != 0 {
+		t.Errorf("expected the reservation kept, got %+v", p.Remove)
+	}
+}
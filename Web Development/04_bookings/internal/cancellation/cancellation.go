@@ -0,0 +1,127 @@
+// Package cancellation works out what a guest is charged for cancelling a reservation under its policy, and
+// describes a policy's terms. Like package promo it only holds the rules.
+package cancellation
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+// Outcome is the result of cancelling a reservation
+type Outcome struct {
+	PenaltyPercent int
+	PenaltyCents   int
+	RefundCents    int
+}
+
+// Term is one line of a policy's terms. Message is a catalog key, so it can be translated with Args.
+type Term struct {
+	Message string
+	Args    []any
+}
+
+// Errors returned by Validate, worded for the policy form
+var (
+	ErrNoTiers       = errors.New("Add at least one tier")
+	ErrTierDays      = errors.New("Days before arrival cannot be negative")
+	ErrTierPercent   = errors.New("Penalties must be between 0 and 100 percent")
+	ErrDuplicateDays = errors.New("Two tiers cannot start on the same day")
+	ErrTierOrder     = errors.New("Penalties cannot go down closer to arrival")
+)
+
+// Compute returns what cancelling res at the given time costs under p. The tier with the most days before
+// arrival that the cancellation still meets applies; later cancellations and no-shows are charged in full.
+// A policy without tiers, such as the zero policy of a reservation booked before there were policies,
+// never charges a penalty. The penalty is rounded down to the cent, in the guest's favour.
+func Compute(p models.CancellationPolicy, res models.Reservation, at time.Time) Outcome {
+	percent := PenaltyPercent(p, DaysBefore(res, at))
+	penalty := res.TotalCents * percent / 100
+	return Outcome{
+		PenaltyPercent: percent,
+		PenaltyCents:   penalty,
+		RefundCents:    res.TotalCents - penalty,
+	}
+}
+
+// PenaltyPercent returns the share of the total p charges for cancelling days before arrival
+func PenaltyPercent(p models.CancellationPolicy, days int) int {
+	if len(p.Tiers) == 0 {
+		return 0
+	}
+	for _, t := range Sorted(p.Tiers) {
+		if days >= t.DaysBefore {
+			return t.PenaltyPercent
+		}
+	}
+	return 100
+}
+
+// DaysBefore returns the number of whole days between at and the arrival day of res, negative once the
+// guest was due to arrive
+func DaysBefore(res models.Reservation, at time.Time) int {
+	return int(models.Day(res.StartDate).Sub(models.Day(at)).Hours() / 24)
+}
+
+// Sorted returns tiers from the earliest cancellation to the latest
+func Sorted(tiers []models.CancellationTier) []models.CancellationTier {
+	sorted := append([]models.CancellationTier(nil), tiers...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].DaysBefore > sorted[j].DaysBefore })
+	return sorted
+}
+
+// Validate checks the tiers of a new policy: at least one, no two on the same day, percentages from 0 to
+// 100 and never a lower penalty for cancelling later
+func Validate(tiers []models.CancellationTier) error {
+	if len(tiers) == 0 {
+		return ErrNoTiers
+	}
+	sorted := Sorted(tiers)
+	for i, t := range sorted {
+		if t.DaysBefore < 0 {
+			return ErrTierDays
+		}
+		if t.PenaltyPercent < 0 || t.PenaltyPercent > 100 {
+			return ErrTierPercent
+		}
+		if i == 0 {
+			continue
+		}
+		if t.DaysBefore == sorted[i-1].DaysBefore {
+			return ErrDuplicateDays
+		}
+		if t.PenaltyPercent < sorted[i-1].PenaltyPercent {
+			return ErrTierOrder
+		}
+	}
+	return nil
+}
+
+// Terms describes p to guests: the first tier, each later one as the next window before arrival, and then
+// what cancelling after the last window costs
+func Terms(p models.CancellationPolicy) []Term {
+	if len(p.Tiers) == 0 {
+		return []Term{{Message: "Free cancellation at any time"}}
+	}
+
+	var terms []Term
+	for i, t := range Sorted(p.Tiers) {
+		switch {
+		case i == 0 && t.PenaltyPercent == 0 && t.DaysBefore == 0:
+			terms = append(terms, Term{Message: "Free cancellation until the day of arrival"})
+		case i == 0 && t.PenaltyPercent == 0:
+			terms = append(terms, Term{Message: "Free cancellation until %d days before arrival", Args: []any{t.DaysBefore}})
+		case i == 0 && t.DaysBefore == 0:
+			terms = append(terms, Term{Message: "%d%% of the total for cancelling until the day of arrival", Args: []any{t.PenaltyPercent}})
+		case i == 0:
+			terms = append(terms, Term{Message: "%d%% of the total for cancelling until %d days before arrival", Args: []any{t.PenaltyPercent, t.DaysBefore}})
+		case t.DaysBefore == 0:
+			terms = append(terms, Term{Message: "%d%% of the total for cancelling later, until the day of arrival", Args: []any{t.PenaltyPercent}})
+		default:
+			terms = append(terms, Term{Message: "%d%% of the total for cancelling later, until %d days before arrival", Args: []any{t.PenaltyPercent, t.DaysBefore}})
+		}
+	}
+	return append(terms, Term{Message: "The full price is charged for later cancellations and no-shows"})
+}
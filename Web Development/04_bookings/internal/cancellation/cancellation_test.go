@@ -0,0 +1,94 @@
+package cancellation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+var standard = models.CancellationPolicy{
+	Name:  "Standard",
+	Tiers: []models.CancellationTier{{DaysBefore: 0, PenaltyPercent: 50}, {DaysBefore: 7, PenaltyPercent: 0}},
+}
+
+func TestCompute(t *testing.T) {
+	res := models.Reservation{
+		StartDate:  time.Date(2025, 7, 10, 0, 0, 0, 0, time.UTC),
+		EndDate:    time.Date(2025, 7, 12, 0, 0, 0, 0, time.UTC),
+		TotalCents: 24001,
+	}
+
+	tests := []struct {
+		name        string
+		policy      models.CancellationPolicy
+		at          time.Time
+		wantPercent int
+		wantPenalty int
+	}{
+		{"weeks ahead", standard, time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC), 0, 0},
+		{"on the last free day", standard, time.Date(2025, 7, 3, 23, 59, 0, 0, time.UTC), 0, 0},
+		{"the day after", standard, time.Date(2025, 7, 4, 0, 1, 0, 0, time.UTC), 50, 12000},
+		{"on the day of arrival", standard, time.Date(2025, 7, 10, 18, 0, 0, 0, time.UTC), 50, 12000},
+		{"after arrival", standard, time.Date(2025, 7, 11, 9, 0, 0, 0, time.UTC), 100, 24001},
+		{"no policy", models.CancellationPolicy{}, time.Date(2025, 7, 11, 9, 0, 0, 0, time.UTC), 0, 0},
+	}
+	for _, tt := range tests {
+		o := Compute(tt.policy, res, tt.at)
+		if o.PenaltyPercent != tt.wantPercent || o.PenaltyCents != tt.wantPenalty || o.RefundCents != res.TotalCents-tt.wantPenalty {
+			t.Errorf("%s: got %+v, wanted %d%% and a penalty of %d", tt.name, o, tt.wantPercent, tt.wantPenalty)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		tiers []models.CancellationTier
+		want  error
+	}{
+		{"standard", standard.Tiers, nil},
+		{"single tier", []models.CancellationTier{{DaysBefore: 14, PenaltyPercent: 20}}, nil},
+		{"no tiers", nil, ErrNoTiers},
+		{"negative days", []models.CancellationTier{{DaysBefore: -1, PenaltyPercent: 20}}, ErrTierDays},
+		{"above 100 percent", []models.CancellationTier{{DaysBefore: 1, PenaltyPercent: 120}}, ErrTierPercent},
+		{"same day twice", []models.CancellationTier{{DaysBefore: 3, PenaltyPercent: 20}, {DaysBefore: 3, PenaltyPercent: 40}}, ErrDuplicateDays},
+		{"cheaper later", []models.CancellationTier{{DaysBefore: 30, PenaltyPercent: 50}, {DaysBefore: 3, PenaltyPercent: 10}}, ErrTierOrder},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.tiers); err != tt.want {
+			t.Errorf("%s: Validate() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestTerms(t *testing.T) {
+	policy := models.CancellationPolicy{Tiers: []models.CancellationTier{
+		{DaysBefore: 2, PenaltyPercent: 50},
+		{DaysBefore: 30, PenaltyPercent: 0},
+		{DaysBefore: 0, PenaltyPercent: 80},
+	}}
+	want := []string{
+		"Free cancellation until %d days before arrival",
+		"%d%% of the total for cancelling later, until %d days before arrival",
+		"%d%% of the total for cancelling later, until the day of arrival",
+		"The full price is charged for later cancellations and no-shows",
+	}
+
+	terms := Terms(policy)
+	if len(terms) != len(want) {
+		t.Fatalf("expected %d terms, got %+v", len(want), terms)
+	}
+	for i, term := range terms {
+		if term.Message != want[i] {
+			t.Errorf("term %d: got %q, wanted %q", i, term.Message, want[i])
+		}
+	}
+	if terms[1].Args[0] != 50 || terms[1].Args[1] != 2 {
+		t.Errorf("unexpected arguments %v", terms[1].Args)
+	}
+
+	if terms := Terms(models.CancellationPolicy{}); len(terms) != 1 || terms[0].Message != "Free cancellation at any time" {
+		t.Errorf("unexpected terms without a policy %+v", terms)
+	}
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"html/template"
-	"log"
+	"io/fs"
+	"log/slog"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/ashparshp/bookings/internal/models"
@@ -12,20 +14,77 @@ import (
 type AppConfig struct {
 	UseCahce bool
 	TemplateCache map[string]*template.Template
-	InfoLog *log.Logger
-	ErrorLog *log.Logger
+	// Templates, MailTemplates and Static are embedded in the binary, or read from disk in dev mode
+	Templates fs.FS
+	MailTemplates fs.FS
+	Static fs.FS
+	Logger *slog.Logger
 	InProduction bool
+	DBDriver string
+	DBTimeout time.Duration
+	Port int
+	ShutdownTimeout time.Duration
 	Session *scs.SessionManager
-	MailChan chan models.MailData
+	// NotifyChan queues the emails and text messages for the notification listener
+	NotifyChan chan models.Notification
+	MailQueueThreshold int
 	MailConfig    MailConfig
+	// BaseURL is the public address of the site, without a trailing slash
+	BaseURL string
+	// SigningKey signs the links sent to guests, see package links
+	SigningKey []byte
+	// Property is the business printed on booking confirmations and invoices
+	Property PropertyConfig
+	// Security controls the security headers sent with every response
+	Security SecurityConfig
 }
 
+// MailConfig holds the SMTP settings used to send email
 type MailConfig struct {
-    Host       string
-    Port       int
-    Username   string
-    Password   string
-    Encryption string
-    FromAddress string
-    FromName   string
-}
\ No newline at end of file
+    Host       string `yaml:"host"`
+    Port       int    `yaml:"port"`
+    Username   string `yaml:"username"`
+    Password   string `yaml:"password"`
+    Encryption string `yaml:"encryption"`
+    FromAddress string `yaml:"from_address"`
+    FromName   string `yaml:"from_name"`
+}
+
+// PropertyConfig holds the details of the business shown on the documents sent to guests
+type PropertyConfig struct {
+	Name    string `yaml:"name"`
+	Address string `yaml:"address"`
+	Phone   string `yaml:"phone"`
+	Email   string `yaml:"email"`
+	// TaxID is the business's VAT or tax registration number, printed on invoices when set
+	TaxID string `yaml:"tax_id"`
+}
+
+// SMSConfig holds the HTTP provider text messages are sent through
+type SMSConfig struct {
+	// URL is where messages are posted; none are sent if it is empty
+	URL string `yaml:"url"`
+	// Token is sent as a bearer token, if set
+	Token string `yaml:"token"`
+	// From is the number or name messages are sent from
+	From string `yaml:"from"`
+}
+
+// Content-Security-Policy modes
+const (
+	// CSPEnforce makes browsers block what the policy does not allow
+	CSPEnforce = "enforce"
+	// CSPReportOnly only reports violations to /csp-report, to try a policy out before enforcing it
+	CSPReportOnly = "report-only"
+	// CSPOff sends no policy
+	CSPOff = "off"
+)
+
+// SecurityConfig holds the settings of the security headers
+type SecurityConfig struct {
+	// CSP is how the Content-Security-Policy is applied: CSPEnforce, CSPReportOnly or CSPOff
+	CSP string `yaml:"csp"`
+	// HSTSMaxAge is how long browsers only visit the site over HTTPS after seeing it there. The header is
+	// only sent in production; zero leaves it out.
+	HSTSMaxAge time.Duration `yaml:"hsts_max_age"`
+}
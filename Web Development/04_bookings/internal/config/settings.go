@@ -0,0 +1,500 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/scheduler"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the environment variable used to locate the config file when -config is not given
+const ConfigFileEnv = "CONFIG_FILE"
+
+// minSigningKeyLength is the shortest signing key accepted, 256 bits of hex or base64 are longer
+const minSigningKeyLength = 32
+
+// redacted replaces secret values in -print-config output
+const redacted = "********"
+
+// Settings holds everything the application is configured with at startup.
+// Values are layered: defaults, then the YAML config file, then environment variables, then flags.
+type Settings struct {
+	Production bool `yaml:"production"`
+	Cache      bool `yaml:"cache"`
+	// Dev reads templates and static files from disk and reloads templates on every request
+	Dev      bool   `yaml:"dev"`
+	LogLevel string `yaml:"log_level"`
+	Port     int    `yaml:"port"`
+	// BaseURL is the public address of the site, used for the links in emails
+	BaseURL string `yaml:"base_url"`
+	// SigningKey signs the links in emails. Without one a random key is made at startup, so links sent
+	// before a restart stop working.
+	SigningKey string `yaml:"signing_key"`
+	// ShutdownTimeout bounds how long in-flight requests and queued emails get to finish on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	DB              DBSettings    `yaml:"db"`
+	Mail            MailSettings  `yaml:"mail"`
+	SMS             SMSConfig     `yaml:"sms"`
+	// NotifyDir is a directory emails and text messages are written to instead of being sent, for development
+	NotifyDir string      `yaml:"notify_dir"`
+	Jobs      JobSettings `yaml:"jobs"`
+	// Property is printed on booking confirmations and invoices
+	Property PropertyConfig `yaml:"property"`
+	// Security controls the security headers of every response
+	Security SecurityConfig `yaml:"security"`
+
+	// ConfigFile is the YAML file the settings were read from, if any
+	ConfigFile string `yaml:"-"`
+	// PrintConfig asks for the effective settings to be printed instead of starting the server
+	PrintConfig bool `yaml:"-"`
+}
+
+// DBSettings holds the database connection settings
+type DBSettings struct {
+	Driver   string        `yaml:"driver"`
+	Host     string        `yaml:"host"`
+	Port     int           `yaml:"port"`
+	Name     string        `yaml:"name"`
+	User     string        `yaml:"user"`
+	Password string        `yaml:"password"`
+	SSLMode  string        `yaml:"sslmode"`
+	Timeout  time.Duration `yaml:"timeout"`
+	// Migrate applies pending migrations when the server starts
+	Migrate bool `yaml:"migrate"`
+}
+
+// MailSettings holds the SMTP settings and the mail queue readiness threshold
+type MailSettings struct {
+	MailConfig     `yaml:",inline"`
+	QueueThreshold int `yaml:"queue_threshold"`
+}
+
+// JobSettings controls the scheduled reservation emails. Schedules are five field cron expressions in
+// the server's time zone.
+type JobSettings struct {
+	Enabled            bool   `yaml:"enabled"`
+	ReminderDays       int    `yaml:"reminder_days"`
+	PreArrivalSchedule string `yaml:"pre_arrival_schedule"`
+	CheckInSchedule    string `yaml:"check_in_schedule"`
+	ThankYouSchedule   string `yaml:"thank_you_schedule"`
+}
+
+// DefaultSettings returns the settings used when nothing else is configured
+func DefaultSettings() Settings {
+	return Settings{
+		Production:      true,
+		Cache:           true,
+		LogLevel:        "info",
+		Port:            8080,
+		BaseURL:         "http://localhost:8080",
+		ShutdownTimeout: 20 * time.Second,
+		DB: DBSettings{
+			Driver:  "postgres",
+			Host:    "localhost",
+			Port:    5432,
+			SSLMode: "disable",
+			Timeout: 3 * time.Second,
+		},
+		Mail: MailSettings{
+			MailConfig: MailConfig{
+				Host:        "localhost",
+				Port:        1025,
+				Encryption:  "none",
+				FromAddress: "noreply@bookings.com",
+				FromName:    "Bookings",
+			},
+			QueueThreshold: 50,
+		},
+		Jobs: JobSettings{
+			Enabled:            true,
+			ReminderDays:       3,
+			PreArrivalSchedule: "0 9 * * *",
+			CheckInSchedule:    "0 7 * * *",
+			ThankYouSchedule:   "0 10 * * *",
+		},
+		Property: PropertyConfig{
+			Name: "Fort Smythe Bed and Breakfast",
+		},
+		Security: SecurityConfig{
+			CSP:        CSPEnforce,
+			HSTSMaxAge: 365 * 24 * time.Hour,
+		},
+	}
+}
+
+// option binds one setting to its flag and environment variable
+type option struct {
+	flag   string
+	env    string
+	usage  string
+	secret bool
+	value  flag.Value
+}
+
+func (s *Settings) options() []option {
+	return []option{
+		{"production", "PRODUCTION", "Run in production mode", false, (*boolValue)(&s.Production)},
+		{"cache", "CACHE", "Use template caching", false, (*boolValue)(&s.Cache)},
+		{"dev", "DEV", "Read templates and static files from the working directory and reload templates on every request", false, (*boolValue)(&s.Dev)},
+		{"loglevel", "LOG_LEVEL", "Log level (debug, info, warn, error)", false, (*stringValue)(&s.LogLevel)},
+		{"port", "PORT", "HTTP port to listen on", false, (*intValue)(&s.Port)},
+		{"baseurl", "BASE_URL", "Public address of the site, used for links in emails", false, (*stringValue)(&s.BaseURL)},
+		{"signingkey", "SIGNING_KEY", "Key of at least 32 characters for signing links in emails (prefer SIGNING_KEY or SIGNING_KEY_FILE)", true, (*stringValue)(&s.SigningKey)},
+		{"shutdowntimeout", "SHUTDOWN_TIMEOUT", "Time allowed for in-flight requests and queued emails on shutdown", false, (*durationValue)(&s.ShutdownTimeout)},
+		{"dbdriver", "DB_DRIVER", "Database driver (postgres, sqlite)", false, (*stringValue)(&s.DB.Driver)},
+		{"dbhost", "DB_HOST", "Database host", false, (*stringValue)(&s.DB.Host)},
+		{"dbport", "DB_PORT", "Database port", false, (*intValue)(&s.DB.Port)},
+		{"dbname", "DB_NAME", "Database name (file path when using sqlite)", false, (*stringValue)(&s.DB.Name)},
+		{"dbuser", "DB_USER", "Database user", false, (*stringValue)(&s.DB.User)},
+		{"dbpassword", "DB_PASSWORD", "Database password (prefer DB_PASSWORD or DB_PASSWORD_FILE)", true, (*stringValue)(&s.DB.Password)},
+		{"dbssl", "DB_SSLMODE", "Database SSL setting (disable, prefer, require)", false, (*stringValue)(&s.DB.SSLMode)},
+		{"dbtimeout", "DB_TIMEOUT", "Maximum duration of a single database query", false, (*durationValue)(&s.DB.Timeout)},
+		{"dbmigrate", "DB_MIGRATE", "Apply pending database migrations on startup", false, (*boolValue)(&s.DB.Migrate)},
+		{"mailhost", "MAIL_HOST", "SMTP host", false, (*stringValue)(&s.Mail.Host)},
+		{"mailport", "MAIL_PORT", "SMTP port", false, (*intValue)(&s.Mail.Port)},
+		{"mailusername", "MAIL_USERNAME", "SMTP username", true, (*stringValue)(&s.Mail.Username)},
+		{"mailpassword", "MAIL_PASSWORD", "SMTP password (prefer MAIL_PASSWORD or MAIL_PASSWORD_FILE)", true, (*stringValue)(&s.Mail.Password)},
+		{"mailencryption", "MAIL_ENCRYPTION", "SMTP encryption (none, starttls, tls, ssl)", false, (*stringValue)(&s.Mail.Encryption)},
+		{"mailfrom", "MAIL_FROM_ADDRESS", "Mail from address", false, (*stringValue)(&s.Mail.FromAddress)},
+		{"mailfromname", "MAIL_FROM_NAME", "Mail from name", false, (*stringValue)(&s.Mail.FromName)},
+		{"mailqueuethreshold", "MAIL_QUEUE_THRESHOLD", "Queued emails at which /readyz reports not ready", false, (*intValue)(&s.Mail.QueueThreshold)},
+		{"smsurl", "SMS_URL", "Address of the HTTP provider text messages are posted to; none are sent if empty", false, (*stringValue)(&s.SMS.URL)},
+		{"smstoken", "SMS_TOKEN", "Bearer token of the SMS provider (prefer SMS_TOKEN or SMS_TOKEN_FILE)", true, (*stringValue)(&s.SMS.Token)},
+		{"smsfrom", "SMS_FROM", "Number or name text messages are sent from", false, (*stringValue)(&s.SMS.From)},
+		{"notifydir", "NOTIFY_DIR", "Write emails and text messages to files in this directory instead of sending them", false, (*stringValue)(&s.NotifyDir)},
+		{"jobs", "JOBS", "Run the scheduled reminder and thank-you emails", false, (*boolValue)(&s.Jobs.Enabled)},
+		{"reminderdays", "REMINDER_DAYS", "Days before arrival the pre-arrival reminder is sent", false, (*intValue)(&s.Jobs.ReminderDays)},
+		{"prearrivalschedule", "PRE_ARRIVAL_SCHEDULE", "Cron schedule of the pre-arrival reminders", false, (*stringValue)(&s.Jobs.PreArrivalSchedule)},
+		{"checkinschedule", "CHECK_IN_SCHEDULE", "Cron schedule of the check-in day emails", false, (*stringValue)(&s.Jobs.CheckInSchedule)},
+		{"thankyouschedule", "THANK_YOU_SCHEDULE", "Cron schedule of the post-stay thank-you emails", false, (*stringValue)(&s.Jobs.ThankYouSchedule)},
+		{"propertyname", "PROPERTY_NAME", "Name of the business on confirmations and invoices", false, (*stringValue)(&s.Property.Name)},
+		{"propertyaddress", "PROPERTY_ADDRESS", "Postal address on confirmations and invoices, lines separated by commas", false, (*stringValue)(&s.Property.Address)},
+		{"propertyphone", "PROPERTY_PHONE", "Phone number on confirmations and invoices", false, (*stringValue)(&s.Property.Phone)},
+		{"propertyemail", "PROPERTY_EMAIL", "Email address on confirmations and invoices", false, (*stringValue)(&s.Property.Email)},
+		{"propertytaxid", "PROPERTY_TAX_ID", "VAT or tax registration number printed on invoices", false, (*stringValue)(&s.Property.TaxID)},
+		{"csp", "CSP", "Content-Security-Policy mode (enforce, report-only, off)", false, (*stringValue)(&s.Security.CSP)},
+		{"hstsmaxage", "HSTS_MAX_AGE", "How long browsers should only use HTTPS for the site, sent in production; 0 disables HSTS", false, (*durationValue)(&s.Security.HSTSMaxAge)},
+	}
+}
+
+// Load builds the settings from defaults, the config file, the environment and the command line
+// arguments, in that order, and validates the result. getenv is usually os.Getenv.
+func Load(name string, args []string, getenv func(string) string) (*Settings, error) {
+	s := DefaultSettings()
+	opts := s.options()
+
+	// Flags are parsed first to find -config, but only applied after the file and environment
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&s.ConfigFile, "config", "", "Path to a YAML config file (or set "+ConfigFileEnv+")")
+	fs.BoolVar(&s.PrintConfig, "print-config", false, "Print the effective configuration with secrets redacted and exit")
+	flagValues := make(map[string]*pendingValue, len(opts))
+	for _, o := range opts {
+		_, isBool := o.value.(*boolValue)
+		v := &pendingValue{def: o.value.String(), isBool: isBool}
+		flagValues[o.flag] = v
+		fs.Var(v, o.flag, fmt.Sprintf("%s (env %s)", o.usage, o.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if s.ConfigFile == "" {
+		s.ConfigFile = getenv(ConfigFileEnv)
+	}
+	if s.ConfigFile != "" {
+		if err := s.readFile(s.ConfigFile); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, o := range opts {
+		if err := applyEnv(o, getenv); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		v, ok := flagValues[f.Name]
+		if !ok || err != nil {
+			return
+		}
+		for _, o := range opts {
+			if o.flag == f.Name {
+				if setErr := o.value.Set(v.value); setErr != nil {
+					err = fmt.Errorf("invalid value %q for flag -%s: %w", v.value, f.Name, setErr)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.DB.Driver == "sqlite" && s.DB.Name == "" {
+		s.DB.Name = "bookings.db"
+	}
+
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// readFile merges the YAML config file at path over the current settings
+func (s *Settings) readFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(s); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv sets o from its environment variable, or from the file named by the _FILE variant
+func applyEnv(o option, getenv func(string) string) error {
+	value := getenv(o.env)
+	fileName := getenv(o.env + "_FILE")
+
+	switch {
+	case value != "" && fileName != "":
+		return fmt.Errorf("both %s and %s_FILE are set, use only one", o.env, o.env)
+	case fileName != "":
+		b, err := os.ReadFile(fileName)
+		if err != nil {
+			return fmt.Errorf("cannot read %s_FILE: %w", o.env, err)
+		}
+		value = strings.TrimRight(string(b), "\r\n")
+	case value == "":
+		return nil
+	}
+
+	if err := o.value.Set(value); err != nil {
+		if o.secret {
+			return fmt.Errorf("invalid value for %s: %w", o.env, err)
+		}
+		return fmt.Errorf("invalid value %q for %s: %w", value, o.env, err)
+	}
+	return nil
+}
+
+// Validate checks the settings and reports every problem found
+func (s *Settings) Validate() error {
+	var problems []string
+	addErr := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch s.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		addErr("log level %q is not one of debug, info, warn, error", s.LogLevel)
+	}
+	if !validPort(s.Port) {
+		addErr("port %d is not between 1 and 65535", s.Port)
+	}
+	if u, err := url.Parse(s.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		addErr("base URL %q must be an absolute http or https URL", s.BaseURL)
+	}
+	if s.SigningKey != "" && len(s.SigningKey) < minSigningKeyLength {
+		addErr("signing key must be at least %d characters", minSigningKeyLength)
+	}
+	if s.ShutdownTimeout <= 0 {
+		addErr("shutdown timeout must be positive, got %s", s.ShutdownTimeout)
+	}
+
+	switch s.DB.Driver {
+	case "postgres":
+		if s.DB.Name == "" {
+			addErr("database name is required (-dbname or DB_NAME)")
+		}
+		if s.DB.User == "" {
+			addErr("database user is required (-dbuser or DB_USER)")
+		}
+		if s.DB.Host == "" {
+			addErr("database host is required (-dbhost or DB_HOST)")
+		}
+		if !validPort(s.DB.Port) {
+			addErr("database port %d is not between 1 and 65535", s.DB.Port)
+		}
+		switch s.DB.SSLMode {
+		case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		default:
+			addErr("database SSL mode %q is not one of disable, allow, prefer, require, verify-ca, verify-full", s.DB.SSLMode)
+		}
+	case "sqlite":
+	default:
+		addErr("unknown database driver %q, expected postgres or sqlite", s.DB.Driver)
+	}
+	if s.DB.Timeout <= 0 {
+		addErr("database timeout must be positive, got %s", s.DB.Timeout)
+	}
+
+	if s.Mail.Host == "" {
+		addErr("mail host is required (-mailhost or MAIL_HOST)")
+	}
+	if !validPort(s.Mail.Port) {
+		addErr("mail port %d is not between 1 and 65535", s.Mail.Port)
+	}
+	switch strings.ToLower(s.Mail.Encryption) {
+	case "none", "starttls", "tls", "ssl":
+	default:
+		addErr("mail encryption %q is not one of none, starttls, tls, ssl", s.Mail.Encryption)
+	}
+	if _, err := mail.ParseAddress(s.Mail.FromAddress); err != nil {
+		addErr("mail from address %q is not a valid email address", s.Mail.FromAddress)
+	}
+	if (s.Mail.Username == "") != (s.Mail.Password == "") {
+		addErr("mail username and password must be set together")
+	}
+	if s.Mail.QueueThreshold < 1 {
+		addErr("mail queue threshold must be at least 1, got %d", s.Mail.QueueThreshold)
+	}
+
+	if s.SMS.URL != "" {
+		if u, err := url.Parse(s.SMS.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			addErr("SMS URL %q must be an absolute http or https URL", s.SMS.URL)
+		}
+	}
+
+	if s.Jobs.ReminderDays < 1 {
+		addErr("reminder days must be at least 1, got %d", s.Jobs.ReminderDays)
+	}
+	for _, spec := range []string{s.Jobs.PreArrivalSchedule, s.Jobs.CheckInSchedule, s.Jobs.ThankYouSchedule} {
+		if _, err := scheduler.Parse(spec); err != nil {
+			addErr("invalid job schedule: %v", err)
+		}
+	}
+
+	if strings.TrimSpace(s.Property.Name) == "" {
+		addErr("property name is required (-propertyname or PROPERTY_NAME)")
+	}
+	if s.Property.Email != "" {
+		if _, err := mail.ParseAddress(s.Property.Email); err != nil {
+			addErr("property email %q is not a valid email address", s.Property.Email)
+		}
+	}
+
+	switch s.Security.CSP {
+	case CSPEnforce, CSPReportOnly, CSPOff:
+	default:
+		addErr("CSP mode %q is not one of %s, %s, %s", s.Security.CSP, CSPEnforce, CSPReportOnly, CSPOff)
+	}
+	if s.Security.HSTSMaxAge < 0 {
+		addErr("HSTS max age must not be negative, got %s", s.Security.HSTSMaxAge)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Redacted returns a copy of the settings with secrets masked
+func (s Settings) Redacted() Settings {
+	for _, o := range s.options() {
+		if o.secret && o.value.String() != "" {
+			_ = o.value.Set(redacted)
+		}
+	}
+	return s
+}
+
+// Dump writes the settings as YAML with secrets masked, suitable for -print-config
+func (s Settings) Dump(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(s.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// ConnectionString returns the postgres connection string for the database settings
+func (d DBSettings) ConnectionString() string {
+	return fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s sslmode=%s",
+		d.Host, d.Port, d.Name, d.User, d.Password, d.SSLMode)
+}
+
+func validPort(p int) bool {
+	return p > 0 && p <= 65535
+}
+
+// pendingValue records a flag's raw value so it can be applied after the file and environment
+type pendingValue struct {
+	def    string
+	value  string
+	isBool bool
+}
+
+func (v *pendingValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.def
+}
+
+func (v *pendingValue) Set(s string) error {
+	v.value = s
+	return nil
+}
+
+func (v *pendingValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return errors.New("not a whole number")
+	}
+	*v = intValue(n)
+	return nil
+}
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return errors.New("expected true or false")
+	}
+	*v = boolValue(b)
+	return nil
+}
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.New("expected a duration such as 3s or 500ms")
+	}
+	*v = durationValue(d)
+	return nil
+}
+func (v *durationValue) String() string { return time.Duration(*v).String() }
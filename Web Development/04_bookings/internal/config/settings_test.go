@@ -0,0 +1,209 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns a getenv function backed by a map
+func env(vars map[string]string) func(string) string {
+	return func(key string) string {
+		return vars[key]
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	s, err := Load("bookings", []string{"-dbdriver=sqlite"}, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.Production || !s.Cache || s.Port != 8080 || s.DB.Timeout != 3*time.Second {
+		t.Errorf("unexpected defaults: %+v", s)
+	}
+	if s.DB.Name != "bookings.db" {
+		t.Errorf("expected sqlite to default to bookings.db, got %q", s.DB.Name)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	file := writeFile(t, "config.yml", `
+production: false
+port: 9000
+db:
+  name: from_file
+  user: file_user
+  host: file-host
+  timeout: 5s
+mail:
+  host: smtp.file.com
+  from_name: File
+`)
+
+	s, err := Load("bookings", []string{"-config=" + file, "-dbuser=flag_user", "-production"}, env(map[string]string{
+		"DB_USER":        "env_user",
+		"DB_HOST":        "env-host",
+		"MAIL_FROM_NAME": "Env",
+		"DEV":            "true",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"file over default", s.DB.Name, "from_file"},
+		{"file duration", s.DB.Timeout, 5 * time.Second},
+		{"file port", s.Port, 9000},
+		{"env over file", s.DB.Host, "env-host"},
+		{"env over file in mail", s.Mail.FromName, "Env"},
+		{"flag over env", s.DB.User, "flag_user"},
+		{"bool flag over file", s.Production, true},
+		{"untouched default", s.DB.Port, 5432},
+		{"file mail host", s.Mail.Host, "smtp.file.com"},
+		{"dev from env", s.Dev, true},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoad_ConfigFileFromEnv(t *testing.T) {
+	file := writeFile(t, "config.yml", "db:\n  driver: sqlite\n  name: env.db\n")
+
+	s, err := Load("bookings", nil, env(map[string]string{ConfigFileEnv: file}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.DB.Name != "env.db" || s.ConfigFile != file {
+		t.Errorf("expected config file from %s to be used, got %+v", ConfigFileEnv, s)
+	}
+}
+
+func TestLoad_SecretFiles(t *testing.T) {
+	dbSecret := writeFile(t, "db_password", "s3cret\n")
+	mailSecret := writeFile(t, "mail_password", "mail-pass")
+
+	s, err := Load("bookings", []string{"-dbname=bookings", "-dbuser=bookings"}, env(map[string]string{
+		"DB_PASSWORD_FILE":   dbSecret,
+		"MAIL_USERNAME":      "me@example.com",
+		"MAIL_PASSWORD_FILE": mailSecret,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.DB.Password != "s3cret" {
+		t.Errorf("expected password from file without trailing newline, got %q", s.DB.Password)
+	}
+	if s.Mail.Password != "mail-pass" {
+		t.Errorf("expected mail password from file, got %q", s.Mail.Password)
+	}
+
+	_, err = Load("bookings", []string{"-dbdriver=sqlite"}, env(map[string]string{
+		"DB_PASSWORD":      "inline",
+		"DB_PASSWORD_FILE": dbSecret,
+	}))
+	if err == nil || !strings.Contains(err.Error(), "DB_PASSWORD_FILE") {
+		t.Errorf("expected an error when both a variable and its _FILE are set, got %v", err)
+	}
+
+	_, err = Load("bookings", []string{"-dbdriver=sqlite"}, env(map[string]string{
+		"DB_PASSWORD_FILE": filepath.Join(t.TempDir(), "missing"),
+	}))
+	if err == nil {
+		t.Error("expected an error for a missing secret file")
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		file string
+		want []string
+	}{
+		{"postgres requires name and user", nil, nil, "", []string{"database name is required", "database user is required"}},
+		{"unknown driver", []string{"-dbdriver=mysql"}, nil, "", []string{`unknown database driver "mysql"`}},
+		{"bad flag value", []string{"-dbport=abc"}, nil, "", []string{"-dbport"}},
+		{"bad env value", nil, map[string]string{"DB_TIMEOUT": "soon"}, "", []string{"DB_TIMEOUT"}},
+		{"several problems", []string{"-dbdriver=sqlite", "-loglevel=loud", "-mailencryption=rot13", "-mailfrom=nobody"}, nil, "", []string{"log level", "mail encryption", "mail from address"}},
+		{"unknown file key", []string{"-dbdriver=sqlite"}, nil, "databse:\n  name: x\n", []string{"databse"}},
+		{"username without password", []string{"-dbdriver=sqlite", "-mailusername=me"}, nil, "", []string{"set together"}},
+		{"bad links", []string{"-dbdriver=sqlite", "-baseurl=localhost:8080"}, map[string]string{"SIGNING_KEY": "short"}, "", []string{"base URL", "signing key"}},
+		{"bad property", []string{"-dbdriver=sqlite", "-propertyemail=front desk"}, map[string]string{"PROPERTY_NAME": " "}, "", []string{"property name", "property email"}},
+		{"bad job schedule", []string{"-dbdriver=sqlite", "-reminderdays=0"}, map[string]string{"CHECK_IN_SCHEDULE": "0 25 * * *"}, "", []string{"reminder days", "hour 25"}},
+		{"bad sms", []string{"-dbdriver=sqlite", "-smsurl=localhost:9090/messages"}, nil, "", []string{"SMS URL"}},
+		{"bad security", []string{"-dbdriver=sqlite", "-csp=strict"}, map[string]string{"HSTS_MAX_AGE": "-1h"}, "", []string{"CSP mode", "HSTS max age"}},
+	}
+
+	for _, tt := range tests {
+		args := tt.args
+		if tt.file != "" {
+			args = append(args, "-config="+writeFile(t, "config.yml", tt.file))
+		}
+		_, err := Load("bookings", args, env(tt.env))
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: expected error to mention %q, got %v", tt.name, want, err)
+			}
+		}
+	}
+}
+
+func TestSettings_Dump(t *testing.T) {
+	s, err := Load("bookings", []string{"-dbname=bookings", "-dbuser=bookings", "-print-config"}, env(map[string]string{
+		"DB_PASSWORD":   "hunter2",
+		"MAIL_USERNAME": "me@example.com",
+		"MAIL_PASSWORD": "smtp-secret",
+		"SMS_TOKEN":     "sms-secret",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.PrintConfig {
+		t.Error("expected -print-config to be recorded")
+	}
+
+	var buf bytes.Buffer
+	if err := s.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, secret := range []string{"hunter2", "smtp-secret", "me@example.com", "sms-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("dump leaked %q:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{"name: bookings", "timeout: 3s", "password: '********'", "from_address: noreply@bookings.com"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected dump to contain %q:\n%s", want, out)
+		}
+	}
+	if s.DB.Password != "hunter2" {
+		t.Error("Dump must not modify the settings it prints")
+	}
+}
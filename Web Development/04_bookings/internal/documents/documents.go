@@ -0,0 +1,268 @@
+// Package documents lays out the PDF booking confirmation and invoice of a reservation. Both are printed
+// in the language the guest booked in, so the copy staff download is the one the guest has.
+package documents
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/i18n"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/pdf"
+	"github.com/ashparshp/bookings/internal/promo"
+)
+
+// Kinds of document
+const (
+	Confirmation = "confirmation"
+	Invoice      = "invoice"
+)
+
+// Kinds lists the kinds of document in the order they are offered
+var Kinds = []string{Confirmation, Invoice}
+
+// IsKind reports whether kind names a kind of document
+func IsKind(kind string) bool {
+	return kind == Confirmation || kind == Invoice
+}
+
+// Reference is the reservation reference guests quote, e.g. BK-000042
+func Reference(res models.Reservation) string {
+	return fmt.Sprintf("BK-%06d", res.ID)
+}
+
+// InvoiceNumber is the number of the reservation's invoice, e.g. INV-000042. There is one invoice per
+// reservation, so it follows the reservation ids.
+func InvoiceNumber(res models.Reservation) string {
+	return fmt.Sprintf("INV-%06d", res.ID)
+}
+
+// Filename is the name a document of kind is downloaded or attached as
+func Filename(kind string, res models.Reservation) string {
+	if kind == Invoice {
+		return "invoice-" + InvoiceNumber(res) + ".pdf"
+	}
+	return "confirmation-" + Reference(res) + ".pdf"
+}
+
+// Render returns the PDF of the document of kind for res, in locale l. terms are the lines of the
+// reservation's cancellation policy, which confirmations list.
+func Render(kind string, p config.PropertyConfig, l *i18n.Locale, res models.Reservation, terms []string) ([]byte, error) {
+	switch kind {
+	case Confirmation:
+		return ConfirmationPDF(p, l, res, terms), nil
+	case Invoice:
+		return InvoicePDF(p, l, res), nil
+	}
+	return nil, fmt.Errorf("unknown document %q", kind)
+}
+
+// Layout of an A4 page, in points
+const (
+	left      = 50.0
+	right     = pdf.PageWidth - 50
+	column    = 310.0
+	bodySize  = 10.0
+	smallSize = 8.5
+	lineGap   = 15.0
+)
+
+// sheet is a page being filled from top to bottom
+type sheet struct {
+	*pdf.Page
+	y float64
+}
+
+// ConfirmationPDF returns the booking confirmation of res
+func ConfirmationPDF(p config.PropertyConfig, l *i18n.Locale, res models.Reservation, terms []string) []byte {
+	d, s := newDocument(p, l.T("Booking Confirmation"), []string{
+		l.T("Reference") + ": " + Reference(res),
+		l.T("Booked on %s", l.Date(res.CreatedAt)),
+	})
+
+	if !res.CancelledAt.IsZero() {
+		s.Box(left, s.y-12, right-left, 18, 0.85)
+		s.Text(left+8, s.y+1, pdf.HelveticaBold, bodySize, l.T("This reservation was cancelled on %s.", l.Date(res.CancelledAt)))
+		s.y += 30
+	}
+
+	s.guestAndStay(l, res)
+	s.amounts(l, res)
+
+	if len(terms) > 0 {
+		s.heading(l.T("Cancellation Policy"))
+		for _, t := range terms {
+			for i, line := range pdf.Wrap(pdf.Helvetica, bodySize, right-left-12, t) {
+				if i == 0 {
+					s.Text(left, s.y, pdf.Helvetica, bodySize, "•")
+				}
+				s.Text(left+12, s.y, pdf.Helvetica, bodySize, line)
+				s.y += lineGap
+			}
+		}
+	}
+
+	s.y += lineGap
+	for _, line := range pdf.Wrap(pdf.Helvetica, bodySize, right-left, l.T("Please quote your reference %s when you contact us about this reservation.", Reference(res))) {
+		s.Text(left, s.y, pdf.Helvetica, bodySize, line)
+		s.y += lineGap
+	}
+
+	footer(s, p)
+	return d.Bytes()
+}
+
+// InvoicePDF returns the invoice of res. A cancelled reservation is invoiced for its cancellation fee.
+func InvoicePDF(p config.PropertyConfig, l *i18n.Locale, res models.Reservation) []byte {
+	date := res.CreatedAt
+	if !res.CancelledAt.IsZero() {
+		date = res.CancelledAt
+	}
+	meta := []string{
+		l.T("Invoice number") + ": " + InvoiceNumber(res),
+		l.T("Invoice date") + ": " + l.Date(date),
+		l.T("Reference") + ": " + Reference(res),
+	}
+	if p.TaxID != "" {
+		meta = append(meta, l.T("Tax ID")+": "+p.TaxID)
+	}
+	d, s := newDocument(p, l.T("Invoice"), meta)
+
+	s.guestAndStay(l, res)
+
+	if res.CancelledAt.IsZero() {
+		s.amounts(l, res)
+	} else {
+		s.heading(l.T("Amounts"))
+		s.rows([]row{
+			{l.T("Reservation total"), l.Money(res.TotalCents)},
+			{l.T("Refund"), "-" + l.Money(res.RefundCents)},
+		})
+		s.total(l.T("Cancellation fee"), l.Money(res.PenaltyCents))
+	}
+
+	footer(s, p)
+	return d.Bytes()
+}
+
+// newDocument starts a document with the property's details on the left and the title and meta lines
+// on the right, and returns its first page below them
+func newDocument(p config.PropertyConfig, title string, meta []string) (*pdf.Document, *sheet) {
+	d := pdf.New()
+	d.Title = title
+	d.Author = p.Name
+	s := &sheet{Page: d.AddPage(), y: 70}
+
+	s.Text(left, s.y, pdf.HelveticaBold, 16, p.Name)
+	s.TextRight(right, s.y, pdf.HelveticaBold, 16, title)
+
+	y := s.y + 18
+	for _, line := range propertyLines(p) {
+		s.Text(left, y, pdf.Helvetica, smallSize, line)
+		y += 11
+	}
+	metaY := s.y + 18
+	for _, line := range meta {
+		s.TextRight(right, metaY, pdf.Helvetica, bodySize, line)
+		metaY += 13
+	}
+
+	s.y = max(y, metaY) + 10
+	s.Line(left, s.y, right, s.y, 0.75)
+	s.y += 28
+	return d, s
+}
+
+// propertyLines are the address, split on commas, and the contact details of the property
+func propertyLines(p config.PropertyConfig) []string {
+	var lines []string
+	for _, part := range strings.Split(p.Address, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			lines = append(lines, part)
+		}
+	}
+	for _, contact := range []string{p.Phone, p.Email} {
+		if contact != "" {
+			lines = append(lines, contact)
+		}
+	}
+	return lines
+}
+
+// guestAndStay prints who booked next to what they booked
+func (s *sheet) guestAndStay(l *i18n.Locale, res models.Reservation) {
+	top := s.y
+	s.Text(left, s.y, pdf.HelveticaBold, 11, l.T("Guest"))
+	s.y += 18
+	for _, line := range []string{res.FirstName + " " + res.LastName, res.Email, res.Phone} {
+		if strings.TrimSpace(line) != "" {
+			s.Text(left, s.y, pdf.Helvetica, bodySize, line)
+			s.y += lineGap
+		}
+	}
+	guestBottom := s.y
+
+	s.y = top
+	s.Text(column, s.y, pdf.HelveticaBold, 11, l.T("Stay"))
+	s.y += 18
+	for _, field := range []row{
+		{l.T("Room"), res.Room.RoomName},
+		{l.T("Check-in"), l.Date(res.StartDate)},
+		{l.T("Check-out"), l.Date(res.EndDate)},
+		{l.T("Nights"), fmt.Sprint(promo.Nights(res))},
+	} {
+		s.Text(column, s.y, pdf.Helvetica, bodySize, field.label)
+		s.TextRight(right, s.y, pdf.Helvetica, bodySize, field.value)
+		s.y += lineGap
+	}
+
+	s.y = max(s.y, guestBottom) + 20
+}
+
+// row is a label with a value printed against the right margin
+type row struct {
+	label string
+	value string
+}
+
+// amounts prints the price of the stay, any promo code discount and the total
+func (s *sheet) amounts(l *i18n.Locale, res models.Reservation) {
+	s.heading(l.T("Amounts"))
+	lines := []row{{l.T("%s, %d nights", res.Room.RoomName, promo.Nights(res)), l.Money(res.SubtotalCents)}}
+	if res.PromoCode != "" {
+		lines = append(lines, row{l.T("Promo code %s", res.PromoCode), "-" + l.Money(res.DiscountCents)})
+	}
+	s.rows(lines)
+	s.total(l.T("Total"), l.Money(res.TotalCents))
+}
+
+func (s *sheet) heading(title string) {
+	s.Box(left, s.y-12, right-left, 18, 0.92)
+	s.Text(left+6, s.y+1, pdf.HelveticaBold, bodySize, title)
+	s.y += 24
+}
+
+func (s *sheet) rows(lines []row) {
+	for _, r := range lines {
+		s.Text(left+6, s.y, pdf.Helvetica, bodySize, r.label)
+		s.TextRight(right-6, s.y, pdf.Helvetica, bodySize, r.value)
+		s.y += lineGap + 3
+	}
+}
+
+func (s *sheet) total(label, value string) {
+	s.Line(column, s.y-10, right, s.y-10, 0.5)
+	s.y += 4
+	s.Text(left+6, s.y, pdf.HelveticaBold, 11, label)
+	s.TextRight(right-6, s.y, pdf.HelveticaBold, 11, value)
+	s.y += 30
+}
+
+// footer repeats the property's name and contact details at the bottom of the page
+func footer(s *sheet, p config.PropertyConfig) {
+	y := pdf.PageHeight - 50
+	s.Line(left, y-14, right, y-14, 0.5)
+	parts := append([]string{p.Name}, propertyLines(p)...)
+	s.Text(left, y, pdf.Helvetica, smallSize, strings.Join(parts, "  ·  "))
+}
@@ -0,0 +1,116 @@
+package documents
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/i18n"
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+var property = config.PropertyConfig{
+	Name:    "Fort Smythe Bed and Breakfast",
+	Address: "1 Fort Road, Smythe",
+	Phone:   "+1 555 0100",
+	Email:   "stay@example.com",
+	TaxID:   "US-123456",
+}
+
+func reservation() models.Reservation {
+	return models.Reservation{
+		ID:            42,
+		FirstName:     "Ana",
+		LastName:      "Muñoz",
+		Email:         "ana@example.com",
+		Phone:         "555-0199",
+		StartDate:     time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:       time.Date(2026, 6, 4, 0, 0, 0, 0, time.UTC),
+		CreatedAt:     time.Date(2026, 5, 2, 9, 0, 0, 0, time.UTC),
+		SubtotalCents: 36000,
+		DiscountCents: 3600,
+		TotalCents:    32400,
+		PromoCode:     "SUMMER10",
+		Room:          models.Room{ID: 1, RoomName: "General's Quarters"},
+	}
+}
+
+// text returns the lines of text shown in a PDF, converted back from WinAnsi
+func text(b []byte) string {
+	var lines []string
+	for _, m := range regexp.MustCompile(`\((.*?[^\\])\) Tj`).FindAllSubmatch(b, -1) {
+		var line strings.Builder
+		for _, c := range m[1] {
+			line.WriteRune(rune(c))
+		}
+		lines = append(lines, strings.NewReplacer(`\(`, "(", `\)`, ")", `\\`, `\`).Replace(line.String()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestConfirmationPDF(t *testing.T) {
+	terms := []string{"Free cancellation until 7 days before arrival"}
+	b := ConfirmationPDF(property, i18n.Default(), reservation(), terms)
+
+	if !bytes.HasPrefix(b, []byte("%PDF-")) {
+		t.Fatal("expected a PDF")
+	}
+	got := text(b)
+	for _, want := range []string{
+		"Fort Smythe Bed and Breakfast", "Booking Confirmation", "Reference: BK-000042", "Booked on May 2, 2026",
+		"1 Fort Road", "Smythe", "stay@example.com",
+		"Ana Muñoz", "ana@example.com", "General's Quarters", "June 1, 2026", "June 4, 2026",
+		"General's Quarters, 3 nights", "$360.00", "Promo code SUMMER10", "-$36.00", "$324.00",
+		"Free cancellation until 7 days before arrival",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected the confirmation to show %q, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "US-123456") {
+		t.Error("expected the tax id only on invoices")
+	}
+}
+
+func TestInvoicePDF(t *testing.T) {
+	es, _ := i18n.Get("es")
+	got := text(InvoicePDF(property, es, reservation()))
+	for _, want := range []string{"Factura", "INV-000042", "US-123456", "1 de junio de 2026", "324,00 US$"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected the invoice to show %q, got:\n%s", want, got)
+		}
+	}
+
+	cancelled := reservation()
+	cancelled.CancelledAt = time.Date(2026, 5, 20, 15, 0, 0, 0, time.UTC)
+	cancelled.PenaltyCents = 16200
+	cancelled.RefundCents = 16200
+	got = text(InvoicePDF(property, i18n.Default(), cancelled))
+	for _, want := range []string{"Invoice date: May 20, 2026", "Reservation total", "Refund", "-$162.00", "Cancellation fee"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("cancelled: expected the invoice to show %q, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	for _, kind := range Kinds {
+		b, err := Render(kind, property, i18n.Default(), reservation(), nil)
+		if err != nil || len(b) == 0 {
+			t.Errorf("%s: expected a document, got %v", kind, err)
+		}
+	}
+	if _, err := Render("receipt", property, i18n.Default(), reservation(), nil); err == nil {
+		t.Error("expected an error for an unknown kind of document")
+	}
+
+	if got := Filename(Invoice, reservation()); got != "invoice-INV-000042.pdf" {
+		t.Errorf("unexpected invoice filename %q", got)
+	}
+	if got := Filename(Confirmation, reservation()); got != "confirmation-BK-000042.pdf" {
+		t.Errorf("unexpected confirmation filename %q", got)
+	}
+}
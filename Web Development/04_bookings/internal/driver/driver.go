@@ -25,7 +25,7 @@ const maxDbLifetime = 5 * time.Minute
 func ConnectSQL(dsn string) (*DB, error) {
 	d, err := NewDatabase(dsn)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	d.SetMaxOpenConns(maxOpenDbConns)
@@ -0,0 +1,89 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/ashparshp/bookings"
+	"github.com/ashparshp/bookings/internal/migrate"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteBootstrapVersion is the newest migration whose tables the server created itself before sqlite
+// databases were migrated; a file made back then has them all but no record of the migrations
+const sqliteBootstrapVersion = "20261019100003"
+
+// ConnectSQLite opens (creating if needed) a sqlite database file and applies the pending migrations
+func ConnectSQLite(path string) (*DB, error) {
+	db, err := OpenSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := migrate.Load(bookings.Migrations(), migrate.SQLite)
+	if err != nil {
+		db.SQL.Close()
+		return nil, err
+	}
+	if _, err := migrate.NewSQLite(db.SQL, migrations).Up(context.Background()); err != nil {
+		db.SQL.Close()
+		return nil, fmt.Errorf("migrating sqlite database: %w", err)
+	}
+
+	return db, nil
+}
+
+// OpenSQLite opens (creating if needed) a sqlite database file without migrating it
+func OpenSQLite(path string) (*DB, error) {
+	d, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000", path))
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite only allows one writer at a time, so a single connection avoids "database is locked" errors
+	d.SetMaxOpenConns(1)
+
+	if err := testDB(d); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	if err := adoptSQLite(d); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	dbConn.SQL = d
+
+	return dbConn, nil
+}
+
+// adoptSQLite records the migrations of a database file the server created before sqlite databases were
+// migrated, so they are not run against the tables that are already there
+func adoptSQLite(d *sql.DB) error {
+	var migrated, bootstrapped, current bool
+	err := d.QueryRow(`SELECT
+		EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migration'),
+		EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'users'),
+		EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'guest_notification_preferences')`,
+	).Scan(&migrated, &bootstrapped, &current)
+	if err != nil {
+		return fmt.Errorf("inspecting sqlite database: %w", err)
+	}
+	if migrated || !bootstrapped {
+		return nil
+	}
+	if !current {
+		return fmt.Errorf("the sqlite database was created by an older version of the server than can be migrated; delete it to start over")
+	}
+
+	migrations, err := migrate.Load(bookings.Migrations(), migrate.SQLite)
+	if err != nil {
+		return err
+	}
+	if _, err := migrate.NewSQLite(d, migrations).Baseline(context.Background(), sqliteBootstrapVersion); err != nil {
+		return fmt.Errorf("recording the migrations of the sqlite database: %w", err)
+	}
+	return nil
+}
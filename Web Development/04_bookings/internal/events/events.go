@@ -0,0 +1,101 @@
+// Package events is an in-process publish and subscribe bus. Handlers publish reservation and calendar
+// changes on it and the admin pages' live update stream subscribes to it. Events are not stored: a
+// subscriber only sees what is published while it is subscribed, on the instance it is connected to.
+package events
+
+import "sync"
+
+// subscriberBuffer is how many events a subscriber may fall behind before it is dropped
+const subscriberBuffer = 32
+
+// Event is a change that happened, named like the webhook events, with data that encodes to JSON
+type Event struct {
+	Name string
+	Data any
+}
+
+// Bus hands every published event to every current subscriber
+type Bus struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewBus returns an empty bus
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscription receives the events published on a bus on C until it is closed. C is closed when the
+// subscription ends, whether by Close, by the bus closing or by the subscriber falling too far behind.
+type Subscription struct {
+	C <-chan Event
+
+	ch  chan Event
+	bus *Bus
+}
+
+// Subscribe starts a subscription. On a closed bus the subscription has already ended.
+func (b *Bus) Subscribe() *Subscription {
+	ch := make(chan Event, subscriberBuffer)
+	s := &Subscription{C: ch, ch: ch, bus: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return s
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Close ends the subscription; it is safe to call more than once
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
+
+// Publish hands e to every subscriber without waiting. A subscriber whose buffer is full is dropped rather
+// than holding up the publisher, which is usually a request; its client is expected to reconnect and
+// load the current state again.
+func (b *Bus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subs {
+		select {
+		case s.ch <- e:
+		default:
+			b.remove(s)
+		}
+	}
+}
+
+// Subscribers returns the number of current subscriptions
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// Close ends every subscription and refuses new ones, so long lived streams finish when the server shuts
+// down
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for s := range b.subs {
+		b.remove(s)
+	}
+}
+
+// remove ends s if it is still subscribed; b.mu must be held
+func (b *Bus) remove(s *Subscription) {
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.ch)
+	}
+}
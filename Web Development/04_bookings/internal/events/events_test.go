@@ -0,0 +1,66 @@
+package events
+
+import "testing"
+
+func TestBus(t *testing.T) {
+	b := NewBus()
+	first, second := b.Subscribe(), b.Subscribe()
+	if b.Subscribers() != 2 {
+		t.Fatalf("expected 2 subscribers, got %d", b.Subscribers())
+	}
+
+	b.Publish(Event{Name: "block.added", Data: 1})
+	for _, s := range []*Subscription{first, second} {
+		if e := <-s.C; e.Name != "block.added" || e.Data != 1 {
+			t.Errorf("expected the published event, got %+v", e)
+		}
+	}
+
+	second.Close()
+	second.Close()
+	if _, ok := <-second.C; ok {
+		t.Error("expected a closed subscription's channel to be closed")
+	}
+	b.Publish(Event{Name: "block.removed"})
+	if e := <-first.C; e.Name != "block.removed" {
+		t.Errorf("expected the remaining subscriber to get the event, got %+v", e)
+	}
+	if b.Subscribers() != 1 {
+		t.Errorf("expected 1 subscriber, got %d", b.Subscribers())
+	}
+}
+
+func TestBus_SlowSubscriber(t *testing.T) {
+	b := NewBus()
+	slow := b.Subscribe()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish(Event{Name: "reservation.created", Data: i})
+	}
+
+	got := 0
+	for range slow.C {
+		got++
+	}
+	if got != subscriberBuffer {
+		t.Errorf("expected the %d buffered events before the subscriber was dropped, got %d", subscriberBuffer, got)
+	}
+	if b.Subscribers() != 0 {
+		t.Errorf("expected the slow subscriber to be dropped, got %d subscribers", b.Subscribers())
+	}
+}
+
+func TestBus_Close(t *testing.T) {
+	b := NewBus()
+	s := b.Subscribe()
+
+	b.Close()
+	if _, ok := <-s.C; ok {
+		t.Error("expected closing the bus to end its subscriptions")
+	}
+	if _, ok := <-b.Subscribe().C; ok {
+		t.Error("expected a subscription to a closed bus to have ended")
+	}
+	s.Close()
+	b.Publish(Event{Name: "block.added"})
+}
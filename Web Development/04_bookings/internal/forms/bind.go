@@ -0,0 +1,286 @@
+package forms
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDateLayout is used for time.Time fields without a layout tag
+const DefaultDateLayout = "2006-01-02"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// boundField describes one struct field that Bind fills in
+type boundField struct {
+	index  []int
+	name   string
+	layout string
+	rules  []rule
+}
+
+// rule is one parsed entry of a validate tag
+type rule struct {
+	name  string
+	param string
+	re    *regexp.Regexp
+}
+
+// bindCache holds the parsed fields of each struct type passed to Bind
+var bindCache sync.Map
+
+// Bind decodes the form values into the struct pointed to by dst and validates them, driven by struct tags:
+//
+//	type booking struct {
+//		Name   string    `form:"name" validate:"required,maxlen=100"`
+//		Guests int       `form:"guests" validate:"min=1,max=4"`
+//		Start  time.Time `form:"start" validate:"required"`
+//		End    time.Time `form:"end" layout:"2006-01-02" validate:"required,after=start"`
+//		Terms  bool      `form:"terms" validate:"required"`
+//	}
+//
+// Supported field types are strings, ints, uints, floats, bools (checkboxes), []string and time.Time, parsed
+// with the layout tag or DefaultDateLayout. Supported rules are required, minlen=N, maxlen=N, min=N, max=N,
+// email, phone (E.164), oneof=a b c, eqfield=other, after=other and regex=pattern, which must come last so the
+// pattern may contain commas. Fields without a form tag are left alone.
+//
+// Conversion and validation problems are added to f.Errors under the form field name, so templates keep
+// working. Bind returns an error only when dst is not a pointer to a struct or a tag is malformed.
+func (f *Form) Bind(dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("forms: Bind needs a pointer to a struct, got %T", dst)
+	}
+	v = v.Elem()
+
+	fields, err := fieldsOf(v.Type())
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		if !f.decode(v.FieldByIndex(field.index), field) {
+			continue
+		}
+		f.validate(field)
+	}
+	return nil
+}
+
+// decode converts the raw value of field into the struct field, reporting whether it succeeded
+func (f *Form) decode(fv reflect.Value, field boundField) bool {
+	raw := strings.TrimSpace(f.Get(field.name))
+
+	if fv.Type() == timeType {
+		if raw == "" {
+			fv.Set(reflect.Zero(timeType))
+			return true
+		}
+		t, err := time.Parse(field.layout, raw)
+		if err != nil {
+			f.Errors.Add(field.name, f.message("This field must be a date in the format %s", field.layout))
+			return false
+		}
+		fv.Set(reflect.ValueOf(t))
+		return true
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(f.Get(field.name))
+	case reflect.Slice:
+		fv.Set(reflect.ValueOf(append([]string(nil), f.Values[field.name]...)))
+	case reflect.Bool:
+		switch strings.ToLower(raw) {
+		case "", "off", "false", "0", "no":
+			fv.SetBool(false)
+		case "on", "true", "1", "yes":
+			fv.SetBool(true)
+		default:
+			f.Errors.Add(field.name, f.message("This field must be yes or no"))
+			return false
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if raw == "" {
+			fv.SetInt(0)
+			return true
+		}
+		n, err := strconv.ParseInt(raw, 10, fv.Type().Bits())
+		if err != nil {
+			f.Errors.Add(field.name, f.message("This field must be a whole number"))
+			return false
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if raw == "" {
+			fv.SetUint(0)
+			return true
+		}
+		n, err := strconv.ParseUint(raw, 10, fv.Type().Bits())
+		if err != nil {
+			f.Errors.Add(field.name, f.message("This field must be a positive whole number"))
+			return false
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if raw == "" {
+			fv.SetFloat(0)
+			return true
+		}
+		n, err := strconv.ParseFloat(raw, fv.Type().Bits())
+		if err != nil {
+			f.Errors.Add(field.name, f.message("This field must be a number"))
+			return false
+		}
+		fv.SetFloat(n)
+	}
+	return true
+}
+
+// validate applies the rules of field; rules other than required are skipped for empty values
+func (f *Form) validate(field boundField) {
+	for _, r := range field.rules {
+		if r.name == "required" {
+			before := len(f.Errors[field.name])
+			f.Required(field.name)
+			if len(f.Errors[field.name]) > before {
+				return
+			}
+			continue
+		}
+		if strings.TrimSpace(f.Get(field.name)) == "" {
+			return
+		}
+
+		var ok bool
+		switch r.name {
+		case "minlen":
+			n, _ := strconv.Atoi(r.param)
+			ok = f.MinLength(field.name, n)
+		case "maxlen":
+			n, _ := strconv.Atoi(r.param)
+			ok = f.MaxLength(field.name, n)
+		case "min":
+			n, _ := strconv.ParseFloat(r.param, 64)
+			ok = f.Min(field.name, n)
+		case "max":
+			n, _ := strconv.ParseFloat(r.param, 64)
+			ok = f.Max(field.name, n)
+		case "email":
+			before := len(f.Errors[field.name])
+			f.IsEmail(field.name)
+			ok = len(f.Errors[field.name]) == before
+		case "phone":
+			ok = f.IsPhone(field.name)
+		case "oneof":
+			ok = f.In(field.name, strings.Fields(r.param)...)
+		case "eqfield":
+			ok = f.EqualTo(field.name, r.param)
+		case "after":
+			ok = f.DateAfter(field.name, r.param, field.layout)
+		case "regex":
+			ok = f.Matches(field.name, r.re)
+		}
+		if !ok {
+			// one message per field is enough
+			return
+		}
+	}
+}
+
+// fieldsOf returns the bindable fields of struct type t, parsing and caching its tags
+func fieldsOf(t reflect.Type) ([]boundField, error) {
+	if cached, ok := bindCache.Load(t); ok {
+		return cached.([]boundField), nil
+	}
+
+	var fields []boundField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, ok := sf.Tag.Lookup("form")
+		if !ok || name == "-" || !sf.IsExported() {
+			continue
+		}
+		if !bindable(sf.Type) {
+			return nil, fmt.Errorf("forms: field %s has unsupported type %s", sf.Name, sf.Type)
+		}
+
+		field := boundField{index: sf.Index, name: name, layout: sf.Tag.Get("layout")}
+		if field.layout == "" {
+			field.layout = DefaultDateLayout
+		}
+
+		rules, err := parseRules(sf.Tag.Get("validate"))
+		if err != nil {
+			return nil, fmt.Errorf("forms: field %s: %w", sf.Name, err)
+		}
+		field.rules = rules
+		fields = append(fields, field)
+	}
+
+	bindCache.Store(t, fields)
+	return fields, nil
+}
+
+func bindable(t reflect.Type) bool {
+	if t == timeType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// parseRules parses a validate tag such as "required,maxlen=255,regex=^[a-z]+$"
+func parseRules(tag string) ([]rule, error) {
+	var rules []rule
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "regex=") {
+			// the pattern runs to the end of the tag
+			part, tag = tag, ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+
+		name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+		r := rule{name: name, param: param}
+
+		switch name {
+		case "required", "email", "phone":
+		case "minlen", "maxlen":
+			if _, err := strconv.Atoi(param); err != nil {
+				return nil, fmt.Errorf("rule %s needs a whole number, got %q", name, param)
+			}
+		case "min", "max":
+			if _, err := strconv.ParseFloat(param, 64); err != nil {
+				return nil, fmt.Errorf("rule %s needs a number, got %q", name, param)
+			}
+		case "oneof", "eqfield", "after":
+			if param == "" {
+				return nil, fmt.Errorf("rule %s needs a parameter", name)
+			}
+		case "regex":
+			re, err := regexp.Compile(param)
+			if err != nil {
+				return nil, fmt.Errorf("rule regex: %w", err)
+			}
+			r.re = re
+		default:
+			return nil, fmt.Errorf("unknown validation rule %q", name)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
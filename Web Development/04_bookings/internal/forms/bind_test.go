@@ -0,0 +1,133 @@
+package forms
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+type bookingForm struct {
+	Name     string    `form:"name" validate:"required,minlen=3,maxlen=10"`
+	Email    string    `form:"email" validate:"required,email"`
+	Phone    string    `form:"phone" validate:"phone"`
+	Guests   int       `form:"guests" validate:"min=1,max=4"`
+	Start    time.Time `form:"start" validate:"required"`
+	End      time.Time `form:"end" validate:"required,after=start"`
+	Day      time.Time `form:"day" layout:"01/02/2006"`
+	Terms    bool      `form:"terms" validate:"required"`
+	News     bool      `form:"news"`
+	Kind     string    `form:"kind" validate:"oneof=single double"`
+	Password string    `form:"password"`
+	Confirm  string    `form:"confirm" validate:"eqfield=password"`
+	Code     string    `form:"code" validate:"regex=^[A-Z]{2,4}$"`
+	Tags     []string  `form:"tag"`
+	Price    float64   `form:"price"`
+	Ignored  string
+}
+
+func TestForm_Bind(t *testing.T) {
+	form := New(url.Values{
+		"name":     {"Jane"},
+		"email":    {"jane@example.com"},
+		"phone":    {"+14155552671"},
+		"guests":   {"2"},
+		"start":    {"2025-06-01"},
+		"end":      {"2025-06-03"},
+		"day":      {"07/04/2025"},
+		"terms":    {"on"},
+		"kind":     {"double"},
+		"password": {"secret"},
+		"confirm":  {"secret"},
+		"code":     {"AB"},
+		"tag":      {"a", "b"},
+		"price":    {"12.5"},
+		"Ignored":  {"x"},
+	})
+
+	var b bookingForm
+	if err := form.Bind(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !form.Valid() {
+		t.Fatalf("expected a valid form, got %v", form.Errors)
+	}
+
+	if b.Name != "Jane" || b.Guests != 2 || !b.Terms || b.News || b.Kind != "double" || b.Price != 12.5 {
+		t.Errorf("unexpected values: %+v", b)
+	}
+	if !b.Start.Equal(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)) || !b.Day.Equal(time.Date(2025, 7, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("dates not parsed: start %s, day %s", b.Start, b.Day)
+	}
+	if len(b.Tags) != 2 || b.Tags[1] != "b" {
+		t.Errorf("expected multiple values for tag, got %v", b.Tags)
+	}
+	if b.Ignored != "" {
+		t.Error("fields without a form tag should not be bound")
+	}
+}
+
+func TestForm_BindErrors(t *testing.T) {
+	form := New(url.Values{
+		"name":     {"Jo"},
+		"email":    {"not-an-email"},
+		"phone":    {"555-5555"},
+		"guests":   {"two"},
+		"start":    {"2025-06-03"},
+		"end":      {"2025-06-01"},
+		"day":      {"2025-07-04"},
+		"kind":     {"suite"},
+		"password": {"secret"},
+		"confirm":  {"secret!"},
+		"code":     {"toolong"},
+	})
+
+	var b bookingForm
+	if err := form.Bind(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, field := range []string{"name", "email", "phone", "guests", "end", "day", "terms", "kind", "confirm", "code"} {
+		if form.Errors.Get(field) == "" {
+			t.Errorf("expected an error for %s", field)
+		}
+	}
+	for _, field := range []string{"start", "password", "news"} {
+		if msg := form.Errors.Get(field); msg != "" {
+			t.Errorf("unexpected error for %s: %s", field, msg)
+		}
+	}
+	if len(form.Errors["name"]) != 1 {
+		t.Errorf("expected one message per field, got %v", form.Errors["name"])
+	}
+
+	// optional fields are only validated when given
+	form = New(url.Values{"name": {"Jane"}, "email": {"jane@example.com"}, "start": {"2025-06-01"}, "end": {"2025-06-02"}, "terms": {"1"}})
+	if err := form.Bind(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !form.Valid() {
+		t.Errorf("expected empty optional fields to be valid, got %v", form.Errors)
+	}
+}
+
+func TestForm_BindInvalidTarget(t *testing.T) {
+	form := New(url.Values{})
+
+	if err := form.Bind(bookingForm{}); err == nil {
+		t.Error("expected an error for a non-pointer")
+	}
+
+	var bad struct {
+		Name string `form:"name" validate:"shout"`
+	}
+	if err := form.Bind(&bad); err == nil {
+		t.Error("expected an error for an unknown rule")
+	}
+
+	var unsupported struct {
+		Data map[string]string `form:"data"`
+	}
+	if err := form.Bind(&unsupported); err == nil {
+		t.Error("expected an error for an unsupported field type")
+	}
+}
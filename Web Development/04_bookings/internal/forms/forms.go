@@ -12,8 +12,13 @@ import (
 type Form struct {
 	url.Values
 	Errors errors
+
+	translate Translator
 }
 
+// Translator returns format in the user's language, filled in with args
+type Translator func(format string, args ...any) string
+
 // Valid returns true if there are no errors, otherwise false
 func (f *Form) Valid() bool {
 	return len(f.Errors) == 0
@@ -22,9 +27,26 @@ func (f *Form) Valid() bool {
 // New initializes a form struct
 func New(data url.Values) *Form {
 	return &Form{
-		data,
-		errors(map[string][]string{}),
+		Values: data,
+		Errors: errors(map[string][]string{}),
+	}
+}
+
+// Translate makes the form add its error messages in another language and returns the form
+func (f *Form) Translate(t Translator) *Form {
+	f.translate = t
+	return f
+}
+
+// message formats an error message, translating it when a translator is set
+func (f *Form) message(format string, args ...any) string {
+	if f.translate != nil {
+		return f.translate(format, args...)
+	}
+	if len(args) == 0 {
+		return format
 	}
+	return fmt.Sprintf(format, args...)
 }
 
 // Required checks for required fields
@@ -32,7 +54,7 @@ func (f *Form) Required(fields ...string) {
 	for _, field := range fields {
 		value := f.Get(field)
 		if strings.TrimSpace(value) == "" {
-			f.Errors.Add(field, "This field cannot be blank")
+			f.Errors.Add(field, f.message("This field cannot be blank"))
 		}
 	}
 }
@@ -50,7 +72,7 @@ func (f *Form) Has(field string) bool {
 func (f *Form) MinLength(field string, length int) bool {
 	x := f.Get(field)
 	if len(x) < length {
-		f.Errors.Add(field, fmt.Sprintf("This field must be at least %d characters long", length))
+		f.Errors.Add(field, f.message("This field must be at least %d characters long", length))
 		return false
 	}
 	return true
@@ -59,6 +81,6 @@ func (f *Form) MinLength(field string, length int) bool {
 // IsEmail checks for valid email address
 func (f *Form) IsEmail(field string) {
 	if !govalidator.IsEmail(f.Get(field)) {
-		f.Errors.Add(field, "Invalid email address")
+		f.Errors.Add(field, f.message("Invalid email address"))
 	}
 }
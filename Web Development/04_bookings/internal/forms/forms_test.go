@@ -5,6 +5,8 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+
+	"github.com/ashparshp/bookings/internal/i18n"
 )
 
 func TestForm_Valid(t *testing.T) {
@@ -130,4 +132,18 @@ func TestForm_IsEmail(t *testing.T) {
 	}
 }
 
-*/
\ No newline at end of file
+*/
+func TestForm_Translate(t *testing.T) {
+	es, _ := i18n.Get("es")
+	form := New(url.Values{"first_name": {"ab"}}).Translate(es.T)
+
+	form.Required("email")
+	form.MinLength("first_name", 3)
+
+	if got := form.Errors.Get("email"); got != "Este campo no puede estar vacío" {
+		t.Errorf("expected a translated required message, got %q", got)
+	}
+	if got := form.Errors.Get("first_name"); got != "Este campo debe tener al menos 3 caracteres" {
+		t.Errorf("expected a translated length message, got %q", got)
+	}
+}
@@ -0,0 +1,124 @@
+package forms
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// e164 matches phone numbers in E.164 format, e.g. +14155552671
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// MaxLength checks for string maximum length, counted in characters
+func (f *Form) MaxLength(field string, length int) bool {
+	if utf8.RuneCountInString(f.Get(field)) > length {
+		f.Errors.Add(field, f.message("This field must be at most %d characters long", length))
+		return false
+	}
+	return true
+}
+
+// Min checks that a numeric field is at least min
+func (f *Form) Min(field string, min float64) bool {
+	n, ok := f.number(field)
+	if !ok {
+		return false
+	}
+	if n < min {
+		f.Errors.Add(field, f.message("This field must be at least %s", formatNumber(min)))
+		return false
+	}
+	return true
+}
+
+// Max checks that a numeric field is at most max
+func (f *Form) Max(field string, max float64) bool {
+	n, ok := f.number(field)
+	if !ok {
+		return false
+	}
+	if n > max {
+		f.Errors.Add(field, f.message("This field must be at most %s", formatNumber(max)))
+		return false
+	}
+	return true
+}
+
+// IsPhone checks for a phone number in international E.164 format
+func (f *Form) IsPhone(field string) bool {
+	if !e164.MatchString(f.Get(field)) {
+		f.Errors.Add(field, f.message("Invalid phone number, use the international format e.g. +14155552671"))
+		return false
+	}
+	return true
+}
+
+// Matches checks that a field matches the regular expression re
+func (f *Form) Matches(field string, re *regexp.Regexp) bool {
+	if !re.MatchString(f.Get(field)) {
+		f.Errors.Add(field, f.message("This field is not in the expected format"))
+		return false
+	}
+	return true
+}
+
+// In checks that a field is one of the allowed values
+func (f *Form) In(field string, allowed ...string) bool {
+	value := f.Get(field)
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	f.Errors.Add(field, f.message("This field must be one of: %s", strings.Join(allowed, ", ")))
+	return false
+}
+
+// EqualTo checks that a field has the same value as another field, e.g. a password confirmation
+func (f *Form) EqualTo(field, other string) bool {
+	if f.Get(field) != f.Get(other) {
+		f.Errors.Add(field, f.message("This field must match %s", f.message(label(other))))
+		return false
+	}
+	return true
+}
+
+// DateAfter checks that the date in field is later than the date in other, both parsed with layout
+func (f *Form) DateAfter(field, other, layout string) bool {
+	date, err := time.Parse(layout, f.Get(field))
+	if err != nil {
+		f.Errors.Add(field, f.message("This field must be a date in the format %s", layout))
+		return false
+	}
+	otherDate, err := time.Parse(layout, f.Get(other))
+	if err != nil {
+		// the other field reports its own error
+		return false
+	}
+	if !date.After(otherDate) {
+		f.Errors.Add(field, f.message("This date must be after the %s", f.message(label(other))))
+		return false
+	}
+	return true
+}
+
+// number parses a numeric field, adding an error if it is not a number
+func (f *Form) number(field string) (float64, bool) {
+	n, err := strconv.ParseFloat(strings.TrimSpace(f.Get(field)), 64)
+	if err != nil {
+		f.Errors.Add(field, f.message("This field must be a number"))
+		return 0, false
+	}
+	return n, true
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// label turns a field name such as start_date into "start date" for error messages
+func label(field string) string {
+	return strings.ReplaceAll(field, "_", " ")
+}
@@ -0,0 +1,45 @@
+package forms
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+func TestForm_Validators(t *testing.T) {
+	tests := []struct {
+		name   string
+		values url.Values
+		check  func(f *Form) bool
+		valid  bool
+	}{
+		{"max length ok", url.Values{"a": {"héllo"}}, func(f *Form) bool { return f.MaxLength("a", 5) }, true},
+		{"max length too long", url.Values{"a": {"hello!"}}, func(f *Form) bool { return f.MaxLength("a", 5) }, false},
+		{"min ok", url.Values{"n": {"3"}}, func(f *Form) bool { return f.Min("n", 1) }, true},
+		{"min too small", url.Values{"n": {"0"}}, func(f *Form) bool { return f.Min("n", 1) }, false},
+		{"max too big", url.Values{"n": {"11.5"}}, func(f *Form) bool { return f.Max("n", 10) }, false},
+		{"max not a number", url.Values{"n": {"ten"}}, func(f *Form) bool { return f.Max("n", 10) }, false},
+		{"phone e164", url.Values{"p": {"+14155552671"}}, func(f *Form) bool { return f.IsPhone("p") }, true},
+		{"phone without plus", url.Values{"p": {"4155552671"}}, func(f *Form) bool { return f.IsPhone("p") }, false},
+		{"phone with dashes", url.Values{"p": {"+1-415-555-2671"}}, func(f *Form) bool { return f.IsPhone("p") }, false},
+		{"matches", url.Values{"c": {"ABC"}}, func(f *Form) bool { return f.Matches("c", regexp.MustCompile(`^[A-Z]{3}$`)) }, true},
+		{"does not match", url.Values{"c": {"abc"}}, func(f *Form) bool { return f.Matches("c", regexp.MustCompile(`^[A-Z]{3}$`)) }, false},
+		{"in set", url.Values{"s": {"b"}}, func(f *Form) bool { return f.In("s", "a", "b") }, true},
+		{"not in set", url.Values{"s": {"c"}}, func(f *Form) bool { return f.In("s", "a", "b") }, false},
+		{"equal", url.Values{"p": {"x"}, "c": {"x"}}, func(f *Form) bool { return f.EqualTo("c", "p") }, true},
+		{"not equal", url.Values{"p": {"x"}, "c": {"y"}}, func(f *Form) bool { return f.EqualTo("c", "p") }, false},
+		{"date after", url.Values{"s": {"2025-01-01"}, "e": {"2025-01-03"}}, func(f *Form) bool { return f.DateAfter("e", "s", "2006-01-02") }, true},
+		{"same date", url.Values{"s": {"2025-01-01"}, "e": {"2025-01-01"}}, func(f *Form) bool { return f.DateAfter("e", "s", "2006-01-02") }, false},
+		{"bad date", url.Values{"s": {"2025-01-01"}, "e": {"tomorrow"}}, func(f *Form) bool { return f.DateAfter("e", "s", "2006-01-02") }, false},
+	}
+
+	for _, tt := range tests {
+		form := New(tt.values)
+		if got := tt.check(form); got != tt.valid {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.valid)
+		}
+		if form.Valid() != tt.valid {
+			t.Errorf("%s: form.Valid() is %v but errors are %v", tt.name, form.Valid(), form.Errors)
+		}
+	}
+}
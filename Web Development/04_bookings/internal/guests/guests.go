@@ -0,0 +1,175 @@
+// Package guests holds the rules for guest profiles: how repeat guests are recognised, when their personal
+// data may be erased and what an export of it contains. Like package promo it only holds the rules.
+package guests
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+// Anonymized names replace an erased guest's names on the profile and on their reservations
+const (
+	AnonymizedFirstName = "Anonymized"
+	AnonymizedLastName  = "Guest"
+)
+
+// Errors returned by CanAnonymize, worded for staff
+var (
+	ErrAnonymized   = errors.New("This guest's personal data has already been erased")
+	ErrUpcomingStay = errors.New("This guest has a stay that has not ended yet. Cancel it before erasing their data")
+)
+
+// NormalizeEmail returns the form of an email address guests are told apart by, so the same person is one
+// guest however they typed their address
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// AnonymizedEmail is stored in place of an erased guest's email. The id keeps it unique and the reserved
+// .invalid domain means nothing is ever delivered to it.
+func AnonymizedEmail(id int) string {
+	return fmt.Sprintf("anonymized-%d@guests.invalid", id)
+}
+
+// CanAnonymize checks that the personal data of g may be erased. Reservations that have not ended yet still
+// need the guest's contact details, so they have to be cancelled first.
+func CanAnonymize(g models.Guest, stays []models.Reservation, now time.Time) error {
+	if !g.AnonymizedAt.IsZero() {
+		return ErrAnonymized
+	}
+	today := models.Day(now)
+	for _, res := range stays {
+		if res.CancelledAt.IsZero() && !models.Day(res.EndDate).Before(today) {
+			return ErrUpcomingStay
+		}
+	}
+	return nil
+}
+
+// Export is everything stored about a guest, as handed to them when they ask for their data
+type Export struct {
+	ExportedAt   time.Time    `json:"exported_at"`
+	Guest        ExportGuest  `json:"guest"`
+	Reservations []ExportStay `json:"reservations"`
+	// Notifications are the channels the guest chose for each kind of notification
+	Notifications []ExportNotification `json:"notification_preferences"`
+}
+
+// ExportGuest is the guest's profile
+type ExportGuest struct {
+	ID           int        `json:"id"`
+	Email        string     `json:"email"`
+	FirstName    string     `json:"first_name"`
+	LastName     string     `json:"last_name"`
+	Phone        string     `json:"phone"`
+	Notes        string     `json:"notes"`
+	CreatedAt    time.Time  `json:"created_at"`
+	AnonymizedAt *time.Time `json:"anonymized_at,omitempty"`
+}
+
+// ExportNotification is whether the guest gets a kind of notification on a channel
+type ExportNotification struct {
+	Kind    string `json:"kind"`
+	Channel string `json:"channel"`
+	Enabled bool   `json:"enabled"`
+}
+
+// ExportStay is one reservation with the details the guest entered when booking it
+type ExportStay struct {
+	ID            int           `json:"id"`
+	Room          string        `json:"room"`
+	StartDate     string        `json:"start_date"`
+	EndDate       string        `json:"end_date"`
+	FirstName     string        `json:"first_name"`
+	LastName      string        `json:"last_name"`
+	Email         string        `json:"email"`
+	Phone         string        `json:"phone"`
+	Language      string        `json:"language"`
+	SubtotalCents int           `json:"subtotal_cents"`
+	DiscountCents int           `json:"discount_cents"`
+	TotalCents    int           `json:"total_cents"`
+	PromoCode     string        `json:"promo_code,omitempty"`
+	BookedAt      time.Time     `json:"booked_at"`
+	CancelledAt   *time.Time    `json:"cancelled_at,omitempty"`
+	PenaltyCents  int           `json:"penalty_cents,omitempty"`
+	RefundCents   int           `json:"refund_cents,omitempty"`
+	Review        *ExportReview `json:"review,omitempty"`
+}
+
+// ExportReview is the review the guest left for a stay
+type ExportReview struct {
+	Rating    int       `json:"rating"`
+	Body      string    `json:"body"`
+	Status    string    `json:"status"`
+	Reply     string    `json:"reply,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewExport puts together the export of g with their stays, the reviews left for them, keyed by
+// reservation id, and their notification preferences
+func NewExport(g models.Guest, stays []models.Reservation, reviews map[int]models.Review, prefs []models.NotificationPreference, at time.Time) Export {
+	e := Export{
+		ExportedAt: at,
+		Guest: ExportGuest{
+			ID:           g.ID,
+			Email:        g.Email,
+			FirstName:    g.FirstName,
+			LastName:     g.LastName,
+			Phone:        g.Phone,
+			Notes:        g.Notes,
+			CreatedAt:    g.CreatedAt,
+			AnonymizedAt: optionalTime(g.AnonymizedAt),
+		},
+		Reservations:  []ExportStay{},
+		Notifications: []ExportNotification{},
+	}
+
+	for _, res := range stays {
+		stay := ExportStay{
+			ID:            res.ID,
+			Room:          res.Room.RoomName,
+			StartDate:     res.StartDate.Format("2006-01-02"),
+			EndDate:       res.EndDate.Format("2006-01-02"),
+			FirstName:     res.FirstName,
+			LastName:      res.LastName,
+			Email:         res.Email,
+			Phone:         res.Phone,
+			Language:      res.Locale,
+			SubtotalCents: res.SubtotalCents,
+			DiscountCents: res.DiscountCents,
+			TotalCents:    res.TotalCents,
+			PromoCode:     res.PromoCode,
+			BookedAt:      res.CreatedAt,
+			CancelledAt:   optionalTime(res.CancelledAt),
+			PenaltyCents:  res.PenaltyCents,
+			RefundCents:   res.RefundCents,
+		}
+		if rv, ok := reviews[res.ID]; ok {
+			stay.Review = &ExportReview{
+				Rating:    rv.Rating,
+				Body:      rv.Body,
+				Status:    rv.Status,
+				Reply:     rv.Reply,
+				CreatedAt: rv.CreatedAt,
+			}
+		}
+		e.Reservations = append(e.Reservations, stay)
+	}
+
+	for _, p := range prefs {
+		e.Notifications = append(e.Notifications, ExportNotification{Kind: p.Kind, Channel: p.Channel, Enabled: p.Enabled})
+	}
+	return e
+}
+
+// optionalTime leaves zero times out of the export
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
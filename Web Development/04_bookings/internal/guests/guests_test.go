@@ -0,0 +1,85 @@
+package guests
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	if got := NormalizeEmail("  Ana@Example.COM "); got != "ana@example.com" {
+		t.Errorf("NormalizeEmail() = %q", got)
+	}
+	if got := AnonymizedEmail(7); got != "anonymized-7@guests.invalid" {
+		t.Errorf("AnonymizedEmail() = %q", got)
+	}
+}
+
+func TestCanAnonymize(t *testing.T) {
+	now := time.Date(2025, 7, 10, 15, 0, 0, 0, time.UTC)
+	past := models.Reservation{StartDate: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2025, 7, 9, 0, 0, 0, 0, time.UTC)}
+	leavingToday := models.Reservation{StartDate: time.Date(2025, 7, 8, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2025, 7, 10, 0, 0, 0, 0, time.UTC)}
+	upcoming := models.Reservation{StartDate: time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2025, 8, 3, 0, 0, 0, 0, time.UTC)}
+	cancelled := upcoming
+	cancelled.CancelledAt = time.Date(2025, 7, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		guest models.Guest
+		stays []models.Reservation
+		want  error
+	}{
+		{"past stays", models.Guest{}, []models.Reservation{past}, nil},
+		{"no stays", models.Guest{}, nil, nil},
+		{"cancelled stay", models.Guest{}, []models.Reservation{past, cancelled}, nil},
+		{"leaving today", models.Guest{}, []models.Reservation{leavingToday}, ErrUpcomingStay},
+		{"upcoming stay", models.Guest{}, []models.Reservation{past, upcoming}, ErrUpcomingStay},
+		{"already anonymized", models.Guest{AnonymizedAt: now}, nil, ErrAnonymized},
+	}
+	for _, tt := range tests {
+		if err := CanAnonymize(tt.guest, tt.stays, now); err != tt.want {
+			t.Errorf("%s: CanAnonymize() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestNewExport(t *testing.T) {
+	g := models.Guest{ID: 3, Email: "ana@example.com", FirstName: "Ana", LastName: "Lima", Notes: "Allergic to feathers"}
+	stays := []models.Reservation{
+		{ID: 10, FirstName: "Ana", Email: "Ana@Example.com", Room: models.Room{RoomName: "Major's Suite"},
+			StartDate: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2025, 7, 3, 0, 0, 0, 0, time.UTC), TotalCents: 36000},
+		{ID: 11, CancelledAt: time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC), PenaltyCents: 100},
+	}
+	reviews := map[int]models.Review{10: {Rating: 5, Body: "Lovely", Status: models.ReviewApproved}}
+
+	prefs := []models.NotificationPreference{{Kind: models.NotifyCheckIn, Channel: models.ChannelSMS, Enabled: true}}
+
+	e := NewExport(g, stays, reviews, prefs, time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+	if e.Guest.Notes != g.Notes || e.Guest.AnonymizedAt != nil || len(e.Reservations) != 2 {
+		t.Fatalf("unexpected export %+v", e)
+	}
+	if s := e.Reservations[0]; s.Room != "Major's Suite" || s.StartDate != "2025-07-01" || s.Review == nil || s.Review.Rating != 5 || s.CancelledAt != nil {
+		t.Errorf("unexpected stay %+v", s)
+	}
+	if s := e.Reservations[1]; s.Review != nil || s.CancelledAt == nil || s.PenaltyCents != 100 {
+		t.Errorf("unexpected cancelled stay %+v", s)
+	}
+
+	out, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"email":"ana@example.com"`, `"notes":"Allergic to feathers"`, `"body":"Lovely"`,
+		`"notification_preferences":[{"kind":"check_in","channel":"sms","enabled":true}]`} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected the JSON to contain %s", want)
+		}
+	}
+
+	if e := NewExport(models.Guest{ID: 4}, nil, nil, nil, time.Now()); e.Reservations == nil || e.Notifications == nil {
+		t.Error("expected empty lists of reservations and notification preferences rather than null")
+	}
+}
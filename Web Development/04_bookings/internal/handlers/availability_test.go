@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// availabilityRequest returns a search for the dates from start to end, flexible as the form field says
+func availabilityRequest(start, end, flexible string) *http.Request {
+	req := loggedInRequest("POST", "/search-availability", 0, url.Values{
+		"start":    {start},
+		"end":      {end},
+		"flexible": {flexible},
+	})
+	req.ParseForm()
+	return req
+}
+
+func TestRepository_PostAvailabilityPage(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       *http.Request
+		wantCode  int
+		wantStays []string
+		wantError string
+	}{
+		// the test repository has no room free on the exact dates, General's Quarters is booked throughout
+		// and Major's Suite is free
+		{"full dates offer nearby stays", availabilityRequest("2050-01-10", "2050-01-12", ""), http.StatusOK,
+			[]string{"id=2&s=2050-01-08&e=2050-01-10", "s=2050-01-09", "s=2050-01-11", "s=2050-01-12"}, ""},
+		{"a week either side", availabilityRequest("2050-01-10", "2050-01-12", "7"), http.StatusOK,
+			[]string{"s=2050-01-08", "s=2050-01-12"}, ""},
+		{"anywhere in the month", availabilityRequest("2050-01-10", "2050-01-12", "month"), http.StatusOK,
+			[]string{"s=2050-01-08", "s=2050-01-12"}, ""},
+		{"unknown flexibility searches near the dates", availabilityRequest("2050-01-10", "2050-01-12", "90"), http.StatusOK,
+			[]string{"s=2050-01-09"}, ""},
+		{"no stay of no nights", availabilityRequest("2050-01-10", "2050-01-10", ""), http.StatusSeeOther, nil, "No availability"},
+		{"invalid start date", availabilityRequest("invalid", "2050-01-12", ""), http.StatusInternalServerError, nil, ""},
+		{"database error", availabilityRequest("2101-01-10", "2101-01-12", ""), http.StatusInternalServerError, nil, ""},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostAvailabilityPage).ServeHTTP(rr, tt.req)
+
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s: got status %d, wanted %d", tt.name, rr.Code, tt.wantCode)
+		}
+		body := rr.Body.String()
+		for _, stay := range tt.wantStays {
+			if !strings.Contains(body, stay) {
+				t.Errorf("%s: expected a stay linking to %s", tt.name, stay)
+			}
+		}
+		if tt.wantStays != nil {
+			if !strings.Contains(body, `id="alternatives"`) || strings.Contains(body, "id=1&") {
+				t.Errorf("%s: expected stays in Major's Suite only", tt.name)
+			}
+			if strings.Contains(body, "s=2050-01-10&e=2050-01-12") {
+				t.Errorf("%s: expected the requested dates not to be offered again", tt.name)
+			}
+		}
+		if got := session.GetString(tt.req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+}
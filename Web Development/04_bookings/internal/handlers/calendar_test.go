@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/calendar"
+	"github.com/ashparshp/bookings/internal/events"
+	"github.com/ashparshp/bookings/internal/webhooks"
+)
+
+// january is the version of General's Quarters in January 2050 in the test repository, with reservation
+// 1 from the 10th to the 12th and block 2 on the 20th
+func january(t *testing.T) string {
+	t.Helper()
+	restrictions, err := Repo.DB.GetRestrictionsForRoomByDate(loggedInRequest("GET", "/", 0, nil).Context(), 1, time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2050, 2, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return calendar.Version(restrictions)
+}
+
+func TestRepository_AdminReservationCalendarPage(t *testing.T) {
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminReservationCalendarPage).ServeHTTP(rr, loggedInRequest("GET", "/admin/reservations-calendar?y=2050&m=1", 1, nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		`name="version_1" value="` + january(t) + `"`,
+		`name="version_2" value="` + calendar.Version(nil) + `"`,
+		`name="block_1" value="2"`,
+		`name="remove_block_1_2050-01-20"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected the calendar to contain %s", want)
+		}
+	}
+}
+
+func TestRepository_AdminPostReservationCalendarPage(t *testing.T) {
+	bus := Repo.Events
+	defer func() { Repo.Events = bus }()
+
+	tests := []struct {
+		name        string
+		form        url.Values
+		wantAdded   []string
+		wantRemoved []int
+		wantWarning string
+		wantError   string
+	}{
+		{
+			name: "up to date",
+			form: url.Values{
+				"y": {"2050"}, "m": {"1"}, "version_1": {january(t)}, "version_2": {calendar.Version(nil)},
+				"block_1": {"2"}, "remove_block_1_2050-01-20": {"2"}, "add_block_2_2050-01-5": {"1"},
+			},
+			wantAdded: []string{"2050-01-05"},
+		},
+		{
+			name: "unticked block",
+			form: url.Values{
+				"y": {"2050"}, "m": {"1"}, "version_1": {january(t)}, "version_2": {calendar.Version(nil)},
+				"block_1": {"2"},
+			},
+			wantRemoved: []int{2},
+		},
+		{
+			// the page was loaded before the reservation and the block were made
+			name: "stale page",
+			form: url.Values{
+				"y": {"2050"}, "m": {"1"}, "version_1": {calendar.Version(nil)}, "version_2": {calendar.Version(nil)},
+				"add_block_1_2050-01-11": {"1"}, "add_block_1_2050-01-20": {"1"}, "add_block_1_2050-01-25": {"1"},
+			},
+			wantAdded:   []string{"2050-01-25"},
+			wantWarning: "These days were booked after you opened the calendar and were not blocked: General's Quarters on January 11",
+		},
+		{
+			// a block the stale page showed has gone, and the block on the 20th was not on it
+			name: "stale removal",
+			form: url.Values{
+				"y": {"2050"}, "m": {"1"}, "version_1": {"0123456789abcdef"}, "version_2": {calendar.Version(nil)},
+				"block_1": {"7"},
+			},
+			wantWarning: "Someone else changed General's Quarters while you had the calendar open. Your changes were saved on top of theirs.",
+		},
+		{
+			name:        "no versions",
+			form:        url.Values{"y": {"2050"}, "m": {"2"}},
+			wantWarning: "Someone else changed General's Quarters, Major's Suite while you had the calendar open. Your changes were saved on top of theirs.",
+		},
+		{
+			name:      "invalid month",
+			form:      url.Values{"y": {"2050"}, "m": {"13"}},
+			wantError: "Invalid month",
+		},
+		{
+			name:      "invalid room",
+			form:      url.Values{"y": {"2050"}, "m": {"1"}, "add_block_x_2050-01-5": {"1"}},
+			wantError: "Invalid room ID",
+		},
+		{
+			name:      "invalid date",
+			form:      url.Values{"y": {"2050"}, "m": {"1"}, "add_block_1_tomorrow": {"1"}},
+			wantError: "Invalid date format",
+		},
+	}
+
+	for _, tt := range tests {
+		Repo.Events = events.NewBus()
+		sub := Repo.Events.Subscribe()
+
+		req := loggedInRequest("POST", "/admin/reservations-calendar", 1, tt.form)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostReservationCalendarPage).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: got status %d, wanted %d", tt.name, rr.Code, http.StatusSeeOther)
+		}
+
+		var added []string
+		var removed []int
+		Repo.Events.Close()
+		for e := range sub.C {
+			b := e.Data.(webhooks.Block)
+			switch e.Name {
+			case webhooks.BlockAdded:
+				added = append(added, b.Date)
+			case webhooks.BlockRemoved:
+				removed = append(removed, b.ID)
+			}
+		}
+		if strings.Join(added, ",") != strings.Join(tt.wantAdded, ",") {
+			t.Errorf("%s: expected blocks added on %v, got %v", tt.name, tt.wantAdded, added)
+		}
+		if len(removed) != len(tt.wantRemoved) || (len(removed) > 0 && removed[0] != tt.wantRemoved[0]) {
+			t.Errorf("%s: expected blocks %v removed, got %v", tt.name, tt.wantRemoved, removed)
+		}
+
+		if got := session.GetString(req.Context(), "warning"); got != tt.wantWarning {
+			t.Errorf("%s: expected warning %q, got %q", tt.name, tt.wantWarning, got)
+		}
+		if got := session.GetString(req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/cancellation"
+	"github.com/ashparshp/bookings/internal/forms"
+	"github.com/ashparshp/bookings/internal/helpers"
+	"github.com/ashparshp/bookings/internal/i18n"
+	"github.com/ashparshp/bookings/internal/logger"
+	"github.com/ashparshp/bookings/internal/metrics"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/render"
+	"github.com/ashparshp/bookings/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+)
+
+// cancellationPolicy returns the policy with id, or the zero policy, which cancels free of charge, for
+// reservations booked before there were policies
+func (m *Repository) cancellationPolicy(r *http.Request, id int) (models.CancellationPolicy, error) {
+	if id == 0 {
+		return models.CancellationPolicy{}, nil
+	}
+	return m.DB.GetCancellationPolicyByID(r.Context(), id)
+}
+
+// cancellationTerms returns the terms of a policy in the guest's language
+func cancellationTerms(locale *i18n.Locale, p models.CancellationPolicy) []string {
+	var terms []string
+	for _, t := range cancellation.Terms(p) {
+		terms = append(terms, locale.T(t.Message, t.Args...))
+	}
+	return terms
+}
+
+// guestCancellationTerms returns the terms of the policy with id for a page or email shown after the guest
+// chose their room. The terms were on the reservation page already, so if they cannot be loaded now the
+// error is logged and they are left out rather than failing the booking.
+func (m *Repository) guestCancellationTerms(r *http.Request, locale *i18n.Locale, id int) []string {
+	p, err := m.cancellationPolicy(r, id)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can't load cancellation policy", "cancellation_policy_id", id, "error", err)
+		return nil
+	}
+	return cancellationTerms(locale, p)
+}
+
+// cancellationLines is the part of a confirmation email listing the cancellation terms, empty without them
+func cancellationLines(locale *i18n.Locale, terms []string) string {
+	if len(terms) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("<br>" + locale.T("Cancellation policy:") + "<br>")
+	for _, t := range terms {
+		b.WriteString("- " + template.HTMLEscapeString(t) + "<br>")
+	}
+	return b.String()
+}
+
+// AdminPostCancelReservation cancels a reservation under the policy it was booked with, records the
+// penalty and refund and tells the guest
+func (m *Repository) AdminPostCancelReservation(w http.ResponseWriter, r *http.Request) {
+	src := chi.URLParam(r, "src")
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid reservation ID")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+	showPage := fmt.Sprintf("/admin/reservations/%s/%d/show", src, id)
+	log := logger.FromContext(r.Context()).With("reservation_id", id)
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		log.Error("can't get reservation to cancel", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to retrieve reservation")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+	if !res.CancelledAt.IsZero() {
+		m.App.Session.Put(r.Context(), "error", "This reservation is already cancelled")
+		http.Redirect(w, r, showPage, http.StatusSeeOther)
+		return
+	}
+
+	policy, err := m.cancellationPolicy(r, res.CancellationPolicyID)
+	if err != nil {
+		log.Error("can't load cancellation policy", "cancellation_policy_id", res.CancellationPolicyID, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to cancel reservation")
+		http.Redirect(w, r, showPage, http.StatusSeeOther)
+		return
+	}
+
+	now := time.Now()
+	outcome := cancellation.Compute(policy, res, now)
+	err = m.DB.CancelReservation(r.Context(), id, now, outcome.PenaltyCents, outcome.RefundCents)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "This reservation is already cancelled")
+		http.Redirect(w, r, showPage, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Error("can't cancel reservation", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to cancel reservation")
+		http.Redirect(w, r, showPage, http.StatusSeeOther)
+		return
+	}
+
+	metrics.ReservationsCancelled.Inc()
+	res.CancelledAt = now
+	res.PenaltyCents = outcome.PenaltyCents
+	res.RefundCents = outcome.RefundCents
+	m.publish(r, webhooks.ReservationCancelled, webhooks.NewReservation(res))
+	log.Info("reservation cancelled", "penalty_cents", outcome.PenaltyCents, "refund_cents", outcome.RefundCents,
+		"user_id", m.App.Session.GetInt(r.Context(), "user_id"))
+
+	locale, ok := i18n.Get(res.Locale)
+	if !ok {
+		locale = i18n.Default()
+	}
+	htmlMessage := fmt.Sprintf(`
+	<strong>%s</strong><br>
+	%s<br>
+	%s<br>
+	%s<br>
+	%s<br>
+	`, locale.T("Reservation Cancelled"),
+		locale.T("Dear %s,", template.HTMLEscapeString(res.FirstName)),
+		locale.T("Your reservation from %s to %s has been cancelled.", locale.Date(res.StartDate), locale.Date(res.EndDate)),
+		locale.T("Cancellation fee: %s", locale.Money(outcome.PenaltyCents)),
+		locale.T("Refund: %s", locale.Money(outcome.RefundCents)))
+
+	m.sendNotification(r, models.Notification{
+		Kind:     models.NotifyCancellation,
+		To:       res.Email,
+		Phone:    res.Phone,
+		From:     m.App.MailConfig.FromAddress,
+		Subject:  locale.T("Reservation Cancelled"),
+		Content:  htmlMessage,
+		Text:     locale.T("Your reservation from %s to %s has been cancelled.", locale.Date(res.StartDate), locale.Date(res.EndDate)),
+		Template: "basic.html",
+		Locale:   locale.Code,
+	})
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Reservation cancelled with a fee of %s and a refund of %s",
+		i18n.Default().Money(outcome.PenaltyCents), i18n.Default().Money(outcome.RefundCents)))
+	http.Redirect(w, r, showPage, http.StatusSeeOther)
+}
+
+// renderCancellationPoliciesPage shows the policies, the rooms they apply to and the form for a new one
+func (m *Repository) renderCancellationPoliciesPage(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	policies, err := m.DB.AllCancellationPolicies(r.Context())
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to retrieve cancellation policies", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to retrieve cancellation policies")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to retrieve rooms", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to retrieve rooms")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	terms := make(map[int][]string, len(policies))
+	for _, p := range policies {
+		terms[p.ID] = cancellationTerms(i18n.Default(), p)
+	}
+
+	data := make(map[string]interface{})
+	data["policies"] = policies
+	data["terms"] = terms
+	data["rooms"] = rooms
+	data["tier_rows"] = tierRows(form)
+
+	render.Template(w, r, "admin-cancellation-policies.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// tierRow is a row of the tiers on the new cancellation policy form
+type tierRow struct {
+	DaysBefore     string
+	PenaltyPercent string
+}
+
+// tierRows returns the tier rows of the form with the values posted, if any
+func tierRows(form *forms.Form) []tierRow {
+	rows := make([]tierRow, maxCancellationTiers)
+	for i := range rows {
+		rows[i].DaysBefore = formValue(form.Values["days_before"], i)
+		rows[i].PenaltyPercent = formValue(form.Values["penalty_percent"], i)
+	}
+	return rows
+}
+
+// AdminCancellationPoliciesPage lists the cancellation policies and which rooms use them
+func (m *Repository) AdminCancellationPoliciesPage(w http.ResponseWriter, r *http.Request) {
+	m.renderCancellationPoliciesPage(w, r, forms.New(nil))
+}
+
+// AdminPostCancellationPolicy creates a cancellation policy
+func (m *Repository) AdminPostCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	var posted cancellationPolicyForm
+	if err := form.Bind(&posted); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	policy := posted.policy(form)
+
+	if !form.Valid() {
+		m.renderCancellationPoliciesPage(w, r, form)
+		return
+	}
+
+	id, err := m.DB.InsertCancellationPolicy(r.Context(), policy)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to save cancellation policy", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to save cancellation policy")
+		http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("cancellation policy created", "cancellation_policy_id", id)
+	m.App.Session.Put(r.Context(), "flash", "Cancellation policy "+policy.Name+" created")
+	http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+}
+
+// AdminPostRoomCancellationPolicy changes the policy new reservations of a room are booked under.
+// Existing reservations keep the policy they were booked with.
+func (m *Repository) AdminPostRoomCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid room ID")
+		http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+		return
+	}
+	policyID, err := strconv.Atoi(r.Form.Get("cancellation_policy_id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid cancellation policy")
+		http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+		return
+	}
+
+	if _, err := m.DB.GetCancellationPolicyByID(r.Context(), policyID); err != nil {
+		logger.FromContext(r.Context()).Warn("unknown cancellation policy", "cancellation_policy_id", policyID, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Invalid cancellation policy")
+		http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+		return
+	}
+
+	if err := m.DB.SetRoomCancellationPolicy(r.Context(), roomID, policyID); err != nil {
+		logger.FromContext(r.Context()).Error("unable to set cancellation policy", "room_id", roomID, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to update room")
+		http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("room cancellation policy changed", "room_id", roomID, "cancellation_policy_id", policyID)
+	m.App.Session.Put(r.Context(), "flash", "Cancellation policy of the room updated")
+	http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+}
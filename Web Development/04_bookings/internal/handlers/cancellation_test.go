@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRepository_AdminPostCancelReservation(t *testing.T) {
+	tests := []struct {
+		name         string
+		id           string
+		wantLocation string
+		wantFlash    string
+		wantError    string
+	}{
+		{"within the last tier", "2", "/admin/reservations/all/2/show", "Reservation cancelled with a fee of $120.00 and a refund of $120.00", ""},
+		{"booked before policies", "1", "/admin/reservations/all/1/show", "Reservation cancelled with a fee of $0.00 and a refund of $0.00", ""},
+		{"already cancelled", "4", "/admin/reservations/all/4/show", "", "This reservation is already cancelled"},
+		{"invalid id", "abc", "/admin/dashboard", "", "Invalid reservation ID"},
+		{"missing reservation", "2000", "/admin/dashboard", "", "Unable to retrieve reservation"},
+	}
+
+	for _, tt := range tests {
+		req := loggedInRequest("POST", "/admin/reservations/all/"+tt.id+"/cancel", 1, url.Values{})
+		req = withURLParam(req, "id", tt.id)
+		chi.RouteContext(req.Context()).URLParams.Add("src", "all")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostCancelReservation).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != tt.wantLocation {
+			t.Errorf("%s: expected a redirect to %s, got %d %s", tt.name, tt.wantLocation, rr.Code, rr.Header().Get("Location"))
+		}
+		if got := session.GetString(req.Context(), "flash"); got != tt.wantFlash {
+			t.Errorf("%s: expected flash %q, got %q", tt.name, tt.wantFlash, got)
+		}
+		if got := session.GetString(req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+}
+
+func TestRepository_AdminShowReservationCancellation(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want []string
+	}{
+		{"open", "2", []string{"Standard", "Free cancellation until 7 days before arrival", "Cancelling today costs 50% of the total", `id="cancel-form"`}},
+		{"cancelled", "4", []string{"Cancelled on", "$120.00"}},
+		{"booked before policies", "1", []string{"Booked before cancellation policies", "Free cancellation at any time"}},
+	}
+
+	for _, tt := range tests {
+		req := loggedInRequest("GET", "/admin/reservations/all/"+tt.id+"/show", 1, nil)
+		req.RequestURI = "/admin/reservations/all/" + tt.id + "/show"
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminShowReservationPage).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: got status %d, wanted %d", tt.name, rr.Code, http.StatusOK)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(rr.Body.String(), want) {
+				t.Errorf("%s: expected the page to contain %q", tt.name, want)
+			}
+		}
+		if tt.id == "4" && strings.Contains(rr.Body.String(), `id="cancel-form"`) {
+			t.Errorf("%s: expected no cancel form for a cancelled reservation", tt.name)
+		}
+	}
+}
+
+func TestRepository_ReservationCancellationTerms(t *testing.T) {
+	req := loggedInRequest("GET", "/make-reservation", 0, nil)
+	session.Put(req.Context(), "reservation", models.Reservation{RoomID: 1})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.ReservationPage).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	for _, want := range []string{"Free cancellation until 7 days before arrival", "50% of the total for cancelling later, until the day of arrival"} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("expected the page to contain %q", want)
+		}
+	}
+}
+
+func TestRepository_AdminCancellationPoliciesPage(t *testing.T) {
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminCancellationPoliciesPage).ServeHTTP(rr, loggedInRequest("GET", "/admin/cancellation-policies", 1, nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	for _, want := range []string{"Standard", "Free cancellation until 7 days before arrival", `action="/admin/cancellation-policies"`} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("expected the page to contain %q", want)
+		}
+	}
+}
+
+func TestRepository_AdminPostCancellationPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		form      url.Values
+		wantCode  int
+		wantBody  string
+		wantFlash string
+		wantError string
+	}{
+		{"valid", url.Values{"name": {"Flexible"}, "days_before": {"1", ""}, "penalty_percent": {"0", ""}}, http.StatusSeeOther, "", "Cancellation policy Flexible created", ""},
+		{"no tiers", url.Values{"name": {"Flexible"}, "days_before": {""}, "penalty_percent": {""}}, http.StatusOK, "Add at least one tier", "", ""},
+		{"cheaper later", url.Values{"name": {"Odd"}, "days_before": {"30", "3"}, "penalty_percent": {"50", "10"}}, http.StatusOK, "Penalties cannot go down closer to arrival", "", ""},
+		{"not a number", url.Values{"name": {"Odd"}, "days_before": {"a week"}, "penalty_percent": {"10"}}, http.StatusOK, "Each tier needs a whole number of days and a whole percentage", "", ""},
+		{"short name", url.Values{"name": {"x"}, "days_before": {"1"}, "penalty_percent": {"0"}}, http.StatusOK, "is-invalid", "", ""},
+		{"database error", url.Values{"name": {"FAIL"}, "days_before": {"1"}, "penalty_percent": {"0"}}, http.StatusSeeOther, "", "", "Unable to save cancellation policy"},
+	}
+
+	for _, tt := range tests {
+		req := loggedInRequest("POST", "/admin/cancellation-policies", 1, tt.form)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostCancellationPolicy).ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s: got status %d, wanted %d", tt.name, rr.Code, tt.wantCode)
+		}
+		if tt.wantBody != "" && !strings.Contains(rr.Body.String(), tt.wantBody) {
+			t.Errorf("%s: expected the page to contain %q", tt.name, tt.wantBody)
+		}
+		if got := session.GetString(req.Context(), "flash"); got != tt.wantFlash {
+			t.Errorf("%s: expected flash %q, got %q", tt.name, tt.wantFlash, got)
+		}
+		if got := session.GetString(req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+}
+
+func TestRepository_AdminPostRoomCancellationPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		roomID    string
+		policyID  string
+		wantFlash string
+		wantError string
+	}{
+		{"valid", "1", "1", "Cancellation policy of the room updated", ""},
+		{"unknown policy", "1", "9", "", "Invalid cancellation policy"},
+		{"invalid policy", "1", "", "", "Invalid cancellation policy"},
+		{"unknown room", "99", "1", "", "Unable to update room"},
+		{"invalid room", "abc", "1", "", "Invalid room ID"},
+	}
+
+	for _, tt := range tests {
+		form := url.Values{"cancellation_policy_id": {tt.policyID}}
+		req := withURLParam(loggedInRequest("POST", "/admin/rooms/"+tt.roomID+"/cancellation-policy", 1, form), "id", tt.roomID)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostRoomCancellationPolicy).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/cancellation-policies" {
+			t.Errorf("%s: expected a redirect to /admin/cancellation-policies, got %d %s", tt.name, rr.Code, rr.Header().Get("Location"))
+		}
+		if got := session.GetString(req.Context(), "flash"); got != tt.wantFlash {
+			t.Errorf("%s: expected flash %q, got %q", tt.name, tt.wantFlash, got)
+		}
+		if got := session.GetString(req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+}
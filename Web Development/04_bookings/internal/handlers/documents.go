@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/documents"
+	"github.com/ashparshp/bookings/internal/i18n"
+	"github.com/ashparshp/bookings/internal/links"
+	"github.com/ashparshp/bookings/internal/logger"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// documentLinkLifetime is how long after check-out the download links given to a guest keep working
+const documentLinkLifetime = 365 * 24 * time.Hour
+
+// documentURL returns the signed link a guest downloads the document of kind for res with
+func (m *Repository) documentURL(res models.Reservation, kind string) string {
+	token := links.Sign(m.App.SigningKey, links.Documents, res.ID, res.EndDate.Add(documentLinkLifetime))
+	return "/reservations/" + token + "/" + kind
+}
+
+// reservationDocument returns the PDF of the document of kind for res, in the language the guest booked in
+func (m *Repository) reservationDocument(r *http.Request, kind string, res models.Reservation) ([]byte, error) {
+	locale, ok := i18n.Get(res.Locale)
+	if !ok {
+		locale = i18n.Default()
+	}
+	var terms []string
+	if kind == documents.Confirmation {
+		terms = m.guestCancellationTerms(r, locale, res.CancellationPolicyID)
+	}
+	return documents.Render(kind, m.App.Property, locale, res, terms)
+}
+
+// confirmationAttachment is the booking confirmation of res to attach to the email sent when it is booked.
+// Without it the email still goes out, so a failure is logged.
+func (m *Repository) confirmationAttachment(r *http.Request, res models.Reservation) []models.Attachment {
+	b, err := m.reservationDocument(r, documents.Confirmation, res)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can't render booking confirmation", "reservation_id", res.ID, "error", err)
+		return nil
+	}
+	return []models.Attachment{{
+		Name:        documents.Filename(documents.Confirmation, res),
+		ContentType: "application/pdf",
+		Data:        b,
+	}}
+}
+
+// writeDocument sends a rendered document as a download
+func writeDocument(w http.ResponseWriter, kind string, res models.Reservation, b []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": documents.Filename(kind, res)}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	// the documents hold the guest's personal details
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(b)
+}
+
+// ReservationDocument downloads the confirmation or invoice of the reservation a signed link is for
+func (m *Repository) ReservationDocument(w http.ResponseWriter, r *http.Request) {
+	locale := i18n.FromContext(r.Context())
+	kind := chi.URLParam(r, "kind")
+	if !documents.IsKind(kind) {
+		http.NotFound(w, r)
+		return
+	}
+
+	id, err := links.Verify(m.App.SigningKey, links.Documents, chi.URLParam(r, "token"), time.Now())
+	if err != nil {
+		message := "This download link is not valid"
+		if errors.Is(err, links.ErrExpired) {
+			message = "This download link has expired"
+		}
+		m.App.Session.Put(r.Context(), "error", locale.T(message))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can't get reservation for document", "reservation_id", id, "error", err)
+		m.App.Session.Put(r.Context(), "error", locale.T("This download link is not valid"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	b, err := m.reservationDocument(r, kind, res)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can't render document", "kind", kind, "reservation_id", id, "error", err)
+		m.App.Session.Put(r.Context(), "error", locale.T("This download link is not valid"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	writeDocument(w, kind, res, b)
+}
+
+// AdminReservationDocument downloads the confirmation or invoice of a reservation, as the guest has it
+func (m *Repository) AdminReservationDocument(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, "kind")
+	if !documents.IsKind(kind) {
+		http.NotFound(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid reservation ID")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+	back := "/admin/reservations/" + chi.URLParam(r, "src") + "/" + strconv.Itoa(id) + "/show"
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can't get reservation for document", "reservation_id", id, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to retrieve reservation")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	b, err := m.reservationDocument(r, kind, res)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can't render document", "kind", kind, "reservation_id", id, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to create the document")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	writeDocument(w, kind, res, b)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/links"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// documentRequest returns a request for a document of reservationID through a link valid for ttl
+func documentRequest(reservationID int, kind string, ttl time.Duration) *http.Request {
+	token := links.Sign(app.SigningKey, links.Documents, reservationID, time.Now().Add(ttl))
+	req := withURLParam(loggedInRequest("GET", "/reservations/"+token+"/"+kind, 0, nil), "token", token)
+	chi.RouteContext(req.Context()).URLParams.Add("kind", kind)
+	return req
+}
+
+func TestRepository_ReservationDocument(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          *http.Request
+		wantCode     int
+		wantFilename string
+		wantError    string
+	}{
+		{"confirmation", documentRequest(1, "confirmation", time.Hour), http.StatusOK, "confirmation-BK-000001.pdf", ""},
+		{"invoice", documentRequest(4, "invoice", time.Hour), http.StatusOK, "invoice-INV-000004.pdf", ""},
+		{"unknown kind", documentRequest(1, "receipt", time.Hour), http.StatusNotFound, "", ""},
+		{"expired link", documentRequest(1, "invoice", -time.Hour), http.StatusSeeOther, "", "This download link has expired"},
+		{"unknown reservation", documentRequest(2000, "invoice", time.Hour), http.StatusSeeOther, "", "This download link is not valid"},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.ReservationDocument).ServeHTTP(rr, tt.req)
+
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s: got status %d, wanted %d", tt.name, rr.Code, tt.wantCode)
+		}
+		if tt.wantFilename != "" {
+			if got := rr.Header().Get("Content-Type"); got != "application/pdf" {
+				t.Errorf("%s: expected a PDF, got %q", tt.name, got)
+			}
+			if got := rr.Header().Get("Content-Disposition"); got != "attachment; filename="+tt.wantFilename {
+				t.Errorf("%s: expected the download to be named %s, got %q", tt.name, tt.wantFilename, got)
+			}
+			if !bytes.HasPrefix(rr.Body.Bytes(), []byte("%PDF-")) {
+				t.Errorf("%s: expected a PDF body", tt.name)
+			}
+		}
+		if got := session.GetString(tt.req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+
+	// a review link is not accepted for documents
+	token := links.Sign(app.SigningKey, links.Review, 1, time.Now().Add(time.Hour))
+	req := withURLParam(loggedInRequest("GET", "/reservations/"+token+"/invoice", 0, nil), "token", token)
+	chi.RouteContext(req.Context()).URLParams.Add("kind", "invoice")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.ReservationDocument).ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther || session.GetString(req.Context(), "error") != "This download link is not valid" {
+		t.Errorf("review link: expected a redirect with an error, got %d", rr.Code)
+	}
+}
+
+func TestRepository_AdminReservationDocument(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        string
+		kind      string
+		wantCode  int
+		wantError string
+	}{
+		{"confirmation", "1", "confirmation", http.StatusOK, ""},
+		{"invoice", "4", "invoice", http.StatusOK, ""},
+		{"unknown kind", "1", "receipt", http.StatusNotFound, ""},
+		{"invalid id", "abc", "invoice", http.StatusSeeOther, "Invalid reservation ID"},
+		{"database error", "2000", "invoice", http.StatusSeeOther, "Unable to retrieve reservation"},
+	}
+
+	for _, tt := range tests {
+		req := withURLParam(loggedInRequest("GET", "/admin/reservations/all/"+tt.id+"/documents/"+tt.kind, 1, nil), "id", tt.id)
+		chi.RouteContext(req.Context()).URLParams.Add("src", "all")
+		chi.RouteContext(req.Context()).URLParams.Add("kind", tt.kind)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminReservationDocument).ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s: got status %d, wanted %d", tt.name, rr.Code, tt.wantCode)
+		}
+		if tt.wantCode == http.StatusOK && !bytes.HasPrefix(rr.Body.Bytes(), []byte("%PDF-")) {
+			t.Errorf("%s: expected a PDF body", tt.name)
+		}
+		if got := session.GetString(req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+}
+
+func TestRepository_ConfirmationAttachment(t *testing.T) {
+	res := models.Reservation{
+		ID:        7,
+		FirstName: "John",
+		LastName:  "Smith",
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		Locale:    "es",
+		Room:      models.Room{ID: 1, RoomName: "General's Quarters"},
+	}
+	attachments := Repo.confirmationAttachment(loggedInRequest("POST", "/make-reservation", 0, nil), res)
+
+	if len(attachments) != 1 {
+		t.Fatalf("expected the confirmation attached, got %d attachments", len(attachments))
+	}
+	a := attachments[0]
+	if a.Name != "confirmation-BK-000007.pdf" || a.ContentType != "application/pdf" || !bytes.HasPrefix(a.Data, []byte("%PDF-")) {
+		t.Errorf("unexpected attachment %s %s", a.Name, a.ContentType)
+	}
+	// printed in the language the guest booked in
+	if !bytes.Contains(a.Data, []byte("Confirmaci\xf3n de reserva")) {
+		t.Error("expected the confirmation in Spanish")
+	}
+
+	url := Repo.documentURL(res, "invoice")
+	if !strings.HasPrefix(url, "/reservations/") || !strings.HasSuffix(url, "/invoice") {
+		t.Errorf("unexpected document link %q", url)
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/logger"
+)
+
+const (
+	// eventsHeartbeat keeps a quiet stream open through proxies that close idle connections
+	eventsHeartbeat = 25 * time.Second
+	// eventsRetry is how long the browser waits before reconnecting a dropped stream
+	eventsRetry = 5 * time.Second
+)
+
+// pendingEvent carries the number of reservations waiting to be processed, for the badge in the menu
+const pendingEvent = "pending"
+
+// AdminEvents streams reservation and calendar changes to the admin pages as server-sent events, named
+// like the webhook events with the same JSON data. The stream starts with a pending event holding the
+// number of new reservations, which is sent again after every reservation event.
+func (m *Repository) AdminEvents(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context())
+	rc := http.NewResponseController(w)
+
+	sub := m.Events.Subscribe()
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// keeps nginx and similar proxies from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", eventsRetry.Milliseconds())
+	m.writePendingCount(w, r)
+	if err := rc.Flush(); err != nil {
+		log.Error("cannot stream admin events", "error", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				// the server is shutting down or this stream fell behind; the browser reconnects
+				return
+			}
+			if err := writeEvent(w, e.Name, e.Data); err != nil {
+				log.Error("cannot encode admin event", "event", e.Name, "error", err)
+				continue
+			}
+			if strings.HasPrefix(e.Name, "reservation.") {
+				m.writePendingCount(w, r)
+			}
+		case <-heartbeat.C:
+			io.WriteString(w, ": ping\n\n")
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writePendingCount sends the number of reservations waiting to be processed. If it cannot be counted
+// the badge keeps its old number until the next reservation event.
+func (m *Repository) writePendingCount(w io.Writer, r *http.Request) {
+	pending, err := m.DB.AllNewReservations(r.Context())
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to count new reservations", "error", err)
+		return
+	}
+	writeEvent(w, pendingEvent, map[string]int{"count": len(pending)})
+}
+
+// writeEvent writes one server-sent event with data encoded as JSON. The encoding holds no newlines, so
+// it fits on a single data line.
+func writeEvent(w io.Writer, name string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, b)
+	return err
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/events"
+	"github.com/go-chi/chi/v5"
+)
+
+// sseEvent is one event read off a server-sent event stream
+type sseEvent struct {
+	name string
+	data string
+}
+
+// readSSE reads server-sent events from body onto the returned channel, which is closed when the stream
+// ends. Comments and retry lines are skipped.
+func readSSE(body io.Reader) <-chan sseEvent {
+	ch := make(chan sseEvent)
+	go func() {
+		defer close(ch)
+		var e sseEvent
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if e.name != "" || e.data != "" {
+					ch <- e
+				}
+				e = sseEvent{}
+			case strings.HasPrefix(line, "event: "):
+				e.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				e.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return ch
+}
+
+func nextSSE(t *testing.T, stream <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case e, ok := <-stream:
+		if !ok {
+			t.Fatal("the event stream ended early")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return sseEvent{}
+}
+
+func TestRepository_AdminEvents(t *testing.T) {
+	bus := Repo.Events
+	Repo.Events = events.NewBus()
+	defer func() { Repo.Events = bus }()
+
+	srv := httptest.NewServer(http.HandlerFunc(Repo.AdminEvents))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("expected an event stream, got content type %q", got)
+	}
+	stream := readSSE(resp.Body)
+
+	if e := nextSSE(t, stream); e.name != "pending" || e.data != `{"count":0}` {
+		t.Errorf("expected the stream to start with the pending count, got %+v", e)
+	}
+
+	// a handler's change reaches the stream, followed by the new pending count
+	req := withURLParam(loggedInRequest("GET", "/admin/process-reservation/new/1/do", 1, nil), "id", "1")
+	chi.RouteContext(req.Context()).URLParams.Add("src", "new")
+	http.HandlerFunc(Repo.AdminProcessReservationPage).ServeHTTP(httptest.NewRecorder(), req)
+
+	e := nextSSE(t, stream)
+	var data struct {
+		ID int `json:"id"`
+	}
+	if e.name != "reservation.processed" || json.Unmarshal([]byte(e.data), &data) != nil || data.ID != 1 {
+		t.Errorf("expected the processed reservation, got %+v", e)
+	}
+	if e := nextSSE(t, stream); e.name != "pending" {
+		t.Errorf("expected the pending count after a reservation event, got %+v", e)
+	}
+
+	Repo.Events.Publish(events.Event{Name: "block.added", Data: map[string]any{"room_id": 1, "date": "2050-01-02"}})
+	if e := nextSSE(t, stream); e.name != "block.added" || e.data != `{"date":"2050-01-02","room_id":1}` {
+		t.Errorf("expected the block event, got %+v", e)
+	}
+
+	// closing the bus, as the server does when it shuts down, ends the stream
+	Repo.Events.Close()
+	select {
+	case e, ok := <-stream:
+		if ok {
+			t.Errorf("expected the stream to end, got %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected the stream to end when the bus closes")
+	}
+	if _, err := resp.Body.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("expected the response to be finished, got %v", err)
+	}
+}
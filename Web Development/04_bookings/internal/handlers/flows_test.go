@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/events"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/repository/dbrepo"
+	"github.com/ashparshp/bookings/internal/webhooks"
+)
+
+// useMemoryRepo makes the handlers use an in-memory database for the rest of the test, for flows that need
+// what one request writes to be read by the next
+func useMemoryRepo(t *testing.T) *dbrepo.MemoryRepo {
+	t.Helper()
+
+	db := dbrepo.NewMemoryRepo(&app)
+	saved := Repo
+	Repo = &Repository{
+		App:      &app,
+		DB:       db,
+		Events:   events.NewBus(),
+		Webhooks: webhooks.NewDispatcher(db, app.Logger),
+	}
+	t.Cleanup(func() { Repo = saved })
+	return db
+}
+
+// bookRoom posts the reservation form for a stay in room 1, as a guest who picked the dates beforehand
+func bookRoom(start, end time.Time) *httptest.ResponseRecorder {
+	form := url.Values{"first_name": {"John"}, "last_name": {"Smith"}, "email": {"john@example.com"}, "phone": {"123456789"}}
+	req := loggedInRequest("POST", "/make-reservation", 0, form)
+	session.Put(req.Context(), "reservation", models.Reservation{
+		RoomID: 1, StartDate: start, EndDate: end, Room: models.Room{ID: 1, RoomName: "General's Quarters", PriceCents: 12000},
+	})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostReservationPage).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestFlow_BookingShowsOnCalendar(t *testing.T) {
+	db := useMemoryRepo(t)
+	start := time.Date(2050, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	calendarPage := func() string {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminReservationCalendarPage).ServeHTTP(rr, loggedInRequest("GET", "/admin/reservations-calendar?y=2050&m=3", 1, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("calendar: got status %d, wanted %d", rr.Code, http.StatusOK)
+		}
+		return rr.Body.String()
+	}
+	if strings.Contains(calendarPage(), "/admin/reservations/cal/1/show") {
+		t.Fatal("expected no reservation on the calendar before booking")
+	}
+
+	if rr := bookRoom(start, start.AddDate(0, 0, 2)); rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/reservation-summary" {
+		t.Fatalf("expected the booking to go to the summary, got %d to %s", rr.Code, rr.Header().Get("Location"))
+	}
+
+	if !strings.Contains(calendarPage(), "/admin/reservations/cal/1/show") {
+		t.Error("expected the new reservation on the calendar")
+	}
+	if available, _ := db.SearchAvailabilityByDatesByRoomID(context.Background(), start.AddDate(0, 0, 1), start.AddDate(0, 0, 3), 1); available {
+		t.Error("expected the room to be taken for overlapping dates")
+	}
+	if list, _ := db.AllGuests(context.Background(), "john@example.com"); len(list) != 1 || list[0].Stays != 1 {
+		t.Errorf("expected the guest to be recorded with the stay, got %+v", list)
+	}
+}
+
+func TestFlow_BookingFailsWithTheDatabase(t *testing.T) {
+	db := useMemoryRepo(t)
+	start := time.Date(2050, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	db.FailOn("InsertRoomRestriction", errors.New("connection reset"))
+	if rr := bookRoom(start, start.AddDate(0, 0, 2)); rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/" {
+		t.Fatalf("expected the failed booking to go home, got %d to %s", rr.Code, rr.Header().Get("Location"))
+	}
+	if available, _ := db.SearchAvailabilityByDatesByRoomID(context.Background(), start, start.AddDate(0, 0, 2), 1); !available {
+		t.Error("expected the room to stay free when its restriction could not be saved")
+	}
+}
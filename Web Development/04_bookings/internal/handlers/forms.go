@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/cancellation"
+	"github.com/ashparshp/bookings/internal/forms"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/webhooks"
+)
+
+// guestForm holds the guest details posted from the reservation forms
+type guestForm struct {
+	FirstName string `form:"first_name" validate:"required,minlen=3,maxlen=100"`
+	LastName  string `form:"last_name" validate:"required,maxlen=100"`
+	Email     string `form:"email" validate:"required,email,maxlen=255"`
+	Phone     string `form:"phone" validate:"required,maxlen=30"`
+}
+
+// apply copies the guest details onto a reservation
+func (g guestForm) apply(res *models.Reservation) {
+	res.FirstName = g.FirstName
+	res.LastName = g.LastName
+	res.Email = g.Email
+	res.Phone = g.Phone
+}
+
+// firstError returns the first validation message in field order, prefixed with the field
+func (g guestForm) firstError(form *forms.Form) string {
+	for _, field := range []string{"first_name", "last_name", "email", "phone"} {
+		if msg := form.Errors.Get(field); msg != "" {
+			return fmt.Sprintf("%s: %s", strings.ReplaceAll(field, "_", " "), msg)
+		}
+	}
+	return ""
+}
+
+// loginForm holds the posted login credentials
+type loginForm struct {
+	Email    string `form:"email" validate:"required,email"`
+	Password string `form:"password" validate:"required"`
+}
+
+// reviewForm holds a guest's review of their stay
+type reviewForm struct {
+	Rating int    `form:"rating" validate:"required,min=1,max=5"`
+	Body   string `form:"body" validate:"required,minlen=10,maxlen=2000"`
+}
+
+// reviewReplyForm holds the hotel's reply to a review; an empty reply removes it
+type reviewReplyForm struct {
+	Reply string `form:"reply" validate:"maxlen=2000"`
+}
+
+// guestNotesForm holds staff's notes on a guest
+type guestNotesForm struct {
+	Notes string `form:"notes" validate:"maxlen=2000"`
+}
+
+// webhookEndpointForm holds a new webhook endpoint and the events it subscribes to
+type webhookEndpointForm struct {
+	URL    string   `form:"url" validate:"required,maxlen=2048"`
+	Events []string `form:"events"`
+}
+
+// check adds the errors the validate tags cannot express
+func (e webhookEndpointForm) check(form *forms.Form) {
+	if u, err := url.Parse(e.URL); form.Errors.Get("url") == "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		form.Errors.Add("url", "Enter an absolute http or https URL")
+	}
+	if len(e.Events) == 0 {
+		form.Errors.Add("events", "Choose at least one event")
+	}
+	for _, event := range e.Events {
+		if !webhooks.IsEvent(event) {
+			form.Errors.Add("events", "Unknown event "+event)
+			break
+		}
+	}
+}
+
+// promoEntryForm holds the promo code a guest entered on the reservation form
+type promoEntryForm struct {
+	Code string `form:"promo_code" validate:"maxlen=32"`
+}
+
+// promoCodeForm holds a new promo code. Amount is a percentage for percent codes and a price, e.g. 25.50,
+// for fixed ones; zero dates and limits are left open.
+type promoCodeForm struct {
+	Code            string    `form:"code" validate:"required,minlen=3,maxlen=32,regex=^[A-Za-z0-9_-]+$"`
+	Description     string    `form:"description" validate:"maxlen=255"`
+	Kind            string    `form:"kind" validate:"required,oneof=percent fixed"`
+	Amount          float64   `form:"amount" validate:"required,min=0.01"`
+	BookingStart    time.Time `form:"booking_start"`
+	BookingEnd      time.Time `form:"booking_end"`
+	StayStart       time.Time `form:"stay_start"`
+	StayEnd         time.Time `form:"stay_end"`
+	MinNights       int       `form:"min_nights" validate:"min=0,max=365"`
+	MaxUses         int       `form:"max_uses" validate:"min=0"`
+	MaxUsesPerEmail int       `form:"max_uses_per_email" validate:"min=0"`
+	Rooms           []string  `form:"rooms"`
+}
+
+// check adds the errors that depend on more than one field
+func (p promoCodeForm) check(form *forms.Form) {
+	if p.Kind == models.PromoPercent && form.Errors.Get("amount") == "" && (p.Amount > 100 || p.Amount != math.Trunc(p.Amount)) {
+		form.Errors.Add("amount", "A percentage must be a whole number up to 100")
+	}
+	if !p.BookingStart.IsZero() && !p.BookingEnd.IsZero() && p.BookingEnd.Before(p.BookingStart) {
+		form.Errors.Add("booking_end", "The last booking day must not be before the first")
+	}
+	if !p.StayStart.IsZero() && !p.StayEnd.IsZero() && !p.StayEnd.After(p.StayStart) {
+		form.Errors.Add("stay_end", "The last departure day must be after the first arrival day")
+	}
+}
+
+// promoCode converts the form into a new, active promo code; rooms are the ids posted as checkboxes
+func (p promoCodeForm) promoCode() (models.PromoCode, error) {
+	code := models.PromoCode{
+		Code:            p.Code,
+		Description:     p.Description,
+		Kind:            p.Kind,
+		Amount:          int(p.Amount),
+		BookingStart:    p.BookingStart,
+		BookingEnd:      p.BookingEnd,
+		StayStart:       p.StayStart,
+		StayEnd:         p.StayEnd,
+		MinNights:       p.MinNights,
+		MaxUses:         p.MaxUses,
+		MaxUsesPerEmail: p.MaxUsesPerEmail,
+		Active:          true,
+	}
+	if p.Kind == models.PromoFixed {
+		code.Amount = int(math.Round(p.Amount * 100))
+	}
+	for _, room := range p.Rooms {
+		id, err := strconv.Atoi(room)
+		if err != nil {
+			return code, fmt.Errorf("invalid room id %q", room)
+		}
+		code.RoomIDs = append(code.RoomIDs, id)
+	}
+	return code, nil
+}
+
+// maxCancellationTiers is the number of tier rows on the new cancellation policy form
+const maxCancellationTiers = 4
+
+// cancellationPolicyForm holds a new cancellation policy. Each tier is a row of the form, posted as a
+// days_before and a penalty_percent value; rows left empty are skipped.
+type cancellationPolicyForm struct {
+	Name           string   `form:"name" validate:"required,minlen=3,maxlen=255"`
+	Description    string   `form:"description" validate:"maxlen=255"`
+	DaysBefore     []string `form:"days_before"`
+	PenaltyPercent []string `form:"penalty_percent"`
+}
+
+// policy converts the form into a new policy, adding an error on "tiers" if they are not valid
+func (p cancellationPolicyForm) policy(form *forms.Form) models.CancellationPolicy {
+	policy := models.CancellationPolicy{Name: p.Name, Description: p.Description}
+
+	for i := 0; i < len(p.DaysBefore) || i < len(p.PenaltyPercent); i++ {
+		days, percent := formValue(p.DaysBefore, i), formValue(p.PenaltyPercent, i)
+		if days == "" && percent == "" {
+			continue
+		}
+		d, err1 := strconv.Atoi(days)
+		pc, err2 := strconv.Atoi(percent)
+		if err1 != nil || err2 != nil {
+			form.Errors.Add("tiers", "Each tier needs a whole number of days and a whole percentage")
+			return policy
+		}
+		policy.Tiers = append(policy.Tiers, models.CancellationTier{DaysBefore: d, PenaltyPercent: pc})
+	}
+
+	if err := cancellation.Validate(policy.Tiers); err != nil {
+		form.Errors.Add("tiers", err.Error())
+	}
+	return policy
+}
+
+// formValue returns values[i], or an empty string past the end
+func formValue(values []string, i int) string {
+	if i >= len(values) {
+		return ""
+	}
+	return strings.TrimSpace(values[i])
+}
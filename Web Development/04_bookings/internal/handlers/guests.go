@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/forms"
+	"github.com/ashparshp/bookings/internal/guests"
+	"github.com/ashparshp/bookings/internal/helpers"
+	"github.com/ashparshp/bookings/internal/logger"
+	"github.com/ashparshp/bookings/internal/metrics"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/notify"
+	"github.com/ashparshp/bookings/internal/render"
+	"github.com/go-chi/chi/v5"
+)
+
+// AdminGuestsPage lists the guests, optionally those whose name or email contains the search
+func (m *Repository) AdminGuestsPage(w http.ResponseWriter, r *http.Request) {
+	search := r.URL.Query().Get("q")
+
+	list, err := m.DB.AllGuests(r.Context(), search)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to retrieve guests", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to retrieve guests")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["guests"] = list
+
+	stringMap := make(map[string]string)
+	stringMap["search"] = search
+
+	render.Template(w, r, "admin-guests.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// loadGuest returns the guest with the id in the URL and their reservations. If they cannot be loaded it
+// has already redirected to the guest list.
+func (m *Repository) loadGuest(w http.ResponseWriter, r *http.Request) (models.Guest, []models.Reservation, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid guest ID")
+		http.Redirect(w, r, "/admin/guests", http.StatusSeeOther)
+		return models.Guest{}, nil, false
+	}
+
+	g, err := m.DB.GetGuestByID(r.Context(), id)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can't get guest", "guest_id", id, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to retrieve guest")
+		http.Redirect(w, r, "/admin/guests", http.StatusSeeOther)
+		return g, nil, false
+	}
+
+	stays, err := m.DB.ReservationsForGuest(r.Context(), id)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can't get reservations of guest", "guest_id", id, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to retrieve guest")
+		http.Redirect(w, r, "/admin/guests", http.StatusSeeOther)
+		return g, nil, false
+	}
+	return g, stays, true
+}
+
+// notificationChoice is one checkbox of the notification preferences form
+type notificationChoice struct {
+	Field   string
+	Checked bool
+}
+
+// notificationRow is a kind of notification with a checkbox per channel, in the order of notify.Channels
+type notificationRow struct {
+	Name    string
+	Choices []notificationChoice
+}
+
+// notificationField is the name of the checkbox for kind on channel
+func notificationField(kind, channel string) string {
+	return "notify_" + kind + "_" + channel
+}
+
+// notificationRows lays out prefs as the rows of the notification preferences form
+func notificationRows(prefs []models.NotificationPreference) []notificationRow {
+	var rows []notificationRow
+	for _, kind := range notify.GuestKinds {
+		row := notificationRow{Name: notify.KindName(kind)}
+		for _, channel := range notify.Channels {
+			row.Choices = append(row.Choices, notificationChoice{
+				Field:   notificationField(kind, channel),
+				Checked: notify.Wants(prefs, kind, channel),
+			})
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// renderGuestPage shows a guest's profile, stay history, notification preferences and notes
+func (m *Repository) renderGuestPage(w http.ResponseWriter, r *http.Request, g models.Guest, stays []models.Reservation, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["guest"] = g
+	data["reservations"] = stays
+
+	stringMap := make(map[string]string)
+	if err := guests.CanAnonymize(g, stays, time.Now()); err != nil {
+		stringMap["anonymize_blocked"] = err.Error()
+	}
+
+	if g.AnonymizedAt.IsZero() {
+		prefs, err := m.DB.NotificationPreferences(r.Context(), g.Email)
+		if err != nil {
+			// without the saved preferences the form would overwrite them with the defaults
+			logger.FromContext(r.Context()).Error("unable to retrieve notification preferences", "guest_id", g.ID, "error", err)
+			stringMap["notifications_error"] = "Unable to retrieve notification preferences"
+		} else {
+			data["notifications"] = notificationRows(prefs)
+			data["channels"] = notify.Channels
+		}
+	}
+
+	render.Template(w, r, "admin-guest.page.tmpl", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// AdminShowGuestPage shows a guest's profile with their stay history and staff's notes
+func (m *Repository) AdminShowGuestPage(w http.ResponseWriter, r *http.Request) {
+	g, stays, ok := m.loadGuest(w, r)
+	if !ok {
+		return
+	}
+
+	form := forms.New(url.Values{"notes": {g.Notes}})
+	m.renderGuestPage(w, r, g, stays, form)
+}
+
+// AdminPostGuestNotes saves staff's notes on a guest
+func (m *Repository) AdminPostGuestNotes(w http.ResponseWriter, r *http.Request) {
+	g, stays, ok := m.loadGuest(w, r)
+	if !ok {
+		return
+	}
+	guestPage := fmt.Sprintf("/admin/guests/%d", g.ID)
+
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, guestPage, http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	var posted guestNotesForm
+	if err := form.Bind(&posted); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	if !form.Valid() {
+		m.renderGuestPage(w, r, g, stays, form)
+		return
+	}
+
+	if err := m.DB.UpdateGuestNotes(r.Context(), g.ID, posted.Notes); err != nil {
+		logger.FromContext(r.Context()).Error("unable to save guest notes", "guest_id", g.ID, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to save notes")
+		http.Redirect(w, r, guestPage, http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Notes saved")
+	http.Redirect(w, r, guestPage, http.StatusSeeOther)
+}
+
+// AdminPostGuestNotifications saves the channels a guest gets each kind of notification on. Every
+// combination is saved, so unticking email turns off a default rather than falling back to it.
+func (m *Repository) AdminPostGuestNotifications(w http.ResponseWriter, r *http.Request) {
+	g, _, ok := m.loadGuest(w, r)
+	if !ok {
+		return
+	}
+	guestPage := fmt.Sprintf("/admin/guests/%d", g.ID)
+	log := logger.FromContext(r.Context()).With("guest_id", g.ID)
+
+	if !g.AnonymizedAt.IsZero() {
+		m.App.Session.Put(r.Context(), "error", guests.ErrAnonymized.Error())
+		http.Redirect(w, r, guestPage, http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, guestPage, http.StatusSeeOther)
+		return
+	}
+
+	var prefs []models.NotificationPreference
+	for _, kind := range notify.GuestKinds {
+		for _, channel := range notify.Channels {
+			prefs = append(prefs, models.NotificationPreference{
+				Kind:    kind,
+				Channel: channel,
+				Enabled: r.PostForm.Get(notificationField(kind, channel)) != "",
+			})
+		}
+	}
+
+	if err := m.DB.SetNotificationPreferences(r.Context(), g.ID, prefs); err != nil {
+		log.Error("unable to save notification preferences", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to save notification preferences")
+		http.Redirect(w, r, guestPage, http.StatusSeeOther)
+		return
+	}
+
+	log.Info("notification preferences saved", "user_id", m.App.Session.GetInt(r.Context(), "user_id"))
+	m.App.Session.Put(r.Context(), "flash", "Notification preferences saved")
+	http.Redirect(w, r, guestPage, http.StatusSeeOther)
+}
+
+// AdminGuestExport downloads everything stored about a guest as JSON, for data subject access requests
+func (m *Repository) AdminGuestExport(w http.ResponseWriter, r *http.Request) {
+	g, stays, ok := m.loadGuest(w, r)
+	if !ok {
+		return
+	}
+
+	reviews := make(map[int]models.Review)
+	for _, res := range stays {
+		rv, err := m.DB.GetReviewByReservationID(r.Context(), res.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+		reviews[res.ID] = rv
+	}
+
+	prefs, err := m.DB.NotificationPreferences(r.Context(), g.Email)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	out, err := json.MarshalIndent(guests.NewExport(g, stays, reviews, prefs, time.Now()), "", "  ")
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	metrics.GuestDataRequests.Inc("export")
+	logger.FromContext(r.Context()).Info("guest data exported", "guest_id", g.ID,
+		"user_id", m.App.Session.GetInt(r.Context(), "user_id"))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="guest-%d.json"`, g.ID))
+	w.Write(out)
+}
+
+// AdminPostAnonymizeGuest erases a guest's personal data, keeping their stays for occupancy figures
+func (m *Repository) AdminPostAnonymizeGuest(w http.ResponseWriter, r *http.Request) {
+	g, stays, ok := m.loadGuest(w, r)
+	if !ok {
+		return
+	}
+	guestPage := fmt.Sprintf("/admin/guests/%d", g.ID)
+	log := logger.FromContext(r.Context()).With("guest_id", g.ID)
+
+	if err := guests.CanAnonymize(g, stays, time.Now()); err != nil {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		http.Redirect(w, r, guestPage, http.StatusSeeOther)
+		return
+	}
+
+	err := m.DB.AnonymizeGuest(r.Context(), g.ID, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", guests.ErrAnonymized.Error())
+		http.Redirect(w, r, guestPage, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Error("unable to anonymize guest", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to erase the guest's data")
+		http.Redirect(w, r, guestPage, http.StatusSeeOther)
+		return
+	}
+
+	metrics.GuestDataRequests.Inc("anonymize")
+	log.Info("guest anonymized", "reservations", len(stays), "user_id", m.App.Session.GetInt(r.Context(), "user_id"))
+	m.App.Session.Put(r.Context(), "flash", "The guest's personal data was erased")
+	http.Redirect(w, r, guestPage, http.StatusSeeOther)
+}
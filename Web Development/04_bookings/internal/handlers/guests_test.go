@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ashparshp/bookings/internal/guests"
+)
+
+func TestRepository_AdminGuestsPage(t *testing.T) {
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminGuestsPage).ServeHTTP(rr, loggedInRequest("GET", "/admin/guests?q=smith", 1, nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	for _, want := range []string{`href="/admin/guests/1"`, "john@example.com", "Jane Doe", "anonymized", `value="smith"`} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("expected the page to contain %q", want)
+		}
+	}
+	if strings.Contains(rr.Body.String(), "anonymized-3@guests.invalid") {
+		t.Error("expected the placeholder email of an anonymized guest to be hidden")
+	}
+
+	req := loggedInRequest("GET", "/admin/guests?q=FAIL", 1, nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminGuestsPage).ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther || session.GetString(req.Context(), "error") != "Unable to retrieve guests" {
+		t.Errorf("expected a redirect with an error, got %d", rr.Code)
+	}
+}
+
+func TestRepository_AdminShowGuestPage(t *testing.T) {
+	tests := []struct {
+		name         string
+		id           string
+		wantCode     int
+		want         []string
+		dontWant     []string
+		wantLocation string
+	}{
+		{"past guest", "1", http.StatusOK, []string{"John Smith", "Prefers a quiet room", `href="/admin/reservations/all/3/show"`, "Cancelled", `id="anonymize-form"`,
+			`name="notify_check_in_sms" value="1" checked`, `name="notify_confirmation_email" value="1" checked`},
+			[]string{`name="notify_confirmation_sms" value="1" checked`}, ""},
+		{"upcoming stay", "2", http.StatusOK, []string{guests.ErrUpcomingStay.Error()}, []string{`id="anonymize-form"`}, ""},
+		{"anonymized", "3", http.StatusOK, []string{"Anonymized on", "personal data was erased"}, []string{`id="anonymize-form"`, `id="notes-form"`, `id="notifications-form"`}, ""},
+		{"missing guest", "9", http.StatusSeeOther, nil, nil, "/admin/guests"},
+		{"invalid id", "abc", http.StatusSeeOther, nil, nil, "/admin/guests"},
+	}
+
+	for _, tt := range tests {
+		req := withURLParam(loggedInRequest("GET", "/admin/guests/"+tt.id, 1, nil), "id", tt.id)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminShowGuestPage).ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s: got status %d, wanted %d", tt.name, rr.Code, tt.wantCode)
+			continue
+		}
+		if tt.wantLocation != "" && rr.Header().Get("Location") != tt.wantLocation {
+			t.Errorf("%s: expected a redirect to %s, got %s", tt.name, tt.wantLocation, rr.Header().Get("Location"))
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(rr.Body.String(), want) {
+				t.Errorf("%s: expected the page to contain %q", tt.name, want)
+			}
+		}
+		for _, dontWant := range tt.dontWant {
+			if strings.Contains(rr.Body.String(), dontWant) {
+				t.Errorf("%s: expected the page not to contain %q", tt.name, dontWant)
+			}
+		}
+	}
+}
+
+func TestRepository_AdminPostGuestNotes(t *testing.T) {
+	req := withURLParam(loggedInRequest("POST", "/admin/guests/1/notes", 1, url.Values{"notes": {"Celebrating an anniversary"}}), "id", "1")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostGuestNotes).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/guests/1" {
+		t.Errorf("expected a redirect to the guest, got %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+	if got := session.GetString(req.Context(), "flash"); got != "Notes saved" {
+		t.Errorf("expected flash %q, got %q", "Notes saved", got)
+	}
+
+	req = withURLParam(loggedInRequest("POST", "/admin/guests/1/notes", 1, url.Values{"notes": {strings.Repeat("x", 2001)}}), "id", "1")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostGuestNotes).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "is-invalid") {
+		t.Errorf("expected the page again with an error for notes that are too long, got %d", rr.Code)
+	}
+}
+
+func TestRepository_AdminGuestExport(t *testing.T) {
+	req := withURLParam(loggedInRequest("GET", "/admin/guests/1/export", 1, nil), "id", "1")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminGuestExport).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get("Content-Disposition"); got != `attachment; filename="guest-1.json"` {
+		t.Errorf("unexpected Content-Disposition %q", got)
+	}
+
+	var export guests.Export
+	if err := json.Unmarshal(rr.Body.Bytes(), &export); err != nil {
+		t.Fatal(err)
+	}
+	if export.Guest.Email != "john@example.com" || export.Guest.Notes != "Prefers a quiet room" || len(export.Reservations) != 2 {
+		t.Errorf("unexpected export %+v", export)
+	}
+	if export.Reservations[1].Review == nil || export.Reservations[0].Review != nil {
+		t.Error("expected the review of reservation 3 only")
+	}
+	want := []guests.ExportNotification{{Kind: "check_in", Channel: "sms", Enabled: true}}
+	if !reflect.DeepEqual(export.Notifications, want) {
+		t.Errorf("expected the notification preferences %+v, got %+v", want, export.Notifications)
+	}
+
+	req = withURLParam(loggedInRequest("GET", "/admin/guests/2000/export", 1, nil), "id", "2000")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminGuestExport).ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther || session.GetString(req.Context(), "error") != "Unable to retrieve guest" {
+		t.Errorf("expected a redirect with an error for a guest that cannot be loaded, got %d", rr.Code)
+	}
+}
+
+func TestRepository_AdminPostAnonymizeGuest(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        string
+		wantFlash string
+		wantError string
+	}{
+		{"past guest", "1", "The guest's personal data was erased", ""},
+		{"upcoming stay", "2", "", guests.ErrUpcomingStay.Error()},
+		{"already anonymized", "3", "", guests.ErrAnonymized.Error()},
+	}
+
+	for _, tt := range tests {
+		req := withURLParam(loggedInRequest("POST", "/admin/guests/"+tt.id+"/anonymize", 1, url.Values{}), "id", tt.id)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostAnonymizeGuest).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/guests/"+tt.id {
+			t.Errorf("%s: expected a redirect to the guest, got %d %s", tt.name, rr.Code, rr.Header().Get("Location"))
+		}
+		if got := session.GetString(req.Context(), "flash"); got != tt.wantFlash {
+			t.Errorf("%s: expected flash %q, got %q", tt.name, tt.wantFlash, got)
+		}
+		if got := session.GetString(req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+}
+
+func TestRepository_AdminPostGuestNotifications(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        string
+		wantFlash string
+		wantError string
+	}{
+		{"guest", "1", "Notification preferences saved", ""},
+		{"anonymized", "3", "", guests.ErrAnonymized.Error()},
+	}
+
+	for _, tt := range tests {
+		posted := url.Values{"notify_check_in_sms": {"1"}, "notify_confirmation_email": {"1"}}
+		req := withURLParam(loggedInRequest("POST", "/admin/guests/"+tt.id+"/notifications", 1, posted), "id", tt.id)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostGuestNotifications).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/guests/"+tt.id {
+			t.Errorf("%s: expected a redirect to the guest, got %d %s", tt.name, rr.Code, rr.Header().Get("Location"))
+		}
+		if got := session.GetString(req.Context(), "flash"); got != tt.wantFlash {
+			t.Errorf("%s: expected flash %q, got %q", tt.name, tt.wantFlash, got)
+		}
+		if got := session.GetString(req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+}
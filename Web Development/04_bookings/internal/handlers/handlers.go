@@ -2,20 +2,32 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/ashparshp/bookings/internal/availability"
+	"github.com/ashparshp/bookings/internal/calendar"
+	"github.com/ashparshp/bookings/internal/cancellation"
 	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/documents"
 	"github.com/ashparshp/bookings/internal/driver"
+	"github.com/ashparshp/bookings/internal/events"
 	"github.com/ashparshp/bookings/internal/forms"
 	"github.com/ashparshp/bookings/internal/helpers"
+	"github.com/ashparshp/bookings/internal/i18n"
+	"github.com/ashparshp/bookings/internal/logger"
+	"github.com/ashparshp/bookings/internal/metrics"
 	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/promo"
 	"github.com/ashparshp/bookings/internal/render"
 	"github.com/ashparshp/bookings/internal/repository"
 	"github.com/ashparshp/bookings/internal/repository/dbrepo"
+	"github.com/ashparshp/bookings/internal/webhooks"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -26,21 +38,37 @@ var Repo *Repository
 type Repository struct {
 	App *config.AppConfig
 	DB repository.DatabaseRepo
+	Conn *driver.DB
+	// Events tells the open admin pages about reservation and calendar changes
+	Events *events.Bus
+	// Webhooks tells subscribed endpoints about reservation and calendar changes
+	Webhooks *webhooks.Dispatcher
 }
 
-// NewRepo creates a new repository
+// NewRepo creates a new repository backed by the database driver selected in the app config
 func NewRepo(a *config.AppConfig, db *driver.DB) *Repository {
+	repo := dbrepo.NewPostgresRepo(db.SQL, a)
+	if a.DBDriver == "sqlite" {
+		repo = dbrepo.NewSqliteRepo(db.SQL, a)
+	}
+
 	return &Repository {
 		App: a,
-		DB:  dbrepo.NewPostgresRepo(db.SQL, a),
+		DB:  repo,
+		Conn: db,
+		Events: events.NewBus(),
+		Webhooks: webhooks.NewDispatcher(repo, a.Logger),
 	}
 }
 
 // NewTestRepo creates a new repository for testing
 func NewTestRepo(a *config.AppConfig) *Repository {
+	repo := dbrepo.NewTestRepo(a)
 	return &Repository {
 		App: a,
-		DB:  dbrepo.NewTestRepo(a),
+		DB:  repo,
+		Events: events.NewBus(),
+		Webhooks: webhooks.NewDispatcher(repo, a.Logger),
 	}
 }
 
@@ -49,6 +77,25 @@ func NewHandler(r * Repository) {
 	Repo = r
 }
 
+// sendNotification tags msg with the request's log attributes and queues it for the notification listener
+func (m *Repository) sendNotification(r *http.Request, msg models.Notification) {
+	msg.RequestID = logger.RequestIDFromContext(r.Context())
+	msg.UserID = m.App.Session.GetInt(r.Context(), "user_id")
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		msg.Route = rctx.RoutePattern()
+	}
+	m.App.NotifyChan <- msg
+}
+
+// publish tells the open admin pages about a change and queues it for the webhooks. The change is already
+// saved, so a failure to queue it is logged rather than shown to the user.
+func (m *Repository) publish(r *http.Request, event string, data any) {
+	m.Events.Publish(events.Event{Name: event, Data: data})
+	if err := m.Webhooks.Publish(r.Context(), event, data); err != nil {
+		logger.FromContext(r.Context()).Error("unable to queue webhook event", "event", event, "error", err)
+	}
+}
+
 // HomePage is the handler for the home page
 func (m *Repository) HomePage (w http.ResponseWriter, r *http.Request) {
 	render.Template(w, r, "home.page.tmpl", &models.TemplateData{})
@@ -69,14 +116,26 @@ func (m *Repository) ReservationPage (w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	room, err := m.DB.GetRoomByID(res.RoomID)
+	room, err := m.DB.GetRoomByID(r.Context(), res.RoomID)
 	if err != nil {
+		logger.FromContext(r.Context()).Error("can't find room", "room_id", res.RoomID, "error", err)
 		m.App.Session.Put(r.Context(), "error", "Can't find room")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
 	res.Room.RoomName = room.RoomName
+	priceReservation(&res, room)
+
+	// the reservation is booked under the policy the guest is shown here
+	res.CancellationPolicyID = room.CancellationPolicyID
+	policy, err := m.cancellationPolicy(r, res.CancellationPolicyID)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can't load cancellation policy", "cancellation_policy_id", res.CancellationPolicyID, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to load the cancellation policy")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
 
 	m.App.Session.Put(r.Context(), "reservation", res)
 
@@ -89,6 +148,8 @@ func (m *Repository) ReservationPage (w http.ResponseWriter, r *http.Request) {
 
 	data := make(map[string]interface{})
 	data["reservation"] = res
+	data["nights"] = promo.Nights(res)
+	data["cancellation_terms"] = cancellationTerms(i18n.FromContext(r.Context()), policy)
 
 	render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
 		Form: forms.New(nil),
@@ -121,27 +182,56 @@ func (m *Repository) PostReservationPage (w http.ResponseWriter, r *http.Request
 	layout := "2006-01-02"
 	startDate, err := time.Parse(layout, sd)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
 	endDate, err := time.Parse(layout, ed)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
 	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 	*/
 
-	reservation.FirstName = r.Form.Get("first_name")
-	reservation.LastName = r.Form.Get("last_name")
-	reservation.Email = r.Form.Get("email")
-	reservation.Phone = r.Form.Get("phone")
+	locale := i18n.FromContext(r.Context())
+	form := forms.New(r.PostForm).Translate(locale.T)
+
+	var guest guestForm
+	if err := form.Bind(&guest); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	var entered promoEntryForm
+	if err := form.Bind(&entered); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	guest.apply(&reservation)
+	reservation.Locale = locale.Code
+
+	// charge the price the guest was shown on the reservation page
+	priceReservation(&reservation, reservation.Room)
+
+	var code models.PromoCode
+	if entered.Code != "" && form.Valid() {
+		code, err = m.checkPromoCode(r, entered.Code, reservation)
+		var refused *promo.Error
+		switch {
+		case errors.As(err, &refused):
+			form.Errors.Add("promo_code", promoErrorMessage(locale, refused))
+		case err != nil:
+			logger.FromContext(r.Context()).Error("can't check promo code", "error", err)
+			m.App.Session.Put(r.Context(), "error", "Unable to check the promo code")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+	}
 
 	/*
 	reservation := models.Reservation{
@@ -155,12 +245,6 @@ func (m *Repository) PostReservationPage (w http.ResponseWriter, r *http.Request
 	}
 	*/
 
-	form := forms.New(r.PostForm)
-
-	form.Required("first_name", "last_name", "email", "phone")
-	form.MinLength("first_name", 3)
-	form.IsEmail("email")
-
 	if !form.Valid() {
 
 		sd := reservation.StartDate.Format("2006-01-02")
@@ -169,9 +253,12 @@ func (m *Repository) PostReservationPage (w http.ResponseWriter, r *http.Request
         StringMap := make(map[string]string)
         StringMap["start_date"] = sd
         StringMap["end_date"] = ed
+        StringMap["promo_code"] = entered.Code
 
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
+		data["nights"] = promo.Nights(reservation)
+		data["cancellation_terms"] = m.guestCancellationTerms(r, locale, reservation.CancellationPolicyID)
 		render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
 			Form: form,
 			Data: data,
@@ -180,8 +267,9 @@ func (m *Repository) PostReservationPage (w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	newReservationID, err := m.DB.InsertReservation(reservation)
+	newReservationID, err := m.DB.InsertReservation(r.Context(), reservation)
 	if err != nil {
+		logger.FromContext(r.Context()).Error("can't insert reservation", "error", err)
 		m.App.Session.Put(r.Context(), "error", "can't insert reservation into database")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -195,30 +283,58 @@ func (m *Repository) PostReservationPage (w http.ResponseWriter, r *http.Request
 		RestrictionID: 1,
 	}
 
-	err = m.DB.InsertRoomRestriction(restriction)
+	err = m.DB.InsertRoomRestriction(r.Context(), restriction)
 	if err != nil {
+		logger.FromContext(r.Context()).Error("can't insert room restriction", "reservation_id", newReservationID, "error", err)
 		m.App.Session.Put(r.Context(), "error", "can't insert room restriction")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	// send an email to the user
-	htmlMessage := fmt.Sprintf(`
-	<strong>Reservation Confirmation</strong><br>
-	Dear %s:, <br>
-	Thank you for your reservation from %s to %s.<br>
-	`, reservation.FirstName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
+	metrics.ReservationsCreated.Inc()
 
+	reservation.ID = newReservationID
+	// the repository stamps the row with the time it was inserted, which the confirmation shows
+	reservation.CreatedAt = time.Now()
+	if code.ID != 0 {
+		m.redeemPromoCode(r, &reservation, code)
+	}
+	m.publish(r, webhooks.ReservationCreated, webhooks.NewReservation(reservation))
 
-	msg := models.MailData{
+	// send a confirmation to the user, in the language they booked in
+	htmlMessage := fmt.Sprintf(`
+	<strong>%s</strong><br>
+	%s<br>
+	%s<br>
+	%s%s<br>
+	%s
+	<br>%s<br>
+	<a href="%s">%s</a><br>
+	`, locale.T("Reservation Confirmation"),
+		locale.T("Dear %s,", template.HTMLEscapeString(reservation.FirstName)),
+		locale.T("Thank you for your reservation from %s to %s.", locale.Date(reservation.StartDate), locale.Date(reservation.EndDate)),
+		promoLine(locale, reservation),
+		locale.T("Total: %s", locale.Money(reservation.TotalCents)),
+		cancellationLines(locale, m.guestCancellationTerms(r, locale, reservation.CancellationPolicyID)),
+		locale.T("Your booking confirmation is attached."),
+		template.HTMLEscapeString(m.App.BaseURL+m.documentURL(reservation, documents.Invoice)), locale.T("Download your invoice"))
+
+
+	msg := models.Notification{
+        Kind:    models.NotifyConfirmation,
         To:      reservation.Email,
+        Phone:   reservation.Phone,
         From:    m.App.MailConfig.FromAddress,
-        Subject: "Reservation Confirmation",
+        Subject: locale.T("Reservation Confirmation"),
         Content: htmlMessage,
         Template: "basic.html",
+        Locale:   locale.Code,
+        Text: locale.T("Your reservation from %s to %s is confirmed. Total: %s", locale.Date(reservation.StartDate),
+            locale.Date(reservation.EndDate), locale.Money(reservation.TotalCents)),
+        Attachments: m.confirmationAttachment(r, reservation),
     }
 
-	m.App.MailChan <- msg
+	m.sendNotification(r, msg)
 
 	// send an email to the admin
 	adminMessage := fmt.Sprintf(`
@@ -227,9 +343,14 @@ func (m *Repository) PostReservationPage (w http.ResponseWriter, r *http.Request
     Email: %s<br>
     Phone: %s<br>
     Room ID: %d<br>
-    `, reservation.FirstName, reservation.LastName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"), reservation.Email, reservation.Phone, reservation.RoomID)
+    %sTotal: %s<br>
+    `, template.HTMLEscapeString(reservation.FirstName), template.HTMLEscapeString(reservation.LastName),
+		reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"),
+		template.HTMLEscapeString(reservation.Email), template.HTMLEscapeString(reservation.Phone), reservation.RoomID,
+		promoLine(i18n.Default(), reservation), i18n.Default().Money(reservation.TotalCents))
     
-    adminMsg := models.MailData{
+    adminMsg := models.Notification{
+        Kind:    models.NotifyNewReservation,
         To:      "ashparshp1@gmail.com",
         From:    m.App.MailConfig.FromAddress,
         Subject: "New Reservation",
@@ -237,28 +358,57 @@ func (m *Repository) PostReservationPage (w http.ResponseWriter, r *http.Request
         Template: "basic.html",
     }
 
-    m.App.MailChan <- adminMsg
+    m.sendNotification(r, adminMsg)
 
 
 	m.App.Session.Put(r.Context(), "reservation", reservation)
 	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
 }
 
+// priceReservation sets the amounts of a new reservation in room, before any promo code
+func priceReservation(res *models.Reservation, room models.Room) {
+	res.Room.PriceCents = room.PriceCents
+	res.SubtotalCents = promo.Subtotal(room, *res)
+	res.DiscountCents = 0
+	res.TotalCents = res.SubtotalCents
+	res.PromoCode = ""
+}
+
+// promoLine is the line of a confirmation email showing the promo code discount, empty without one
+func promoLine(locale *i18n.Locale, res models.Reservation) string {
+	if res.PromoCode == "" {
+		return ""
+	}
+	return locale.T("Promo code %s: -%s", template.HTMLEscapeString(res.PromoCode), locale.Money(res.DiscountCents)) + "<br>"
+}
+
 // GeneralsPage renders the room page
 func (m *Repository) GeneralsPage (w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "generals.page.tmpl", &models.TemplateData{})
+	render.Template(w, r, "generals.page.tmpl", &models.TemplateData{
+		Data: m.roomReviews(r, 1),
+	})
 }
 
 // MajorsPage renders the room page
 func (m *Repository) MajorsPage (w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "majors.page.tmpl", &models.TemplateData{})
+	render.Template(w, r, "majors.page.tmpl", &models.TemplateData{
+		Data: m.roomReviews(r, 2),
+	})
 }
 
 // AvailabilityPage renders the room page
 func (m *Repository) AvailabilityPage (w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{})
+	data := make(map[string]interface{})
+	data["flexible_days"] = availability.Days
+
+	render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
 }
 
+// alternativesPerRoom is how many other stays the choose room page offers in each room
+const alternativesPerRoom = 4
+
 // PostAvailabilityPage handles post
 func (m *Repository) PostAvailabilityPage (w http.ResponseWriter, r *http.Request) {
 	start := r.Form.Get("start")
@@ -267,23 +417,41 @@ func (m *Repository) PostAvailabilityPage (w http.ResponseWriter, r *http.Reques
 	layout := "2006-01-02"
 	startDate, err := time.Parse(layout, start)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
 	endDate, err := time.Parse(layout, end)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	rooms, err := m.DB.SearchAvailabilityForAllRooms(r.Context(), startDate, endDate)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	if len(rooms) == 0 {
+	// other dates are offered when the guest asked for flexible dates, or the dates they asked for are full
+	requested := availability.Window{Start: startDate, End: endDate}
+	search, flexible := availability.Flexible(r.Form.Get("flexible"), requested, time.Now())
+	if !flexible && len(rooms) == 0 {
+		search, flexible = availability.Around(requested, availability.DefaultDays, time.Now()), true
+	}
+
+	var alternatives []availability.Alternative
+	if flexible {
+		from, to := search.Span()
+		occupancy, err := m.DB.RoomOccupancy(r.Context(), from, to)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+		alternatives = search.Alternatives(occupancy, alternativesPerRoom)
+	}
+
+	if len(rooms) == 0 && len(alternatives) == 0 {
 		m.App.Session.Put(r.Context(), "error", "No availability")
 		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
 		return
@@ -291,6 +459,7 @@ func (m *Repository) PostAvailabilityPage (w http.ResponseWriter, r *http.Reques
 
 	data := make(map[string]interface{})
 	data["rooms"] = rooms
+	data["alternatives"] = alternatives
 
 	res := models.Reservation{
 		StartDate: startDate,
@@ -320,24 +489,24 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 	layout := "2006-01-02"
 	startDate, err := time.Parse(layout, sd)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 	endDate, err := time.Parse(layout, ed)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
 	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	available, err := m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomID)
+	available, err := m.DB.SearchAvailabilityByDatesByRoomID(r.Context(), startDate, endDate, roomID)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
@@ -351,7 +520,7 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 
 	out, err := json.MarshalIndent(resp, "", "     ")
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
@@ -368,7 +537,7 @@ func (m *Repository) ContactPage (w http.ResponseWriter, r *http.Request) {
 func (m *Repository) ReservationSummaryPage (w http.ResponseWriter, r *http.Request) {
 	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		m.App.ErrorLog.Println("Can't get reservation from session")
+		logger.FromContext(r.Context()).Warn("can't get reservation from session")
 		m.App.Session.Put(r.Context(), "error", "Cannot get reservation from session")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -377,13 +546,16 @@ func (m *Repository) ReservationSummaryPage (w http.ResponseWriter, r *http.Requ
 	m.App.Session.Remove(r.Context(), "reservation")
 	data := make(map[string]interface{})
 	data["reservation"] = reservation
+	data["nights"] = promo.Nights(reservation)
+	data["cancellation_terms"] = m.guestCancellationTerms(r, i18n.FromContext(r.Context()), reservation.CancellationPolicyID)
 
 	sd := reservation.StartDate.Format("2006-01-02")
 	ed := reservation.EndDate.Format("2006-01-02")
 	StringMap := (map[string]string{})
 	StringMap["start_date"] = sd
 	StringMap["end_date"] = ed
-
+	StringMap["confirmation_url"] = m.documentURL(reservation, documents.Confirmation)
+	StringMap["invoice_url"] = m.documentURL(reservation, documents.Invoice)
 
 	render.Template(w, r, "reservation-summary.page.tmpl", &models.TemplateData{
 		Data: data,
@@ -395,13 +567,13 @@ func (m *Repository) ReservationSummaryPage (w http.ResponseWriter, r *http.Requ
 func (m *Repository) ChooseRoomPage (w http.ResponseWriter, r *http.Request) {
 	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
 	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
@@ -415,7 +587,7 @@ func (m *Repository) ChooseRoomPage (w http.ResponseWriter, r *http.Request) {
 func (m *Repository) BookRoomPage (w http.ResponseWriter, r *http.Request) {
 	roomID, err := strconv.Atoi(r.URL.Query().Get("id"))
     if err != nil {
-        helpers.ServerError(w, err)
+        helpers.ServerError(w, r, err)
         return
     }
 	
@@ -425,13 +597,13 @@ func (m *Repository) BookRoomPage (w http.ResponseWriter, r *http.Request) {
 	layout := "2006-01-02"
 	startDate, err := time.Parse(layout, sd)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
 	endDate, err := time.Parse(layout, ed)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 	
@@ -440,9 +612,9 @@ func (m *Repository) BookRoomPage (w http.ResponseWriter, r *http.Request) {
 	res.StartDate = startDate
 	res.EndDate = endDate
 
-	room, err := m.DB.GetRoomByID(roomID)
+	room, err := m.DB.GetRoomByID(r.Context(), roomID)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 	res.Room.RoomName = room.RoomName
@@ -469,12 +641,13 @@ func (m *Repository) PostLoginPage (w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	email := r.Form.Get("email")
-	password := r.Form.Get("password")
-	
-	form := forms.New(r.PostForm)
-	form.Required("email", "password")
-	form.IsEmail("email")
+	form := forms.New(r.PostForm).Translate(i18n.FromContext(r.Context()).T)
+
+	var login loginForm
+	if err := form.Bind(&login); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
 	if !form.Valid() {
 		render.Template(w, r, "login.page.tmpl", &models.TemplateData{
 			Form: form,
@@ -482,13 +655,16 @@ func (m *Repository) PostLoginPage (w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, _, err := m.DB.AuthenticateUser(email, password)
+	id, _, err := m.DB.AuthenticateUser(r.Context(), login.Email, login.Password)
 	if err != nil {
+		metrics.LoginFailures.Inc()
+		logger.FromContext(r.Context()).Warn("login failed", "error", err)
 		m.App.Session.Put(r.Context(), "error", "Invalid login credentials")
 		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 		return
 	}
 	m.App.Session.Put(r.Context(), "user_id", id)
+	logger.FromContext(r.Context()).Info("user logged in")
 	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -509,8 +685,9 @@ func (m *Repository) AdminDashboardPage(w http.ResponseWriter, r *http.Request)
 
 // AdminNewReservationPage renders the admin new reservations page
 func (m *Repository) AdminNewReservationPage(w http.ResponseWriter, r *http.Request) {
-	newReservations, err := m.DB.AllNewReservations()
+	newReservations, err := m.DB.AllNewReservations(r.Context())
 	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to retrieve new reservations", "error", err)
 		m.App.Session.Put(r.Context(), "error", "Unable to retrieve new reservations")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -524,8 +701,9 @@ func (m *Repository) AdminNewReservationPage(w http.ResponseWriter, r *http.Requ
 
 // AdminAllReservationsPage renders the admin all reservations page
 func (m *Repository) AdminAllReservationsPage(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllReservations()
+	reservations, err := m.DB.AllReservations(r.Context())
 	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to retrieve reservations", "error", err)
 		m.App.Session.Put(r.Context(), "error", "Unable to retrieve reservations")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
@@ -545,7 +723,7 @@ func (m *Repository) AdminShowReservationPage(w http.ResponseWriter, r *http.Req
 
 	id, err := strconv.Atoi(pathSegments[4])
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		m.App.Session.Put(r.Context(), "error", "Invalid reservation ID")
 		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 		return
@@ -564,23 +742,37 @@ func (m *Repository) AdminShowReservationPage(w http.ResponseWriter, r *http.Req
 		stringMap["month"] = month
 	}
 
-	res, err := m.DB.GetReservationByID(id)
+	res, err := m.DB.GetReservationByID(r.Context(), id)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		m.App.Session.Put(r.Context(), "error", "Unable to retrieve reservation")
 		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 		return
 	}
 
 	if res.Room.ID == 0 {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		m.App.Session.Put(r.Context(), "error", "No room found for this reservation")
 		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 		return
 	}
 
+	policy, err := m.cancellationPolicy(r, res.CancellationPolicyID)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can't load cancellation policy", "cancellation_policy_id", res.CancellationPolicyID, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to load the cancellation policy")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
 	data := make(map[string]interface{})
 	data["reservation"] = res
+	data["cancellation_policy"] = policy
+	data["cancellation_terms"] = cancellationTerms(i18n.Default(), policy)
+	if res.CancelledAt.IsZero() {
+		// what cancelling would cost if it was done now
+		data["cancellation_outcome"] = cancellation.Compute(policy, res, time.Now())
+	}
 
 	render.Template(w, r, "admin-show-reservation.page.tmpl", &models.TemplateData{
 		Data: data,
@@ -593,7 +785,7 @@ func (m *Repository) AdminShowReservationPage(w http.ResponseWriter, r *http.Req
 func (m *Repository) AdminPostShowReservationPage(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
@@ -601,7 +793,7 @@ func (m *Repository) AdminPostShowReservationPage(w http.ResponseWriter, r *http
 
 	id, err := strconv.Atoi(pathSegments[4])
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		m.App.Session.Put(r.Context(), "error", "Invalid reservation ID")
 		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 		return
@@ -611,24 +803,34 @@ func (m *Repository) AdminPostShowReservationPage(w http.ResponseWriter, r *http
 	stringMap:= make(map[string]string)
 	stringMap["src"] = src
 
-	res, err := m.DB.GetReservationByID(id)
+	res, err := m.DB.GetReservationByID(r.Context(), id)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		m.App.Session.Put(r.Context(), "error", "Unable to retrieve reservation")
 		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 		return
 	}
 
-	res.FirstName = r.Form.Get("first_name")
-	res.LastName = r.Form.Get("last_name")
-	res.Email = r.Form.Get("email")
-	res.Phone = r.Form.Get("phone")
-	
-	err = m.DB.UpdateReservation(res, id)
+	form := forms.New(r.PostForm)
+
+	var guest guestForm
+	if err := form.Bind(&guest); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Invalid guest details: "+guest.firstError(form))
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s/%d/show", src, id), http.StatusSeeOther)
+		return
+	}
+	guest.apply(&res)
+
+	err = m.DB.UpdateReservation(r.Context(), res, id)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
+	m.publish(r, webhooks.ReservationUpdated, webhooks.NewReservation(res))
 
 	month := r.Form.Get("month")
 	year := r.Form.Get("year")
@@ -650,13 +852,13 @@ func (m *Repository) AdminReservationCalendarPage(w http.ResponseWriter, r *http
 	if r.URL.Query().Get("y") != "" {
 		year, err := strconv.Atoi(r.URL.Query().Get("y"))
 		if err != nil {
-			helpers.ServerError(w, err)
+			helpers.ServerError(w, r, err)
 			return
 		}
 
 		month, err := strconv.Atoi(r.URL.Query().Get("m"))
 		if err != nil {
-			helpers.ServerError(w, err)
+			helpers.ServerError(w, r, err)
 			return
 		}
 
@@ -683,16 +885,15 @@ func (m *Repository) AdminReservationCalendarPage(w http.ResponseWriter, r *http
 
 	// get the first and last day of the month
 	currentYear, currentMonth, _ := now.Date()
-	currentLocation := now.Location()
-	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
-	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+	firstOfMonth, firstOfNextMonth := calendar.Month(currentYear, currentMonth)
+	lastOfMonth := firstOfNextMonth.AddDate(0, 0, -1)
 
 	intMap := make(map[string]int)
 	intMap["days_in_month"] = lastOfMonth.Day()
 
-	rooms, err := m.DB.AllRooms()
+	rooms, err := m.DB.AllRooms(r.Context())
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
@@ -703,28 +904,29 @@ func (m *Repository) AdminReservationCalendarPage(w http.ResponseWriter, r *http
 		blockMap := make(map[string]int)
 
 		for d := firstOfMonth; !d.After(lastOfMonth); d = d.AddDate(0, 0, 1) {
-			reservationMap[d.Format("2006-01-2")] = 0
-			blockMap[d.Format("2006-01-2")] = 0
+			reservationMap[d.Format(calendar.DayLayout)] = 0
+			blockMap[d.Format(calendar.DayLayout)] = 0
 		}
 
-		restrictions , err := m.DB.GetRestrictionsForRoomByDate(room.ID, firstOfMonth, lastOfMonth)
+		restrictions , err := m.DB.GetRestrictionsForRoomByDate(r.Context(), room.ID, firstOfMonth, firstOfNextMonth)
 		if err != nil {
-			helpers.ServerError(w, err)
+			helpers.ServerError(w, r, err)
 			return
 		}
 
 		for _, restriction := range restrictions {
 			if restriction.ReservationID > 0 {
 				for d := restriction.StartDate; !d.After(restriction.EndDate); d = d.AddDate(0, 0, 1) {
-					reservationMap[d.Format("2006-01-2")] = restriction.ReservationID
+					reservationMap[d.Format(calendar.DayLayout)] = restriction.ReservationID
 				}
 			} else {
-				blockMap[restriction.StartDate.Format("2006-01-2")] = restriction.ID
+				blockMap[restriction.StartDate.Format(calendar.DayLayout)] = restriction.ID
 			}
 		}
 
-		m.App.Session.Put(r.Context(), fmt.Sprintf("reservation_map_%d", room.ID), reservationMap)
-		m.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", room.ID), blockMap)
+		// the form carries the version and the blocks it shows, so a save can tell what its user changed
+		// from what others changed since
+		stringMap[fmt.Sprintf("version_%d", room.ID)] = calendar.Version(restrictions)
 
 		data[fmt.Sprintf("reservation_map_%d", room.ID)] = reservationMap
 		data[fmt.Sprintf("block_map_%d", room.ID)] = blockMap
@@ -741,21 +943,27 @@ func (m *Repository) AdminReservationCalendarPage(w http.ResponseWriter, r *http
 func (m *Repository) AdminProcessReservationPage(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		m.App.Session.Put(r.Context(), "error", "Invalid reservation ID")
 		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 		return
 	}
 	src := chi.URLParam(r, "src")
 
-	err = m.DB.UpdateProcessedForReservation(id, 1)
+	err = m.DB.UpdateProcessedForReservation(r.Context(), id, 1)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		m.App.Session.Put(r.Context(), "error", "Unable to process reservation")
 		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 		return
 	}
 
+	if res, err := m.DB.GetReservationByID(r.Context(), id); err != nil {
+		logger.FromContext(r.Context()).Error("can't get processed reservation for webhooks", "reservation_id", id, "error", err)
+	} else {
+		m.publish(r, webhooks.ReservationProcessed, webhooks.NewReservation(res))
+	}
+
 	year := r.URL.Query().Get("y")
 	month := r.URL.Query().Get("m")
 	m.App.Session.Put(r.Context(), "flash", "Reservation processed!")
@@ -773,16 +981,16 @@ func (m *Repository) AdminProcessReservationPage(w http.ResponseWriter, r *http.
 func (m *Repository) AdminDeleteReservationPage(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		m.App.Session.Put(r.Context(), "error", "Invalid reservation ID")
 		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 		return
 	}
 	src := chi.URLParam(r, "src")
 
-	err = m.DB.DeleteReservation(id)
+	err = m.DB.DeleteReservation(r.Context(), id)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		m.App.Session.Put(r.Context(), "error", "Unable to delete reservation")
 		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 		return
@@ -800,76 +1008,136 @@ func (m *Repository) AdminDeleteReservationPage(w http.ResponseWriter, r *http.R
 	}
 }
 
-// AdminPostReservationCalendarPage handles the post request for the admin reservation calendar
+// AdminPostReservationCalendarPage handles the post request for the admin reservation calendar. The form
+// says which blocks it showed, which of them are still ticked and which days were ticked to block, and
+// carries the version of each room's month. Only those changes are made, to the month as it is now, and
+// days booked in the meantime are reported rather than blocked.
 func (m *Repository) AdminPostReservationCalendarPage(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	year, _ := strconv.Atoi(r.Form.Get("y"))
-	month, _ := strconv.Atoi(r.Form.Get("m"))
-
-	// process blocks
-	rooms, err := m.DB.AllRooms()
-	if err != nil {
-		helpers.ServerError(w, err)
+	year, errYear := strconv.Atoi(r.Form.Get("y"))
+	month, errMonth := strconv.Atoi(r.Form.Get("m"))
+	if errYear != nil || errMonth != nil || month < 1 || month > 12 {
+		m.App.Session.Put(r.Context(), "error", "Invalid month")
+		http.Redirect(w, r, "/admin/reservations-calendar", http.StatusSeeOther)
 		return
 	}
+	back := fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month)
+
+	// days ticked to block and blocks left ticked, by room
+	additions := make(map[int][]time.Time)
+	kept := make(map[int]map[int]bool)
+	for name, values := range r.PostForm {
+		var roomID int
+		var rest string
+		switch {
+		case strings.HasPrefix(name, "add_block_"):
+			roomID, rest, err = calendarField(strings.TrimPrefix(name, "add_block_"))
+		case strings.HasPrefix(name, "remove_block_"):
+			roomID, rest, err = calendarField(strings.TrimPrefix(name, "remove_block_"))
+		default:
+			continue
+		}
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Invalid room ID")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
 
-	forms := forms.New(r.PostForm)
-
-	for _, room := range rooms {
-		curMap := m.App.Session.Get(r.Context(), fmt.Sprintf("block_map_%d", room.ID)).(map[string]int)
-		for name, value := range curMap {
-			if val, ok := curMap[name]; ok {
-				if val > 0 {
-					if !forms.Has(fmt.Sprintf("remove_block_%d_%s", room.ID, name)) {
-						// delete the restriction by id
-						err = m.DB.DeleteBlockByID(value)
-						if err != nil {
-							m.App.Session.Put(r.Context(), "error", "Unable to delete block")
-							http.Redirect(w, r, "/admin/reservations-calendar", http.StatusSeeOther)
-							return
-						}
-					}
-				}
+		if strings.HasPrefix(name, "add_block_") {
+			blockDate, err := time.Parse(calendar.DayLayout, rest)
+			if err != nil {
+				m.App.Session.Put(r.Context(), "error", "Invalid date format")
+				http.Redirect(w, r, back, http.StatusSeeOther)
+				return
+			}
+			additions[roomID] = append(additions[roomID], blockDate)
+			continue
+		}
+		if kept[roomID] == nil {
+			kept[roomID] = make(map[int]bool)
+		}
+		for _, v := range values {
+			if id, err := strconv.Atoi(v); err == nil {
+				kept[roomID][id] = true
 			}
 		}
 	}
 
-	// now handle new blocks
-	for name, _ := range r.PostForm {
-		if strings.HasPrefix(name, "add_block_") {
-			parts := strings.Split(name, "_")
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
 
-			roomID, err := strconv.Atoi(parts[2])
-			if err != nil {
-				m.App.Session.Put(r.Context(), "error", "Invalid room ID")
-				http.Redirect(w, r, "/admin/reservations-calendar", http.StatusSeeOther)
-				return
+	from, to := calendar.Month(year, time.Month(month))
+	var changed, conflicts []string
+	for _, room := range rooms {
+		current, err := m.DB.GetRestrictionsForRoomByDate(r.Context(), room.ID, from, to)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+		if r.PostForm.Get(fmt.Sprintf("version_%d", room.ID)) != calendar.Version(current) {
+			changed = append(changed, room.RoomName)
+		}
+
+		// blocks the page showed and its user unticked
+		var removals []int
+		for _, v := range r.PostForm[fmt.Sprintf("block_%d", room.ID)] {
+			if id, err := strconv.Atoi(v); err == nil && !kept[room.ID][id] {
+				removals = append(removals, id)
 			}
+		}
 
-			dateStr := parts[3]
-			layout := "2006-01-2"
-			blockDate, err := time.Parse(layout, dateStr)
+		plan := calendar.Reconcile(current, additions[room.ID], removals)
+
+		for _, b := range plan.Remove {
+			err = m.DB.DeleteBlockByID(r.Context(), b.ID)
 			if err != nil {
-				m.App.Session.Put(r.Context(), "error", "Invalid date format")
-				http.Redirect(w, r, "/admin/reservations-calendar", http.StatusSeeOther)
+				logger.FromContext(r.Context()).Error("unable to delete block", "block_id", b.ID, "error", err)
+				m.App.Session.Put(r.Context(), "error", "Unable to delete block")
+				http.Redirect(w, r, back, http.StatusSeeOther)
 				return
 			}
+			m.publish(r, webhooks.BlockRemoved, webhooks.NewBlock(b.ID, room.ID, b.Date))
+		}
 
-			err = m.DB.InsertBlockForRoom(roomID, blockDate)
+		for _, blockDate := range plan.Add {
+			err = m.DB.InsertBlockForRoom(r.Context(), room.ID, blockDate)
 			if err != nil {
-				m.App.ErrorLog.Println("Error inserting block for room:", err)
+				logger.FromContext(r.Context()).Error("unable to insert block", "room_id", room.ID, "error", err)
 				m.App.Session.Put(r.Context(), "error", "Unable to insert block")
-				http.Redirect(w, r, "/admin/reservations-calendar", http.StatusSeeOther)
+				http.Redirect(w, r, back, http.StatusSeeOther)
 				return
 			}
+			m.publish(r, webhooks.BlockAdded, webhooks.NewBlock(0, room.ID, blockDate))
 		}
+
+		for _, d := range plan.Conflicts {
+			conflicts = append(conflicts, fmt.Sprintf("%s on %s", room.RoomName, d.Format("January 2")))
+		}
+	}
+
+	switch {
+	case len(conflicts) > 0:
+		logger.FromContext(r.Context()).Info("calendar save conflicts", "rooms_changed", changed, "conflicts", conflicts)
+		m.App.Session.Put(r.Context(), "warning", "These days were booked after you opened the calendar and were not blocked: "+strings.Join(conflicts, ", "))
+	case len(changed) > 0:
+		m.App.Session.Put(r.Context(), "warning", "Someone else changed "+strings.Join(changed, ", ")+" while you had the calendar open. Your changes were saved on top of theirs.")
 	}
 
 	m.App.Session.Put(r.Context(), "flash", "Calendar updated")
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// calendarField splits the end of a calendar checkbox name, "{room id}_{day}", into its parts
+func calendarField(s string) (roomID int, rest string, err error) {
+	id, rest, _ := strings.Cut(s, "_")
+	roomID, err = strconv.Atoi(id)
+	return roomID, rest, err
 }
\ No newline at end of file
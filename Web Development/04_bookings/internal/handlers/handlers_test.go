@@ -270,6 +270,11 @@ func TestRepository_ReservationSummary(t *testing.T) {
     if rr.Code != http.StatusOK {
         t.Errorf("ReservationSummaryPage handler returned wrong status code: got %d, wanted %d", rr.Code, http.StatusOK)
     }
+    for _, want := range []string{`id="download-confirmation"`, `id="download-invoice"`} {
+        if !strings.Contains(rr.Body.String(), want) {
+            t.Errorf("ReservationSummaryPage: expected the page to contain %q", want)
+        }
+    }
 
     // Case 2: reservation not in session
     req, _ = http.NewRequest("GET", "/reservation-summary", nil)
@@ -285,3 +290,60 @@ func TestRepository_ReservationSummary(t *testing.T) {
         t.Errorf("ReservationSummaryPage handler returned wrong status code when no reservation in session: got %d, wanted %d", rr.Code, http.StatusSeeOther)
     }
 }
+
+func TestRepository_RequestTimeout(t *testing.T) {
+    reservation := models.Reservation{
+        RoomID:    1,
+        StartDate: time.Date(2025, 01, 01, 0, 0, 0, 0, time.UTC),
+        EndDate:   time.Date(2025, 01, 02, 0, 0, 0, 0, time.UTC),
+        Room: models.Room{
+            ID:       1,
+            RoomName: "General's Quarters",
+        },
+    }
+
+    // Case 1: the request deadline has already passed when the room is looked up
+    req, _ := http.NewRequest("GET", "/make-reservation", nil)
+    ctx, cancel := context.WithDeadline(getCtx(req), time.Now().Add(-time.Second))
+    defer cancel()
+    req = req.WithContext(ctx)
+
+    rr := httptest.NewRecorder()
+    session.Put(ctx, "reservation", reservation)
+
+    handler := http.HandlerFunc(Repo.ReservationPage)
+    handler.ServeHTTP(rr, req)
+
+    if rr.Code != http.StatusSeeOther {
+        t.Errorf("ReservationPage handler returned wrong status code for timed out request: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+    }
+    if msg := session.GetString(ctx, "error"); msg != "Can't find room" {
+        t.Errorf("expected room lookup to fail on timeout, got error %q", msg)
+    }
+
+    // Case 2: the client went away before the reservation was inserted
+    postedData := url.Values{}
+    postedData.Add("first_name", "John")
+    postedData.Add("last_name", "Smith")
+    postedData.Add("email", "john@example.com")
+    postedData.Add("phone", "123456789")
+
+    req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+    ctx, cancel = context.WithCancel(getCtx(req))
+    cancel()
+    req = req.WithContext(ctx)
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+    rr = httptest.NewRecorder()
+    session.Put(ctx, "reservation", reservation)
+
+    handler = http.HandlerFunc(Repo.PostReservationPage)
+    handler.ServeHTTP(rr, req)
+
+    if rr.Code != http.StatusSeeOther {
+        t.Errorf("PostReservationPage handler returned wrong status code for cancelled request: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+    }
+    if msg := session.GetString(ctx, "error"); msg != "can't insert reservation into database" {
+        t.Errorf("expected insert to fail on cancellation, got error %q", msg)
+    }
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/logger"
+)
+
+// readinessTimeout bounds how long the database ping in Readyz may take
+const readinessTimeout = 2 * time.Second
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Healthz reports that the process is up and able to serve requests
+func (m *Repository) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// Readyz reports whether the database, template cache and mail queue are ready for traffic
+func (m *Repository) Readyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{
+		"database":   m.checkDatabase(r.Context()),
+		"templates":  m.checkTemplates(),
+		"mail_queue": m.checkMailQueue(),
+	}
+
+	resp := healthResponse{Status: "ok", Checks: checks}
+	status := http.StatusOK
+	for name, result := range checks {
+		if result != "ok" {
+			resp.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+			logger.FromContext(r.Context()).Warn("readiness check failed", "check", name, "result", result)
+		}
+	}
+
+	writeHealth(w, status, resp)
+}
+
+func (m *Repository) checkDatabase(ctx context.Context) string {
+	if m.Conn == nil || m.Conn.SQL == nil {
+		return "no database connection"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	// the response is public, so the driver's error, which may name the host, only goes to the log
+	if err := m.Conn.SQL.PingContext(ctx); err != nil {
+		logger.FromContext(ctx).Error("database ping failed", "error", err)
+		return "unreachable"
+	}
+	return "ok"
+}
+
+func (m *Repository) checkTemplates() string {
+	if len(m.App.TemplateCache) == 0 {
+		return "template cache is empty"
+	}
+	return "ok"
+}
+
+func (m *Repository) checkMailQueue() string {
+	depth := len(m.App.NotifyChan)
+	if m.App.MailQueueThreshold > 0 && depth >= m.App.MailQueueThreshold {
+		return fmt.Sprintf("%d messages queued, threshold is %d", depth, m.App.MailQueueThreshold)
+	}
+	return "ok"
+}
+
+func writeHealth(w http.ResponseWriter, status int, resp healthResponse) {
+	out, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(out)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/ashparshp/bookings/internal/driver"
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+func TestRepository_Healthz(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.Healthz).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Healthz returned wrong status code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestRepository_Readyz(t *testing.T) {
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL.Close()
+
+	readyApp := app
+	readyApp.NotifyChan = make(chan models.Notification, 2)
+	readyApp.MailQueueThreshold = 1
+	repo := &Repository{App: &readyApp, DB: Repo.DB, Conn: db}
+
+	// Case 1: everything is ready
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(repo.Readyz).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Readyz returned wrong status code: got %d, wanted %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	// Case 2: the mail queue is backed up
+	readyApp.NotifyChan <- models.Notification{To: "me@here.com"}
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(repo.Readyz).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Readyz returned wrong status code for full mail queue: got %d, wanted %d", rr.Code, http.StatusServiceUnavailable)
+	}
+
+	var resp healthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Checks["mail_queue"] == "ok" || resp.Checks["database"] != "ok" || resp.Checks["templates"] != "ok" {
+		t.Errorf("unexpected readiness checks: %+v", resp.Checks)
+	}
+
+	// Case 3: the database is gone
+	<-readyApp.NotifyChan
+	db.SQL.Close()
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(repo.Readyz).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Readyz returned wrong status code for closed database: got %d, wanted %d", rr.Code, http.StatusServiceUnavailable)
+	}
+	resp = healthResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Checks["database"] != "unreachable" {
+		t.Errorf("expected the database check to hide the driver's error, got %q", resp.Checks["database"])
+	}
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/forms"
+	"github.com/ashparshp/bookings/internal/helpers"
+	"github.com/ashparshp/bookings/internal/i18n"
+	"github.com/ashparshp/bookings/internal/logger"
+	"github.com/ashparshp/bookings/internal/metrics"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/promo"
+	"github.com/ashparshp/bookings/internal/render"
+	"github.com/go-chi/chi/v5"
+)
+
+// checkPromoCode looks up the code a guest entered and checks it applies to res. The error is a
+// *promo.Error to show the guest, or any other error from the repository.
+func (m *Repository) checkPromoCode(r *http.Request, code string, res models.Reservation) (models.PromoCode, error) {
+	p, err := m.DB.GetPromoCodeByCode(r.Context(), code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, promo.ErrUnknown
+	}
+	if err != nil {
+		return p, err
+	}
+
+	if err := promo.Check(p, res, time.Now()); err != nil {
+		return p, err
+	}
+
+	uses, usesByEmail, err := m.DB.PromoCodeUses(r.Context(), p.ID, res.Email)
+	if err != nil {
+		return p, err
+	}
+	return p, promo.CheckUsage(p, uses, usesByEmail)
+}
+
+// redeemPromoCode records code against the newly inserted reservation res and takes the discount off it.
+// If the code was used up in the meantime the reservation keeps its full price and the guest is told so.
+func (m *Repository) redeemPromoCode(r *http.Request, res *models.Reservation, code models.PromoCode) {
+	log := logger.FromContext(r.Context()).With("reservation_id", res.ID, "promo_code", code.Code)
+	discount := promo.Discount(code, res.SubtotalCents)
+
+	redeemed, err := m.DB.RedeemPromoCode(r.Context(), models.PromoRedemption{
+		PromoCodeID:   code.ID,
+		ReservationID: res.ID,
+		Email:         res.Email,
+		DiscountCents: discount,
+	})
+	if err != nil {
+		log.Error("can't redeem promo code", "error", err)
+	}
+	if err != nil || !redeemed {
+		if err == nil {
+			log.Warn("promo code reached its limit before it was redeemed")
+		}
+		m.App.Session.Put(r.Context(), "warning", "Your promo code could not be applied, so the reservation was booked at the full price")
+		return
+	}
+
+	res.DiscountCents = discount
+	res.TotalCents = res.SubtotalCents - discount
+	res.PromoCode = code.Code
+	metrics.PromoRedemptions.Inc(code.Code)
+	log.Info("promo code redeemed", "discount_cents", discount)
+}
+
+// renderPromoCodesPage shows the promo codes with their usage and the form for a new one
+func (m *Repository) renderPromoCodesPage(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	codes, err := m.DB.AllPromoCodes(r.Context())
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to retrieve promo codes", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to retrieve promo codes")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to retrieve rooms", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to retrieve rooms")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	roomNames := make(map[int]string, len(rooms))
+	for _, room := range rooms {
+		roomNames[room.ID] = room.RoomName
+	}
+
+	// keep the rooms ticked when the form is shown again with errors
+	checkedRooms := make(map[string]bool)
+	for _, id := range form.Values["rooms"] {
+		checkedRooms[id] = true
+	}
+
+	var uses, discount int
+	for _, p := range codes {
+		uses += p.Uses
+		discount += p.DiscountCents
+	}
+
+	data := make(map[string]interface{})
+	data["promo_codes"] = codes
+	data["rooms"] = rooms
+	data["room_names"] = roomNames
+	data["checked_rooms"] = checkedRooms
+	data["total_uses"] = uses
+	data["total_discount"] = discount
+
+	render.Template(w, r, "admin-promo-codes.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// AdminPromoCodesPage lists the promo codes with how often they were used and the discount given
+func (m *Repository) AdminPromoCodesPage(w http.ResponseWriter, r *http.Request) {
+	m.renderPromoCodesPage(w, r, forms.New(nil))
+}
+
+// AdminPostPromoCode creates a promo code
+func (m *Repository) AdminPostPromoCode(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	var posted promoCodeForm
+	if err := form.Bind(&posted); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	posted.check(form)
+
+	code, err := posted.promoCode()
+	if err != nil {
+		form.Errors.Add("rooms", "Unknown room")
+	}
+
+	if form.Valid() {
+		_, err := m.DB.GetPromoCodeByCode(r.Context(), code.Code)
+		switch {
+		case err == nil:
+			form.Errors.Add("code", "A promo code with this name already exists")
+		case !errors.Is(err, sql.ErrNoRows):
+			logger.FromContext(r.Context()).Error("unable to look up promo code", "error", err)
+			m.App.Session.Put(r.Context(), "error", "Unable to save promo code")
+			http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		m.renderPromoCodesPage(w, r, form)
+		return
+	}
+
+	id, err := m.DB.InsertPromoCode(r.Context(), code)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to save promo code", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to save promo code")
+		http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("promo code created", "promo_code_id", id, "promo_code", promo.NormalizeCode(code.Code))
+	m.App.Session.Put(r.Context(), "flash", "Promo code "+promo.NormalizeCode(code.Code)+" created")
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+}
+
+// AdminPostPromoCodeActive enables or disables a promo code
+func (m *Repository) AdminPostPromoCodeActive(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid promo code ID")
+		http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+		return
+	}
+	active := r.Form.Get("active") == "true"
+
+	if err := m.DB.SetPromoCodeActive(r.Context(), id, active); err != nil {
+		logger.FromContext(r.Context()).Error("unable to update promo code", "promo_code_id", id, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to update promo code")
+		http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("promo code updated", "promo_code_id", id, "active", active)
+	if active {
+		m.App.Session.Put(r.Context(), "flash", "Promo code enabled")
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Promo code disabled")
+	}
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+}
+
+// promoErrorMessage returns the message for a refused promo code in the guest's language
+func promoErrorMessage(locale *i18n.Locale, err *promo.Error) string {
+	return locale.T(err.Message, err.Args...)
+}
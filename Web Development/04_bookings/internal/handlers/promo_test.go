@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+func TestRepository_PostReservationPromoCode(t *testing.T) {
+	tests := []struct {
+		name         string
+		roomID       int
+		code         string
+		wantCode     int
+		wantBody     string
+		wantDiscount int
+		wantWarning  string
+	}{
+		{"percent", 1, "summer", http.StatusSeeOther, "", 2400, ""},
+		{"fixed on its room", 2, "ROOM2", http.StatusSeeOther, "", 2500, ""},
+		{"other room", 1, "ROOM2", http.StatusOK, "This promo code is not valid for this room", 0, ""},
+		{"unknown", 1, "NOPE", http.StatusOK, "This promo code does not exist", 0, ""},
+		{"inactive", 1, "OLD", http.StatusOK, "This promo code is no longer active", 0, ""},
+		{"used up", 1, "LIMITED", http.StatusOK, "This promo code has been used up", 0, ""},
+		{"redemption fails", 1, "ERROR", http.StatusSeeOther, "", 0, "Your promo code could not be applied, so the reservation was booked at the full price"},
+		{"no code", 1, "", http.StatusSeeOther, "", 0, ""},
+	}
+
+	for _, tt := range tests {
+		form := url.Values{
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@example.com"},
+			"phone":      {"123456789"},
+			"promo_code": {tt.code},
+		}
+		req := loggedInRequest("POST", "/make-reservation", 0, form)
+		session.Put(req.Context(), "reservation", models.Reservation{
+			RoomID:    tt.roomID,
+			Room:      models.Room{ID: tt.roomID, PriceCents: 12000},
+			StartDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC),
+		})
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostReservationPage).ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s: got status %d, wanted %d", tt.name, rr.Code, tt.wantCode)
+		}
+		if tt.wantBody != "" && !strings.Contains(rr.Body.String(), tt.wantBody) {
+			t.Errorf("%s: expected the page to contain %q", tt.name, tt.wantBody)
+		}
+		if got := session.GetString(req.Context(), "warning"); got != tt.wantWarning {
+			t.Errorf("%s: expected warning %q, got %q", tt.name, tt.wantWarning, got)
+		}
+		if rr.Code != http.StatusSeeOther {
+			continue
+		}
+
+		res, ok := session.Get(req.Context(), "reservation").(models.Reservation)
+		if !ok {
+			t.Errorf("%s: expected the reservation in the session", tt.name)
+			continue
+		}
+		if res.SubtotalCents != 24000 || res.DiscountCents != tt.wantDiscount || res.TotalCents != 24000-tt.wantDiscount {
+			t.Errorf("%s: unexpected amounts %d - %d = %d", tt.name, res.SubtotalCents, res.DiscountCents, res.TotalCents)
+		}
+	}
+}
+
+func TestRepository_AdminPromoCodesPage(t *testing.T) {
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPromoCodesPage).ServeHTTP(rr, loggedInRequest("GET", "/admin/promo-codes", 1, nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	for _, want := range []string{"SUMMER", "ROOM2", "LIMITED", "1 of 1", "$132.00", `action="/admin/promo-codes/3/active"`} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("expected the page to contain %q", want)
+		}
+	}
+}
+
+func TestRepository_AdminPostPromoCode(t *testing.T) {
+	valid := func(changes url.Values) url.Values {
+		form := url.Values{
+			"code":       {"winter"},
+			"kind":       {"percent"},
+			"amount":     {"15"},
+			"stay_start": {"2025-12-01"},
+			"stay_end":   {"2026-02-28"},
+			"rooms":      {"1", "2"},
+		}
+		for k, v := range changes {
+			form[k] = v
+		}
+		return form
+	}
+
+	tests := []struct {
+		name      string
+		form      url.Values
+		wantCode  int
+		wantBody  string
+		wantFlash string
+		wantError string
+	}{
+		{"valid", valid(nil), http.StatusSeeOther, "", "Promo code WINTER created", ""},
+		{"fixed amount", valid(url.Values{"kind": {"fixed"}, "amount": {"25.50"}}), http.StatusSeeOther, "", "Promo code WINTER created", ""},
+		{"percent above 100", valid(url.Values{"amount": {"120"}}), http.StatusOK, "is-invalid", "", ""},
+		{"stay ends first", valid(url.Values{"stay_end": {"2025-11-01"}}), http.StatusOK, "is-invalid", "", ""},
+		{"bad characters", valid(url.Values{"code": {"WIN TER"}}), http.StatusOK, "is-invalid", "", ""},
+		{"duplicate", valid(url.Values{"code": {"summer"}}), http.StatusOK, "A promo code with this name already exists", "", ""},
+		{"database error", valid(url.Values{"code": {"FAIL"}}), http.StatusSeeOther, "", "", "Unable to save promo code"},
+	}
+
+	for _, tt := range tests {
+		req := loggedInRequest("POST", "/admin/promo-codes", 1, tt.form)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostPromoCode).ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s: got status %d, wanted %d", tt.name, rr.Code, tt.wantCode)
+		}
+		if tt.wantBody != "" && !strings.Contains(rr.Body.String(), tt.wantBody) {
+			t.Errorf("%s: expected the page to contain %q", tt.name, tt.wantBody)
+		}
+		if got := session.GetString(req.Context(), "flash"); got != tt.wantFlash {
+			t.Errorf("%s: expected flash %q, got %q", tt.name, tt.wantFlash, got)
+		}
+		if got := session.GetString(req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+}
+
+func TestRepository_AdminPostPromoCodeActive(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        string
+		active    string
+		wantFlash string
+		wantError string
+	}{
+		{"enable", "3", "true", "Promo code enabled", ""},
+		{"disable", "1", "false", "Promo code disabled", ""},
+		{"invalid id", "abc", "true", "", "Invalid promo code ID"},
+		{"missing code", "99", "true", "", "Unable to update promo code"},
+	}
+
+	for _, tt := range tests {
+		form := url.Values{"active": {tt.active}}
+		req := withURLParam(loggedInRequest("POST", "/admin/promo-codes/"+tt.id+"/active", 1, form), "id", tt.id)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostPromoCodeActive).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/promo-codes" {
+			t.Errorf("%s: expected a redirect to /admin/promo-codes, got %d %s", tt.name, rr.Code, rr.Header().Get("Location"))
+		}
+		if got := session.GetString(req.Context(), "flash"); got != tt.wantFlash {
+			t.Errorf("%s: expected flash %q, got %q", tt.name, tt.wantFlash, got)
+		}
+		if got := session.GetString(req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+}
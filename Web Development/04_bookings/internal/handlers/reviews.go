@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/forms"
+	"github.com/ashparshp/bookings/internal/helpers"
+	"github.com/ashparshp/bookings/internal/i18n"
+	"github.com/ashparshp/bookings/internal/links"
+	"github.com/ashparshp/bookings/internal/logger"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/render"
+	"github.com/go-chi/chi/v5"
+)
+
+// reviewStatuses are the statuses a moderator can set, which are also the filters of the admin page
+var reviewStatuses = []string{models.ReviewPending, models.ReviewApproved, models.ReviewHidden}
+
+// stayEnded reports whether a reservation's stay is over, counting the day of departure
+func stayEnded(res models.Reservation, now time.Time) bool {
+	return !res.EndDate.After(models.Day(now))
+}
+
+// reviewReservation returns the reservation the signed review link of the request is for, redirecting
+// home with an error if the link is not valid or the stay has not ended yet
+func (m *Repository) reviewReservation(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	locale := i18n.FromContext(r.Context())
+
+	id, err := links.Verify(m.App.SigningKey, links.Review, chi.URLParam(r, "token"), time.Now())
+	if err != nil {
+		message := "This review link is not valid"
+		if errors.Is(err, links.ErrExpired) {
+			message = "This review link has expired"
+		}
+		m.App.Session.Put(r.Context(), "error", locale.T(message))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return models.Reservation{}, false
+	}
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can't get reservation for review", "reservation_id", id, "error", err)
+		m.App.Session.Put(r.Context(), "error", locale.T("This review link is not valid"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return models.Reservation{}, false
+	}
+
+	// nobody stayed, so there is nothing to review
+	if !res.CancelledAt.IsZero() {
+		m.App.Session.Put(r.Context(), "error", locale.T("This review link is not valid"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return models.Reservation{}, false
+	}
+
+	if !stayEnded(res, time.Now()) {
+		m.App.Session.Put(r.Context(), "error", locale.T("You can review your stay once it has ended"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return models.Reservation{}, false
+	}
+
+	return res, true
+}
+
+// existingReview returns the review already written for a reservation, if any
+func (m *Repository) existingReview(r *http.Request, reservationID int) (models.Review, bool, error) {
+	rv, err := m.DB.GetReviewByReservationID(r.Context(), reservationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Review{}, false, nil
+	}
+	if err != nil {
+		return models.Review{}, false, err
+	}
+	return rv, true, nil
+}
+
+// renderReviewPage shows the review form for res, or the review if one was written
+func (m *Repository) renderReviewPage(w http.ResponseWriter, r *http.Request, res models.Reservation, rv *models.Review, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	if rv != nil {
+		data["review"] = *rv
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["token"] = chi.URLParam(r, "token")
+
+	render.Template(w, r, "review.page.tmpl", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// ReviewPage shows guests who followed the link in their thank-you email the form to review their room
+func (m *Repository) ReviewPage(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.reviewReservation(w, r)
+	if !ok {
+		return
+	}
+
+	rv, found, err := m.existingReview(r, res.ID)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	if found {
+		m.renderReviewPage(w, r, res, &rv, nil)
+		return
+	}
+
+	m.renderReviewPage(w, r, res, nil, forms.New(nil))
+}
+
+// PostReviewPage saves a guest's review, which waits for moderation before it is shown
+func (m *Repository) PostReviewPage(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.reviewReservation(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	locale := i18n.FromContext(r.Context())
+	page := "/reviews/" + url.PathEscape(chi.URLParam(r, "token"))
+
+	if _, found, err := m.existingReview(r, res.ID); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	} else if found {
+		m.App.Session.Put(r.Context(), "error", locale.T("You have already reviewed this stay"))
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm).Translate(locale.T)
+	var review reviewForm
+	if err := form.Bind(&review); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	if !form.Valid() {
+		m.renderReviewPage(w, r, res, nil, form)
+		return
+	}
+
+	id, err := m.DB.InsertReview(r.Context(), models.Review{
+		ReservationID: res.ID,
+		RoomID:        res.RoomID,
+		Rating:        review.Rating,
+		Body:          review.Body,
+	})
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can't insert review", "reservation_id", res.ID, "error", err)
+		m.App.Session.Put(r.Context(), "error", locale.T("Your review could not be saved, please try again"))
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("review submitted", "review_id", id, "reservation_id", res.ID, "rating", review.Rating)
+	m.App.Session.Put(r.Context(), "flash", locale.T("Thank you for your review! It will appear on the room page once approved."))
+	http.Redirect(w, r, page, http.StatusSeeOther)
+}
+
+// roomReviews returns the approved reviews and average rating of a room for its page. Reviews are not
+// essential to the page, so a failure is logged and the page shown without them.
+func (m *Repository) roomReviews(r *http.Request, roomID int) map[string]interface{} {
+	data := make(map[string]interface{})
+
+	reviews, err := m.DB.ApprovedReviewsForRoom(r.Context(), roomID)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can't get reviews", "room_id", roomID, "error", err)
+		return data
+	}
+	average, count, err := m.DB.RoomRating(r.Context(), roomID)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can't get room rating", "room_id", roomID, "error", err)
+		return data
+	}
+
+	data["reviews"] = reviews
+	data["rating"] = average
+	data["rating_stars"] = int(math.Round(average))
+	data["review_count"] = count
+	return data
+}
+
+// AdminReviewsPage lists reviews for moderation, the pending ones unless another status is asked for
+func (m *Repository) AdminReviewsPage(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.ReviewPending
+	}
+	filter := status
+	if filter == "all" {
+		filter = ""
+	}
+
+	reviews, err := m.DB.AllReviews(r.Context(), filter)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("can't get reviews", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to retrieve reviews")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reviews"] = reviews
+	data["statuses"] = reviewStatuses
+
+	stringMap := make(map[string]string)
+	stringMap["status"] = status
+
+	render.Template(w, r, "admin-reviews.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// reviewsPage returns the admin reviews list for the filter posted with a moderation form
+func reviewsPage(r *http.Request) string {
+	if status := r.Form.Get("filter"); status != "" {
+		return "/admin/reviews?status=" + url.QueryEscape(status)
+	}
+	return "/admin/reviews"
+}
+
+// AdminPostReviewStatus approves, hides or returns a review to the pending list
+func (m *Repository) AdminPostReviewStatus(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	back := reviewsPage(r)
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid review ID")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	if !form.In("status", reviewStatuses...) {
+		m.App.Session.Put(r.Context(), "error", "Invalid review status")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	status := r.Form.Get("status")
+
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+	if err := m.DB.UpdateReviewStatus(r.Context(), id, status, userID); err != nil {
+		logger.FromContext(r.Context()).Error("can't update review", "review_id", id, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to update review")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("review moderated", "review_id", id, "status", status)
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Review marked %s", status))
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// AdminPostReviewReply publishes the hotel's reply under a review
+func (m *Repository) AdminPostReviewReply(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	back := reviewsPage(r)
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid review ID")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	var reply reviewReplyForm
+	if err := form.Bind(&reply); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Invalid reply: "+form.Errors.Get("reply"))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+	if err := m.DB.ReplyToReview(r.Context(), id, reply.Reply, userID, time.Now()); err != nil {
+		logger.FromContext(r.Context()).Error("can't reply to review", "review_id", id, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to save reply")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("review replied to", "review_id", id)
+	m.App.Session.Put(r.Context(), "flash", "Reply saved")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
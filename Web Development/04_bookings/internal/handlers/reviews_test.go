@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/links"
+)
+
+// reviewRequest returns a request for the review page of reservationID with a link valid for ttl
+func reviewRequest(method string, reservationID int, ttl time.Duration, form url.Values) *http.Request {
+	token := links.Sign(app.SigningKey, links.Review, reservationID, time.Now().Add(ttl))
+	req := loggedInRequest(method, "/reviews/"+token, 0, form)
+	return withURLParam(req, "token", token)
+}
+
+func TestRepository_ReviewPage(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       *http.Request
+		wantCode  int
+		wantBody  string
+		wantError string
+	}{
+		{"completed stay", reviewRequest("GET", 1, time.Hour, nil), http.StatusOK, `name="body"`, ""},
+		{"already reviewed", reviewRequest("GET", 3, time.Hour, nil), http.StatusOK, "Lovely view of the ocean", ""},
+		{"stay not over", reviewRequest("GET", 2, time.Hour, nil), http.StatusSeeOther, "", "You can review your stay once it has ended"},
+		{"expired link", reviewRequest("GET", 1, -time.Hour, nil), http.StatusSeeOther, "", "This review link has expired"},
+		{"unknown reservation", reviewRequest("GET", 2000, time.Hour, nil), http.StatusSeeOther, "", "This review link is not valid"},
+		{"forged link", withURLParam(loggedInRequest("GET", "/reviews/1.9999999999.abc", 0, nil), "token", "1.9999999999.abc"), http.StatusSeeOther, "", "This review link is not valid"},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.ReviewPage).ServeHTTP(rr, tt.req)
+
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s: got status %d, wanted %d", tt.name, rr.Code, tt.wantCode)
+		}
+		if tt.wantBody != "" && !strings.Contains(rr.Body.String(), tt.wantBody) {
+			t.Errorf("%s: expected the page to contain %q", tt.name, tt.wantBody)
+		}
+		if got := session.GetString(tt.req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+
+	// the form of a guest who already reviewed is not shown again
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.ReviewPage).ServeHTTP(rr, reviewRequest("GET", 3, time.Hour, nil))
+	if strings.Contains(rr.Body.String(), `name="body"`) {
+		t.Error("expected no review form once the stay was reviewed")
+	}
+}
+
+func TestRepository_PostReviewPage(t *testing.T) {
+	valid := url.Values{"rating": {"5"}, "body": {"Wonderful stay, great breakfast."}}
+
+	req := reviewRequest("POST", 1, time.Hour, valid)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostReviewPage).ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther || !strings.HasPrefix(rr.Header().Get("Location"), "/reviews/") {
+		t.Errorf("expected a redirect back to the review page, got %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+	if got := session.GetString(req.Context(), "flash"); !strings.HasPrefix(got, "Thank you for your review") {
+		t.Errorf("expected a thank-you flash, got %q", got)
+	}
+
+	// invalid reviews are shown again with the errors
+	req = reviewRequest("POST", 1, time.Hour, url.Values{"rating": {"6"}, "body": {"Too short"}})
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostReviewPage).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the form to be shown again, got %d", rr.Code)
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, "is-invalid") || !strings.Contains(body, "Too short") {
+		t.Error("expected the errors and the entered text in the form")
+	}
+
+	tests := []struct {
+		name      string
+		req       *http.Request
+		wantError string
+	}{
+		{"already reviewed", reviewRequest("POST", 3, time.Hour, valid), "You have already reviewed this stay"},
+		{"stay not over", reviewRequest("POST", 2, time.Hour, valid), "You can review your stay once it has ended"},
+		{"expired link", reviewRequest("POST", 1, -time.Hour, valid), "This review link has expired"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostReviewPage).ServeHTTP(rr, tt.req)
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected a redirect, got %d", tt.name, rr.Code)
+		}
+		if got := session.GetString(tt.req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+}
+
+func TestRepository_RoomPageReviews(t *testing.T) {
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.GeneralsPage).ServeHTTP(rr, loggedInRequest("GET", "/generals-quarters", 0, nil))
+	body := rr.Body.String()
+	for _, want := range []string{"Guest Reviews", "Lovely view of the ocean", "4.5 out of 5, from 2 reviews", "Thank you, come again!"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected the room page to contain %q", want)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.MajorsPage).ServeHTTP(rr, loggedInRequest("GET", "/majors-suite", 0, nil))
+	if !strings.Contains(rr.Body.String(), "No reviews yet.") {
+		t.Error("expected a room without reviews to say so")
+	}
+}
+
+func TestRepository_AdminReviewsPage(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    []string
+		notWant []string
+	}{
+		{"", []string{`id="review-1"`}, []string{`id="review-2"`}},
+		{"?status=approved", []string{`id="review-2"`}, []string{`id="review-1"`}},
+		{"?status=all", []string{`id="review-1"`, `id="review-2"`}, nil},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminReviewsPage).ServeHTTP(rr, loggedInRequest("GET", "/admin/reviews"+tt.query, 1, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%q: got status %d", tt.query, rr.Code)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(rr.Body.String(), want) {
+				t.Errorf("%q: expected %s", tt.query, want)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(rr.Body.String(), notWant) {
+				t.Errorf("%q: did not expect %s", tt.query, notWant)
+			}
+		}
+	}
+}
+
+func TestRepository_AdminPostReviewStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		id           string
+		status       string
+		wantFlash    string
+		wantError    string
+		wantLocation string
+	}{
+		{"approve", "1", "approved", "Review marked approved", "", "/admin/reviews?status=pending"},
+		{"hide", "2", "hidden", "Review marked hidden", "", "/admin/reviews?status=pending"},
+		{"unknown status", "1", "deleted", "", "Invalid review status", "/admin/reviews?status=pending"},
+		{"invalid id", "abc", "approved", "", "Invalid review ID", "/admin/reviews?status=pending"},
+		{"missing review", "99", "approved", "", "Unable to update review", "/admin/reviews?status=pending"},
+	}
+
+	for _, tt := range tests {
+		form := url.Values{"status": {tt.status}, "filter": {"pending"}}
+		req := withURLParam(loggedInRequest("POST", "/admin/reviews/"+tt.id+"/status", 1, form), "id", tt.id)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostReviewStatus).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != tt.wantLocation {
+			t.Errorf("%s: expected a redirect to %s, got %d %s", tt.name, tt.wantLocation, rr.Code, rr.Header().Get("Location"))
+		}
+		if got := session.GetString(req.Context(), "flash"); got != tt.wantFlash {
+			t.Errorf("%s: expected flash %q, got %q", tt.name, tt.wantFlash, got)
+		}
+		if got := session.GetString(req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+}
+
+func TestRepository_AdminPostReviewReply(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        string
+		reply     string
+		wantFlash string
+		wantError bool
+	}{
+		{"reply", "1", "Thank you for staying with us!", "Reply saved", false},
+		{"remove reply", "1", "", "Reply saved", false},
+		{"too long", "1", strings.Repeat("a", 2001), "", true},
+		{"missing review", "99", "Thanks", "", true},
+	}
+
+	for _, tt := range tests {
+		req := withURLParam(loggedInRequest("POST", "/admin/reviews/"+tt.id+"/reply", 1, url.Values{"reply": {tt.reply}}), "id", tt.id)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostReviewReply).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/reviews" {
+			t.Errorf("%s: expected a redirect to /admin/reviews, got %d %s", tt.name, rr.Code, rr.Header().Get("Location"))
+		}
+		if got := session.GetString(req.Context(), "flash"); got != tt.wantFlash {
+			t.Errorf("%s: expected flash %q, got %q", tt.name, tt.wantFlash, got)
+		}
+		if got := session.GetString(req.Context(), "error"); (got != "") != tt.wantError {
+			t.Errorf("%s: unexpected error %q", tt.name, got)
+		}
+	}
+}
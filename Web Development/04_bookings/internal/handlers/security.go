@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/ashparshp/bookings/internal/logger"
+	"github.com/ashparshp/bookings/internal/metrics"
+	"github.com/ashparshp/bookings/internal/security"
+)
+
+// maxCSPReportSize bounds the body of a violation report
+const maxCSPReportSize = 64 << 10
+
+// CSPReport logs the Content-Security-Policy violations browsers report
+func (m *Repository) CSPReport(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCSPReportSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	violations, err := security.ParseReport(body)
+	if err != nil {
+		logger.FromContext(r.Context()).Debug("ignoring malformed csp report", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	for _, v := range violations {
+		metrics.CSPViolations.Inc()
+		logger.FromContext(r.Context()).Warn("content security policy violation",
+			"document", v.DocumentURL,
+			"directive", v.Directive,
+			"blocked", v.BlockedURL,
+			"source", v.SourceFile,
+			"line", v.Line,
+			"column", v.Column,
+			"sample", v.Sample,
+			"disposition", v.Disposition,
+		)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
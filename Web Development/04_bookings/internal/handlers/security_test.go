@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ashparshp/bookings/internal/logger"
+)
+
+func TestRepository_CSPReport(t *testing.T) {
+	report := `{"csp-report": {"document-uri": "https://example.com/about", "effective-directive": "script-src-elem",
+		"blocked-uri": "inline", "line-number": 12, "disposition": "enforce"}}`
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantLog    bool
+	}{
+		{"violation", report, http.StatusNoContent, true},
+		{"malformed", "{", http.StatusBadRequest, false},
+		{"not a violation", `{"csp-report": {}}`, http.StatusBadRequest, false},
+		{"too large", `{"csp-report": {"blocked-uri": "` + strings.Repeat("x", maxCSPReportSize) + `"}}`, http.StatusRequestEntityTooLarge, false},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		req, _ := http.NewRequest("POST", "/csp-report", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/csp-report")
+		req = req.WithContext(logger.NewContext(req.Context(), logger.New(&buf, slog.LevelInfo, true)))
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.CSPReport).ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.wantStatus, rr.Code)
+		}
+		logged := strings.Contains(buf.String(), `"directive":"script-src-elem"`)
+		if logged != tt.wantLog {
+			t.Errorf("%s: expected the violation logged=%v, got %q", tt.name, tt.wantLog, buf.String())
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/logger"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/render"
+	"github.com/ashparshp/bookings/internal/sessionstore"
+	"github.com/go-chi/chi/v5"
+)
+
+// adminAccessLevel is the access level that may manage other users
+const adminAccessLevel = 3
+
+// currentSessionToken returns the stored form of the request's session token
+func (m *Repository) currentSessionToken(r *http.Request) string {
+	return sessionstore.HashToken(m.App.Session.Token(r.Context()))
+}
+
+// requireAdmin reports whether the logged in user is an administrator, redirecting to the dashboard if not
+func (m *Repository) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	user, err := m.DB.GetUserByID(r.Context(), m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to retrieve current user", "error", err)
+	}
+	if err != nil || user.AccessLevel < adminAccessLevel {
+		m.App.Session.Put(r.Context(), "error", "You are not allowed to manage users")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return false
+	}
+	return true
+}
+
+// AdminSessionsPage lists the devices the logged in user is signed in on
+func (m *Repository) AdminSessionsPage(w http.ResponseWriter, r *http.Request) {
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+
+	sessions, err := m.DB.ActiveSessionsForUser(r.Context(), userID, time.Now())
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to retrieve sessions", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to retrieve your sessions")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["sessions"] = sessions
+
+	stringMap := make(map[string]string)
+	stringMap["current"] = m.currentSessionToken(r)
+
+	render.Template(w, r, "admin-sessions.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// AdminPostRevokeSession signs the logged in user out of one of their other sessions
+func (m *Repository) AdminPostRevokeSession(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+		return
+	}
+
+	token := r.Form.Get("token")
+	if token == "" || token == m.currentSessionToken(r) {
+		m.App.Session.Put(r.Context(), "error", "Use Logout to end the session you are using")
+		http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+		return
+	}
+
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+	if err := m.DB.DeleteUserSession(r.Context(), userID, token); err != nil {
+		logger.FromContext(r.Context()).Error("unable to revoke session", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to revoke session")
+		http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("session revoked")
+	m.App.Session.Put(r.Context(), "flash", "Session revoked")
+	http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+}
+
+// AdminPostRevokeOtherSessions signs the logged in user out everywhere except the current session
+func (m *Repository) AdminPostRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+
+	n, err := m.DB.DeleteUserSessions(r.Context(), userID, m.currentSessionToken(r))
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to revoke sessions", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to revoke sessions")
+		http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("other sessions revoked", "count", n)
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Signed out of %d other sessions", n))
+	http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+}
+
+// AdminUsersPage lists the users with their number of active sessions, for administrators
+func (m *Repository) AdminUsersPage(w http.ResponseWriter, r *http.Request) {
+	if !m.requireAdmin(w, r) {
+		return
+	}
+
+	users, err := m.DB.ListUsers(r.Context())
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to retrieve users", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to retrieve users")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	counts, err := m.DB.ActiveSessionCounts(r.Context(), time.Now())
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to count sessions", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to retrieve users")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["users"] = users
+	data["session_counts"] = counts
+
+	render.Template(w, r, "admin-users.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminPostRevokeUserSessions signs a user out of all their sessions. An administrator revoking their own
+// sessions keeps the one they are using.
+func (m *Repository) AdminPostRevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	if !m.requireAdmin(w, r) {
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid user ID")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	except := ""
+	if id == m.App.Session.GetInt(r.Context(), "user_id") {
+		except = m.currentSessionToken(r)
+	}
+
+	n, err := m.DB.DeleteUserSessions(r.Context(), id, except)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to revoke sessions", "target_user_id", id, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to revoke sessions")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("user sessions revoked", "target_user_id", id, "count", n)
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Revoked %d sessions", n))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
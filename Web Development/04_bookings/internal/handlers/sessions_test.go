@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// loggedInRequest returns a request whose session belongs to userID
+func loggedInRequest(method, target string, userID int, form url.Values) *http.Request {
+	var req *http.Request
+	if form != nil {
+		req, _ = http.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req, _ = http.NewRequest(method, target, nil)
+	}
+	ctx := getCtx(req)
+	if userID != 0 {
+		session.Put(ctx, "user_id", userID)
+	}
+	return req.WithContext(ctx)
+}
+
+func withURLParam(req *http.Request, key, value string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(key, value)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestRepository_AdminSessionsPage(t *testing.T) {
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminSessionsPage).ServeHTTP(rr, loggedInRequest("GET", "/admin/sessions", 1, nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("AdminSessionsPage returned wrong status code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{"Safari on macOS", "Chrome on Windows", "198.51.100.7", `value="other"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected the sessions page to contain %q", want)
+		}
+	}
+
+	// the repository fails for unknown users
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminSessionsPage).ServeHTTP(rr, loggedInRequest("GET", "/admin/sessions", 99, nil))
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminSessionsPage returned wrong status code on error: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+}
+
+func TestRepository_AdminPostRevokeSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		token     string
+		wantFlash string
+		wantError string
+	}{
+		{"other session", "other", "Session revoked", ""},
+		{"no token", "", "", "Use Logout to end the session you are using"},
+	}
+
+	for _, tt := range tests {
+		req := loggedInRequest("POST", "/admin/sessions/revoke", 1, url.Values{"token": {tt.token}})
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostRevokeSession).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/sessions" {
+			t.Errorf("%s: expected a redirect to /admin/sessions, got %d %s", tt.name, rr.Code, rr.Header().Get("Location"))
+		}
+		if got := session.GetString(req.Context(), "flash"); got != tt.wantFlash {
+			t.Errorf("%s: expected flash %q, got %q", tt.name, tt.wantFlash, got)
+		}
+		if got := session.GetString(req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+}
+
+func TestRepository_AdminPostRevokeOtherSessions(t *testing.T) {
+	req := loggedInRequest("POST", "/admin/sessions/revoke-others", 1, url.Values{})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPostRevokeOtherSessions).ServeHTTP(rr, req)
+
+	if got := session.GetString(req.Context(), "flash"); got != "Signed out of 1 other sessions" {
+		t.Errorf("unexpected flash %q", got)
+	}
+}
+
+func TestRepository_AdminUsersPage(t *testing.T) {
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminUsersPage).ServeHTTP(rr, loggedInRequest("GET", "/admin/users", 1, nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("AdminUsersPage returned wrong status code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "/admin/users/1/revoke-sessions") {
+		t.Error("expected a revoke button for the user with sessions")
+	}
+	if strings.Contains(rr.Body.String(), "/admin/users/2/revoke-sessions") {
+		t.Error("expected no revoke button for a user without sessions")
+	}
+
+	// only administrators may see the users
+	req := loggedInRequest("GET", "/admin/users", 2, nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminUsersPage).ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther || session.GetString(req.Context(), "error") == "" {
+		t.Errorf("expected a non-administrator to be redirected with an error, got %d", rr.Code)
+	}
+}
+
+func TestRepository_AdminPostRevokeUserSessions(t *testing.T) {
+	tests := []struct {
+		name      string
+		userID    int
+		target    string
+		wantFlash string
+	}{
+		{"admin revokes a user", 1, "2", "Revoked 1 sessions"},
+		{"invalid id", 1, "abc", ""},
+		{"repository error", 1, "99", ""},
+		{"not an administrator", 2, "1", ""},
+	}
+
+	for _, tt := range tests {
+		req := loggedInRequest("POST", "/admin/users/"+tt.target+"/revoke-sessions", tt.userID, url.Values{})
+		req = withURLParam(req, "id", tt.target)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostRevokeUserSessions).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected a redirect, got %d", tt.name, rr.Code)
+		}
+		if got := session.GetString(req.Context(), "flash"); got != tt.wantFlash {
+			t.Errorf("%s: expected flash %q, got %q", tt.name, tt.wantFlash, got)
+		}
+	}
+}
@@ -2,18 +2,18 @@ package handlers
 
 import (
 	"encoding/gob"
-	"fmt"
-	"html/template"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/ashparshp/bookings"
 	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/logger"
 	"github.com/ashparshp/bookings/internal/models"
 	"github.com/ashparshp/bookings/internal/render"
 	"github.com/go-chi/chi"
@@ -21,15 +21,8 @@ import (
 	"github.com/justinas/nosurf"
 )
 
-var functions = template.FuncMap{
-	"humanDate": render.HumanDate,
-	"formatDate": render.FormatDate,
-	"iterate": render.Iterate,
-	"add": render.Add,
-}
 var app config.AppConfig
 var session *scs.SessionManager
-var pathToTemplates = "./../../templates"
 
 func TestMain(m *testing.M) {
 	gob.Register(models.Reservation{})
@@ -41,12 +34,8 @@ func TestMain(m *testing.M) {
     // change this to true when in production
     app.InProduction = false
 
-    infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-    app.InfoLog = infoLog
-
-    // Use a null writer for error logs during tests
-    errorLog := log.New(io.Discard, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-    app.ErrorLog = errorLog
+    // Use a null writer for logs during tests
+    app.Logger = logger.New(io.Discard, slog.LevelInfo, false)
 
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
@@ -54,17 +43,22 @@ func TestMain(m *testing.M) {
 	session.Cookie.SameSite = http.SameSiteLaxMode
 	session.Cookie.Secure = app.InProduction
 	app.Session = session
+	app.SigningKey = []byte("test signing key for review links")
 
-	// create a channel for mail
-	mailChan := make(chan models.MailData)
-	app.MailChan = mailChan
-	defer close(mailChan)
+	// create a channel for notifications
+	notifyChan := make(chan models.Notification)
+	app.NotifyChan = notifyChan
+	defer close(notifyChan)
 
-	// listen for mail
-	listenForMail()
+	// listen for notifications
+	listenForNotifications()
 
 
-	tc, err := CreateTestTemplateCache()
+	assets := bookings.Load(false, "")
+	app.Templates = assets.Templates
+	app.Static = assets.Static
+
+	tc, err := render.CreateTemplateCache(app.Templates)
 	if err != nil {
 		log.Fatal("Cannot create template cache")
 	}
@@ -81,10 +75,10 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
-func listenForMail() {
+func listenForNotifications() {
 	go func() {
 		for {
-			_ = <-app.MailChan
+			_ = <-app.NotifyChan
 		}
 	}()
 }
@@ -110,7 +104,7 @@ func getRoutes() http.Handler {
 	mux.Get("/reservation-summary", Repo.ReservationSummaryPage)
 
 
-	fileServer := http.FileServer(http.Dir("./static/"))
+	fileServer := http.FileServer(http.FS(app.Static))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
 	return mux
@@ -133,39 +127,3 @@ func NoSurf(next http.Handler) http.Handler {
 func SessionLoad(next http.Handler) http.Handler {
 	return session.LoadAndSave(next)
 }
-
-// CreateTestTemplateCache creates a template cache as a map
-func CreateTestTemplateCache() (map[string]*template.Template, error) {
-	myCache := map[string]*template.Template{}
-
-	// get all the files named *.page.tmpl from ./templates
-	pages, err := filepath.Glob(fmt.Sprintf("%s/*.page.tmpl", pathToTemplates))
-
-	if err != nil {
-		return myCache, err
-	}
-
-	// range through all files with *.page.tmpl
-	for _, page := range pages {
-		name := filepath.Base(page)
-		ts, err := template.New(name).Funcs(functions).ParseFiles(page)
-		if err != nil {
-			return myCache, err
-		}
-		
-		matches, err := filepath.Glob(fmt.Sprintf("%s/*.layout.tmpl", pathToTemplates))
-		if err != nil {
-			return myCache, err
-		}
-
-		if len(matches) > 0 {
-			ts, err = ts.ParseGlob(fmt.Sprintf("%s/*.layout.tmpl", pathToTemplates))
-			if err != nil {
-				return myCache, err
-			}
-		}
-
-		myCache[name] = ts
-	}
-	return myCache, nil
-}
\ No newline at end of file
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ashparshp/bookings/internal/forms"
+	"github.com/ashparshp/bookings/internal/helpers"
+	"github.com/ashparshp/bookings/internal/logger"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/render"
+	"github.com/ashparshp/bookings/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+)
+
+// webhookLogSize is how many of the latest deliveries the webhooks page shows
+const webhookLogSize = 100
+
+// renderWebhooksPage shows the webhook endpoints, the form for a new one and the latest deliveries
+func (m *Repository) renderWebhooksPage(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	endpoints, err := m.DB.AllWebhookEndpoints(r.Context())
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to retrieve webhook endpoints", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to retrieve webhooks")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	deliveries, err := m.DB.WebhookDeliveries(r.Context(), status, webhookLogSize)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to retrieve webhook deliveries", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to retrieve webhooks")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	// keep the events ticked when the form is shown again with errors
+	checkedEvents := make(map[string]bool)
+	for _, event := range form.Values["events"] {
+		checkedEvents[event] = true
+	}
+
+	data := make(map[string]interface{})
+	data["endpoints"] = endpoints
+	data["deliveries"] = deliveries
+	data["events"] = webhooks.Events
+	data["checked_events"] = checkedEvents
+
+	stringMap := make(map[string]string)
+	stringMap["status"] = status
+
+	intMap := make(map[string]int)
+	intMap["max_attempts"] = webhooks.MaxAttempts
+
+	render.Template(w, r, "admin-webhooks.page.tmpl", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+		IntMap:    intMap,
+	})
+}
+
+// AdminWebhooksPage lists the webhook endpoints and the delivery log, optionally only deliveries with the
+// status in ?status=
+func (m *Repository) AdminWebhooksPage(w http.ResponseWriter, r *http.Request) {
+	m.renderWebhooksPage(w, r, forms.New(nil))
+}
+
+// AdminPostWebhookEndpoint adds a webhook endpoint with a new signing secret
+func (m *Repository) AdminPostWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	var posted webhookEndpointForm
+	if err := form.Bind(&posted); err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	posted.check(form)
+
+	if !form.Valid() {
+		m.renderWebhooksPage(w, r, form)
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	id, err := m.DB.InsertWebhookEndpoint(r.Context(), models.WebhookEndpoint{
+		URL:    posted.URL,
+		Secret: secret,
+		Events: posted.Events,
+		Active: true,
+	})
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to save webhook endpoint", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to save webhook")
+		http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("webhook endpoint created", "endpoint_id", id, "events", posted.Events,
+		"user_id", m.App.Session.GetInt(r.Context(), "user_id"))
+	m.App.Session.Put(r.Context(), "flash", "Webhook created. Use its signing secret to check deliveries come from us")
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// AdminPostWebhookEndpointActive enables or disables a webhook endpoint. Deliveries to a disabled endpoint
+// wait until it is enabled again.
+func (m *Repository) AdminPostWebhookEndpointActive(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid webhook ID")
+		http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+		return
+	}
+	active := r.Form.Get("active") == "true"
+
+	if err := m.DB.SetWebhookEndpointActive(r.Context(), id, active); err != nil {
+		logger.FromContext(r.Context()).Error("unable to update webhook endpoint", "endpoint_id", id, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to update webhook")
+		http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("webhook endpoint updated", "endpoint_id", id, "active", active)
+	if active {
+		m.Webhooks.Wake()
+		m.App.Session.Put(r.Context(), "flash", "Webhook enabled")
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Webhook disabled")
+	}
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// AdminPostRedeliverWebhook sends a delivery again with the same payload and delivery id, with a fresh set
+// of attempts
+func (m *Repository) AdminPostRedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid delivery ID")
+		http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+		return
+	}
+
+	err = m.Webhooks.Redeliver(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "Delivery not found")
+		http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		logger.FromContext(r.Context()).Error("unable to redeliver webhook", "delivery_id", id, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Unable to redeliver webhook")
+		http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("webhook redelivery requested", "delivery_id", id,
+		"user_id", m.App.Session.GetInt(r.Context(), "user_id"))
+	m.App.Session.Put(r.Context(), "flash", "The delivery will be sent again shortly")
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRepository_AdminWebhooksPage(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		want     []string
+		dontWant []string
+	}{
+		{"all", "", []string{"https://hooks.example.com/bookings", "test webhook secret", "disabled", `id="webhook-delivery-1"`, `id="webhook-delivery-2"`, "500 Internal Server Error", `action="/admin/webhooks/deliveries/3/redeliver"`}, nil},
+		{"failed", "?status=failed", []string{`id="webhook-delivery-2"`, "7 of 7"}, []string{`id="webhook-delivery-1"`, `id="webhook-delivery-3"`}},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminWebhooksPage).ServeHTTP(rr, loggedInRequest("GET", "/admin/webhooks"+tt.query, 1, nil))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: got status %d, wanted %d", tt.name, rr.Code, http.StatusOK)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(rr.Body.String(), want) {
+				t.Errorf("%s: expected the page to contain %q", tt.name, want)
+			}
+		}
+		for _, dontWant := range tt.dontWant {
+			if strings.Contains(rr.Body.String(), dontWant) {
+				t.Errorf("%s: expected the page not to contain %q", tt.name, dontWant)
+			}
+		}
+	}
+
+	req := loggedInRequest("GET", "/admin/webhooks?status=FAIL", 1, nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminWebhooksPage).ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther || session.GetString(req.Context(), "error") != "Unable to retrieve webhooks" {
+		t.Errorf("database error: expected a redirect with an error, got %d %q", rr.Code, session.GetString(req.Context(), "error"))
+	}
+}
+
+func TestRepository_AdminPostWebhookEndpoint(t *testing.T) {
+	tests := []struct {
+		name      string
+		form      url.Values
+		wantCode  int
+		wantBody  string
+		wantFlash string
+		wantError string
+	}{
+		{"valid", url.Values{"url": {"https://housekeeping.example.com/hooks"}, "events": {"reservation.created", "block.added"}}, http.StatusSeeOther, "", "Webhook created. Use its signing secret to check deliveries come from us", ""},
+		{"no url", url.Values{"events": {"reservation.created"}}, http.StatusOK, "is-invalid", "", ""},
+		{"relative url", url.Values{"url": {"/hooks"}, "events": {"reservation.created"}}, http.StatusOK, "Enter an absolute http or https URL", "", ""},
+		{"other scheme", url.Values{"url": {"ftp://example.com/hooks"}, "events": {"reservation.created"}}, http.StatusOK, "Enter an absolute http or https URL", "", ""},
+		{"no events", url.Values{"url": {"https://housekeeping.example.com/hooks"}}, http.StatusOK, "Choose at least one event", "", ""},
+		{"unknown event", url.Values{"url": {"https://housekeeping.example.com/hooks"}, "events": {"room.painted"}}, http.StatusOK, "Unknown event room.painted", "", ""},
+		{"database error", url.Values{"url": {"https://fail.example.com/hooks"}, "events": {"reservation.created"}}, http.StatusSeeOther, "", "", "Unable to save webhook"},
+	}
+
+	for _, tt := range tests {
+		req := loggedInRequest("POST", "/admin/webhooks", 1, tt.form)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostWebhookEndpoint).ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s: got status %d, wanted %d", tt.name, rr.Code, tt.wantCode)
+		}
+		if tt.wantBody != "" && !strings.Contains(rr.Body.String(), tt.wantBody) {
+			t.Errorf("%s: expected the page to contain %q", tt.name, tt.wantBody)
+		}
+		if got := session.GetString(req.Context(), "flash"); got != tt.wantFlash {
+			t.Errorf("%s: expected flash %q, got %q", tt.name, tt.wantFlash, got)
+		}
+		if got := session.GetString(req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+}
+
+func TestRepository_AdminPostWebhookEndpointActive(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        string
+		active    string
+		wantFlash string
+		wantError string
+	}{
+		{"enable", "2", "true", "Webhook enabled", ""},
+		{"disable", "1", "false", "Webhook disabled", ""},
+		{"missing", "9", "true", "", "Unable to update webhook"},
+		{"invalid id", "abc", "true", "", "Invalid webhook ID"},
+	}
+
+	for _, tt := range tests {
+		req := withURLParam(loggedInRequest("POST", "/admin/webhooks/"+tt.id+"/active", 1, url.Values{"active": {tt.active}}), "id", tt.id)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostWebhookEndpointActive).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/webhooks" {
+			t.Errorf("%s: expected a redirect to /admin/webhooks, got %d %s", tt.name, rr.Code, rr.Header().Get("Location"))
+		}
+		if got := session.GetString(req.Context(), "flash"); got != tt.wantFlash {
+			t.Errorf("%s: expected flash %q, got %q", tt.name, tt.wantFlash, got)
+		}
+		if got := session.GetString(req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+}
+
+func TestRepository_AdminPostRedeliverWebhook(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        string
+		wantFlash string
+		wantError string
+	}{
+		{"failed delivery", "2", "The delivery will be sent again shortly", ""},
+		{"missing", "99", "", "Delivery not found"},
+		{"invalid id", "abc", "", "Invalid delivery ID"},
+	}
+
+	for _, tt := range tests {
+		req := withURLParam(loggedInRequest("POST", "/admin/webhooks/deliveries/"+tt.id+"/redeliver", 1, url.Values{}), "id", tt.id)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostRedeliverWebhook).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/webhooks" {
+			t.Errorf("%s: expected a redirect to /admin/webhooks, got %d %s", tt.name, rr.Code, rr.Header().Get("Location"))
+		}
+		if got := session.GetString(req.Context(), "flash"); got != tt.wantFlash {
+			t.Errorf("%s: expected flash %q, got %q", tt.name, tt.wantFlash, got)
+		}
+		if got := session.GetString(req.Context(), "error"); got != tt.wantError {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.wantError, got)
+		}
+	}
+}
@@ -1,11 +1,10 @@
 package helpers
 
 import (
-	"fmt"
 	"net/http"
-	"runtime/debug"
 
 	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/logger"
 )
 
 var app *config.AppConfig
@@ -15,17 +14,18 @@ func NewHelpers(a *config.AppConfig) {
 	app = a
 }
 
-func ClientError(w http.ResponseWriter, status int) {
-	app.InfoLog.Println("Client error with status of:", status)
+// ClientError logs a client error and sends the matching status to the client
+func ClientError(w http.ResponseWriter, r *http.Request, status int) {
+	logger.FromContext(r.Context()).Info("client error", "status", status)
 	http.Error(w, http.StatusText(status), status)
 }
 
-func ServerError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.ErrorLog.Println(trace)
+// ServerError logs err with the request context and sends a 500 to the client
+func ServerError(w http.ResponseWriter, r *http.Request, err error) {
+	logger.FromContext(r.Context()).Error("server error", "error", err)
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
 func IsAuthenticated(r *http.Request) bool {
 	return app.Session.Exists(r.Context(), "user_id")
-}
\ No newline at end of file
+}
@@ -0,0 +1,205 @@
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLocale is used when the visitor has not asked for a supported language
+const DefaultLocale = "en"
+
+// CookieName is the cookie that remembers the visitor's language
+const CookieName = "lang"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// Locale is a message catalog together with the date and number conventions of a language
+type Locale struct {
+	Code       string   `json:"code"`
+	Name       string   `json:"name"`
+	DateFormat string   `json:"date_format"`
+	Months     []string `json:"months"`
+	Decimal    string   `json:"decimal"`
+	Thousands  string   `json:"thousands"`
+	// MoneyFormat places an amount formatted by Number, e.g. "$%s"
+	MoneyFormat string            `json:"money_format"`
+	Messages    map[string]string `json:"messages"`
+}
+
+var locales = mustLoad()
+
+// mustLoad reads the embedded catalogs; they are part of the binary, so a broken one is a programming error
+func mustLoad() map[string]*Locale {
+	files, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	loaded := make(map[string]*Locale, len(files))
+	for _, f := range files {
+		b, err := localeFiles.ReadFile(path.Join("locales", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var l Locale
+		if err := json.Unmarshal(b, &l); err != nil {
+			panic(fmt.Sprintf("i18n: invalid catalog %s: %v", f.Name(), err))
+		}
+		if len(l.Months) != 12 {
+			panic(fmt.Sprintf("i18n: catalog %s must list 12 months", f.Name()))
+		}
+		if strings.Count(l.MoneyFormat, "%s") != 1 {
+			panic(fmt.Sprintf("i18n: catalog %s must have a money format with one %%s", f.Name()))
+		}
+		loaded[l.Code] = &l
+	}
+	if _, ok := loaded[DefaultLocale]; !ok {
+		panic("i18n: missing catalog for the default locale")
+	}
+	return loaded
+}
+
+// Get returns the locale for a language code such as "es"
+func Get(code string) (*Locale, bool) {
+	l, ok := locales[strings.ToLower(code)]
+	return l, ok
+}
+
+// Default returns the default locale
+func Default() *Locale {
+	return locales[DefaultLocale]
+}
+
+// Supported returns all locales, the default first and the rest by code
+func Supported() []*Locale {
+	all := make([]*Locale, 0, len(locales))
+	for _, l := range locales {
+		all = append(all, l)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Code == DefaultLocale || all[j].Code == DefaultLocale {
+			return all[i].Code == DefaultLocale
+		}
+		return all[i].Code < all[j].Code
+	})
+	return all
+}
+
+// SplitPath separates a leading locale prefix from a URL path, so "/es/about" gives "es" and "/about"
+func SplitPath(p string) (code, rest string, ok bool) {
+	trimmed := strings.TrimPrefix(p, "/")
+	first, remainder, _ := strings.Cut(trimmed, "/")
+	if _, supported := locales[first]; !supported {
+		return "", p, false
+	}
+	return first, "/" + remainder, true
+}
+
+// Match returns the best supported locale for an Accept-Language header, or false if none is acceptable
+func Match(acceptLanguage string) (*Locale, bool) {
+	type candidate struct {
+		code string
+		q    float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		// only the primary language matters, so es-MX and es-ES both select es
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		candidates = append(candidates, candidate{code: primary, q: q})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	for _, c := range candidates {
+		if l, ok := locales[c.code]; ok {
+			return l, true
+		}
+	}
+	return nil, false
+}
+
+// T translates a message, falling back to the message itself, and formats it with args if any are given
+func (l *Locale) T(message string, args ...any) string {
+	if translated, ok := l.Messages[message]; ok && translated != "" {
+		message = translated
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// Date formats a date in the locale's long date format, e.g. "June 1, 2025" or "1 de junio de 2025"
+func (l *Locale) Date(t time.Time) string {
+	s := t.Format(l.DateFormat)
+	return strings.Replace(s, t.Month().String(), l.Months[t.Month()-1], 1)
+}
+
+// Number formats a number with the locale's separators and the given number of decimals
+func (l *Locale) Number(v float64, decimals int) string {
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, fraction, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(l.Thousands)
+		}
+		b.WriteRune(digit)
+	}
+	if fraction != "" {
+		b.WriteString(l.Decimal)
+		b.WriteString(fraction)
+	}
+	return sign + b.String()
+}
+
+// Money formats an amount in cents with the locale's separators and currency format, e.g. "$1,234.50"
+func (l *Locale) Money(cents int) string {
+	return fmt.Sprintf(l.MoneyFormat, l.Number(float64(cents)/100, 2))
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the locale l
+func NewContext(ctx context.Context, l *Locale) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the request's locale, or the default locale if there is none
+func FromContext(ctx context.Context) *Locale {
+	if ctx != nil {
+		if l, ok := ctx.Value(contextKey{}).(*Locale); ok {
+			return l
+		}
+	}
+	return Default()
+}
@@ -0,0 +1,133 @@
+package i18n
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLocale_T(t *testing.T) {
+	es, ok := Get("es")
+	if !ok {
+		t.Fatal("expected an es catalog")
+	}
+
+	if got := es.T("Home"); got != "Inicio" {
+		t.Errorf("expected Inicio, got %q", got)
+	}
+	if got := es.T("This field must be at least %d characters long", 3); got != "Este campo debe tener al menos 3 caracteres" {
+		t.Errorf("unexpected formatted message %q", got)
+	}
+	if got := es.T("No translation for this"); got != "No translation for this" {
+		t.Errorf("expected an unknown message to fall back to itself, got %q", got)
+	}
+	if got := Default().T("Home"); got != "Home" {
+		t.Errorf("expected the default locale to keep the message, got %q", got)
+	}
+}
+
+func TestLocale_Date(t *testing.T) {
+	d := time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC)
+	es, _ := Get("es")
+
+	if got := Default().Date(d); got != "June 1, 2025" {
+		t.Errorf("expected June 1, 2025, got %q", got)
+	}
+	if got := es.Date(d); got != "1 de junio de 2025" {
+		t.Errorf("expected 1 de junio de 2025, got %q", got)
+	}
+}
+
+func TestLocale_Number(t *testing.T) {
+	es, _ := Get("es")
+
+	tests := []struct {
+		locale   *Locale
+		value    float64
+		decimals int
+		want     string
+	}{
+		{Default(), 1234567.891, 2, "1,234,567.89"},
+		{Default(), 999, 0, "999"},
+		{Default(), -1500, 0, "-1,500"},
+		{es, 1234567.891, 2, "1.234.567,89"},
+		{es, 0.5, 1, "0,5"},
+	}
+	for _, tt := range tests {
+		if got := tt.locale.Number(tt.value, tt.decimals); got != tt.want {
+			t.Errorf("%s: Number(%v, %d) = %q, want %q", tt.locale.Code, tt.value, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestLocale_Money(t *testing.T) {
+	es, _ := Get("es")
+
+	if got := Default().Money(123450); got != "$1,234.50" {
+		t.Errorf("en: Money() = %q", got)
+	}
+	if got := es.Money(1999); got != "19,99 US$" {
+		t.Errorf("es: Money() = %q", got)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+		ok     bool
+	}{
+		{"es-MX,es;q=0.9,en;q=0.8", "es", true},
+		{"fr-FR,en;q=0.5,es;q=0.7", "es", true},
+		{"en-GB", "en", true},
+		{"fr, de;q=0.9", "", false},
+		{"es;q=0, en;q=0.1", "en", true},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		l, ok := Match(tt.header)
+		if ok != tt.ok {
+			t.Errorf("%q: expected ok=%v, got %v", tt.header, tt.ok, ok)
+			continue
+		}
+		if ok && l.Code != tt.want {
+			t.Errorf("%q: expected %s, got %s", tt.header, tt.want, l.Code)
+		}
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		path, code, rest string
+		ok               bool
+	}{
+		{"/es/search-availability", "es", "/search-availability", true},
+		{"/es", "es", "/", true},
+		{"/en/", "en", "/", true},
+		{"/rooms/generals-quarters", "", "/rooms/generals-quarters", false},
+		{"/", "", "/", false},
+	}
+	for _, tt := range tests {
+		code, rest, ok := SplitPath(tt.path)
+		if code != tt.code || rest != tt.rest || ok != tt.ok {
+			t.Errorf("SplitPath(%q) = %q, %q, %v", tt.path, code, rest, ok)
+		}
+	}
+}
+
+func TestSupported(t *testing.T) {
+	all := Supported()
+	if len(all) < 2 || all[0].Code != DefaultLocale {
+		t.Errorf("expected the default locale first, got %v", all)
+	}
+}
+
+func TestContext(t *testing.T) {
+	if l := FromContext(context.Background()); l.Code != DefaultLocale {
+		t.Errorf("expected the default locale without one in context, got %s", l.Code)
+	}
+	es, _ := Get("es")
+	if l := FromContext(NewContext(context.Background(), es)); l != es {
+		t.Errorf("expected es from context, got %s", l.Code)
+	}
+}
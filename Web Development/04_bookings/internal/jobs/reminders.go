@@ -0,0 +1,194 @@
+// Package jobs holds the work the scheduler runs in the background: the emails and text messages sent to
+// guests before, on the day of and after their stay.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/i18n"
+	"github.com/ashparshp/bookings/internal/links"
+	"github.com/ashparshp/bookings/internal/logger"
+	"github.com/ashparshp/bookings/internal/metrics"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/repository"
+	"github.com/ashparshp/bookings/internal/scheduler"
+)
+
+// thankYouWindow is how long after a stay the thank-you email is still sent, so a missed run (the site
+// being down for a day) catches up without writing to guests who left long ago
+const thankYouWindow = 7
+
+// reviewLinkLifetime is how long the review link in a thank-you email works
+const reviewLinkLifetime = 60 * 24 * time.Hour
+
+// Reminders sends the scheduled reservation emails. Every email is recorded before it is queued, so a
+// guest gets each kind at most once however often, and on however many instances, the jobs run.
+type Reminders struct {
+	App *config.AppConfig
+	DB  repository.DatabaseRepo
+	// Days is how many days before arrival the pre-arrival reminder goes out
+	Days int
+	now  func() time.Time
+}
+
+// NewReminders returns the reminder jobs for app, sending pre-arrival reminders days before arrival
+func NewReminders(app *config.AppConfig, db repository.DatabaseRepo, days int) *Reminders {
+	return &Reminders{
+		App:  app,
+		DB:   db,
+		Days: days,
+		now:  time.Now,
+	}
+}
+
+// Register adds the reminder jobs to s on the given cron schedules
+func (r *Reminders) Register(s *scheduler.Scheduler, settings config.JobSettings) error {
+	for _, job := range []struct {
+		name, spec string
+		run        func(context.Context) error
+	}{
+		{"pre-arrival-reminders", settings.PreArrivalSchedule, r.PreArrival},
+		{"check-in-emails", settings.CheckInSchedule, r.CheckIn},
+		{"thank-you-emails", settings.ThankYouSchedule, r.ThankYou},
+	} {
+		if err := s.Add(job.name, job.spec, job.run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// today returns the current date as reservation dates are stored, at midnight UTC
+func (r *Reminders) today() time.Time {
+	return models.Day(r.now())
+}
+
+// PreArrival reminds guests arriving within the next Days days, after today, of their stay
+func (r *Reminders) PreArrival(ctx context.Context) error {
+	today := r.today()
+	reservations, err := r.DB.ArrivalsAwaitingEmail(ctx, models.EmailPreArrival, today.AddDate(0, 0, 1), today.AddDate(0, 0, r.Days))
+	if err != nil {
+		return fmt.Errorf("cannot find upcoming arrivals: %w", err)
+	}
+
+	return r.send(ctx, "job:pre-arrival-reminders", models.EmailPreArrival, reservations, func(l *i18n.Locale, res models.Reservation) (string, string, string) {
+		body := fmt.Sprintf(`
+	<strong>%s</strong><br>
+	%s<br>
+	%s<br>
+	%s<br>
+	`, l.T("Your stay is coming up"),
+			l.T("Dear %s,", template.HTMLEscapeString(res.FirstName)),
+			l.T("We look forward to welcoming you to %s on %s.", template.HTMLEscapeString(l.T(res.Room.RoomName)), l.Date(res.StartDate)),
+			l.T("If your plans change, simply reply to this email."))
+		text := l.T("Your stay in %s begins on %s. We look forward to welcoming you.", l.T(res.Room.RoomName), l.Date(res.StartDate))
+		return l.T("Your stay is coming up"), body, text
+	})
+}
+
+// CheckIn sends guests arriving today what they need to know on arrival
+func (r *Reminders) CheckIn(ctx context.Context) error {
+	today := r.today()
+	reservations, err := r.DB.ArrivalsAwaitingEmail(ctx, models.EmailCheckIn, today, today)
+	if err != nil {
+		return fmt.Errorf("cannot find today's arrivals: %w", err)
+	}
+
+	return r.send(ctx, "job:check-in-emails", models.EmailCheckIn, reservations, func(l *i18n.Locale, res models.Reservation) (string, string, string) {
+		body := fmt.Sprintf(`
+	<strong>%s</strong><br>
+	%s<br>
+	%s<br>
+	%s<br>
+	%s<br>
+	`, l.T("Welcome, check-in is today"),
+			l.T("Dear %s,", template.HTMLEscapeString(res.FirstName)),
+			l.T("Your room, %s, is ready from 3:00 PM. Please bring a photo ID to the front desk.", template.HTMLEscapeString(l.T(res.Room.RoomName))),
+			l.T("Check-out is by 11:00 AM on %s.", l.Date(res.EndDate)),
+			l.T("Breakfast is served from 7:00 to 10:00 AM."))
+		text := l.T("Welcome! Your room, %s, is ready from 3:00 PM today. Check-out is by 11:00 AM on %s.", l.T(res.Room.RoomName), l.Date(res.EndDate))
+		return l.T("Welcome, check-in is today"), body, text
+	})
+}
+
+// ThankYou thanks guests whose stay ended in the last week and invites them to review their room
+func (r *Reminders) ThankYou(ctx context.Context) error {
+	today := r.today()
+	reservations, err := r.DB.DeparturesAwaitingEmail(ctx, models.EmailThankYou, today.AddDate(0, 0, -thankYouWindow), today.AddDate(0, 0, -1))
+	if err != nil {
+		return fmt.Errorf("cannot find recent departures: %w", err)
+	}
+
+	return r.send(ctx, "job:thank-you-emails", models.EmailThankYou, reservations, func(l *i18n.Locale, res models.Reservation) (string, string, string) {
+		body := fmt.Sprintf(`
+	<strong>%s</strong><br>
+	%s<br>
+	%s<br>
+	%s<br>
+	<a href="%s">%s</a><br>
+	`, l.T("Thank you for staying with us"),
+			l.T("Dear %s,", template.HTMLEscapeString(res.FirstName)),
+			l.T("Thank you for staying with us from %s to %s.", l.Date(res.StartDate), l.Date(res.EndDate)),
+			l.T("We would love to hear how your stay went."),
+			template.HTMLEscapeString(r.reviewURL(l, res)), l.T("Review your stay"))
+		text := l.T("Thank you for staying with us. Tell us how your stay went: %s", r.reviewURL(l, res))
+		return l.T("Thank you for staying with us"), body, text
+	})
+}
+
+// reviewURL returns the signed link to the review form for res, in the guest's language
+func (r *Reminders) reviewURL(l *i18n.Locale, res models.Reservation) string {
+	prefix := ""
+	if l.Code != i18n.DefaultLocale {
+		prefix = "/" + l.Code
+	}
+	token := links.Sign(r.App.SigningKey, links.Review, res.ID, r.now().Add(reviewLinkLifetime))
+	return r.App.BaseURL + prefix + "/reviews/" + token
+}
+
+// send records and queues one notification of kind per reservation, in the language the guest booked in.
+// compose returns the subject and body of the email and the text of the text message.
+func (r *Reminders) send(ctx context.Context, route, kind string, reservations []models.Reservation, compose func(*i18n.Locale, models.Reservation) (subject, body, text string)) error {
+	log := logger.FromContext(ctx)
+
+	for _, res := range reservations {
+		claimed, err := r.DB.RecordReservationEmail(ctx, res.ID, kind, r.now())
+		if err != nil {
+			return fmt.Errorf("cannot record %s email for reservation %d: %w", kind, res.ID, err)
+		}
+		if !claimed {
+			continue
+		}
+
+		l, ok := i18n.Get(res.Locale)
+		if !ok {
+			l = i18n.Default()
+		}
+		subject, body, text := compose(l, res)
+		msg := models.Notification{
+			Kind:     kind,
+			To:       res.Email,
+			Phone:    res.Phone,
+			Text:     text,
+			From:     r.App.MailConfig.FromAddress,
+			Subject:  subject,
+			Content:  body,
+			Template: "basic.html",
+			Locale:   l.Code,
+			Route:    route,
+		}
+
+		select {
+		case r.App.NotifyChan <- msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		metrics.ReservationEmailsQueued.Inc(kind)
+		log.Info("queued reservation email", "kind", kind, "reservation_id", res.ID)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package jobs
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/driver"
+	"github.com/ashparshp/bookings/internal/links"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/repository/dbrepo"
+	"github.com/ashparshp/bookings/internal/scheduler"
+)
+
+// today is the fixed date the tests run on
+var today = time.Date(2025, 7, 10, 8, 0, 0, 0, time.UTC)
+
+func day(offset int) time.Time {
+	return time.Date(2025, 7, 10+offset, 0, 0, 0, 0, time.UTC)
+}
+
+// stay is a reservation made by a guest called name, with start and end in days from today
+type stay struct {
+	name       string
+	start, end int
+	locale     string
+}
+
+// newReminders returns reminders over a fresh sqlite database holding the stays
+func newReminders(t *testing.T, stays ...stay) *Reminders {
+	t.Helper()
+
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.SQL.Close() })
+
+	app := &config.AppConfig{
+		DBDriver:   "sqlite",
+		NotifyChan: make(chan models.Notification, 10),
+		MailConfig: config.MailConfig{FromAddress: "hotel@example.com"},
+		BaseURL:    "https://hotel.example.com",
+		SigningKey: []byte("test signing key for review links"),
+	}
+	repo := dbrepo.NewSqliteRepo(db.SQL, app)
+	for _, s := range stays {
+		_, err := repo.InsertReservation(context.Background(), models.Reservation{
+			FirstName: s.name,
+			LastName:  "Guest",
+			Email:     strings.ToLower(s.name) + "@example.com",
+			Phone:     "555-0100",
+			StartDate: day(s.start),
+			EndDate:   day(s.end),
+			RoomID:    1,
+			Locale:    s.locale,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewReminders(app, repo, 3)
+	r.now = func() time.Time { return today }
+	return r
+}
+
+// queued drains the notification queue
+func queued(r *Reminders) []models.Notification {
+	var msgs []models.Notification
+	for {
+		select {
+		case m := <-r.App.NotifyChan:
+			msgs = append(msgs, m)
+		default:
+			return msgs
+		}
+	}
+}
+
+func recipients(msgs []models.Notification) []string {
+	var to []string
+	for _, m := range msgs {
+		to = append(to, m.To)
+	}
+	return to
+}
+
+func TestReminders_PreArrival(t *testing.T) {
+	r := newReminders(t,
+		stay{"Today", 0, 2, "en"},
+		stay{"Tomorrow", 1, 3, "es"},
+		stay{"Soon", 3, 5, "en"},
+		stay{"Later", 4, 6, "en"},
+	)
+
+	if err := r.PreArrival(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	msgs := queued(r)
+	if got := strings.Join(recipients(msgs), ","); got != "tomorrow@example.com,soon@example.com" {
+		t.Fatalf("expected reminders for arrivals in the next 3 days, got %s", got)
+	}
+
+	es := msgs[0]
+	if es.Locale != "es" || es.Subject != "Su estancia se acerca" || !strings.Contains(es.Content, "11 de julio de 2025") {
+		t.Errorf("expected the reminder in the guest's language, got %+v", es)
+	}
+	if es.From != "hotel@example.com" || es.Template != "basic.html" || es.Route != "job:pre-arrival-reminders" {
+		t.Errorf("unexpected message fields %+v", es)
+	}
+	// guests who want text messages get a shorter version
+	if es.Kind != models.NotifyPreArrival || es.Phone != "555-0100" || !strings.HasPrefix(es.Text, "Su estancia en") || !strings.Contains(es.Text, "11 de julio de 2025") {
+		t.Errorf("expected a text message in the guest's language, got kind %q to %q: %q", es.Kind, es.Phone, es.Text)
+	}
+
+	// running again, as another instance or after a restart would, sends nothing twice
+	if err := r.PreArrival(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := queued(r); len(msgs) != 0 {
+		t.Errorf("expected no duplicate reminders, got %v", recipients(msgs))
+	}
+}
+
+func TestReminders_CheckIn(t *testing.T) {
+	r := newReminders(t,
+		stay{"Today", 0, 2, "en"},
+		stay{"Tomorrow", 1, 3, "en"},
+	)
+
+	if err := r.CheckIn(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	msgs := queued(r)
+	if len(msgs) != 1 || msgs[0].To != "today@example.com" {
+		t.Fatalf("expected a check-in email for today's arrival only, got %v", recipients(msgs))
+	}
+	if !strings.Contains(msgs[0].Content, "3:00 PM") || !strings.Contains(msgs[0].Content, "July 12, 2025") {
+		t.Errorf("expected arrival information in the email, got %s", msgs[0].Content)
+	}
+
+	// the pre-arrival reminder is tracked separately from the check-in email
+	r.now = func() time.Time { return today.AddDate(0, 0, -1) }
+	if err := r.PreArrival(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(recipients(queued(r)), ","); got != "today@example.com,tomorrow@example.com" {
+		t.Errorf("expected pre-arrival reminders regardless of the check-in email, got %s", got)
+	}
+}
+
+func TestReminders_ThankYou(t *testing.T) {
+	r := newReminders(t,
+		stay{"Staying", -2, 1, "en"},
+		stay{"Leaving", -1, 0, "en"},
+		stay{"Left", -3, -1, "es"},
+		stay{"Long", -12, -10, "en"},
+	)
+
+	if err := r.ThankYou(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	msgs := queued(r)
+	if len(msgs) != 1 || msgs[0].To != "left@example.com" {
+		t.Fatalf("expected a thank-you for the guest who left yesterday only, got %v", recipients(msgs))
+	}
+	if msgs[0].Subject != "Gracias por alojarse con nosotros" {
+		t.Errorf("expected a Spanish subject, got %q", msgs[0].Subject)
+	}
+
+	// the email links to the review page in the guest's language, signed for their reservation
+	prefix := r.App.BaseURL + "/es/reviews/"
+	_, link, ok := strings.Cut(msgs[0].Content, prefix)
+	if !ok {
+		t.Fatalf("expected a review link starting %s in the email", prefix)
+	}
+	token, _, _ := strings.Cut(link, `"`)
+	if id, err := links.Verify(r.App.SigningKey, links.Review, token, today); err != nil || id != 3 {
+		t.Errorf("expected the link to be valid for reservation 3, got %d, %v", id, err)
+	}
+	if !strings.HasSuffix(msgs[0].Text, prefix+token) {
+		t.Errorf("expected the text message to end with the same link, got %q", msgs[0].Text)
+	}
+}
+
+func TestReminders_Register(t *testing.T) {
+	r := newReminders(t)
+	s := scheduler.New(&scheduler.LocalLocker{}, nil)
+
+	settings := config.DefaultSettings().Jobs
+	if err := r.Register(s, settings); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Jobs()) != 3 {
+		t.Errorf("expected 3 jobs, got %d", len(s.Jobs()))
+	}
+
+	settings.ThankYouSchedule = "tomorrow"
+	if err := r.Register(scheduler.New(&scheduler.LocalLocker{}, nil), settings); err == nil {
+		t.Error("expected an invalid schedule to be rejected")
+	}
+}
@@ -0,0 +1,45 @@
+package links
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	token := Sign(key, Review, 42, now.Add(time.Hour))
+
+	if strings.ContainsAny(token, "/+=?&") {
+		t.Errorf("expected a token safe to put in a URL path, got %q", token)
+	}
+
+	id, err := Verify(key, Review, token, now)
+	if err != nil || id != 42 {
+		t.Fatalf("expected id 42, got %d, %v", id, err)
+	}
+
+	tests := []struct {
+		name    string
+		key     []byte
+		purpose string
+		token   string
+		now     time.Time
+		want    error
+	}{
+		{"expired", key, Review, token, now.Add(2 * time.Hour), ErrExpired},
+		{"other key", []byte("another key"), Review, token, now, ErrInvalid},
+		{"other purpose", key, "invoice", token, now, ErrInvalid},
+		{"changed id", key, Review, "43" + token[2:], now, ErrInvalid},
+		{"changed expiry", key, Review, strings.Replace(token, ".", ".9", 1), now, ErrInvalid},
+		{"malformed", key, Review, "42", now, ErrInvalid},
+		{"empty", key, Review, "", now, ErrInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := Verify(tt.key, tt.purpose, tt.token, tt.now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
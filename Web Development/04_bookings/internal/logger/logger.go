@@ -0,0 +1,110 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// RequestIDHeader is the header used to receive and return request IDs
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength caps the length of request IDs accepted from clients
+const maxRequestIDLength = 64
+
+type contextKey string
+
+const (
+	loggerKey    contextKey = "logger"
+	requestIDKey contextKey = "request_id"
+)
+
+// New creates a logger writing to w, using JSON output when json is true and text output otherwise
+func New(w io.Writer, level slog.Level, json bool) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	if json {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// ParseLevel converts a level name (debug, info, warn, error) into a slog.Level
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// NewContext returns a copy of ctx carrying the logger l
+func NewContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// FromContext returns the request-scoped logger, or the default logger if there is none
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+			return l
+		}
+	}
+	return slog.Default()
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// NewRequestID generates a random request ID
+func NewRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ValidRequestID reports whether a client supplied request ID is safe to reuse in logs and headers
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	return strings.IndexFunc(id, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+	}) == -1
+}
+
+// WithDynamicAttrs returns a logger that adds the attributes returned by fn to every record.
+// Unlike With, fn is called when a line is logged, so values that change during a request are current.
+func WithDynamicAttrs(l *slog.Logger, fn func() []slog.Attr) *slog.Logger {
+	return slog.New(dynamicHandler{Handler: l.Handler(), attrs: fn})
+}
+
+type dynamicHandler struct {
+	slog.Handler
+	attrs func() []slog.Attr
+}
+
+func (h dynamicHandler) Handle(ctx context.Context, r slog.Record) error {
+	r = r.Clone()
+	r.AddAttrs(h.attrs()...)
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h dynamicHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return dynamicHandler{Handler: h.Handler.WithAttrs(attrs), attrs: h.attrs}
+}
+
+func (h dynamicHandler) WithGroup(name string) slog.Handler {
+	return dynamicHandler{Handler: h.Handler.WithGroup(name), attrs: h.attrs}
+}
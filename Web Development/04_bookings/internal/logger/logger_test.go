@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level != slog.LevelWarn {
+		t.Errorf("expected warn level, got %s", level)
+	}
+
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if FromContext(context.Background()) != slog.Default() {
+		t.Error("expected the default logger when the context has none")
+	}
+
+	l := New(&bytes.Buffer{}, slog.LevelInfo, true)
+	ctx := NewContext(context.Background(), l)
+	if FromContext(ctx) != l {
+		t.Error("expected the logger stored in the context")
+	}
+
+	ctx = WithRequestID(ctx, "abc")
+	if RequestIDFromContext(ctx) != "abc" {
+		t.Errorf("expected request ID abc, got %q", RequestIDFromContext(ctx))
+	}
+}
+
+func TestWithDynamicAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	userID := 0
+
+	l := WithDynamicAttrs(New(&buf, slog.LevelInfo, true).With("request_id", "abc"), func() []slog.Attr {
+		return []slog.Attr{slog.Int("user_id", userID)}
+	})
+
+	userID = 7
+	l.Info("logged in")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["user_id"] != float64(7) {
+		t.Errorf("expected user_id to be resolved when logging, got %v", entry["user_id"])
+	}
+	if entry["request_id"] != "abc" {
+		t.Errorf("expected request_id to be kept, got %v", entry["request_id"])
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	tests := map[string]bool{
+		"":                       false,
+		"abc-123_X.y":            true,
+		NewRequestID():           true,
+		"has space":              false,
+		"line\nbreak":            false,
+		string(make([]byte, 65)): false,
+	}
+
+	for id, want := range tests {
+		if got := ValidRequestID(id); got != want {
+			t.Errorf("ValidRequestID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
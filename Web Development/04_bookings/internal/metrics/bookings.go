@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+)
+
+// Default is the registry served on /metrics
+var Default = NewRegistry()
+
+var (
+	// HTTPRequests counts handled requests by method, chi route pattern and status code
+	HTTPRequests = Default.NewCounterVec("http_requests_total", "Number of HTTP requests handled.", "method", "route", "status")
+
+	// HTTPRequestDuration tracks request latency by method and chi route pattern
+	HTTPRequestDuration = Default.NewHistogramVec("http_request_duration_seconds", "HTTP request latency in seconds.", DefaultBuckets, "method", "route")
+
+	// ReservationsCreated counts reservations booked by guests
+	ReservationsCreated = Default.NewCounterVec("bookings_reservations_created_total", "Number of reservations created.")
+
+	// ReservationsCancelled counts reservations cancelled by staff
+	ReservationsCancelled = Default.NewCounterVec("bookings_reservations_cancelled_total", "Number of reservations cancelled.")
+
+	// MailsSent counts emails handed to the SMTP server
+	MailsSent = Default.NewCounterVec("bookings_mails_sent_total", "Number of emails sent.")
+
+	// MailsFailed counts emails that could not be sent
+	MailsFailed = Default.NewCounterVec("bookings_mails_failed_total", "Number of emails that failed to send.")
+
+	// Notifications counts notifications delivered by channel (email, sms) and result (sent, failed)
+	Notifications = Default.NewCounterVec("bookings_notifications_total", "Number of notifications delivered.", "channel", "result")
+
+	// LoginFailures counts rejected login attempts
+	LoginFailures = Default.NewCounterVec("bookings_login_failures_total", "Number of failed login attempts.")
+
+	// JobRuns counts scheduled job runs by job and status (ok, failed, locked)
+	JobRuns = Default.NewCounterVec("bookings_job_runs_total", "Number of scheduled job runs.", "job", "status")
+
+	// ReservationEmailsQueued counts scheduled reservation emails queued, by kind
+	ReservationEmailsQueued = Default.NewCounterVec("bookings_reservation_emails_queued_total", "Number of scheduled reservation emails queued.", "kind")
+
+	// PromoRedemptions counts promo codes applied to reservations, by code
+	PromoRedemptions = Default.NewCounterVec("bookings_promo_redemptions_total", "Number of promo codes redeemed.", "code")
+
+	// GuestDataRequests counts guest data exports and erasures, by action (export, anonymize)
+	GuestDataRequests = Default.NewCounterVec("bookings_guest_data_requests_total", "Number of guest data exports and erasures.", "action")
+
+	// WebhookDeliveries counts webhook delivery attempts by event and result (delivered, retry, failed)
+	WebhookDeliveries = Default.NewCounterVec("bookings_webhook_deliveries_total", "Number of webhook delivery attempts.", "event", "result")
+
+	// CSPViolations counts Content-Security-Policy violations reported by browsers
+	CSPViolations = Default.NewCounterVec("bookings_csp_violations_total", "Number of Content-Security-Policy violations reported.")
+)
+
+// Method returns m as a method label, or OTHER for a method outside the standard set, so clients can't add series
+// by inventing methods
+func Method(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return m
+	}
+	return "OTHER"
+}
+
+// RegisterDBStats exposes the connection pool statistics of db on the default registry
+func RegisterDBStats(db *sql.DB) {
+	Default.NewGaugeFunc("db_max_open_connections", "Maximum number of open connections to the database.", func() float64 {
+		return float64(db.Stats().MaxOpenConnections)
+	})
+	Default.NewGaugeFunc("db_open_connections", "Number of established connections, both in use and idle.", func() float64 {
+		return float64(db.Stats().OpenConnections)
+	})
+	Default.NewGaugeFunc("db_in_use_connections", "Number of connections currently in use.", func() float64 {
+		return float64(db.Stats().InUse)
+	})
+	Default.NewGaugeFunc("db_idle_connections", "Number of idle connections.", func() float64 {
+		return float64(db.Stats().Idle)
+	})
+	Default.NewCounterFunc("db_wait_count_total", "Total number of connections waited for.", func() float64 {
+		return float64(db.Stats().WaitCount)
+	})
+	Default.NewCounterFunc("db_wait_duration_seconds_total", "Total time blocked waiting for a new connection.", func() float64 {
+		return db.Stats().WaitDuration.Seconds()
+	})
+	Default.NewCounterFunc("db_max_idle_closed_total", "Total number of connections closed due to SetMaxIdleConns.", func() float64 {
+		return float64(db.Stats().MaxIdleClosed)
+	})
+	Default.NewCounterFunc("db_max_lifetime_closed_total", "Total number of connections closed due to SetConnMaxLifetime.", func() float64 {
+		return float64(db.Stats().MaxLifetimeClosed)
+	})
+}
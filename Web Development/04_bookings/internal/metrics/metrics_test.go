@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+
+	requests := r.NewCounterVec("requests_total", "Requests handled.", "route", "status")
+	requests.Inc("/rooms/{id}", "200")
+	requests.Inc("/rooms/{id}", "200")
+	requests.Inc(`/a"b`, "500")
+
+	logins := r.NewCounterVec("login_failures_total", "Failed logins.")
+
+	latency := r.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	latency.Observe(0.05, "/")
+	latency.Observe(0.5, "/")
+	latency.Observe(5, "/")
+
+	r.NewGaugeFunc("queue_depth", "Queued items.", func() float64 { return 3 })
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+	out := buf.String()
+
+	expected := []string{
+		"# TYPE requests_total counter",
+		`requests_total{route="/rooms/{id}",status="200"} 2`,
+		`requests_total{route="/a\"b",status="500"} 1`,
+		"# TYPE login_failures_total counter",
+		"login_failures_total 0",
+		"# TYPE latency_seconds histogram",
+		`latency_seconds_bucket{route="/",le="0.1"} 1`,
+		`latency_seconds_bucket{route="/",le="1"} 2`,
+		`latency_seconds_bucket{route="/",le="+Inf"} 3`,
+		`latency_seconds_sum{route="/"} 5.55`,
+		`latency_seconds_count{route="/"} 3`,
+		"# TYPE queue_depth gauge",
+		"queue_depth 3",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("expected output to contain %q, got:\n%s", line, out)
+		}
+	}
+
+	logins.Inc()
+	if logins.Value() != 1 {
+		t.Errorf("expected login failures to be 1, got %v", logins.Value())
+	}
+
+	// metrics are written in name order so scrapes are stable
+	if strings.Index(out, "latency_seconds") > strings.Index(out, "queue_depth") {
+		t.Error("expected metrics to be sorted by name")
+	}
+}
@@ -0,0 +1,372 @@
+// Package migrate applies the database migrations the binary carries. A migration is a pair of SQL files,
+// {version}_{name}.up.sql and {version}_{name}.down.sql, where the version is the UTC time it was created
+// as YYYYMMDDHHMMSS. The files are run on postgres and sqlite alike; where the two need different SQL, a
+// file with .postgres before .up.sql or .down.sql takes the place of the plain one on postgres. Applied
+// versions are recorded in the schema_migration table the soda CLI kept, so a database soda migrated
+// carries on where it left off.
+//
+// Each migration runs in its own transaction together with the recording of its version, so a failed
+// migration leaves neither its changes nor its version behind.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Migration is one step of the schema
+type Migration struct {
+	Version string
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and whether it has been applied. A version applied to the database that the
+// binary has no migration for is listed with an empty name.
+type Status struct {
+	Version string
+	Name    string
+	Applied bool
+}
+
+// VersionLayout is the time layout of migration versions
+const VersionLayout = "20060102150405"
+
+// Dialects the migrations are written for
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+var fileName = regexp.MustCompile(`^(\d{14})_(\w+?)(\.postgres)?\.(up|down)\.sql$`)
+
+// Load reads the migrations for dialect in the top directory of fsys, in order of version. Files not named
+// like a migration are ignored; a version without an up file for dialect is an error.
+func Load(fsys fs.FS, dialect string) ([]Migration, error) {
+	if dialect != Postgres && dialect != SQLite {
+		return nil, fmt.Errorf("no migrations for %q databases", dialect)
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[string]*Migration)
+	hasUp := make(map[string]bool)
+	replaced := make(map[string]bool) // version and direction of the files a .postgres file has replaced
+	for _, e := range entries {
+		parts := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || parts == nil {
+			continue
+		}
+		version, name, postgresOnly, direction := parts[1], parts[2], parts[3] != "", parts[4]
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migrations %s_%s and %s_%s share a version", version, m.Name, version, name)
+		}
+		if postgresOnly && dialect != Postgres || !postgresOnly && replaced[version+direction] {
+			continue
+		}
+		if postgresOnly {
+			replaced[version+direction] = true
+		}
+
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		if direction == "up" {
+			m.Up = string(b)
+			hasUp[version] = true
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for version, m := range byVersion {
+		if !hasUp[version] {
+			return nil, fmt.Errorf("migration %s_%s has no up file for %s", version, m.Name, dialect)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// renamedVersions maps the versions some migrations were first released under to their versions now. They
+// were dated days ahead of their creation, so a migration created in the meantime would have sorted, and
+// been applied, before them.
+var renamedVersions = map[string]string{
+	"20261019090000": "20261019075546",
+	"20261020090000": "20261019080343",
+	"20261021090000": "20261019081323",
+	"20261022090000": "20261019082107",
+	"20261023090000": "20261019083048",
+	"20261023090100": "20261019083049",
+	"20261023090200": "20261019083050",
+	"20261024090000": "20261019084028",
+	"20261024090100": "20261019084029",
+	"20261025090000": "20261019084654",
+	"20261025090100": "20261019084655",
+	"20261026090000": "20261019090633",
+	"20261027090000": "20261019100003",
+}
+
+// Migrator applies and rolls back migrations on a database
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+	// Renamed maps old versions of migrations to their current ones; a database that recorded an old
+	// version has it updated before anything else runs, rather than applying the migration again
+	Renamed map[string]string
+	// Lock keeps migrators on other instances from running at the same time; without it the caller must
+	// make sure only one runs
+	Lock func(ctx context.Context, conn *sql.Conn) (unlock func(), err error)
+}
+
+// New returns a migrator for a postgres database. It takes an advisory lock while it works, so servers
+// migrating on startup can start together.
+func New(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{DB: db, Migrations: migrations, Renamed: renamedVersions, Lock: advisoryLock}
+}
+
+// NewSQLite returns a migrator for a sqlite database. It needs no lock: sqlite lets one transaction write
+// at a time, and each migration is one transaction.
+func NewSQLite(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{DB: db, Migrations: migrations, Renamed: renamedVersions}
+}
+
+// advisoryLock holds a postgres advisory lock for as long as the connection does
+func advisoryLock(ctx context.Context, conn *sql.Conn) (func(), error) {
+	h := fnv.New64a()
+	h.Write([]byte("bookings:migrate"))
+	key := int64(h.Sum64())
+
+	if _, err := conn.ExecContext(ctx, "select pg_advisory_lock($1)", key); err != nil {
+		return nil, err
+	}
+	return func() {
+		conn.ExecContext(context.Background(), "select pg_advisory_unlock($1)", key)
+	}, nil
+}
+
+// Up applies every migration not applied yet, oldest first, and returns those it applied. It stops at
+// the first that fails.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withConn(ctx, func(conn *sql.Conn, applied map[string]bool) error {
+		for _, mg := range m.Migrations {
+			if applied[mg.Version] {
+				continue
+			}
+			err := run(ctx, conn, mg.Up, "INSERT INTO schema_migration (version) VALUES ($1)", mg.Version)
+			if err != nil {
+				return fmt.Errorf("migration %s_%s: %w", mg.Version, mg.Name, err)
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the n most recently applied migrations, newest first, and returns those it rolled back
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	if n < 1 {
+		return nil, errors.New("the number of migrations to roll back must be at least 1")
+	}
+
+	byVersion := make(map[string]Migration, len(m.Migrations))
+	for _, mg := range m.Migrations {
+		byVersion[mg.Version] = mg
+	}
+
+	var done []Migration
+	err := m.withConn(ctx, func(conn *sql.Conn, applied map[string]bool) error {
+		versions := make([]string, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(versions)))
+
+		for _, v := range versions[:min(n, len(versions))] {
+			mg, ok := byVersion[v]
+			if !ok {
+				return fmt.Errorf("migration %s is applied but this binary does not have it", v)
+			}
+			err := run(ctx, conn, mg.Down, "DELETE FROM schema_migration WHERE version = $1", mg.Version)
+			if err != nil {
+				return fmt.Errorf("rolling back migration %s_%s: %w", mg.Version, mg.Name, err)
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Baseline records every migration up to and including version as applied without running it, for a
+// database whose schema was created some other way, and returns those it recorded
+func (m *Migrator) Baseline(ctx context.Context, version string) ([]Migration, error) {
+	var done []Migration
+	err := m.withConn(ctx, func(conn *sql.Conn, applied map[string]bool) error {
+		for _, mg := range m.Migrations {
+			if mg.Version > version || applied[mg.Version] {
+				continue
+			}
+			if err := run(ctx, conn, "", "INSERT INTO schema_migration (version) VALUES ($1)", mg.Version); err != nil {
+				return fmt.Errorf("recording migration %s_%s: %w", mg.Version, mg.Name, err)
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists the migrations, oldest first, with whether each has been applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var list []Status
+	err := m.withConn(ctx, func(conn *sql.Conn, applied map[string]bool) error {
+		known := make(map[string]bool, len(m.Migrations))
+		for _, mg := range m.Migrations {
+			known[mg.Version] = true
+			list = append(list, Status{Version: mg.Version, Name: mg.Name, Applied: applied[mg.Version]})
+		}
+		for v := range applied {
+			if !known[v] {
+				list = append(list, Status{Version: v, Applied: true})
+			}
+		}
+		return nil
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, err
+}
+
+// withConn calls f on one connection, holding the lock and with the schema_migration table in place,
+// with the versions applied so far
+func (m *Migrator) withConn(ctx context.Context, f func(conn *sql.Conn, applied map[string]bool) error) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.Lock != nil {
+		unlock, err := m.Lock(ctx, conn)
+		if err != nil {
+			return fmt.Errorf("cannot lock migrations: %w", err)
+		}
+		defer unlock()
+	}
+
+	// the same table soda creates
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migration (version VARCHAR(14) NOT NULL);
+		CREATE UNIQUE INDEX IF NOT EXISTS schema_migration_version_idx ON schema_migration (version)`)
+	if err != nil {
+		return fmt.Errorf("cannot create schema_migration table: %w", err)
+	}
+	for old, current := range m.Renamed {
+		if _, err := conn.ExecContext(ctx, "UPDATE schema_migration SET version = $1 WHERE version = $2", current, old); err != nil {
+			return fmt.Errorf("cannot rename migration %s: %w", old, err)
+		}
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migration")
+	if err != nil {
+		return err
+	}
+	applied := make(map[string]bool)
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[v] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return f(conn, applied)
+}
+
+// run executes a migration's SQL and the statement recording it in one transaction
+func run(ctx context.Context, conn *sql.Conn, migration, record, version string) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if strings.TrimSpace(migration) != "" {
+		if _, err := tx.ExecContext(ctx, migration); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+var nonWord = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Create writes an empty up and down file for a new migration called name to dir and returns their paths.
+// The binary has to be rebuilt to carry it. The version is now, or a second after the newest migration in
+// dir if that is not earlier, so the new migration always runs last.
+func Create(dir, name string, now time.Time) ([]string, error) {
+	name = strings.Trim(nonWord.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return nil, errors.New("a migration needs a name")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	version := now.UTC().Format(VersionLayout)
+	for _, e := range entries {
+		parts := fileName.FindStringSubmatch(e.Name())
+		if parts == nil || parts[1] < version {
+			continue
+		}
+		newest, err := time.Parse(VersionLayout, parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has an invalid version: %w", e.Name(), err)
+		}
+		version = newest.Add(time.Second).Format(VersionLayout)
+	}
+
+	base := filepath.Join(dir, version+"_"+name)
+	paths := []string{base + ".up.sql", base + ".down.sql"}
+	for _, p := range paths {
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
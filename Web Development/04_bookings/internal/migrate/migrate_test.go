@@ -0,0 +1,326 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ashparshp/bookings"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// testMigrations are run on sqlite, so the runner can be tested without a postgres server
+var testMigrations = fstest.MapFS{
+	"20260101000000_create_rooms.up.sql":         {Data: []byte("CREATE TABLE rooms (id INTEGER PRIMARY KEY, name TEXT NOT NULL);")},
+	"20260101000000_create_rooms.down.sql":       {Data: []byte("DROP TABLE rooms;")},
+	"20260102000000_seed_rooms.up.sql":           {Data: []byte("INSERT INTO rooms (name) VALUES ('one');\nINSERT INTO rooms (name) VALUES ('two');")},
+	"20260102000000_seed_rooms.postgres.up.sql":  {Data: []byte("INSERT INTO public.rooms (name) VALUES ('one'), ('two');")},
+	"20260102000000_seed_rooms.down.sql":         {Data: []byte("DELETE FROM rooms;")},
+	"20260103000000_add_price_to_rooms.up.sql":   {Data: []byte("ALTER TABLE rooms ADD COLUMN price INTEGER NOT NULL DEFAULT 0;")},
+	"20260103000000_add_price_to_rooms.down.sql": {Data: []byte("ALTER TABLE rooms DROP COLUMN price;")},
+	"schema.sql":                           {Data: []byte("not a migration")},
+	"20260104000000_no_down_needed.up.sql": {Data: []byte("UPDATE rooms SET price = 100;")},
+}
+
+func newTestMigrator(t *testing.T, fsys fstest.MapFS) *Migrator {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := Load(fsys, SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Migrator{DB: db, Migrations: migrations}
+}
+
+func versions(migrations []Migration) string {
+	var v []string
+	for _, m := range migrations {
+		v = append(v, m.Version[6:8])
+	}
+	return strings.Join(v, ",")
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(testMigrations, SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(migrations); got != "01,02,03,04" {
+		t.Errorf("expected the migrations in order, got %s", got)
+	}
+	if m := migrations[1]; m.Name != "seed_rooms" || !strings.HasPrefix(m.Up, "INSERT INTO rooms") || m.Down != "DELETE FROM rooms;" {
+		t.Errorf("unexpected migration %+v", m)
+	}
+
+	// postgres runs the .postgres file in place of the plain one, and the plain files it has no variant of
+	migrations, err = Load(testMigrations, Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := migrations[1]; !strings.HasPrefix(m.Up, "INSERT INTO public.rooms") || m.Down != "DELETE FROM rooms;" {
+		t.Errorf("expected the postgres variant, got %+v", m)
+	}
+	if got := versions(migrations); got != "01,02,03,04" {
+		t.Errorf("expected the migrations in order, got %s", got)
+	}
+
+	if _, err := Load(fstest.MapFS{"20260101000000_only_down.down.sql": {}}, SQLite); err == nil {
+		t.Error("expected an error for a migration without an up file")
+	}
+	if _, err := Load(fstest.MapFS{"20260101000000_seed.postgres.up.sql": {}}, SQLite); err == nil {
+		t.Error("expected an error for a migration sqlite has no up file for")
+	}
+	if _, err := Load(fstest.MapFS{
+		"20260101000000_one.up.sql": {},
+		"20260101000000_two.up.sql": {},
+	}, SQLite); err == nil {
+		t.Error("expected an error for two migrations with the same version")
+	}
+	if _, err := Load(testMigrations, "mysql"); err == nil {
+		t.Error("expected an error for a database without migrations")
+	}
+}
+
+func TestLoad_Embedded(t *testing.T) {
+	for _, dialect := range []string{Postgres, SQLite} {
+		migrations, err := Load(bookings.Migrations(), dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrations) == 0 || migrations[0].Name != "create_user_table" {
+			t.Fatalf("expected the embedded %s migrations, got %d", dialect, len(migrations))
+		}
+		for _, current := range renamedVersions {
+			if !slices.ContainsFunc(migrations, func(m Migration) bool { return m.Version == current }) {
+				t.Errorf("no %s migration has the renamed version %s", dialect, current)
+			}
+		}
+	}
+
+	migrations, err := Load(bookings.Migrations(), Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if strings.TrimSpace(m.Up) == "" {
+			t.Errorf("migration %s_%s does nothing", m.Version, m.Name)
+		}
+	}
+}
+
+func TestMigrator_Embedded(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	migrations, err := Load(bookings.Migrations(), SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewSQLite(db, migrations)
+
+	// every migration runs on sqlite, and rolls back again
+	if done, err := m.Up(ctx); err != nil || len(done) != len(migrations) {
+		t.Fatalf("expected all %d migrations applied, got %d %v", len(migrations), len(done), err)
+	}
+	var rooms int
+	if err := db.QueryRow("SELECT COUNT(*) FROM rooms WHERE price_cents > 0 AND cancellation_policy_id IS NOT NULL").Scan(&rooms); err != nil || rooms != 2 {
+		t.Errorf("expected the seeded rooms, got %d %v", rooms, err)
+	}
+	if done, err := m.Down(ctx, len(migrations)); err != nil || len(done) != len(migrations) {
+		t.Fatalf("expected all migrations rolled back, got %d %v", len(done), err)
+	}
+	var tables int
+	db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migration', 'sqlite_sequence')").Scan(&tables)
+	if tables != 0 {
+		t.Errorf("expected no tables left, got %d", tables)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMigrator(t, testMigrations)
+
+	done, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(done); got != "01,02,03,04" {
+		t.Errorf("expected all migrations applied, got %s", got)
+	}
+	var price int
+	if err := m.DB.QueryRow("SELECT price FROM rooms WHERE name = 'two'").Scan(&price); err != nil || price != 100 {
+		t.Errorf("expected the migrated rooms, got %d %v", price, err)
+	}
+
+	// nothing left to do
+	if done, err := m.Up(ctx); err != nil || len(done) != 0 {
+		t.Errorf("expected no migrations applied twice, got %s %v", versions(done), err)
+	}
+
+	done, err = m.Down(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(done); got != "04,03" {
+		t.Errorf("expected the two latest rolled back, got %s", got)
+	}
+	if _, err := m.DB.Exec("SELECT price FROM rooms"); err == nil {
+		t.Error("expected the price column dropped")
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var applied []string
+	for _, s := range status {
+		if s.Applied {
+			applied = append(applied, s.Name)
+		}
+	}
+	if len(status) != 4 || strings.Join(applied, ",") != "create_rooms,seed_rooms" {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	if _, err := m.Down(ctx, 0); err == nil {
+		t.Error("expected an error rolling back no migrations")
+	}
+	// asking for more than were applied rolls back the rest
+	if done, err := m.Down(ctx, 10); err != nil || versions(done) != "02,01" {
+		t.Errorf("expected the rest rolled back, got %s %v", versions(done), err)
+	}
+}
+
+func TestMigrator_FailedMigration(t *testing.T) {
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"20260101000000_create_rooms.up.sql": testMigrations["20260101000000_create_rooms.up.sql"],
+		// the insert succeeds before the typo fails, and is rolled back with it
+		"20260102000000_broken.up.sql": {Data: []byte("INSERT INTO rooms (name) VALUES ('one');\nINSERT INTO roms (name) VALUES ('two');")},
+		"20260103000000_later.up.sql":  {Data: []byte("INSERT INTO rooms (name) VALUES ('three');")},
+	}
+	m := newTestMigrator(t, fsys)
+
+	done, err := m.Up(ctx)
+	if err == nil || !strings.Contains(err.Error(), "20260102000000_broken") {
+		t.Fatalf("expected the broken migration to fail, got %v", err)
+	}
+	if versions(done) != "01" {
+		t.Errorf("expected only the first migration applied, got %s", versions(done))
+	}
+
+	var rooms int
+	m.DB.QueryRow("SELECT COUNT(*) FROM rooms").Scan(&rooms)
+	if rooms != 0 {
+		t.Errorf("expected the failed migration rolled back, got %d rooms", rooms)
+	}
+	status, _ := m.Status(ctx)
+	if len(status) != 3 || !status[0].Applied || status[1].Applied || status[2].Applied {
+		t.Errorf("expected only the first migration recorded, got %+v", status)
+	}
+
+	// a version in the database that the binary does not know is listed, and not rolled back blindly
+	m.DB.Exec("INSERT INTO schema_migration (version) VALUES ('20270101000000')")
+	status, _ = m.Status(ctx)
+	if last := status[len(status)-1]; last.Version != "20270101000000" || last.Name != "" || !last.Applied {
+		t.Errorf("expected the unknown version listed, got %+v", last)
+	}
+	if _, err := m.Down(ctx, 1); err == nil {
+		t.Error("expected an error rolling back a migration the binary does not have")
+	}
+}
+
+func TestMigrator_Renamed(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMigrator(t, testMigrations)
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the database recorded the price migration under the version it was released with
+	m.DB.Exec("UPDATE schema_migration SET version = '20270103000000' WHERE version = '20260103000000'")
+	m.Renamed = map[string]string{"20270103000000": "20260103000000"}
+
+	if done, err := m.Up(ctx); err != nil || len(done) != 0 {
+		t.Errorf("expected the renamed migration not to run again, got %s %v", versions(done), err)
+	}
+	status, _ := m.Status(ctx)
+	if len(status) != 4 || !status[2].Applied {
+		t.Errorf("expected the migration recorded under its new version, got %+v", status)
+	}
+}
+
+func TestMigrator_Baseline(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMigrator(t, testMigrations)
+
+	// the rooms table was made before there were migrations
+	m.DB.Exec("CREATE TABLE rooms (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+	done, err := m.Baseline(ctx, "20260102000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(done); got != "01,02" {
+		t.Errorf("expected the first two recorded, got %s", got)
+	}
+	var rooms int
+	m.DB.QueryRow("SELECT COUNT(*) FROM rooms").Scan(&rooms)
+	if rooms != 0 {
+		t.Errorf("expected the seed not run, got %d rooms", rooms)
+	}
+
+	if done, err := m.Up(ctx); err != nil || versions(done) != "03,04" {
+		t.Errorf("expected the rest applied, got %s %v", versions(done), err)
+	}
+	if done, err := m.Baseline(ctx, "20260104000000"); err != nil || len(done) != 0 {
+		t.Errorf("expected nothing recorded twice, got %s %v", versions(done), err)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 27, 9, 30, 0, 0, time.FixedZone("CET", 3600))
+
+	paths, err := Create(dir, "Add Notes to Rooms!", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "20261027083000_add_notes_to_rooms.up.sql"),
+		filepath.Join(dir, "20261027083000_add_notes_to_rooms.down.sql"),
+	}
+	if len(paths) != 2 || paths[0] != want[0] || paths[1] != want[1] {
+		t.Errorf("expected %v, got %v", want, paths)
+	}
+	for _, p := range want {
+		if _, err := os.Stat(p); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// a clock behind the newest migration still puts the new one after it
+	paths, err = Create(dir, "add notes to rooms", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "20261027083001_add_notes_to_rooms.up.sql"); paths[0] != want {
+		t.Errorf("expected %s, got %s", want, paths[0])
+	}
+	if _, err := Create(dir, "!!", now); err == nil {
+		t.Error("expected an error for a migration without a name")
+	}
+}
@@ -20,6 +20,10 @@ type User struct {
 type Room struct {
 	ID int
 	RoomName string
+	// PriceCents is the price of one night
+	PriceCents int
+	// CancellationPolicyID is the policy new reservations of the room are booked under
+	CancellationPolicyID int
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
@@ -45,6 +49,25 @@ type Reservation struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Processed int
+	Locale string
+	// SubtotalCents is the room price for the stay, DiscountCents what a promo code took off it and
+	// TotalCents what the guest pays
+	SubtotalCents int
+	DiscountCents int
+	TotalCents int
+	// PromoCode is the code redeemed on the reservation, empty if none was
+	PromoCode string
+	// CancellationPolicyID is the policy the reservation was booked under, zero for reservations booked
+	// before there were policies
+	CancellationPolicyID int
+	// CancelledAt is zero unless the reservation was cancelled, when PenaltyCents is what the guest was
+	// charged and RefundCents what they get back
+	CancelledAt time.Time
+	PenaltyCents int
+	RefundCents int
+	// GuestID is the guest profile the reservation belongs to. The names, email and phone above are what
+	// was entered for this reservation.
+	GuestID int
 	Room Room
 }
 
@@ -63,11 +86,244 @@ type RoomRestriction struct {
 	Restriction Restriction
 }
 
-// MailData holds an email message
-type MailData struct {
+// RoomOccupancy is a room with the restrictions on it over some period, in order of start date
+type RoomOccupancy struct {
+	Room Room
+	Busy []RoomRestriction
+}
+
+// Guest is a person who has booked, told apart from other guests by their normalized email. The names and
+// phone are the latest ones they booked with.
+type Guest struct {
+	ID int
+	Email string
+	FirstName string
+	LastName string
+	Phone string
+	// Notes are staff's own notes on the guest, never shown to them
+	Notes string
+	// AnonymizedAt is zero unless the guest's personal data was erased
+	AnonymizedAt time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Stays counts the guest's reservations that were not cancelled and LastStay is the arrival day of the
+	// latest one, for the guest list
+	Stays int
+	LastStay time.Time
+}
+
+// Session is a stored browser session, for both guests and logged in users
+type Session struct {
+	// Token is a hash of the session cookie, so the table cannot be used to hijack sessions
+	Token string
+	// UserID is zero for guests
+	UserID int
+	Data []byte
+	Expiry time.Time
+	IPAddress string
+	UserAgent string
+	LastActivity time.Time
+	CreatedAt time.Time
+}
+
+// Review is a guest's rating and comments on the room of a completed stay
+type Review struct {
+	ID int
+	ReservationID int
+	RoomID int
+	// Rating is from 1 to 5 stars
+	Rating int
+	Body string
+	Status string
+	// Reply is the hotel's public answer, empty if there is none
+	Reply string
+	RepliedAt time.Time
+	// ModeratedBy is the user who last approved, hid or replied to the review, zero if nobody has
+	ModeratedBy int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Room Room
+	Reservation Reservation
+}
+
+// Review statuses: new reviews wait for a moderator, who approves them for the room page or hides them
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewHidden   = "hidden"
+)
+
+// PromoCode is a discount guests enter when booking. Zero dates leave a window open on that side and zero
+// limits mean unlimited.
+type PromoCode struct {
+	ID int
+	// Code is stored upper case; guests may enter it in any case
+	Code string
+	Description string
+	// Kind is PromoPercent, with Amount the percentage taken off, or PromoFixed, with Amount in cents
+	Kind string
+	Amount int
+	// BookingStart and BookingEnd are the days the code may be used on
+	BookingStart time.Time
+	BookingEnd time.Time
+	// StayStart and StayEnd are the first arrival and last departure day the code is valid for
+	StayStart time.Time
+	StayEnd time.Time
+	MinNights int
+	MaxUses int
+	MaxUsesPerEmail int
+	// RoomIDs are the rooms the code is valid for, all rooms if empty
+	RoomIDs []int
+	Active bool
+	// Uses and DiscountCents are the number of redemptions and the total discount given
+	Uses int
+	DiscountCents int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Promo code kinds
+const (
+	PromoPercent = "percent"
+	PromoFixed   = "fixed"
+)
+
+// PromoRedemption records a promo code applied to a reservation
+type PromoRedemption struct {
+	ID int
+	PromoCodeID int
+	ReservationID int
+	// Email is the guest's address, lower case, for the per email limit
+	Email string
+	DiscountCents int
+	CreatedAt time.Time
+}
+
+// CancellationPolicy decides what a guest is charged for cancelling. Policies are not edited once created,
+// so a reservation is always cancelled under the terms it was booked with.
+type CancellationPolicy struct {
+	ID int
+	Name string
+	Description string
+	// Tiers are ordered from the earliest cancellation to the latest
+	Tiers []CancellationTier
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// CancellationTier charges PenaltyPercent of the total for cancelling at least DaysBefore days before arrival
+type CancellationTier struct {
+	DaysBefore int
+	PenaltyPercent int
+}
+
+// WebhookEndpoint is an address outside the site that is told about reservation and calendar changes
+type WebhookEndpoint struct {
+	ID int
+	URL string
+	// Secret signs every delivery, so the receiver can check it came from the site
+	Secret string
+	// Events are the names of the events the endpoint subscribed to
+	Events []string
+	Active bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// WebhookDelivery is one event posted, or still to be posted, to an endpoint. Failed attempts are retried
+// at NextAttemptAt until the delivery succeeds or runs out of attempts.
+type WebhookDelivery struct {
+	ID int
+	EndpointID int
+	Event string
+	// Payload is the JSON body, kept as it was first sent so a redelivery is identical
+	Payload string
+	Status string
+	Attempts int
+	NextAttemptAt time.Time
+	// LastStatusCode and LastError describe the latest attempt; the code is zero if no response came back
+	LastStatusCode int
+	LastError string
+	DeliveredAt time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Endpoint WebhookEndpoint
+}
+
+// Webhook delivery statuses: pending deliveries are still being tried, failed ones ran out of attempts
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// Kinds of scheduled email sent about a reservation, each at most once
+const (
+	EmailPreArrival = "pre_arrival"
+	EmailCheckIn    = "check_in"
+	EmailThankYou   = "thank_you"
+)
+
+// Notification is a message to a guest or to staff. It goes out on the channels the recipient wants its
+// kind of message on, each of which renders it its own way: email sends the subject and the HTML content,
+// wrapped in its template, with the attachments, and SMS sends the text.
+type Notification struct {
+	// Kind is what the message is about, one of the Notify constants
+	Kind string
+	// To is the email address, whose guest's preferences decide the channels
 	To      string
+	// Phone is the number text messages go to, none are sent without one
+	Phone   string
 	From    string
 	Subject string
 	Content string
 	Template string
-}
\ No newline at end of file
+	// Text is the short plain version sent by text message; kinds without one are only emailed
+	Text string
+	// Locale is the language the template is rendered in
+	Locale string
+	// RequestID, UserID and Route identify the request that queued the message, for logging
+	RequestID string
+	UserID int
+	Route string
+	// Attachments are sent as files with the message
+	Attachments []Attachment
+}
+
+// Kinds of notification. Guests choose the channels of the guest kinds; staff notices are always emailed.
+const (
+	NotifyConfirmation   = "confirmation"
+	NotifyCancellation   = "cancellation"
+	NotifyPreArrival     = EmailPreArrival
+	NotifyCheckIn        = EmailCheckIn
+	NotifyThankYou       = EmailThankYou
+	NotifyNewReservation = "new_reservation"
+)
+
+// Notification channels
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+// NotificationPreference is whether a guest wants one kind of notification on one channel. Without one the
+// default of the channel applies: email on, SMS off.
+type NotificationPreference struct {
+	Kind string
+	Channel string
+	Enabled bool
+}
+
+// Attachment is a file sent with an email
+type Attachment struct {
+	Name string
+	ContentType string
+	Data []byte
+}
+
+// Day returns the date of t at midnight UTC, as reservation dates are stored, so dates read from different
+// databases, or times later in the same day, compare equal
+func Day(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -14,4 +14,8 @@ type TemplateData struct {
 	Error string
 	Form *forms.Form
 	IsAuthenticated int
+	Locale string
+	Path string
+	// CSPNonce lets the page's inline scripts run under the Content-Security-Policy
+	CSPNonce string
 }
\ No newline at end of file
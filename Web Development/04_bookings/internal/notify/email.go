@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/i18n"
+	"github.com/ashparshp/bookings/internal/metrics"
+	"github.com/ashparshp/bookings/internal/models"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// smtpTimeout bounds connecting to the SMTP server and sending one message
+const smtpTimeout = 10 * time.Second
+
+// SMTP sends notifications by email
+type SMTP struct {
+	Config config.MailConfig
+	// Templates holds the email templates messages are wrapped in
+	Templates fs.FS
+}
+
+// NewSMTP returns an email notifier sending through the server in cfg
+func NewSMTP(cfg config.MailConfig, templates fs.FS) *SMTP {
+	return &SMTP{Config: cfg, Templates: templates}
+}
+
+// Channel returns models.ChannelEmail
+func (s *SMTP) Channel() string {
+	return models.ChannelEmail
+}
+
+// Notify renders n as an email and hands it to the SMTP server
+func (s *SMTP) Notify(_ context.Context, n models.Notification) error {
+	server := mail.NewSMTPClient()
+	server.Host = s.Config.Host
+	server.Port = s.Config.Port
+	server.Username = s.Config.Username
+	server.Password = s.Config.Password
+	server.KeepAlive = false
+	server.ConnectTimeout = smtpTimeout
+	server.SendTimeout = smtpTimeout
+
+	// the settings only let these through
+	switch strings.ToLower(s.Config.Encryption) {
+	case "starttls", "tls":
+		server.Encryption = mail.EncryptionSTARTTLS
+	case "ssl":
+		server.Encryption = mail.EncryptionSSLTLS
+	default:
+		server.Encryption = mail.EncryptionNone
+	}
+
+	if s.Config.Host == "smtp.gmail.com" && s.Config.Port == 465 {
+		server.Encryption = mail.EncryptionSSLTLS
+		server.TLSConfig = &tls.Config{InsecureSkipVerify: false}
+	}
+
+	if s.Config.Username != "" && s.Config.Password != "" {
+		server.Authentication = mail.AuthPlain
+	}
+
+	email, err := newEmail(s.Config, s.Templates, n)
+	if err != nil {
+		metrics.MailsFailed.Inc()
+		return fmt.Errorf("cannot render email: %w", err)
+	}
+
+	client, err := server.Connect()
+	if err != nil {
+		metrics.MailsFailed.Inc()
+		return fmt.Errorf("cannot connect to mail server: %w", err)
+	}
+
+	if err := email.Send(client); err != nil {
+		metrics.MailsFailed.Inc()
+		return fmt.Errorf("cannot send email: %w", err)
+	}
+
+	metrics.MailsSent.Inc()
+	return nil
+}
+
+// newEmail builds the email of n, sent from its From address or the configured one
+func newEmail(cfg config.MailConfig, templates fs.FS, n models.Notification) (*mail.Email, error) {
+	body, err := RenderEmail(templates, n)
+	if err != nil {
+		return nil, err
+	}
+
+	from := cfg.FromAddress
+	if n.From != "" {
+		from = n.From
+	}
+
+	email := mail.NewMSG()
+	email.SetFrom(from).
+		AddTo(n.To).
+		SetSubject(n.Subject)
+	email.SetBody(mail.TextHTML, body)
+	for _, a := range n.Attachments {
+		email.Attach(&mail.File{Name: a.Name, MimeType: a.ContentType, Data: a.Data})
+	}
+	return email, email.GetError()
+}
+
+// RenderEmail returns the HTML body of n: its content on its own, or wrapped in its email template from
+// templates. Templates are rendered in the message's locale and receive the content as .Body.
+func RenderEmail(templates fs.FS, n models.Notification) (string, error) {
+	if n.Template == "" {
+		return n.Content, nil
+	}
+
+	locale, ok := i18n.Get(n.Locale)
+	if !ok {
+		locale = i18n.Default()
+	}
+
+	t, err := template.New(n.Template).
+		Funcs(template.FuncMap{"T": locale.T}).
+		ParseFS(templates, n.Template)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = t.Execute(&buf, map[string]any{
+		// the content is built by the handlers, which escape anything the guest typed
+		"Body":   template.HTML(n.Content),
+		"Locale": locale.Code,
+	})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
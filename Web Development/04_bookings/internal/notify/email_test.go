@@ -0,0 +1,47 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ashparshp/bookings"
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+func TestRenderEmail(t *testing.T) {
+	templates := bookings.Load(false, ".").MailTemplates
+
+	body, err := RenderEmail(templates, models.Notification{Content: "<p>plain</p>"})
+	if err != nil || body != "<p>plain</p>" {
+		t.Errorf("expected content without a template to be sent as is, got %q, %v", body, err)
+	}
+
+	body, err = RenderEmail(templates, models.Notification{Content: "<p>Hola</p>", Template: "basic.html", Locale: "es"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<p>Hola</p>", `lang="es"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected the embedded template to contain %q:\n%s", want, body)
+		}
+	}
+
+	if _, err := RenderEmail(templates, models.Notification{Template: "missing.html"}); err == nil {
+		t.Error("expected an error for a missing template")
+	}
+}
+
+func TestRenderEmail_FS(t *testing.T) {
+	// dev mode reads email templates from disk; any file system works
+	templates := fstest.MapFS{
+		"short.html": {Data: []byte(`{{T "Reservation Confirmation"}}: {{.Body}}`)},
+	}
+	body, err := RenderEmail(templates, models.Notification{Content: "ok", Template: "short.html", Locale: "es"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "Confirmación de reserva: ok" {
+		t.Errorf("unexpected body %q", body)
+	}
+}
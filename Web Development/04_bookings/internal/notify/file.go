@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+// FileSink writes the notifications of one channel to a directory instead of sending them, for
+// development: emails as .eml files, which mail clients open with their attachments, and text messages as
+// .txt files. Files are named after the time they were written, so they list in order.
+type FileSink struct {
+	Dir     string
+	channel string
+	// Mail and Templates render emails as the SMTP notifier would
+	Mail      config.MailConfig
+	Templates fs.FS
+
+	now func() time.Time
+	seq atomic.Uint64
+}
+
+// NewFileSink returns a sink writing the notifications of channel to dir, which is created if needed
+func NewFileSink(dir, channel string, mail config.MailConfig, templates fs.FS) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileSink{
+		Dir:       dir,
+		channel:   channel,
+		Mail:      mail,
+		Templates: templates,
+		now:       time.Now,
+	}, nil
+}
+
+// Channel returns the channel the sink stands in for
+func (f *FileSink) Channel() string {
+	return f.channel
+}
+
+// Notify renders n for the channel and writes it to a new file
+func (f *FileSink) Notify(_ context.Context, n models.Notification) error {
+	var ext, content string
+	switch f.channel {
+	case models.ChannelEmail:
+		email, err := newEmail(f.Mail, f.Templates, n)
+		if err != nil {
+			return fmt.Errorf("cannot render email: %w", err)
+		}
+		ext, content = ".eml", email.GetMessage()
+	case models.ChannelSMS:
+		ext = ".txt"
+		content = fmt.Sprintf("To: %s\nKind: %s\n\n%s\n", n.Phone, n.Kind, RenderSMS(n))
+	default:
+		return fmt.Errorf("unknown channel %q", f.channel)
+	}
+
+	name := fmt.Sprintf("%s-%03d-%s-%s%s", f.now().UTC().Format("20060102-150405.000000"), f.seq.Add(1)%1000,
+		f.channel, fileNamePart(n.Kind), ext)
+	return os.WriteFile(filepath.Join(f.Dir, name), []byte(content), 0o644)
+}
+
+// fileNamePart keeps the letters, digits, dashes and underscores of s
+func fileNamePart(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return -1
+	}, s)
+	if s == "" {
+		return "message"
+	}
+	return s
+}
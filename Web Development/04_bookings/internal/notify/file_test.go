@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+func TestFileSink_Notify(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	mail := config.MailConfig{FromAddress: "hotel@example.com"}
+	at := time.Date(2025, 7, 10, 8, 30, 0, 0, time.UTC)
+
+	n := models.Notification{
+		Kind:        models.NotifyConfirmation,
+		To:          "ana@example.com",
+		Phone:       "555-0100",
+		Subject:     "Reservation Confirmation",
+		Content:     "<p>See you soon</p>",
+		Text:        "Your reservation is confirmed.",
+		Attachments: []models.Attachment{{Name: "confirmation.pdf", ContentType: "application/pdf", Data: []byte("%PDF")}},
+	}
+	for _, channel := range Channels {
+		sink, err := NewFileSink(dir, channel, mail, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sink.now = func() time.Time { return at }
+		if err := sink.Notify(context.Background(), n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read := func(name string) string {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	eml := read("20250710-083000.000000-001-email-confirmation.eml")
+	for _, want := range []string{"To: <ana@example.com>", "From: <hotel@example.com>", "Subject: Reservation Confirmation", "confirmation.pdf"} {
+		if !strings.Contains(eml, want) {
+			t.Errorf("expected the email to contain %q:\n%s", want, eml)
+		}
+	}
+
+	txt := read("20250710-083000.000000-001-sms-confirmation.txt")
+	if txt != "To: 555-0100\nKind: confirmation\n\nYour reservation is confirmed.\n" {
+		t.Errorf("unexpected text message file %q", txt)
+	}
+}
+
+func TestFileNamePart(t *testing.T) {
+	for in, want := range map[string]string{"check_in": "check_in", "../etc/passwd": "etcpasswd", "": "message"} {
+		if got := fileNamePart(in); got != want {
+			t.Errorf("fileNamePart(%q) = %q, wanted %q", in, got, want)
+		}
+	}
+}
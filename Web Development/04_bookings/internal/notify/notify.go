@@ -0,0 +1,152 @@
+// Package notify delivers the messages sent to guests and staff. A Dispatcher sends each notification on
+// the channels its recipient wants its kind of message on, through one Notifier per channel: email over
+// SMTP, text messages through an HTTP provider or, in development, files written to a directory.
+package notify
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ashparshp/bookings/internal/metrics"
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+// Notifier delivers notifications on one channel
+type Notifier interface {
+	// Channel is the channel the notifier delivers on, models.ChannelEmail or models.ChannelSMS
+	Channel() string
+	// Notify renders n for the channel and delivers it
+	Notify(ctx context.Context, n models.Notification) error
+}
+
+// GuestKinds are the kinds of notification guests choose the channels of, in the order they are listed
+var GuestKinds = []string{
+	models.NotifyConfirmation,
+	models.NotifyCancellation,
+	models.NotifyPreArrival,
+	models.NotifyCheckIn,
+	models.NotifyThankYou,
+}
+
+// Channels are the notification channels, in the order they are listed
+var Channels = []string{models.ChannelEmail, models.ChannelSMS}
+
+var kindNames = map[string]string{
+	models.NotifyConfirmation:   "Booking confirmation",
+	models.NotifyCancellation:   "Cancellation",
+	models.NotifyPreArrival:     "Pre-arrival reminder",
+	models.NotifyCheckIn:        "Check-in day",
+	models.NotifyThankYou:       "Thank you and review invitation",
+	models.NotifyNewReservation: "New reservation (staff)",
+}
+
+// KindName returns the name staff know a kind of notification by
+func KindName(kind string) string {
+	if name, ok := kindNames[kind]; ok {
+		return name
+	}
+	return kind
+}
+
+// IsGuestKind reports whether guests choose the channels of kind
+func IsGuestKind(kind string) bool {
+	for _, k := range GuestKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// IsChannel reports whether channel is a notification channel
+func IsChannel(channel string) bool {
+	for _, c := range Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// Wants reports whether a recipient with prefs wants kind on channel. Staff notices, and guests who have not
+// chosen, get the default of the channel: email, but no text messages.
+func Wants(prefs []models.NotificationPreference, kind, channel string) bool {
+	if IsGuestKind(kind) {
+		for _, p := range prefs {
+			if p.Kind == kind && p.Channel == channel {
+				return p.Enabled
+			}
+		}
+	}
+	return channel == models.ChannelEmail
+}
+
+// PreferenceStore looks up the notification preferences of the guest with an email address
+type PreferenceStore interface {
+	NotificationPreferences(ctx context.Context, email string) ([]models.NotificationPreference, error)
+}
+
+// Dispatcher sends notifications on the channels their recipients want
+type Dispatcher struct {
+	Prefs     PreferenceStore
+	notifiers map[string]Notifier
+	log       *slog.Logger
+}
+
+// NewDispatcher returns a dispatcher sending through notifiers, one per channel, logging to log or the
+// default logger if nil. Channels without a notifier are skipped.
+func NewDispatcher(prefs PreferenceStore, log *slog.Logger, notifiers ...Notifier) *Dispatcher {
+	if log == nil {
+		log = slog.Default()
+	}
+	d := &Dispatcher{
+		Prefs:     prefs,
+		notifiers: make(map[string]Notifier),
+		log:       log,
+	}
+	for _, n := range notifiers {
+		d.notifiers[n.Channel()] = n
+	}
+	return d
+}
+
+// Send delivers n on every channel its recipient wants it on and has an address for. A failure is logged
+// and counted, and does not stop the other channels.
+func (d *Dispatcher) Send(ctx context.Context, n models.Notification) {
+	log := d.log.With("request_id", n.RequestID, "user_id", n.UserID, "route", n.Route, "kind", n.Kind)
+
+	var prefs []models.NotificationPreference
+	if IsGuestKind(n.Kind) && n.To != "" {
+		var err error
+		prefs, err = d.Prefs.NotificationPreferences(ctx, n.To)
+		if err != nil {
+			// a confirmation on the default channel is better than none at all
+			log.Error("cannot load notification preferences, using the defaults", "error", err)
+		}
+	}
+
+	for _, channel := range Channels {
+		notifier, ok := d.notifiers[channel]
+		if !ok || !Wants(prefs, n.Kind, channel) || !deliverable(n, channel) {
+			continue
+		}
+		if err := notifier.Notify(ctx, n); err != nil {
+			metrics.Notifications.Inc(channel, "failed")
+			log.Error("cannot send notification", "channel", channel, "error", err)
+			continue
+		}
+		metrics.Notifications.Inc(channel, "sent")
+		log.Info("notification sent", "channel", channel)
+	}
+}
+
+// deliverable reports whether n has what channel needs: an email address, or a phone number and a text
+func deliverable(n models.Notification, channel string) bool {
+	switch channel {
+	case models.ChannelEmail:
+		return n.To != ""
+	case models.ChannelSMS:
+		return n.Phone != "" && n.Text != ""
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+// recorder is a notifier remembering who it was asked to notify
+type recorder struct {
+	channel string
+	err     error
+	sent    []string
+}
+
+func (r *recorder) Channel() string {
+	return r.channel
+}
+
+func (r *recorder) Notify(_ context.Context, n models.Notification) error {
+	to := n.To
+	if r.channel == models.ChannelSMS {
+		to = n.Phone
+	}
+	r.sent = append(r.sent, n.Kind+":"+to)
+	return r.err
+}
+
+// prefStore returns the preferences of one guest, or an error for everyone if err is set
+type prefStore struct {
+	email string
+	prefs []models.NotificationPreference
+	err   error
+}
+
+func (p prefStore) NotificationPreferences(_ context.Context, email string) ([]models.NotificationPreference, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if email == p.email {
+		return p.prefs, nil
+	}
+	return nil, nil
+}
+
+func TestWants(t *testing.T) {
+	prefs := []models.NotificationPreference{
+		{Kind: models.NotifyCheckIn, Channel: models.ChannelSMS, Enabled: true},
+		{Kind: models.NotifyCheckIn, Channel: models.ChannelEmail, Enabled: false},
+	}
+
+	tests := []struct {
+		kind, channel string
+		want          bool
+	}{
+		{models.NotifyCheckIn, models.ChannelSMS, true},
+		{models.NotifyCheckIn, models.ChannelEmail, false},
+		{models.NotifyConfirmation, models.ChannelEmail, true},
+		{models.NotifyConfirmation, models.ChannelSMS, false},
+		// staff notices are not up to the guest
+		{models.NotifyNewReservation, models.ChannelEmail, true},
+	}
+	for _, tt := range tests {
+		if got := Wants(prefs, tt.kind, tt.channel); got != tt.want {
+			t.Errorf("%s on %s: expected %v, got %v", tt.kind, tt.channel, tt.want, got)
+		}
+	}
+}
+
+func TestDispatcher_Send(t *testing.T) {
+	store := prefStore{email: "ana@example.com", prefs: []models.NotificationPreference{
+		{Kind: models.NotifyCheckIn, Channel: models.ChannelSMS, Enabled: true},
+		{Kind: models.NotifyCheckIn, Channel: models.ChannelEmail, Enabled: false},
+	}}
+	email := &recorder{channel: models.ChannelEmail}
+	sms := &recorder{channel: models.ChannelSMS}
+	d := NewDispatcher(store, slog.New(slog.NewTextHandler(io.Discard, nil)), email, sms)
+
+	for _, n := range []models.Notification{
+		{Kind: models.NotifyCheckIn, To: "ana@example.com", Phone: "555-0100", Text: "Welcome"},
+		{Kind: models.NotifyCheckIn, To: "ben@example.com", Phone: "555-0101", Text: "Welcome"},
+		{Kind: models.NotifyConfirmation, To: "ana@example.com", Phone: "555-0100", Text: "Confirmed"},
+		// there is no text to send without a phone number or a text
+		{Kind: models.NotifyCheckIn, To: "ana@example.com", Text: "Welcome"},
+		{Kind: models.NotifyCheckIn, To: "ana@example.com", Phone: "555-0100"},
+	} {
+		d.Send(context.Background(), n)
+	}
+
+	if want := []string{"check_in:ben@example.com", "confirmation:ana@example.com"}; !reflect.DeepEqual(email.sent, want) {
+		t.Errorf("expected emails %v, got %v", want, email.sent)
+	}
+	if want := []string{"check_in:555-0100"}; !reflect.DeepEqual(sms.sent, want) {
+		t.Errorf("expected text messages %v, got %v", want, sms.sent)
+	}
+}
+
+func TestDispatcher_SendFailures(t *testing.T) {
+	email := &recorder{channel: models.ChannelEmail, err: errors.New("connection refused")}
+	sms := &recorder{channel: models.ChannelSMS}
+	store := prefStore{err: errors.New("database is down")}
+	d := NewDispatcher(store, slog.New(slog.NewTextHandler(io.Discard, nil)), email, sms)
+
+	// the guest still gets their confirmation on the default channel
+	d.Send(context.Background(), models.Notification{Kind: models.NotifyConfirmation, To: "ana@example.com", Phone: "555-0100", Text: "Confirmed"})
+	if len(email.sent) != 1 || len(sms.sent) != 0 {
+		t.Errorf("expected an attempt by email only, got %v and %v", email.sent, sms.sent)
+	}
+
+	// channels without a notifier are skipped
+	d = NewDispatcher(store, slog.New(slog.NewTextHandler(io.Discard, nil)), sms)
+	d.Send(context.Background(), models.Notification{Kind: models.NotifyNewReservation, To: "staff@example.com"})
+	if len(sms.sent) != 0 {
+		t.Errorf("expected no text message for a staff notice, got %v", sms.sent)
+	}
+}
@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+const (
+	// smsTimeout bounds a single request to the SMS provider
+	smsTimeout = 10 * time.Second
+	// maxErrorBody is how much of a failed response is kept in the error
+	maxErrorBody = 512
+)
+
+// SMS sends notifications as text messages through an HTTP provider. Each message is posted to the
+// configured URL as JSON, with the token, if there is one, as a bearer token:
+//
+//	{"from": "Fort Smythe", "to": "+15550100", "text": "...", "kind": "check_in"}
+//
+// Any 2xx response means the provider accepted the message. Providers with another API are reached through
+// a small adapter, and during development any server that answers 2xx stands in for one.
+type SMS struct {
+	Config config.SMSConfig
+	Client *http.Client
+}
+
+// smsMessage is the body posted to the provider
+type smsMessage struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	Text string `json:"text"`
+	Kind string `json:"kind"`
+}
+
+// NewSMS returns a text message notifier posting to the provider in cfg
+func NewSMS(cfg config.SMSConfig) *SMS {
+	return &SMS{
+		Config: cfg,
+		Client: &http.Client{Timeout: smsTimeout},
+	}
+}
+
+// Channel returns models.ChannelSMS
+func (s *SMS) Channel() string {
+	return models.ChannelSMS
+}
+
+// Notify posts the text of n to the provider
+func (s *SMS) Notify(ctx context.Context, n models.Notification) error {
+	body, err := json.Marshal(smsMessage{
+		From: s.Config.From,
+		To:   n.Phone,
+		Text: RenderSMS(n),
+		Kind: n.Kind,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Config.Token)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot reach SMS provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		answer, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("SMS provider answered %s: %s", resp.Status, strings.TrimSpace(string(answer)))
+	}
+	return nil
+}
+
+// RenderSMS returns the text message of n: its text with the whitespace around it trimmed
+func RenderSMS(n models.Notification) string {
+	return strings.TrimSpace(n.Text)
+}
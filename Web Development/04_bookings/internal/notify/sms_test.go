@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+func TestSMS_Notify(t *testing.T) {
+	var got smsMessage
+	var auth string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		if got.To == "555-0199" {
+			http.Error(w, "unknown number", http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer provider.Close()
+
+	sms := NewSMS(config.SMSConfig{URL: provider.URL, Token: "sms-secret", From: "Fort Smythe"})
+	n := models.Notification{Kind: models.NotifyCheckIn, Phone: "555-0100", Text: "  Welcome!\n", Content: "<p>Welcome!</p>"}
+	if err := sms.Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	want := smsMessage{From: "Fort Smythe", To: "555-0100", Text: "Welcome!", Kind: models.NotifyCheckIn}
+	if got != want || auth != "Bearer sms-secret" {
+		t.Errorf("expected %+v with the token, got %+v and %q", want, got, auth)
+	}
+
+	n.Phone = "555-0199"
+	err := sms.Notify(context.Background(), n)
+	if err == nil || !strings.Contains(err.Error(), "422") || !strings.Contains(err.Error(), "unknown number") {
+		t.Errorf("expected the provider's answer in the error, got %v", err)
+	}
+}
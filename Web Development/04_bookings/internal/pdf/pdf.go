@@ -0,0 +1,188 @@
+// Package pdf writes simple PDF documents: A4 pages of text in the standard Helvetica fonts, lines and
+// shaded boxes. The standard fonts are built into every PDF reader, so nothing is embedded and no
+// external tools are needed. Text is encoded as WinAnsi, which covers English and the western European
+// languages; other characters are printed as a question mark.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page size of A4 in points
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Font is one of the standard fonts
+type Font int
+
+const (
+	Helvetica Font = iota
+	HelveticaBold
+)
+
+var fontNames = [...]string{Helvetica: "Helvetica", HelveticaBold: "Helvetica-Bold"}
+
+// Document is a PDF being built. Pages are added with AddPage and the result written with WriteTo.
+type Document struct {
+	// Title, Author and Subject are shown in the reader's document properties
+	Title   string
+	Author  string
+	Subject string
+	// Created is the creation date recorded in the document, left out if zero
+	Created time.Time
+
+	pages []*Page
+}
+
+// New returns an empty document
+func New() *Document {
+	return &Document{}
+}
+
+// Page is a page of a document. Positions are in points from the top left corner of the page, and the
+// y of text is its baseline.
+type Page struct {
+	content bytes.Buffer
+}
+
+// AddPage starts a new page at the end of the document
+func (d *Document) AddPage() *Page {
+	p := &Page{}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Text writes s with its left end at x
+func (p *Page) Text(x, y float64, f Font, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /F%d %s Tf %s %s Td (%s) Tj ET\n", f+1, num(size), num(x), num(PageHeight-y), escape(encode(s)))
+}
+
+// TextRight writes s with its right end at x, for columns of amounts
+func (p *Page) TextRight(x, y float64, f Font, size float64, s string) {
+	p.Text(x-Width(f, size, s), y, f, size, s)
+}
+
+// Line draws a line of the given width in points
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s m %s %s l S\n", num(width), num(x1), num(PageHeight-y1), num(x2), num(PageHeight-y2))
+}
+
+// Box fills a rectangle with a shade of grey, from 0 for black to 1 for white. Text drawn afterwards is
+// black again.
+func (p *Page) Box(x, y, w, h, grey float64) {
+	fmt.Fprintf(&p.content, "%s g %s %s %s %s re f 0 g\n", num(grey), num(x), num(PageHeight-y-h), num(w), num(h))
+}
+
+// Width returns the width of s in points when written in f at size
+func Width(f Font, size float64, s string) float64 {
+	widths := &helveticaWidths
+	if f == HelveticaBold {
+		widths = &helveticaBoldWidths
+	}
+
+	var units int
+	for _, c := range encode(s) {
+		if c >= 32 && c <= 126 {
+			units += widths[c-32]
+		} else {
+			// the accented letters are about as wide as an average lower case letter
+			units += 556
+		}
+	}
+	return float64(units) * size / 1000
+}
+
+// Wrap splits s into lines no wider than width, breaking between words
+func Wrap(f Font, size, width float64, s string) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && Width(f, size, candidate) > width {
+			lines = append(lines, line)
+			candidate = word
+		}
+		line = candidate
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// WriteTo writes the document as a PDF file
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	var offsets []int
+
+	// objects are numbered from 1 in the order they are written: the catalog, the page tree, the
+	// fonts, the information dictionary and then each page followed by its content
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	const firstPage = 6
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+
+	for _, name := range fontNames {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+	}
+
+	info := []string{"/Producer (bookings)"}
+	for _, field := range []struct{ key, value string }{{"Title", d.Title}, {"Author", d.Author}, {"Subject", d.Subject}} {
+		if field.value != "" {
+			info = append(info, fmt.Sprintf("/%s (%s)", field.key, escape(encode(field.value))))
+		}
+	}
+	if !d.Created.IsZero() {
+		info = append(info, fmt.Sprintf("/CreationDate (D:%s)", d.Created.UTC().Format("20060102150405Z")))
+	}
+	object("<< " + strings.Join(info, " ") + " >>")
+
+	for i, p := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			num(PageWidth), num(PageHeight), firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.Bytes()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// Bytes returns the document as a PDF file
+func (d *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	d.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// num formats a coordinate or size with at most two decimals
+func num(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
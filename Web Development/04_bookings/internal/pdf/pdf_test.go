@@ -0,0 +1,110 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDocument(t *testing.T) {
+	d := New()
+	d.Title = "Invoice (copy)"
+	d.Created = time.Date(2026, 10, 19, 12, 30, 0, 0, time.UTC)
+	p := d.AddPage()
+	p.Text(50, 60, HelveticaBold, 18, `Fort (Smythe) \ Café €5`)
+	p.Line(50, 70, 545, 70, 0.5)
+	d.AddPage().Box(50, 100, 200, 20, 0.9)
+	b := d.Bytes()
+
+	if !bytes.HasPrefix(b, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(b, []byte("%%EOF\n")) {
+		t.Fatalf("expected a PDF header and trailer, got %q", b)
+	}
+	for _, want := range []string{
+		"/Count 2",
+		"/BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding",
+		`/Title (Invoice \(copy\))`,
+		"/CreationDate (D:20261019123000Z)",
+		"BT /F2 18 Tf 50 781.89 Td (Fort \\(Smythe\\) \\\\ Caf\xe9 \x805) Tj ET",
+		"0.5 w 50 771.89 m 545 771.89 l S",
+		"0.9 g 50 721.89 200 20 re f 0 g",
+	} {
+		if !bytes.Contains(b, []byte(want)) {
+			t.Errorf("expected the document to contain %q", want)
+		}
+	}
+
+	// every cross reference entry must point at the start of its object
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(b)
+	if startxref == nil {
+		t.Fatal("expected a startxref")
+	}
+	xref, _ := strconv.Atoi(string(startxref[1]))
+	if !bytes.HasPrefix(b[xref:], []byte("xref\n")) {
+		t.Fatalf("expected startxref to point at the cross reference table")
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(b[xref:], -1)
+	if len(entries) != 9 {
+		t.Errorf("expected 9 objects, got %d", len(entries))
+	}
+	for i, e := range entries {
+		offset, _ := strconv.Atoi(string(e[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(b[offset:], []byte(want)) {
+			t.Errorf("expected object %d at offset %d", i+1, offset)
+		}
+	}
+
+	// stream lengths must match their content
+	for _, m := range regexp.MustCompile(`(?s)<< /Length (\d+) >>\nstream\n(.*?)endstream`).FindAllSubmatch(b, -1) {
+		if n, _ := strconv.Atoi(string(m[1])); n != len(m[2]) {
+			t.Errorf("expected a stream of %d bytes, got %d", n, len(m[2]))
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Reserva del 2 de junio", "Reserva del 2 de junio"},
+		{"Señor Muñoz", "Se\xf1or Mu\xf1oz"},
+		{"€ – “quoted”", "\x80 \x96 \x93quoted\x94"},
+		{"Zoë\tМосква\n", "Zo\xeb ?????? "},
+	}
+
+	for _, tt := range tests {
+		if got := string(encode(tt.in)); got != tt.want {
+			t.Errorf("encode(%q): got %q, wanted %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWidth(t *testing.T) {
+	if got := Width(Helvetica, 10, "Hi"); got != 9.44 {
+		t.Errorf("expected Hi to be 9.44 points wide, got %v", got)
+	}
+	if Width(HelveticaBold, 10, "Total") <= Width(Helvetica, 10, "Total") {
+		t.Error("expected bold text to be wider")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	s := "Free cancellation until 7 days before arrival, then half of the total"
+	lines := Wrap(Helvetica, 10, 150, s)
+
+	if len(lines) < 2 || strings.Join(lines, " ") != s {
+		t.Fatalf("expected the text split into lines, got %q", lines)
+	}
+	for _, l := range lines {
+		if Width(Helvetica, 10, l) > 150 {
+			t.Errorf("line %q is wider than 150 points", l)
+		}
+	}
+	if got := Wrap(Helvetica, 10, 10, "unbreakable"); len(got) != 1 {
+		t.Errorf("expected a long word to keep a line of its own, got %q", got)
+	}
+}
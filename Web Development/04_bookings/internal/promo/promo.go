@@ -0,0 +1,125 @@
+// Package promo prices stays and decides whether a promo code applies to a reservation. It only holds the
+// rules; looking codes up and recording redemptions is up to the repository.
+package promo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/guests"
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+// Error explains why a code cannot be used. Message is a catalog key, so it can be translated with Args.
+type Error struct {
+	Message string
+	Args    []any
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf(e.Message, e.Args...)
+}
+
+// Reasons a promo code is refused
+var (
+	ErrUnknown       = &Error{Message: "This promo code does not exist"}
+	ErrInactive      = &Error{Message: "This promo code is no longer active"}
+	ErrBookingWindow = &Error{Message: "This promo code cannot be used today"}
+	ErrStayWindow    = &Error{Message: "This promo code is not valid for these dates"}
+	ErrRoom          = &Error{Message: "This promo code is not valid for this room"}
+	ErrUsedUp        = &Error{Message: "This promo code has been used up"}
+	ErrUsedByEmail   = &Error{Message: "You have already used this promo code"}
+)
+
+// errMinNights is returned for stays shorter than a code's minimum
+func errMinNights(n int) *Error {
+	return &Error{Message: "This promo code needs a stay of at least %d nights", Args: []any{n}}
+}
+
+// NormalizeCode returns a code as it is stored: trimmed and upper case
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// NormalizeEmail returns an email address as redemptions are counted by, the same form guests are told
+// apart by
+func NormalizeEmail(email string) string {
+	return guests.NormalizeEmail(email)
+}
+
+// Nights returns the number of nights of a reservation
+func Nights(res models.Reservation) int {
+	return int(models.Day(res.EndDate).Sub(models.Day(res.StartDate)).Hours() / 24)
+}
+
+// Subtotal returns the price of a stay in room before any discount
+func Subtotal(room models.Room, res models.Reservation) int {
+	return room.PriceCents * Nights(res)
+}
+
+// Discount returns the amount p takes off subtotal, never more than the subtotal. Percentages round down
+// to the cent.
+func Discount(p models.PromoCode, subtotal int) int {
+	var d int
+	switch p.Kind {
+	case models.PromoPercent:
+		d = subtotal * p.Amount / 100
+	case models.PromoFixed:
+		d = p.Amount
+	}
+	return max(0, min(d, subtotal))
+}
+
+// Check returns an *Error if p cannot be used on res when booking at now. It checks everything but the
+// usage limits, which need the redemption counts: see CheckUsage.
+func Check(p models.PromoCode, res models.Reservation, now time.Time) error {
+	if !p.Active {
+		return ErrInactive
+	}
+
+	today := models.Day(now)
+	if !p.BookingStart.IsZero() && today.Before(models.Day(p.BookingStart)) {
+		return ErrBookingWindow
+	}
+	if !p.BookingEnd.IsZero() && today.After(models.Day(p.BookingEnd)) {
+		return ErrBookingWindow
+	}
+
+	if !p.StayStart.IsZero() && models.Day(res.StartDate).Before(models.Day(p.StayStart)) {
+		return ErrStayWindow
+	}
+	if !p.StayEnd.IsZero() && models.Day(res.EndDate).After(models.Day(p.StayEnd)) {
+		return ErrStayWindow
+	}
+
+	if p.MinNights > 0 && Nights(res) < p.MinNights {
+		return errMinNights(p.MinNights)
+	}
+
+	if len(p.RoomIDs) > 0 && !containsInt(p.RoomIDs, res.RoomID) {
+		return ErrRoom
+	}
+	return nil
+}
+
+// CheckUsage returns an *Error if p has reached its limits, given how often it was redeemed in total and
+// by the guest's email address
+func CheckUsage(p models.PromoCode, uses, usesByEmail int) error {
+	if p.MaxUses > 0 && uses >= p.MaxUses {
+		return ErrUsedUp
+	}
+	if p.MaxUsesPerEmail > 0 && usesByEmail >= p.MaxUsesPerEmail {
+		return ErrUsedByEmail
+	}
+	return nil
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
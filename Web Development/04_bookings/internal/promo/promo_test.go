@@ -0,0 +1,116 @@
+package promo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+func date(m time.Month, d int) time.Time {
+	return time.Date(2025, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestDiscount(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     models.PromoCode
+		subtotal int
+		want     int
+	}{
+		{"percent", models.PromoCode{Kind: models.PromoPercent, Amount: 15}, 30000, 4500},
+		{"percent rounds down", models.PromoCode{Kind: models.PromoPercent, Amount: 10}, 12345, 1234},
+		{"fixed", models.PromoCode{Kind: models.PromoFixed, Amount: 2500}, 30000, 2500},
+		{"fixed above the subtotal", models.PromoCode{Kind: models.PromoFixed, Amount: 50000}, 30000, 30000},
+		{"unknown kind", models.PromoCode{Kind: "free", Amount: 100}, 30000, 0},
+	}
+	for _, tt := range tests {
+		if got := Discount(tt.code, tt.subtotal); got != tt.want {
+			t.Errorf("%s: Discount() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSubtotal(t *testing.T) {
+	res := models.Reservation{StartDate: date(7, 10), EndDate: date(7, 13)}
+	if n := Nights(res); n != 3 {
+		t.Errorf("expected 3 nights, got %d", n)
+	}
+	if got := Subtotal(models.Room{PriceCents: 12000}, res); got != 36000 {
+		t.Errorf("expected a subtotal of 36000, got %d", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	summer := models.PromoCode{
+		Code:         "SUMMER",
+		Active:       true,
+		BookingStart: date(5, 1),
+		BookingEnd:   date(6, 30),
+		StayStart:    date(7, 1),
+		StayEnd:      date(8, 31),
+		MinNights:    2,
+		RoomIDs:      []int{1},
+	}
+	stay := models.Reservation{StartDate: date(7, 10), EndDate: date(7, 13), RoomID: 1}
+	booked := time.Date(2025, 6, 30, 23, 30, 0, 0, time.UTC)
+
+	inactive := summer
+	inactive.Active = false
+
+	tests := []struct {
+		name string
+		code models.PromoCode
+		res  models.Reservation
+		now  time.Time
+		want error
+	}{
+		{"valid on the last booking day", summer, stay, booked, nil},
+		{"inactive", inactive, stay, booked, ErrInactive},
+		{"booked too early", summer, stay, date(4, 30), ErrBookingWindow},
+		{"booked too late", summer, stay, date(7, 1), ErrBookingWindow},
+		{"arrives before the window", summer, models.Reservation{StartDate: date(6, 30), EndDate: date(7, 3), RoomID: 1}, booked, ErrStayWindow},
+		{"leaves after the window", summer, models.Reservation{StartDate: date(8, 30), EndDate: date(9, 1), RoomID: 1}, booked, ErrStayWindow},
+		{"leaves on the last day", summer, models.Reservation{StartDate: date(8, 29), EndDate: date(8, 31), RoomID: 1}, booked, nil},
+		{"other room", summer, models.Reservation{StartDate: date(7, 10), EndDate: date(7, 13), RoomID: 2}, booked, ErrRoom},
+		{"open windows", models.PromoCode{Active: true}, stay, booked, nil},
+	}
+	for _, tt := range tests {
+		if err := Check(tt.code, tt.res, tt.now); err != tt.want {
+			t.Errorf("%s: Check() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	err := Check(summer, models.Reservation{StartDate: date(7, 10), EndDate: date(7, 11), RoomID: 1}, booked)
+	var promoErr *Error
+	if !errors.As(err, &promoErr) || err.Error() != "This promo code needs a stay of at least 2 nights" {
+		t.Errorf("expected the minimum nights to be enforced, got %v", err)
+	}
+}
+
+func TestCheckUsage(t *testing.T) {
+	code := models.PromoCode{MaxUses: 10, MaxUsesPerEmail: 1}
+
+	if err := CheckUsage(code, 9, 0); err != nil {
+		t.Errorf("expected the code to be usable, got %v", err)
+	}
+	if err := CheckUsage(code, 10, 0); err != ErrUsedUp {
+		t.Errorf("expected the code to be used up, got %v", err)
+	}
+	if err := CheckUsage(code, 3, 1); err != ErrUsedByEmail {
+		t.Errorf("expected the guest's use to count, got %v", err)
+	}
+	if err := CheckUsage(models.PromoCode{}, 1000, 1000); err != nil {
+		t.Errorf("expected a code without limits to be usable, got %v", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if got := NormalizeCode("  summer25 "); got != "SUMMER25" {
+		t.Errorf("NormalizeCode() = %q", got)
+	}
+	if got := NormalizeEmail(" Ana@Example.COM"); got != "ana@example.com" {
+		t.Errorf("NormalizeEmail() = %q", got)
+	}
+}
@@ -4,13 +4,18 @@ import (
 	"bytes"
 	"fmt"
 	"html/template"
-	"log"
+	"io/fs"
 	"net/http"
-	"path/filepath"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/i18n"
+	"github.com/ashparshp/bookings/internal/logger"
 	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/security"
+	"github.com/ashparshp/bookings/internal/sessionstore"
 	"github.com/justinas/nosurf"
 )
 
@@ -73,16 +78,34 @@ func createTemplateCache(t string) error {
 }
 */
 
-// functions to be used in templates
+// functions to be used in templates; the locale dependent ones are replaced per request by localeFunctions
 var functions = template.FuncMap{
 	"humanDate": HumanDate,
 	"formatDate": FormatDate,
 	"iterate": Iterate,
 	"add": Add,
+	"locales": i18n.Supported,
+	"device": sessionstore.Device,
+	"stars": Stars,
+}
+
+func init() {
+	for name, fn := range localeFunctions(i18n.Default()) {
+		functions[name] = fn
+	}
+}
+
+// localeFunctions returns the template functions that translate and format for locale l
+func localeFunctions(l *i18n.Locale) template.FuncMap {
+	return template.FuncMap{
+		"T":         l.T,
+		"localDate": l.Date,
+		"number":    l.Number,
+		"money":     l.Money,
+	}
 }
 
 var app *config.AppConfig
-var pathToTemplates = "./templates"
 
 func Add(a, b int) int {
 	return a + b
@@ -102,6 +125,17 @@ func NewRenderer(a *config.AppConfig) {
 	app = a
 }
 
+// Stars shows a rating out of five as filled and empty stars
+func Stars(filled int) string {
+	if filled < 0 {
+		filled = 0
+	}
+	if filled > 5 {
+		filled = 5
+	}
+	return strings.Repeat("★", filled) + strings.Repeat("☆", 5-filled)
+}
+
 // HumanDate returns time in "YYYY-MM-DD" format
 func HumanDate(t time.Time) string {
 	return t.Format("2006-01-02")
@@ -116,6 +150,9 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 	td.Error = app.Session.PopString(r.Context(), "error")
 	td.Warning = app.Session.PopString(r.Context(), "warning")
 	td.CSRFToken = nosurf.Token(r)
+	td.Locale = i18n.FromContext(r.Context()).Code
+	td.Path = r.URL.Path
+	td.CSPNonce = security.NonceFromContext(r.Context())
 	if app.Session.Exists(r.Context(), "user_id") {
 		td.IsAuthenticated = 1
 	}
@@ -130,7 +167,12 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
 		// get the template cache from the app config
 		tc = app.TemplateCache
 	} else {
-		tc, _ = CreateTemplateCache()
+		// dev mode: parse again on every request so template edits show up straight away
+		var err error
+		tc, err = CreateTemplateCache(app.Templates)
+		if err != nil {
+			return fmt.Errorf("could not create template cache: %w", err)
+		}
 	}
 
 	// get requested template from cache
@@ -139,49 +181,56 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
 		return fmt.Errorf("could not get template from template cache")
 	}
 
+	// cached templates are shared, so bind the request's language to a copy
+	t, err := t.Clone()
+	if err != nil {
+		return fmt.Errorf("could not clone template: %w", err)
+	}
+	t.Funcs(localeFunctions(i18n.FromContext(r.Context())))
+
 	buf := new(bytes.Buffer)
 
 	td = AddDefaultData(td, r)
 
-	err := t.Execute(buf, td)
+	err = t.Execute(buf, td)
 	if err != nil {
-		log.Println(err)
+		logger.FromContext(r.Context()).Error("could not execute template", "template", tmpl, "error", err)
 	}
 
 	// render the template
 	_, err = buf.WriteTo(w)
 	if err != nil {
-		log.Println(err)
+		logger.FromContext(r.Context()).Error("could not write template", "template", tmpl, "error", err)
 		return fmt.Errorf("could not write template to response writer")
 	}
 	return nil
 }
 
-func CreateTemplateCache() (map[string]*template.Template, error) {
+// CreateTemplateCache parses every *.page.tmpl in fsys together with the *.layout.tmpl files
+func CreateTemplateCache(fsys fs.FS) (map[string]*template.Template, error) {
 	myCache := map[string]*template.Template{}
 
-	// get all the files named *.page.tmpl from ./templates
-	pages, err := filepath.Glob(fmt.Sprintf("%s/*.page.tmpl", pathToTemplates))
+	// get all the files named *.page.tmpl
+	pages, err := fs.Glob(fsys, "*.page.tmpl")
+	if err != nil {
+		return myCache, err
+	}
 
+	layouts, err := fs.Glob(fsys, "*.layout.tmpl")
 	if err != nil {
 		return myCache, err
 	}
 
 	// range through all files with *.page.tmpl
 	for _, page := range pages {
-		name := filepath.Base(page)
-		ts, err := template.New(name).Funcs(functions).ParseFiles(page)
-		if err != nil {
-			return myCache, err
-		}
-		
-		matches, err := filepath.Glob(fmt.Sprintf("%s/*.layout.tmpl", pathToTemplates))
+		name := path.Base(page)
+		ts, err := template.New(name).Funcs(functions).ParseFS(fsys, page)
 		if err != nil {
 			return myCache, err
 		}
 
-		if len(matches) > 0 {
-			ts, err = ts.ParseGlob(fmt.Sprintf("%s/*.layout.tmpl", pathToTemplates))
+		if len(layouts) > 0 {
+			ts, err = ts.ParseFS(fsys, layouts...)
 			if err != nil {
 				return myCache, err
 			}
@@ -190,4 +239,4 @@ func CreateTemplateCache() (map[string]*template.Template, error) {
 		myCache[name] = ts
 	}
 	return myCache, nil
-}
\ No newline at end of file
+}
@@ -1,10 +1,18 @@
 package render
 
 import (
+	"io/fs"
 	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/fstest"
 
+	"github.com/ashparshp/bookings/internal/i18n"
 	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/security"
 )
 
 func TestAddDefaultData(t *testing.T) {
@@ -25,9 +33,7 @@ func TestAddDefaultData(t *testing.T) {
 }
 
 func TestRenderTemplate(t *testing.T) {
-	pathToTemplates = "./../../templates"
-
-	tc, err := CreateTemplateCache()
+	tc, err := CreateTemplateCache(app.Templates)
 	if err != nil {
 		t.Error("failed to create template cache")
 	}
@@ -72,9 +78,111 @@ func TestNewTemplates(t *testing.T) {
 }
 
 func TestCreateTemplateCache(t *testing.T) {
-	pathToTemplates = "./../../templates"
-	_, err := CreateTemplateCache()
+	tc, err := CreateTemplateCache(app.Templates)
 	if err != nil {
-		t.Error("failed to create template cache")
+		t.Fatal("failed to create template cache")
+	}
+	if _, ok := tc["home.page.tmpl"]; !ok {
+		t.Error("expected home.page.tmpl in the cache")
+	}
+
+	_, err = CreateTemplateCache(fstest.MapFS{
+		"broken.page.tmpl": {Data: []byte(`{{template "base" .}`)},
+	})
+	if err == nil {
+		t.Error("expected an error for a broken template")
+	}
+}
+
+func TestRenderTemplate_Dev(t *testing.T) {
+	oldTemplates := app.Templates
+	app.UseCahce = false
+	app.Templates = fstest.MapFS{
+		"plain.page.tmpl": {Data: []byte(`{{T "Home"}}`)},
+	}
+	defer func() { app.Templates = oldTemplates }()
+
+	r, err := getSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	if err := Template(rr, r, "plain.page.tmpl", &models.TemplateData{}); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Body.String() != "Home" {
+		t.Errorf("expected the template to be parsed on demand, got %q", rr.Body.String())
+	}
+
+	// an edit is picked up by the next request
+	app.Templates.(fstest.MapFS)["plain.page.tmpl"].Data = []byte(`{{T "About"}}`)
+	rr = httptest.NewRecorder()
+	if err := Template(rr, r, "plain.page.tmpl", &models.TemplateData{}); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Body.String() != "About" {
+		t.Errorf("expected the edited template, got %q", rr.Body.String())
 	}
-}
\ No newline at end of file
+}
+
+func TestRenderTemplate_CSPNonce(t *testing.T) {
+	tc, err := CreateTemplateCache(app.Templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.TemplateCache = tc
+
+	r, err := getSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = r.WithContext(security.NewContext(r.Context(), "n0nce"))
+
+	// every inline script carries the nonce, and no element has an inline event handler
+	inlineHandler := regexp.MustCompile(`\son[a-z]+="`)
+	for _, page := range []string{"home.page.tmpl", "about.page.tmpl", "admin-all-reservations.page.tmpl"} {
+		rr := httptest.NewRecorder()
+		if err := Template(rr, r, page, &models.TemplateData{}); err != nil {
+			t.Fatalf("%s: %v", page, err)
+		}
+		body := rr.Body.String()
+		if !strings.Contains(body, `<script nonce="n0nce">`) || strings.Contains(body, "<script>") {
+			t.Errorf("%s: expected all inline scripts to carry the nonce", page)
+		}
+		if inlineHandler.MatchString(body) {
+			t.Errorf("%s: found an inline event handler: %s", page, inlineHandler.FindString(body))
+		}
+	}
+}
+
+func TestTemplates_Translated(t *testing.T) {
+	es, ok := i18n.Get("es")
+	if !ok {
+		t.Fatal("expected an es catalog")
+	}
+
+	// every message a template translates has a Spanish entry, so new text can't fall back to English unnoticed
+	call := regexp.MustCompile(`{{-?\s*T\s+("(?:[^"\\]|\\.)*"|` + "`[^`]*`)")
+	err := fs.WalkDir(app.Templates, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := fs.ReadFile(app.Templates, path)
+		if err != nil {
+			return err
+		}
+		for _, m := range call.FindAllStringSubmatch(string(b), -1) {
+			msg, err := strconv.Unquote(m[1])
+			if err != nil {
+				return err
+			}
+			if _, ok := es.Messages[msg]; !ok {
+				t.Errorf("%s: no es translation for %q", path, msg)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
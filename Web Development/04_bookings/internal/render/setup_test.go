@@ -2,14 +2,16 @@ package render
 
 import (
 	"encoding/gob"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/ashparshp/bookings"
 	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/logger"
 	"github.com/ashparshp/bookings/internal/models"
 )
 
@@ -23,11 +25,7 @@ func TestMain(m *testing.M) {
 	// change this to true when in production
 	testApp.InProduction = false
 
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	testApp.InfoLog = infoLog
-
-	errorLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	testApp.ErrorLog = errorLog
+	testApp.Logger = logger.New(os.Stdout, slog.LevelInfo, false)
 
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
@@ -36,6 +34,8 @@ func TestMain(m *testing.M) {
 	session.Cookie.Secure = false
 	testApp.Session = session
 
+	testApp.Templates = bookings.Load(false, "").Templates
+
 	app = &testApp
 
 	os.Exit(m.Run())
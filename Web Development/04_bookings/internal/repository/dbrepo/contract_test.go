@@ -0,0 +1,1414 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings"
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/driver"
+	"github.com/ashparshp/bookings/internal/guests"
+	"github.com/ashparshp/bookings/internal/migrate"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/repository"
+	"github.com/ashparshp/bookings/internal/webhooks"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The contract tests hold every DatabaseRepo to the same behaviour, so handler tests using the in-memory
+// repository see what the server sees. Each test gets a fresh repository holding only the seed data.
+//
+// The postgres repository is tested when BOOKINGS_TEST_POSTGRES holds the connection string of a database
+// the tests may create schemas in, such as "host=localhost user=postgres dbname=bookings_test".
+
+// contractRepo is a repository under test, with a way to add the users the interface cannot
+type contractRepo struct {
+	repository.DatabaseRepo
+	addUser func(t *testing.T, u models.User, password string) int
+}
+
+var contractBackends = []struct {
+	name string
+	open func(t *testing.T) contractRepo
+}{
+	{"memory", openMemoryRepo},
+	{"sqlite", openSqliteRepo},
+	{"postgres", openPostgresRepo},
+}
+
+var contractTests = []struct {
+	name string
+	test func(t *testing.T, repo contractRepo)
+}{
+	{"Seed", contractSeed},
+	{"ReservationFlow", contractReservationFlow},
+	{"Blocks", contractBlocks},
+	{"Users", contractUsers},
+	{"Sessions", contractSessions},
+	{"Cancellation", contractCancellation},
+	{"ReservationEmails", contractReservationEmails},
+	{"Reviews", contractReviews},
+	{"PromoCodes", contractPromoCodes},
+	{"CancellationPolicies", contractCancellationPolicies},
+	{"Guests", contractGuests},
+	{"NotificationPreferences", contractNotificationPreferences},
+	{"Webhooks", contractWebhooks},
+	{"AnonymizedWebhooks", contractAnonymizedWebhooks},
+	{"MissingRows", contractMissingRows},
+	{"Constraints", contractConstraints},
+	{"DeleteReservation", contractDeleteReservation},
+}
+
+func TestDatabaseRepoContract(t *testing.T) {
+	for _, b := range contractBackends {
+		t.Run(b.name, func(t *testing.T) {
+			for _, ct := range contractTests {
+				t.Run(ct.name, func(t *testing.T) {
+					ct.test(t, b.open(t))
+				})
+			}
+		})
+	}
+}
+
+func openMemoryRepo(t *testing.T) contractRepo {
+	repo := NewMemoryRepo(&config.AppConfig{})
+	return contractRepo{repo, func(t *testing.T, u models.User, password string) int {
+		t.Helper()
+		id, err := repo.AddUser(u, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}}
+}
+
+// newSqliteTestRepo returns a repository backed by a freshly seeded sqlite file in a temp dir
+func newSqliteTestRepo(t *testing.T) (repository.DatabaseRepo, *driver.DB) {
+	t.Helper()
+
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatalf("cannot open sqlite database: %v", err)
+	}
+	t.Cleanup(func() { db.SQL.Close() })
+
+	return NewSqliteRepo(db.SQL, &config.AppConfig{DBDriver: "sqlite"}), db
+}
+
+func openSqliteRepo(t *testing.T) contractRepo {
+	repo, db := newSqliteTestRepo(t)
+	return contractRepo{repo, sqlAddUser(db.SQL)}
+}
+
+// openPostgresRepo migrates a schema of its own for the test, and drops it afterwards
+func openPostgresRepo(t *testing.T) contractRepo {
+	dsn := os.Getenv("BOOKINGS_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("BOOKINGS_TEST_POSTGRES is not set")
+	}
+
+	admin, err := driver.NewDatabase(dsn)
+	if err != nil {
+		t.Fatalf("cannot connect to postgres: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("contract_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	db, err := driver.NewDatabase(withSearchPath(dsn, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := migrate.Load(bookings.Migrations(), migrate.Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrate.New(db, migrations).Up(context.Background()); err != nil {
+		t.Fatalf("cannot migrate schema %s: %v", schema, err)
+	}
+
+	return contractRepo{NewPostgresRepo(db, &config.AppConfig{}), sqlAddUser(db)}
+}
+
+// withSearchPath adds search_path to a connection string, in URL or keyword form
+func withSearchPath(dsn, schema string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + schema
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&search_path=" + schema
+	}
+	return dsn + "?search_path=" + schema
+}
+
+// sqlAddUser inserts users directly, the way the seed command does
+func sqlAddUser(db *sql.DB) func(t *testing.T, u models.User, password string) int {
+	return func(t *testing.T, u models.User, password string) int {
+		t.Helper()
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var id int
+		err = db.QueryRow(`INSERT INTO users (first_name, last_name, email, password, access_level, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`, u.FirstName, u.LastName, u.Email, string(hash), u.AccessLevel,
+			time.Now(), time.Now()).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+}
+
+func contractSeed(t *testing.T, repo contractRepo) {
+	ctx := context.Background()
+
+	rooms, err := repo.AllRooms(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 2 {
+		t.Errorf("expected 2 seeded rooms, got %d", len(rooms))
+	}
+
+	room, err := repo.GetRoomByID(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.RoomName != "Major's Suite" {
+		t.Errorf("expected Major's Suite, got %q", room.RoomName)
+	}
+
+	if _, err := repo.GetRoomByID(ctx, 99); err == nil {
+		t.Error("expected an error for a non-existent room")
+	}
+}
+
+func contractReservationFlow(t *testing.T, repo contractRepo) {
+	ctx := context.Background()
+
+	start := time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 6, 12, 0, 0, 0, 0, time.UTC)
+
+	available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, start, end, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Error("expected room 1 to be available before booking")
+	}
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@example.com",
+		Phone:     "555-555-5555",
+		StartDate: start,
+		EndDate:   end,
+		RoomID:    1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.InsertRoomRestriction(ctx, models.RoomRestriction{
+		StartDate:     start,
+		EndDate:       end,
+		RoomID:        1,
+		ReservationID: id,
+		RestrictionID: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	available, err = repo.SearchAvailabilityByDatesByRoomID(ctx, start.AddDate(0, 0, 1), end.AddDate(0, 0, 1), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available {
+		t.Error("expected overlapping dates to be unavailable")
+	}
+
+	// a stay starting on the checkout day does not overlap
+	available, err = repo.SearchAvailabilityByDatesByRoomID(ctx, end, end.AddDate(0, 0, 2), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Error("expected dates starting at checkout to be available")
+	}
+
+	rooms, err := repo.SearchAvailabilityForAllRooms(ctx, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 1 || rooms[0].ID != 2 {
+		t.Errorf("expected only room 2 to be available, got %+v", rooms)
+	}
+
+	occupancy, err := repo.RoomOccupancy(ctx, start.AddDate(0, 0, -5), end.AddDate(0, 0, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(occupancy) != 2 || occupancy[0].Room.ID != 1 || occupancy[1].Room.ID != 2 {
+		t.Fatalf("expected both rooms, got %+v", occupancy)
+	}
+	if busy := occupancy[0].Busy; len(busy) != 1 || !busy[0].StartDate.Equal(start) || !busy[0].EndDate.Equal(end) || busy[0].ReservationID != id {
+		t.Errorf("expected room 1 busy with the reservation, got %+v", busy)
+	}
+	if len(occupancy[1].Busy) != 0 {
+		t.Errorf("expected room 2 free, got %+v", occupancy[1].Busy)
+	}
+	// a period ending on the day the reservation starts does not include it
+	occupancy, err = repo.RoomOccupancy(ctx, start.AddDate(0, 0, -5), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(occupancy) != 2 || len(occupancy[0].Busy) != 0 {
+		t.Errorf("expected no restrictions before the reservation, got %+v", occupancy)
+	}
+
+	res, err := repo.GetReservationByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.StartDate.Equal(start) || !res.EndDate.Equal(end) {
+		t.Errorf("dates did not round trip: got %s to %s", res.StartDate, res.EndDate)
+	}
+	if res.Room.RoomName != "General's Quaters" {
+		t.Errorf("expected joined room name, got %q", res.Room.RoomName)
+	}
+
+	newReservations, err := repo.AllNewReservations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(newReservations) != 1 {
+		t.Errorf("expected 1 new reservation, got %d", len(newReservations))
+	}
+
+	if err := repo.UpdateProcessedForReservation(ctx, id, 1); err != nil {
+		t.Fatal(err)
+	}
+	newReservations, err = repo.AllNewReservations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(newReservations) != 0 {
+		t.Errorf("expected no new reservations after processing, got %d", len(newReservations))
+	}
+
+	res.FirstName = "Jane"
+	if err := repo.UpdateReservation(ctx, res, id); err != nil {
+		t.Fatal(err)
+	}
+	all, err := repo.AllReservations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].FirstName != "Jane" || all[0].Processed != 1 {
+		t.Errorf("unexpected reservations after update: %+v", all)
+	}
+
+	// deleting the reservation cascades to its room restriction
+	if err := repo.DeleteReservation(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	available, err = repo.SearchAvailabilityByDatesByRoomID(ctx, start, end, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Error("expected room to be available after deleting the reservation")
+	}
+}
+
+func contractBlocks(t *testing.T, repo contractRepo) {
+	ctx := context.Background()
+
+	day := time.Date(2025, 7, 4, 0, 0, 0, 0, time.UTC)
+	if err := repo.InsertBlockForRoom(ctx, 2, day); err != nil {
+		t.Fatal(err)
+	}
+
+	firstOfMonth := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+
+	restrictions, err := repo.GetRestrictionsForRoomByDate(ctx, 2, firstOfMonth, lastOfMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restrictions) != 1 {
+		t.Fatalf("expected 1 restriction, got %d", len(restrictions))
+	}
+	if restrictions[0].ReservationID != 0 || restrictions[0].RestrictionID != 2 {
+		t.Errorf("expected an owner block, got %+v", restrictions[0])
+	}
+	if !restrictions[0].StartDate.Equal(day) {
+		t.Errorf("expected block to start on %s, got %s", day, restrictions[0].StartDate)
+	}
+
+	if err := repo.DeleteBlockByID(ctx, restrictions[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	restrictions, err = repo.GetRestrictionsForRoomByDate(ctx, 2, firstOfMonth, lastOfMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restrictions) != 0 {
+		t.Errorf("expected block to be deleted, got %d restrictions", len(restrictions))
+	}
+}
+
+func contractUsers(t *testing.T, repo contractRepo) {
+	ctx := context.Background()
+
+	repo.addUser(t, models.User{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", AccessLevel: 1}, "secret")
+
+	id, _, err := repo.AuthenticateUser(ctx, "jane@example.com", "secret")
+	if err != nil {
+		t.Fatalf("expected valid credentials to authenticate: %v", err)
+	}
+
+	if _, _, err := repo.AuthenticateUser(ctx, "jane@example.com", "wrong"); err == nil {
+		t.Error("expected an error for an incorrect password")
+	}
+
+	user, err := repo.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user.LastName = "Smith"
+	if err := repo.UpdateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	admin, err := repo.GetUserByID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.LastName != "pandey" {
+		t.Errorf("updating one user changed another: got %q", admin.LastName)
+	}
+
+	user, err = repo.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.LastName != "Smith" {
+		t.Errorf("expected updated last name, got %q", user.LastName)
+	}
+}
+
+func contractSessions(t *testing.T, repo contractRepo) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	jane := repo.addUser(t, models.User{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", AccessLevel: 1}, "secret")
+
+	sessions := []models.Session{
+		{Token: "admin-laptop", UserID: 1, Expiry: now.Add(time.Hour), IPAddress: "192.0.2.1", UserAgent: "Firefox/120.0", LastActivity: now.Add(-time.Minute)},
+		{Token: "admin-phone", UserID: 1, Expiry: now.Add(time.Hour), IPAddress: "192.0.2.2", UserAgent: "iPhone", LastActivity: now},
+		{Token: "admin-old", UserID: 1, Expiry: now.Add(-time.Second), LastActivity: now.Add(-2 * time.Hour)},
+		{Token: "jane", UserID: jane, Expiry: now.Add(time.Hour), LastActivity: now},
+		{Token: "guest", Expiry: now.Add(time.Hour), LastActivity: now},
+	}
+	for _, s := range sessions {
+		s.Data = []byte("data-" + s.Token)
+		if err := repo.SaveSession(ctx, s); err != nil {
+			t.Fatalf("saving %s: %v", s.Token, err)
+		}
+	}
+
+	got, err := repo.GetSession(ctx, "guest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UserID != 0 || string(got.Data) != "data-guest" || !got.Expiry.Equal(now.Add(time.Hour)) {
+		t.Errorf("unexpected guest session %+v", got)
+	}
+	if _, err := repo.GetSession(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing session, got %v", err)
+	}
+
+	// saving again replaces the data and keeps the creation time
+	if err := repo.SaveSession(ctx, models.Session{Token: "guest", UserID: jane, Data: []byte("logged in"), Expiry: now.Add(2 * time.Hour), LastActivity: now}); err != nil {
+		t.Fatal(err)
+	}
+	updated, _ := repo.GetSession(ctx, "guest")
+	if updated.UserID != 2 || string(updated.Data) != "logged in" || !updated.CreatedAt.Equal(got.CreatedAt) {
+		t.Errorf("unexpected updated session %+v", updated)
+	}
+
+	if err := repo.TouchSession(ctx, "admin-laptop", "203.0.113.9", "Chrome/120.0", now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	active, err := repo.ActiveSessionsForUser(ctx, 1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 2 || active[0].Token != "admin-laptop" || active[0].IPAddress != "203.0.113.9" || active[1].Token != "admin-phone" {
+		t.Errorf("expected the two unexpired admin sessions, most recent first, got %+v", active)
+	}
+
+	counts, err := repo.ActiveSessionCounts(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[1] != 2 || counts[jane] != 2 || len(counts) != 2 {
+		t.Errorf("unexpected session counts %v", counts)
+	}
+
+	// a user cannot revoke someone else's session
+	if err := repo.DeleteUserSession(ctx, jane, "admin-phone"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetSession(ctx, "admin-phone"); err != nil {
+		t.Error("expected another user's session to survive")
+	}
+
+	n, err := repo.DeleteUserSessions(ctx, 1, "admin-phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected the laptop and expired sessions to be revoked, got %d", n)
+	}
+	if _, err := repo.GetSession(ctx, "admin-phone"); err != nil {
+		t.Error("expected the excepted session to survive")
+	}
+
+	n, err = repo.DeleteExpiredSessions(ctx, now.Add(90*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 expired sessions to be deleted, got %d", n)
+	}
+
+	if err := repo.DeleteSession(ctx, "guest"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteSession(ctx, "guest"); err != nil {
+		t.Errorf("deleting a missing session should not fail: %v", err)
+	}
+
+	users, err := repo.ListUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].LastName != "Doe" {
+		t.Errorf("expected users ordered by last name, got %+v", users)
+	}
+}
+
+func contractCancellation(t *testing.T, repo contractRepo) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := repo.AllRooms(ctx); err == nil {
+		t.Error("expected an error when the request context is already cancelled")
+	}
+}
+
+func contractReservationEmails(t *testing.T, repo contractRepo) {
+	ctx := context.Background()
+
+	day := func(d int) time.Time { return time.Date(2025, 7, d, 0, 0, 0, 0, time.UTC) }
+	for _, stay := range []struct{ start, end int }{{10, 12}, {11, 14}, {20, 22}} {
+		_, err := repo.InsertReservation(ctx, models.Reservation{
+			FirstName: "Ana",
+			LastName:  "Lopez",
+			Email:     "ana@example.com",
+			StartDate: day(stay.start),
+			EndDate:   day(stay.end),
+			RoomID:    2,
+			Locale:    "es",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	arrivals, err := repo.ArrivalsAwaitingEmail(ctx, models.EmailPreArrival, day(10), day(11))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arrivals) != 2 {
+		t.Fatalf("expected 2 arrivals between the 10th and 11th, got %d", len(arrivals))
+	}
+	if arrivals[0].Room.RoomName != "Major's Suite" || arrivals[0].Locale != "es" {
+		t.Errorf("expected the room and locale to be loaded, got %+v", arrivals[0])
+	}
+
+	claimed, err := repo.RecordReservationEmail(ctx, arrivals[0].ID, models.EmailPreArrival, time.Now())
+	if err != nil || !claimed {
+		t.Fatalf("expected the first claim to succeed, got %v, %v", claimed, err)
+	}
+	claimed, err = repo.RecordReservationEmail(ctx, arrivals[0].ID, models.EmailPreArrival, time.Now())
+	if err != nil || claimed {
+		t.Errorf("expected a second claim of the same email to be refused, got %v, %v", claimed, err)
+	}
+
+	arrivals, err = repo.ArrivalsAwaitingEmail(ctx, models.EmailPreArrival, day(10), day(11))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arrivals) != 1 || arrivals[0].StartDate.Day() != 11 {
+		t.Errorf("expected only the unsent arrival to be left, got %+v", arrivals)
+	}
+
+	// other kinds of email are tracked separately
+	arrivals, err = repo.ArrivalsAwaitingEmail(ctx, models.EmailCheckIn, day(10), day(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arrivals) != 1 {
+		t.Errorf("expected the check-in email to be unaffected, got %d", len(arrivals))
+	}
+
+	departures, err := repo.DeparturesAwaitingEmail(ctx, models.EmailThankYou, day(12), day(21))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(departures) != 2 {
+		t.Errorf("expected 2 departures between the 12th and 21st, got %d", len(departures))
+	}
+}
+
+func contractReviews(t *testing.T, repo contractRepo) {
+	ctx := context.Background()
+
+	var resIDs []int
+	for _, email := range []string{"ana@example.com", "ben@example.com", "cleo@example.com"} {
+		id, err := repo.InsertReservation(ctx, models.Reservation{
+			FirstName: "Guest",
+			LastName:  "Name",
+			Email:     email,
+			StartDate: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2025, 7, 3, 0, 0, 0, 0, time.UTC),
+			RoomID:    1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resIDs = append(resIDs, id)
+	}
+
+	if _, err := repo.GetReviewByReservationID(ctx, resIDs[0]); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected no review yet, got %v", err)
+	}
+
+	var reviewIDs []int
+	for i, rating := range []int{5, 4, 1} {
+		id, err := repo.InsertReview(ctx, models.Review{ReservationID: resIDs[i], RoomID: 1, Rating: rating, Body: "A review of the stay"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reviewIDs = append(reviewIDs, id)
+	}
+	if _, err := repo.InsertReview(ctx, models.Review{ReservationID: resIDs[0], RoomID: 1, Rating: 3, Body: "Again"}); err == nil {
+		t.Error("expected a second review of the same reservation to be refused")
+	}
+
+	rv, err := repo.GetReviewByReservationID(ctx, resIDs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rv.ID != reviewIDs[0] || rv.Status != models.ReviewPending || rv.Room.RoomName != "General's Quaters" || rv.Reservation.Email != "ana@example.com" {
+		t.Errorf("unexpected review %+v", rv)
+	}
+
+	// only approved reviews count towards the room
+	for _, id := range reviewIDs[:2] {
+		if err := repo.UpdateReviewStatus(ctx, id, models.ReviewApproved, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.UpdateReviewStatus(ctx, reviewIDs[2], models.ReviewHidden, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateReviewStatus(ctx, 999, models.ReviewApproved, 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected updating a missing review to return sql.ErrNoRows, got %v", err)
+	}
+
+	approved, err := repo.ApprovedReviewsForRoom(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(approved) != 2 {
+		t.Errorf("expected 2 approved reviews, got %d", len(approved))
+	}
+	average, count, err := repo.RoomRating(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if average != 4.5 || count != 2 {
+		t.Errorf("expected an average of 4.5 from 2 reviews, got %v from %d", average, count)
+	}
+	if average, count, _ := repo.RoomRating(ctx, 2); average != 0 || count != 0 {
+		t.Errorf("expected a room without reviews to have no rating, got %v from %d", average, count)
+	}
+
+	hidden, err := repo.AllReviews(ctx, models.ReviewHidden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := repo.AllReviews(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hidden) != 1 || len(all) != 3 {
+		t.Errorf("expected 1 hidden review of 3, got %d of %d", len(hidden), len(all))
+	}
+
+	at := time.Date(2025, 7, 5, 12, 0, 0, 0, time.UTC)
+	if err := repo.ReplyToReview(ctx, reviewIDs[0], "Thank you!", 1, at); err != nil {
+		t.Fatal(err)
+	}
+	rv, _ = repo.GetReviewByID(ctx, reviewIDs[0])
+	if rv.Reply != "Thank you!" || !rv.RepliedAt.Equal(at) || rv.ModeratedBy != 1 {
+		t.Errorf("expected the reply to be saved, got %+v", rv)
+	}
+	if err := repo.ReplyToReview(ctx, reviewIDs[0], "", 1, at); err != nil {
+		t.Fatal(err)
+	}
+	rv, _ = repo.GetReviewByID(ctx, reviewIDs[0])
+	if rv.Reply != "" || !rv.RepliedAt.IsZero() {
+		t.Errorf("expected the reply to be removed, got %+v", rv)
+	}
+}
+
+func contractPromoCodes(t *testing.T, repo contractRepo) {
+	ctx := context.Background()
+
+	room, err := repo.GetRoomByID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.PriceCents != 12000 {
+		t.Errorf("expected the seeded room price, got %d", room.PriceCents)
+	}
+
+	id, err := repo.InsertPromoCode(ctx, models.PromoCode{
+		Code:            "Summer",
+		Kind:            models.PromoPercent,
+		Amount:          10,
+		StayStart:       time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC),
+		MaxUses:         2,
+		MaxUsesPerEmail: 1,
+		RoomIDs:         []int{1},
+		Active:          true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.InsertPromoCode(ctx, models.PromoCode{Code: "SUMMER", Kind: models.PromoFixed, Amount: 100}); err == nil {
+		t.Error("expected a duplicate code to be refused")
+	}
+
+	p, err := repo.GetPromoCodeByCode(ctx, " summer ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != id || p.Code != "SUMMER" || !p.StayStart.Equal(time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)) || !p.BookingEnd.IsZero() ||
+		len(p.RoomIDs) != 1 || p.RoomIDs[0] != 1 || !p.Active {
+		t.Errorf("unexpected promo code %+v", p)
+	}
+	if _, err := repo.GetPromoCodeByCode(ctx, "WINTER"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for an unknown code, got %v", err)
+	}
+
+	redeem := func(email string) (int, bool) {
+		resID, err := repo.InsertReservation(ctx, models.Reservation{
+			FirstName:     "Guest",
+			LastName:      "Name",
+			Email:         email,
+			StartDate:     time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:       time.Date(2025, 7, 3, 0, 0, 0, 0, time.UTC),
+			RoomID:        1,
+			SubtotalCents: 24000,
+			TotalCents:    24000,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, err := repo.RedeemPromoCode(ctx, models.PromoRedemption{PromoCodeID: id, ReservationID: resID, Email: email, DiscountCents: 2400})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resID, ok
+	}
+
+	resID, ok := redeem("Ana@Example.com")
+	if !ok {
+		t.Fatal("expected the first redemption to succeed")
+	}
+	if _, ok := redeem("ana@example.com"); ok {
+		t.Error("expected a second redemption by the same email to be refused")
+	}
+	if _, ok := redeem("ben@example.com"); !ok {
+		t.Error("expected a redemption by another guest to succeed")
+	}
+	if _, ok := redeem("cleo@example.com"); ok {
+		t.Error("expected the code to be used up")
+	}
+
+	res, err := repo.GetReservationByID(ctx, resID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SubtotalCents != 24000 || res.DiscountCents != 2400 || res.TotalCents != 21600 || res.PromoCode != "SUMMER" {
+		t.Errorf("unexpected reservation amounts %d - %d = %d with %q", res.SubtotalCents, res.DiscountCents, res.TotalCents, res.PromoCode)
+	}
+
+	uses, byEmail, err := repo.PromoCodeUses(ctx, id, " ANA@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uses != 2 || byEmail != 1 {
+		t.Errorf("expected 2 uses, 1 by the guest, got %d and %d", uses, byEmail)
+	}
+
+	codes, err := repo.AllPromoCodes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 1 || codes[0].Uses != 2 || codes[0].DiscountCents != 4800 {
+		t.Errorf("unexpected promo codes %+v", codes)
+	}
+
+	if err := repo.SetPromoCodeActive(ctx, id, false); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := repo.GetPromoCodeByCode(ctx, "SUMMER"); p.Active {
+		t.Error("expected the code to be disabled")
+	}
+	if err := repo.SetPromoCodeActive(ctx, id+100, true); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing code, got %v", err)
+	}
+}
+
+func contractCancellationPolicies(t *testing.T, repo contractRepo) {
+	ctx := context.Background()
+
+	room, err := repo.GetRoomByID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	standard, err := repo.GetCancellationPolicyByID(ctx, room.CancellationPolicyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if standard.Name != "Standard" || len(standard.Tiers) != 2 || standard.Tiers[0].DaysBefore != 7 || standard.Tiers[1].PenaltyPercent != 50 {
+		t.Errorf("unexpected seeded policy %+v", standard)
+	}
+	if _, err := repo.GetCancellationPolicyByID(ctx, 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing policy, got %v", err)
+	}
+
+	id, err := repo.InsertCancellationPolicy(ctx, models.CancellationPolicy{
+		Name:  "Strict",
+		Tiers: []models.CancellationTier{{DaysBefore: 30, PenaltyPercent: 20}, {DaysBefore: 60, PenaltyPercent: 0}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies, err := repo.AllCancellationPolicies(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 2 || policies[1].ID != id || len(policies[1].Tiers) != 2 || policies[1].Tiers[0].DaysBefore != 60 {
+		t.Errorf("unexpected policies %+v", policies)
+	}
+
+	if err := repo.SetRoomCancellationPolicy(ctx, 2, id); err != nil {
+		t.Fatal(err)
+	}
+	if room, _ := repo.GetRoomByID(ctx, 2); room.CancellationPolicyID != id {
+		t.Errorf("expected room 2 to use policy %d, got %d", id, room.CancellationPolicyID)
+	}
+	if err := repo.SetRoomCancellationPolicy(ctx, 99, id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing room, got %v", err)
+	}
+
+	start := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 8, 3, 0, 0, 0, 0, time.UTC)
+	resID, err := repo.InsertReservation(ctx, models.Reservation{
+		FirstName:            "Guest",
+		LastName:             "Name",
+		Email:                "guest@example.com",
+		StartDate:            start,
+		EndDate:              end,
+		RoomID:               1,
+		SubtotalCents:        24000,
+		TotalCents:           24000,
+		CancellationPolicyID: standard.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.InsertRoomRestriction(ctx, models.RoomRestriction{
+		StartDate:     start,
+		EndDate:       end,
+		RoomID:        1,
+		ReservationID: resID,
+		RestrictionID: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancelledAt := time.Date(2025, 7, 30, 9, 0, 0, 0, time.UTC)
+	if err := repo.CancelReservation(ctx, resID, cancelledAt, 12000, 12000); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CancelReservation(ctx, resID, cancelledAt, 12000, 12000); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows when cancelling twice, got %v", err)
+	}
+
+	res, err := repo.GetReservationByID(ctx, resID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.CancellationPolicyID != standard.ID || !res.CancelledAt.Equal(cancelledAt) || res.PenaltyCents != 12000 || res.RefundCents != 12000 {
+		t.Errorf("unexpected cancelled reservation %+v", res)
+	}
+
+	available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, start, end, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Error("expected the room to be available again")
+	}
+
+	reservations, err := repo.AllNewReservations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range reservations {
+		if r.ID == resID {
+			t.Error("expected the cancelled reservation not to be listed as new")
+		}
+	}
+}
+
+func contractGuests(t *testing.T, repo contractRepo) {
+	ctx := context.Background()
+
+	book := func(first, email string, start time.Time) int {
+		id, err := repo.InsertReservation(ctx, models.Reservation{
+			FirstName:  first,
+			LastName:   "Lima",
+			Email:      email,
+			Phone:      "555-0100",
+			StartDate:  start,
+			EndDate:    start.AddDate(0, 0, 2),
+			RoomID:     1,
+			TotalCents: 24000,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	first := book("Ana", "Ana@Example.com", time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC))
+	second := book("Anna", " ana@example.com", time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC))
+	other := book("Ben", "ben@example.com", time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+
+	res1, _ := repo.GetReservationByID(ctx, first)
+	res2, _ := repo.GetReservationByID(ctx, second)
+	res3, _ := repo.GetReservationByID(ctx, other)
+	if res1.GuestID == 0 || res1.GuestID != res2.GuestID || res3.GuestID == res1.GuestID {
+		t.Fatalf("expected the same guest for the same email, got %d, %d and %d", res1.GuestID, res2.GuestID, res3.GuestID)
+	}
+	if res1.Email != "Ana@Example.com" {
+		t.Errorf("expected the reservation to keep the email as entered, got %q", res1.Email)
+	}
+
+	ana, err := repo.GetGuestByID(ctx, res1.GuestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ana.Email != "ana@example.com" || ana.FirstName != "Anna" || ana.Stays != 2 || !ana.LastStay.Equal(time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected guest %+v", ana)
+	}
+	if _, err := repo.GetGuestByID(ctx, 999); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing guest, got %v", err)
+	}
+
+	if err := repo.CancelReservation(ctx, second, time.Now(), 0, 24000); err != nil {
+		t.Fatal(err)
+	}
+	list, err := repo.AllGuests(ctx, " ANNA ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != ana.ID || list[0].Stays != 1 || !list[0].LastStay.Equal(time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected search result %+v", list)
+	}
+	if list, _ := repo.AllGuests(ctx, ""); len(list) != 2 {
+		t.Errorf("expected 2 guests, got %d", len(list))
+	}
+
+	stays, err := repo.ReservationsForGuest(ctx, ana.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stays) != 2 || stays[0].ID != second || stays[0].CancelledAt.IsZero() || stays[1].Room.RoomName == "" {
+		t.Errorf("unexpected stays %+v", stays)
+	}
+
+	if err := repo.UpdateGuestNotes(ctx, ana.ID, "Allergic to feathers"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateGuestNotes(ctx, 999, "x"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing guest, got %v", err)
+	}
+
+	res3.Email = "ana@example.com"
+	if err := repo.UpdateReservation(ctx, res3, other); err != nil {
+		t.Fatal(err)
+	}
+	if moved, _ := repo.GetReservationByID(ctx, other); moved.GuestID != ana.ID {
+		t.Errorf("expected the reservation to move to the guest with its new email, got guest %d", moved.GuestID)
+	}
+
+	if err := repo.AnonymizeGuest(ctx, ana.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.AnonymizeGuest(ctx, ana.ID, time.Now()); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows when anonymizing twice, got %v", err)
+	}
+	ana, _ = repo.GetGuestByID(ctx, ana.ID)
+	if ana.AnonymizedAt.IsZero() || ana.Email != guests.AnonymizedEmail(ana.ID) || ana.Phone != "" || ana.Notes != "" {
+		t.Errorf("expected the guest to be anonymized, got %+v", ana)
+	}
+	stays, _ = repo.ReservationsForGuest(ctx, ana.ID)
+	if len(stays) != 3 {
+		t.Fatalf("expected the stays to be kept, got %d", len(stays))
+	}
+	for _, res := range stays {
+		if res.Email != "" || res.Phone != "" || res.FirstName != guests.AnonymizedFirstName || res.TotalCents != 24000 {
+			t.Errorf("expected reservation %d to be anonymized, got %+v", res.ID, res)
+		}
+	}
+
+	again := book("Ana", "ana@example.com", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	if res, _ := repo.GetReservationByID(ctx, again); res.GuestID == ana.ID {
+		t.Error("expected a new booking after erasure to start a new guest")
+	}
+}
+
+func contractWebhooks(t *testing.T, repo contractRepo) {
+	ctx := context.Background()
+	now := time.Date(2025, 7, 10, 9, 0, 0, 0, time.UTC)
+
+	all, err := repo.InsertWebhookEndpoint(ctx, models.WebhookEndpoint{URL: "https://a.example.com/hook", Secret: "a",
+		Events: []string{"reservation.created", "block.added"}, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := repo.InsertWebhookEndpoint(ctx, models.WebhookEndpoint{URL: "https://b.example.com/hook", Secret: "b",
+		Events: []string{"block.added"}, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints, err := repo.AllWebhookEndpoints(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 2 || len(endpoints[0].Events) == 0 {
+		t.Fatalf("expected 2 endpoints with their events, got %+v", endpoints)
+	}
+
+	// an event only goes to the endpoints subscribed to it, and a name that merely contains another does not match
+	for _, tt := range []struct {
+		event string
+		want  int
+	}{
+		{"reservation.created", 1},
+		{"block.added", 2},
+		{"block.removed", 0},
+		{"added", 0},
+	} {
+		n, err := repo.QueueWebhookDeliveries(ctx, tt.event, `{"event":"`+tt.event+`"}`, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != tt.want {
+			t.Errorf("%s: expected %d deliveries queued, got %d", tt.event, tt.want, n)
+		}
+	}
+
+	if err := repo.SetWebhookEndpointActive(ctx, blocks, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetWebhookEndpointActive(ctx, 99, false); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing endpoint, got %v", err)
+	}
+
+	// deliveries to the disabled endpoint wait
+	due, err := repo.DueWebhookDeliveries(ctx, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 2 || due[0].Endpoint.ID != all || due[0].Endpoint.Secret != "a" || due[0].Event != "reservation.created" {
+		t.Fatalf("expected the 2 deliveries to the active endpoint, oldest first, got %+v", due)
+	}
+	if due, _ := repo.DueWebhookDeliveries(ctx, now.Add(-time.Second), 10); len(due) != 0 {
+		t.Errorf("expected no deliveries due before they were queued, got %d", len(due))
+	}
+
+	d := due[0]
+	if err := repo.ClaimWebhookDelivery(ctx, d.ID, d.Attempts, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.ClaimWebhookDelivery(ctx, d.ID, d.Attempts, now.Add(time.Minute)); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected a second claim to fail with sql.ErrNoRows, got %v", err)
+	}
+	if due, _ := repo.DueWebhookDeliveries(ctx, now, 10); len(due) != 1 {
+		t.Errorf("expected the claimed delivery not to be due, got %d due", len(due))
+	}
+
+	d.Attempts = 1
+	d.Status = models.WebhookDelivered
+	d.LastStatusCode = 204
+	d.DeliveredAt = now
+	if err := repo.SaveWebhookAttempt(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+
+	delivered, err := repo.WebhookDeliveries(ctx, models.WebhookDelivered, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delivered) != 1 || delivered[0].Attempts != 1 || delivered[0].LastStatusCode != 204 || !delivered[0].DeliveredAt.Equal(now) {
+		t.Fatalf("expected the delivered delivery with its response, got %+v", delivered)
+	}
+	if log, _ := repo.WebhookDeliveries(ctx, "", 10); len(log) != 3 {
+		t.Errorf("expected 3 deliveries in the log, got %d", len(log))
+	}
+
+	later := now.Add(time.Hour)
+	if err := repo.RedeliverWebhook(ctx, d.ID, later); err != nil {
+		t.Fatal(err)
+	}
+	due, err = repo.DueWebhookDeliveries(ctx, later, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 2 || due[1].ID != d.ID || due[1].Attempts != 0 || due[1].Status != models.WebhookPending {
+		t.Errorf("expected the redelivered delivery to be pending from its first attempt, got %+v", due)
+	}
+	if err := repo.RedeliverWebhook(ctx, 99, later); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing delivery, got %v", err)
+	}
+}
+
+func contractAnonymizedWebhooks(t *testing.T, repo contractRepo) {
+	ctx := context.Background()
+	now := time.Date(2025, 7, 10, 9, 0, 0, 0, time.UTC)
+
+	_, err := repo.InsertWebhookEndpoint(ctx, models.WebhookEndpoint{URL: "https://a.example.com/hook", Secret: "a",
+		Events: []string{webhooks.ReservationCreated, webhooks.BlockAdded}, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// queue events as the dispatcher does, for a reservation of each of two guests
+	publish := func(event string, data any) {
+		t.Helper()
+		body, err := json.Marshal(webhooks.Envelope{Event: event, OccurredAt: now, Data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.QueueWebhookDeliveries(ctx, event, string(body), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var ana models.Reservation
+	for _, email := range []string{"ana@example.com", "ben@example.com"} {
+		res := models.Reservation{FirstName: "Guest", LastName: "Lima", Email: email, Phone: "555-0100", RoomID: 1,
+			StartDate: time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2025, 8, 3, 0, 0, 0, 0, time.UTC), TotalCents: 24000}
+		id, err := repo.InsertReservation(ctx, res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err = repo.GetReservationByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if email == "ana@example.com" {
+			ana = res
+		}
+		publish(webhooks.ReservationCreated, webhooks.NewReservation(res))
+	}
+	publish(webhooks.BlockAdded, webhooks.NewBlock(0, 1, now))
+
+	if err := repo.AnonymizeGuest(ctx, ana.GuestID, now); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := repo.WebhookDeliveries(ctx, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 3 {
+		t.Fatalf("expected 3 deliveries, got %d", len(log))
+	}
+	var kept bool
+	for _, d := range log {
+		if strings.Contains(d.Payload, "ana@example.com") {
+			t.Errorf("expected delivery %d to have the guest's data erased, got %s", d.ID, d.Payload)
+		}
+		if d.Event != webhooks.ReservationCreated {
+			continue
+		}
+		var envelope struct {
+			Event string
+			Data  webhooks.Reservation
+		}
+		if err := json.Unmarshal([]byte(d.Payload), &envelope); err != nil {
+			t.Fatal(err)
+		}
+		if envelope.Data.ID == ana.ID {
+			if envelope.Data.FirstName != guests.AnonymizedFirstName || envelope.Data.TotalCents != 24000 || envelope.Data.StartDate != "2025-08-01" {
+				t.Errorf("expected the anonymized reservation with its stay, got %+v", envelope.Data)
+			}
+		} else {
+			kept = envelope.Data.Email == "ben@example.com"
+		}
+	}
+	if !kept {
+		t.Error("expected the other guest's delivery to be left alone")
+	}
+}
+
+func contractNotificationPreferences(t *testing.T, repo contractRepo) {
+	ctx := context.Background()
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{FirstName: "Ana", Email: "Ana@Example.com", Phone: "555-0100",
+		StartDate: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2025, 7, 3, 0, 0, 0, 0, time.UTC), RoomID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _ := repo.GetReservationByID(ctx, id)
+
+	if prefs, err := repo.NotificationPreferences(ctx, "ana@example.com"); err != nil || len(prefs) != 0 {
+		t.Errorf("expected no preferences before the guest chose any, got %+v and %v", prefs, err)
+	}
+
+	chosen := []models.NotificationPreference{
+		{Kind: models.NotifyConfirmation, Channel: models.ChannelEmail, Enabled: false},
+		{Kind: models.NotifyCheckIn, Channel: models.ChannelSMS, Enabled: true},
+	}
+	if err := repo.SetNotificationPreferences(ctx, res.GuestID, chosen); err != nil {
+		t.Fatal(err)
+	}
+	// guests are found by their email however it is written
+	prefs, err := repo.NotificationPreferences(ctx, " ANA@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.NotificationPreference{chosen[1], chosen[0]}
+	if !reflect.DeepEqual(prefs, want) {
+		t.Errorf("expected %+v, got %+v", want, prefs)
+	}
+	if prefs, _ := repo.NotificationPreferences(ctx, "ben@example.com"); len(prefs) != 0 {
+		t.Errorf("expected no preferences for an unknown email, got %+v", prefs)
+	}
+
+	// a failed update leaves the preferences as they were
+	twice := []models.NotificationPreference{
+		{Kind: models.NotifyThankYou, Channel: models.ChannelSMS, Enabled: true},
+		{Kind: models.NotifyThankYou, Channel: models.ChannelSMS, Enabled: false},
+	}
+	if err := repo.SetNotificationPreferences(ctx, res.GuestID, twice); err == nil {
+		t.Error("expected two preferences for the same kind and channel to be refused")
+	}
+	if prefs, _ := repo.NotificationPreferences(ctx, "ana@example.com"); !reflect.DeepEqual(prefs, want) {
+		t.Errorf("expected the refused update not to be saved, got %+v", prefs)
+	}
+
+	if err := repo.SetNotificationPreferences(ctx, res.GuestID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if prefs, _ := repo.NotificationPreferences(ctx, "ana@example.com"); len(prefs) != 0 {
+		t.Errorf("expected the preferences to be replaced, got %+v", prefs)
+	}
+}
+
+func contractMissingRows(t *testing.T, repo contractRepo) {
+	ctx := context.Background()
+	now := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	for name, err := range map[string]error{
+		"GetUserByID":                second(repo.GetUserByID(ctx, 99)),
+		"GetReservationByID":         second(repo.GetReservationByID(ctx, 99)),
+		"GetReviewByID":              second(repo.GetReviewByID(ctx, 99)),
+		"ReplyToReview":              repo.ReplyToReview(ctx, 99, "Thanks", 1, now),
+		"CancelReservation":          repo.CancelReservation(ctx, 99, now, 0, 0),
+		"AnonymizeGuest":             repo.AnonymizeGuest(ctx, 99, now),
+		"SetNotificationPreferences": repo.SetNotificationPreferences(ctx, 99, nil),
+		"ClaimWebhookDelivery":       repo.ClaimWebhookDelivery(ctx, 99, 0, now),
+		"SaveWebhookAttempt":         repo.SaveWebhookAttempt(ctx, models.WebhookDelivery{ID: 99, Status: models.WebhookFailed}),
+	} {
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("%s: expected sql.ErrNoRows, got %v", name, err)
+		}
+	}
+	if _, _, err := repo.AuthenticateUser(ctx, "nobody@example.com", "secret"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for an unknown user, got %v", err)
+	}
+
+	// updates and deletes of rows that do not exist do nothing
+	for name, err := range map[string]error{
+		"UpdateReservation":             repo.UpdateReservation(ctx, models.Reservation{FirstName: "Nobody"}, 99),
+		"UpdateProcessedForReservation": repo.UpdateProcessedForReservation(ctx, 99, 1),
+		"DeleteReservation":             repo.DeleteReservation(ctx, 99),
+		"DeleteBlockByID":               repo.DeleteBlockByID(ctx, 99),
+		"UpdateUser":                    repo.UpdateUser(ctx, models.User{ID: 99, Email: "nobody@example.com"}),
+	} {
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", name, err)
+		}
+	}
+	if list, err := repo.AllReservations(ctx); err != nil || len(list) != 0 {
+		t.Errorf("expected no reservations, got %d and %v", len(list), err)
+	}
+}
+
+// second returns the error of a call returning a value and an error
+func second[T any](_ T, err error) error {
+	return err
+}
+
+func contractConstraints(t *testing.T, repo contractRepo) {
+	ctx := context.Background()
+	start := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := repo.InsertReservation(ctx, models.Reservation{FirstName: "Ana", Email: "ana@example.com", StartDate: start,
+		EndDate: start.AddDate(0, 0, 2), RoomID: 99}); err == nil {
+		t.Error("expected a reservation of a missing room to be refused")
+	}
+	if err := repo.InsertRoomRestriction(ctx, models.RoomRestriction{StartDate: start, EndDate: start.AddDate(0, 0, 2), RoomID: 1,
+		ReservationID: 99, RestrictionID: 1}); err == nil {
+		t.Error("expected a restriction for a missing reservation to be refused")
+	}
+	if err := repo.InsertBlockForRoom(ctx, 99, start); err == nil {
+		t.Error("expected a block of a missing room to be refused")
+	}
+	if _, err := repo.RecordReservationEmail(ctx, 99, models.EmailPreArrival, start); err == nil {
+		t.Error("expected an email for a missing reservation to be refused")
+	}
+	if _, err := repo.InsertReview(ctx, models.Review{ReservationID: 99, RoomID: 1, Rating: 5}); err == nil {
+		t.Error("expected a review of a missing reservation to be refused")
+	}
+	if _, err := repo.InsertPromoCode(ctx, models.PromoCode{Code: "ROOMLESS", Kind: models.PromoFixed, Amount: 100, RoomIDs: []int{99}}); err == nil {
+		t.Error("expected a promo code for a missing room to be refused")
+	}
+	if _, err := repo.GetPromoCodeByCode(ctx, "ROOMLESS"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the refused promo code not to be saved, got %v", err)
+	}
+	if _, err := repo.InsertCancellationPolicy(ctx, models.CancellationPolicy{Name: "Twice",
+		Tiers: []models.CancellationTier{{DaysBefore: 3}, {DaysBefore: 3, PenaltyPercent: 100}}}); err == nil {
+		t.Error("expected a policy with two tiers for the same day to be refused")
+	}
+	if err := repo.SetRoomCancellationPolicy(ctx, 1, 99); err == nil {
+		t.Error("expected a missing policy to be refused")
+	}
+	if err := repo.SaveSession(ctx, models.Session{Token: "orphan", UserID: 99, Expiry: start}); err == nil {
+		t.Error("expected a session of a missing user to be refused")
+	}
+
+	// email addresses of users are unique
+	jane := repo.addUser(t, models.User{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", AccessLevel: 1}, "secret")
+	if err := repo.UpdateUser(ctx, models.User{ID: jane, FirstName: "Jane", LastName: "Doe", Email: "ashparsh@admin.com", AccessLevel: 1}); err == nil {
+		t.Error("expected taking another user's email to be refused")
+	}
+	if u, _ := repo.GetUserByID(ctx, jane); u.Email != "jane@example.com" {
+		t.Errorf("expected the refused update not to be saved, got %q", u.Email)
+	}
+}
+
+func contractDeleteReservation(t *testing.T, repo contractRepo) {
+	ctx := context.Background()
+	start := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	promoID, err := repo.InsertPromoCode(ctx, models.PromoCode{Code: "ONCE", Kind: models.PromoFixed, Amount: 1000, MaxUses: 1, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{FirstName: "Ana", LastName: "Lima", Email: "ana@example.com",
+		StartDate: start, EndDate: start.AddDate(0, 0, 2), RoomID: 1, SubtotalCents: 24000, TotalCents: 24000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.InsertRoomRestriction(ctx, models.RoomRestriction{StartDate: start, EndDate: start.AddDate(0, 0, 2), RoomID: 1,
+		ReservationID: id, RestrictionID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.RecordReservationEmail(ctx, id, models.EmailPreArrival, start); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.InsertReview(ctx, models.Review{ReservationID: id, RoomID: 1, Rating: 5, Body: "Lovely"}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := repo.RedeemPromoCode(ctx, models.PromoRedemption{PromoCodeID: promoID, ReservationID: id, Email: "ana@example.com",
+		DiscountCents: 1000}); err != nil || !ok {
+		t.Fatalf("expected the promo code to be redeemed, got %v, %v", ok, err)
+	}
+
+	// everything belonging to the reservation goes with it, and the promo code can be used again
+	if err := repo.DeleteReservation(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if restrictions, _ := repo.GetRestrictionsForRoomByDate(ctx, 1, start, start.AddDate(0, 0, 2)); len(restrictions) != 0 {
+		t.Errorf("expected the restriction to be deleted, got %+v", restrictions)
+	}
+	if reviews, _ := repo.AllReviews(ctx, ""); len(reviews) != 0 {
+		t.Errorf("expected the review to be deleted, got %+v", reviews)
+	}
+	if uses, _, _ := repo.PromoCodeUses(ctx, promoID, "ana@example.com"); uses != 0 {
+		t.Errorf("expected the redemption to be deleted, got %d uses", uses)
+	}
+	if _, err := repo.GetReservationByID(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the reservation to be gone, got %v", err)
+	}
+
+	// the guest stays, without the stay
+	list, err := repo.AllGuests(ctx, "ana@")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Stays != 0 {
+		t.Errorf("expected the guest to be kept without stays, got %+v", list)
+	}
+}
@@ -1,17 +1,33 @@
 package dbrepo
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
 
 	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/guests"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/promo"
 	"github.com/ashparshp/bookings/internal/repository"
 )
 
+// defaultQueryTimeout is used when the app config does not set a query timeout
+const defaultQueryTimeout = 3 * time.Second
+
 type postgresDBRepo struct {
 	App *config.AppConfig
 	DB *sql.DB
 }
 
+type sqliteDBRepo struct {
+	App *config.AppConfig
+	DB  *sql.DB
+}
+
 type testDBRepo struct {
 	App *config.AppConfig
 	DB  *sql.DB
@@ -24,8 +40,663 @@ func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo
 	}
 }
 
+func NewSqliteRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
+	return &sqliteDBRepo{
+		App: a,
+		DB:  conn,
+	}
+}
+
 func NewTestRepo(a *config.AppConfig) repository.DatabaseRepo {
 	return &testDBRepo{
 		App: a,
 	}
-}
\ No newline at end of file
+}
+
+// queryTimeout returns the configured per-query timeout for the repositories
+func queryTimeout(a *config.AppConfig) time.Duration {
+	if a == nil || a.DBTimeout <= 0 {
+		return defaultQueryTimeout
+	}
+	return a.DBTimeout
+}
+
+// reservationLocale returns the language stored with a reservation, defaulting to English
+func reservationLocale(res models.Reservation) string {
+	if res.Locale == "" {
+		return "en"
+	}
+	return res.Locale
+}
+
+// maxUserAgentLength matches the size of the sessions.user_agent column
+const maxUserAgentLength = 512
+
+// sessionUserID stores guests' sessions with a NULL user, which the foreign key to users requires
+func sessionUserID(id int) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// nullID stores a zero foreign key as NULL
+func nullID(id int) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// truncateUserAgent cuts user agents that would not fit in the sessions table
+func truncateUserAgent(ua string) string {
+	if len(ua) <= maxUserAgentLength {
+		return ua
+	}
+	return ua[:maxUserAgentLength]
+}
+
+// reviewQuery selects reviews with their room and the guest's reservation, for scanReview; callers add the
+// WHERE and ORDER BY clauses
+const reviewQuery = `
+	SELECT
+		rv.id, rv.reservation_id, rv.room_id, rv.rating, rv.body, rv.status, rv.reply,
+		rv.replied_at, rv.moderated_by, rv.created_at, rv.updated_at,
+		rm.id, rm.room_name,
+		r.id, r.first_name, r.last_name, r.email, r.start_date, r.end_date
+	FROM reviews rv
+	JOIN rooms rm ON rm.id = rv.room_id
+	JOIN reservations r ON r.id = rv.reservation_id
+`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanReview reads a row selected by reviewQuery
+func scanReview(row rowScanner) (models.Review, error) {
+	var rv models.Review
+	var repliedAt sql.NullTime
+	var moderatedBy sql.NullInt64
+	err := row.Scan(
+		&rv.ID,
+		&rv.ReservationID,
+		&rv.RoomID,
+		&rv.Rating,
+		&rv.Body,
+		&rv.Status,
+		&rv.Reply,
+		&repliedAt,
+		&moderatedBy,
+		&rv.CreatedAt,
+		&rv.UpdatedAt,
+		&rv.Room.ID,
+		&rv.Room.RoomName,
+		&rv.Reservation.ID,
+		&rv.Reservation.FirstName,
+		&rv.Reservation.LastName,
+		&rv.Reservation.Email,
+		&rv.Reservation.StartDate,
+		&rv.Reservation.EndDate,
+	)
+	rv.RepliedAt = repliedAt.Time
+	rv.ModeratedBy = int(moderatedBy.Int64)
+	return rv, err
+}
+
+// scanReviews reads all rows selected by reviewQuery
+func scanReviews(rows *sql.Rows) ([]models.Review, error) {
+	defer rows.Close()
+
+	var reviews []models.Review
+	for rows.Next() {
+		rv, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, rv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+// requireOneRow turns an update that matched nothing into sql.ErrNoRows
+func requireOneRow(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// replyTime is when a reply was made, or NULL when the reply is being removed
+func replyTime(reply string, at time.Time) any {
+	if reply == "" {
+		return nil
+	}
+	return at
+}
+
+// promoCodeQuery selects promo codes with their number of redemptions and the discount given, for
+// scanPromoCode; callers add the WHERE and ORDER BY clauses
+const promoCodeQuery = `
+	SELECT
+		pc.id, pc.code, pc.description, pc.kind, pc.amount,
+		pc.booking_start, pc.booking_end, pc.stay_start, pc.stay_end,
+		pc.min_nights, pc.max_uses, pc.max_uses_per_email, pc.active, pc.created_at, pc.updated_at,
+		(SELECT COUNT(*) FROM promo_redemptions pr WHERE pr.promo_code_id = pc.id),
+		(SELECT COALESCE(SUM(pr.discount_cents), 0) FROM promo_redemptions pr WHERE pr.promo_code_id = pc.id)
+	FROM promo_codes pc
+`
+
+// scanPromoCode reads a row selected by promoCodeQuery; the rooms are loaded by loadPromoCodeRooms
+func scanPromoCode(row rowScanner) (models.PromoCode, error) {
+	var p models.PromoCode
+	var bookingStart, bookingEnd, stayStart, stayEnd sql.NullTime
+	err := row.Scan(
+		&p.ID,
+		&p.Code,
+		&p.Description,
+		&p.Kind,
+		&p.Amount,
+		&bookingStart,
+		&bookingEnd,
+		&stayStart,
+		&stayEnd,
+		&p.MinNights,
+		&p.MaxUses,
+		&p.MaxUsesPerEmail,
+		&p.Active,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+		&p.Uses,
+		&p.DiscountCents,
+	)
+	p.BookingStart = bookingStart.Time
+	p.BookingEnd = bookingEnd.Time
+	p.StayStart = stayStart.Time
+	p.StayEnd = stayEnd.Time
+	return p, err
+}
+
+// scanPromoCodes reads all rows selected by promoCodeQuery
+func scanPromoCodes(rows *sql.Rows) ([]models.PromoCode, error) {
+	defer rows.Close()
+
+	var codes []models.PromoCode
+	for rows.Next() {
+		p, err := scanPromoCode(rows)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// loadPromoCodeRooms fills in the rooms each of codes is restricted to. The table holds a few rows per
+// code, so it is read whole rather than with a per dialect IN list.
+func loadPromoCodeRooms(ctx context.Context, db *sql.DB, codes []models.PromoCode) error {
+	if len(codes) == 0 {
+		return nil
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT promo_code_id, room_id FROM promo_code_rooms ORDER BY promo_code_id, room_id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	index := make(map[int]int, len(codes))
+	for i, p := range codes {
+		index[p.ID] = i
+	}
+	for rows.Next() {
+		var codeID, roomID int
+		if err := rows.Scan(&codeID, &roomID); err != nil {
+			return err
+		}
+		if i, ok := index[codeID]; ok {
+			codes[i].RoomIDs = append(codes[i].RoomIDs, roomID)
+		}
+	}
+	return rows.Err()
+}
+
+// nullDate stores the zero time, an open end of a promo code's window, as NULL
+func nullDate(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// usageAllows reports whether a promo code with the given limits may be redeemed once more
+func usageAllows(maxUses, maxUsesPerEmail, uses, usesByEmail int) bool {
+	limits := models.PromoCode{MaxUses: maxUses, MaxUsesPerEmail: maxUsesPerEmail}
+	return promo.CheckUsage(limits, uses, usesByEmail) == nil
+}
+
+// cancellationPolicyQuery selects cancellation policies for scanCancellationPolicy; callers add the WHERE
+// and ORDER BY clauses
+const cancellationPolicyQuery = `SELECT id, name, description, created_at, updated_at FROM cancellation_policies`
+
+// scanCancellationPolicy reads a row selected by cancellationPolicyQuery; the tiers are loaded by
+// loadCancellationTiers
+func scanCancellationPolicy(row rowScanner) (models.CancellationPolicy, error) {
+	var p models.CancellationPolicy
+	err := row.Scan(&p.ID, &p.Name, &p.Description, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+// loadCancellationTiers fills in the tiers of policies, earliest cancellation first. Like the rooms of promo
+// codes, the table is small enough to be read whole.
+func loadCancellationTiers(ctx context.Context, db *sql.DB, policies []models.CancellationPolicy) error {
+	if len(policies) == 0 {
+		return nil
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT cancellation_policy_id, days_before, penalty_percent
+		FROM cancellation_policy_tiers ORDER BY cancellation_policy_id, days_before DESC`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	index := make(map[int]int, len(policies))
+	for i, p := range policies {
+		index[p.ID] = i
+	}
+	for rows.Next() {
+		var policyID int
+		var t models.CancellationTier
+		if err := rows.Scan(&policyID, &t.DaysBefore, &t.PenaltyPercent); err != nil {
+			return err
+		}
+		if i, ok := index[policyID]; ok {
+			policies[i].Tiers = append(policies[i].Tiers, t)
+		}
+	}
+	return rows.Err()
+}
+
+// guestQuery selects guests with the number of stays they did not cancel and the arrival day of the latest
+// one, for scanGuest. Callers fill in their database's expression for that day as YYYY-MM-DD text with
+// fmt.Sprintf and add the WHERE and ORDER BY clauses.
+const guestQuery = `
+	SELECT
+		g.id, g.email, g.first_name, g.last_name, g.phone, g.notes, g.anonymized_at, g.created_at, g.updated_at,
+		(SELECT COUNT(*) FROM reservations r WHERE r.guest_id = g.id AND r.cancelled_at IS NULL),
+		(SELECT COALESCE(%s, '') FROM reservations r WHERE r.guest_id = g.id AND r.cancelled_at IS NULL)
+	FROM guests g
+`
+
+// scanGuest reads a row selected by guestQuery
+func scanGuest(row rowScanner) (models.Guest, error) {
+	var g models.Guest
+	var anonymizedAt sql.NullTime
+	var lastStay string
+	err := row.Scan(
+		&g.ID,
+		&g.Email,
+		&g.FirstName,
+		&g.LastName,
+		&g.Phone,
+		&g.Notes,
+		&anonymizedAt,
+		&g.CreatedAt,
+		&g.UpdatedAt,
+		&g.Stays,
+		&lastStay,
+	)
+	if err != nil {
+		return g, err
+	}
+	g.AnonymizedAt = anonymizedAt.Time
+	if lastStay != "" {
+		g.LastStay, err = time.Parse("2006-01-02", lastStay)
+	}
+	return g, err
+}
+
+// scanGuests reads all rows selected by guestQuery
+func scanGuests(rows *sql.Rows) ([]models.Guest, error) {
+	defer rows.Close()
+
+	var list []models.Guest
+	for rows.Next() {
+		g, err := scanGuest(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// scanNotificationPreferences reads the kind, channel and enabled columns of all rows
+func scanNotificationPreferences(rows *sql.Rows) ([]models.NotificationPreference, error) {
+	defer rows.Close()
+
+	var prefs []models.NotificationPreference
+	for rows.Next() {
+		var p models.NotificationPreference
+		if err := rows.Scan(&p.Kind, &p.Channel, &p.Enabled); err != nil {
+			return nil, err
+		}
+		prefs = append(prefs, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+// guestSearchPattern matches guests whose email or name contains search, or every guest if it is empty
+func guestSearchPattern(search string) string {
+	return "%" + strings.ToLower(strings.TrimSpace(search)) + "%"
+}
+
+// guestReservationQuery selects reservations with their room and promo code for the guest pages, for
+// scanGuestReservations; callers add the WHERE and ORDER BY clauses
+const guestReservationQuery = `
+	SELECT
+		r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.locale,
+		r.subtotal_cents, r.discount_cents, r.total_cents, COALESCE(pc.code, ''),
+		r.cancelled_at, r.penalty_cents, r.refund_cents, COALESCE(r.guest_id, 0), r.created_at,
+		rm.id, rm.room_name
+	FROM reservations r
+	JOIN rooms rm ON rm.id = r.room_id
+	LEFT JOIN promo_redemptions pr ON pr.reservation_id = r.id
+	LEFT JOIN promo_codes pc ON pc.id = pr.promo_code_id
+`
+
+// scanGuestReservations reads all rows selected by guestReservationQuery
+func scanGuestReservations(rows *sql.Rows) ([]models.Reservation, error) {
+	defer rows.Close()
+
+	var reservations []models.Reservation
+	for rows.Next() {
+		var res models.Reservation
+		var cancelledAt sql.NullTime
+		err := rows.Scan(
+			&res.ID,
+			&res.FirstName,
+			&res.LastName,
+			&res.Email,
+			&res.Phone,
+			&res.StartDate,
+			&res.EndDate,
+			&res.RoomID,
+			&res.Locale,
+			&res.SubtotalCents,
+			&res.DiscountCents,
+			&res.TotalCents,
+			&res.PromoCode,
+			&cancelledAt,
+			&res.PenaltyCents,
+			&res.RefundCents,
+			&res.GuestID,
+			&res.CreatedAt,
+			&res.Room.ID,
+			&res.Room.RoomName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		res.CancelledAt = cancelledAt.Time
+		reservations = append(reservations, res)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return reservations, nil
+}
+
+// webhookEndpointQuery selects webhook endpoints for scanWebhookEndpoints; callers add the WHERE and ORDER BY
+// clauses
+const webhookEndpointQuery = `SELECT id, url, secret, events, active, created_at, updated_at FROM webhook_endpoints`
+
+// scanWebhookEndpoints reads all rows selected by webhookEndpointQuery
+func scanWebhookEndpoints(rows *sql.Rows) ([]models.WebhookEndpoint, error) {
+	defer rows.Close()
+
+	var endpoints []models.WebhookEndpoint
+	for rows.Next() {
+		var e models.WebhookEndpoint
+		var events string
+		err := rows.Scan(&e.ID, &e.URL, &e.Secret, &events, &e.Active, &e.CreatedAt, &e.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		e.Events = splitWebhookEvents(events)
+		endpoints = append(endpoints, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// Webhook endpoints store their events as one comma separated column; the database matches an event
+// against it by wrapping both in commas
+func joinWebhookEvents(events []string) string {
+	return strings.Join(events, ",")
+}
+
+func splitWebhookEvents(events string) []string {
+	if events == "" {
+		return nil
+	}
+	return strings.Split(events, ",")
+}
+
+// webhookDeliveryQuery selects deliveries with their endpoint, for scanWebhookDeliveries; callers add the
+// WHERE, ORDER BY and LIMIT clauses
+const webhookDeliveryQuery = `
+	SELECT
+		d.id, d.webhook_endpoint_id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at,
+		d.last_status_code, d.last_error, d.delivered_at, d.created_at, d.updated_at,
+		e.id, e.url, e.secret, e.active
+	FROM webhook_deliveries d
+	JOIN webhook_endpoints e ON e.id = d.webhook_endpoint_id
+`
+
+// scanWebhookDeliveries reads all rows selected by webhookDeliveryQuery
+func scanWebhookDeliveries(rows *sql.Rows) ([]models.WebhookDelivery, error) {
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var deliveredAt sql.NullTime
+		err := rows.Scan(
+			&d.ID,
+			&d.EndpointID,
+			&d.Event,
+			&d.Payload,
+			&d.Status,
+			&d.Attempts,
+			&d.NextAttemptAt,
+			&d.LastStatusCode,
+			&d.LastError,
+			&deliveredAt,
+			&d.CreatedAt,
+			&d.UpdatedAt,
+			&d.Endpoint.ID,
+			&d.Endpoint.URL,
+			&d.Endpoint.Secret,
+			&d.Endpoint.Active,
+		)
+		if err != nil {
+			return nil, err
+		}
+		d.DeliveredAt = deliveredAt.Time
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// redactWebhookPayload erases the guest fields, as webhooks.NewReservation writes them, from the payload of
+// a stored reservation event if the event is about one of reservations. It reports whether it changed the
+// payload.
+func redactWebhookPayload(payload string, reservations map[int]bool) (string, bool, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(payload), &envelope); err != nil {
+		return "", false, err
+	}
+
+	// decode numbers as they were written, so amounts and ids come back unchanged
+	var data map[string]any
+	dec := json.NewDecoder(bytes.NewReader(envelope["data"]))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil {
+		return "", false, err
+	}
+	id, _ := data["id"].(json.Number)
+	n, err := id.Int64()
+	if err != nil || !reservations[int(n)] {
+		return payload, false, nil
+	}
+
+	data["first_name"], data["last_name"], data["email"], data["phone"] = guests.AnonymizedFirstName, guests.AnonymizedLastName, "", ""
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", false, err
+	}
+	envelope["data"] = b
+	b, err = json.Marshal(envelope)
+	if err != nil {
+		return "", false, err
+	}
+	return string(b), true, nil
+}
+
+// redactWebhookDeliveries erases the guest fields from the stored payloads of reservation events about the
+// reservations that reservationsQuery selects for guestID, so staff sending a delivery again after the guest
+// is anonymized can't send their personal data. Deliveries don't record their reservation, so every
+// reservation event is read. Callers pass their database's statement updating the payload and updated_at of a
+// delivery by id, and the time to set.
+func redactWebhookDeliveries(ctx context.Context, tx *sql.Tx, reservationsQuery string, guestID int, update string, now any) error {
+	rows, err := tx.QueryContext(ctx, reservationsQuery, guestID)
+	if err != nil {
+		return err
+	}
+	reservations := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		reservations[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(reservations) == 0 {
+		return nil
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT id, payload FROM webhook_deliveries WHERE event LIKE 'reservation.%'`)
+	if err != nil {
+		return err
+	}
+	redacted := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var payload string
+		if err := rows.Scan(&id, &payload); err != nil {
+			rows.Close()
+			return err
+		}
+		payload, changed, err := redactWebhookPayload(payload, reservations)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if changed {
+			redacted[id] = payload
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// the updates wait for the rows to be closed, as a transaction has one connection
+	for id, payload := range redacted {
+		if _, err := tx.ExecContext(ctx, update, payload, now, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nullTime stores a zero time as NULL
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// scanRoomOccupancy reads rows of every room joined to the restrictions on it, ordered by room, into one
+// RoomOccupancy per room. A room without restrictions comes as one row of NULLs.
+func scanRoomOccupancy(rows *sql.Rows) ([]models.RoomOccupancy, error) {
+	defer rows.Close()
+
+	var rooms []models.RoomOccupancy
+	for rows.Next() {
+		var room models.Room
+		var id, reservationID, restrictionID sql.NullInt64
+		var start, end sql.NullTime
+		err := rows.Scan(&room.ID, &room.RoomName, &id, &start, &end, &reservationID, &restrictionID)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(rooms) == 0 || rooms[len(rooms)-1].Room.ID != room.ID {
+			rooms = append(rooms, models.RoomOccupancy{Room: room})
+		}
+		if id.Valid {
+			o := &rooms[len(rooms)-1]
+			o.Busy = append(o.Busy, models.RoomRestriction{
+				ID:            int(id.Int64),
+				StartDate:     start.Time,
+				EndDate:       end.Time,
+				RoomID:        room.ID,
+				ReservationID: int(reservationID.Int64),
+				RestrictionID: int(restrictionID.Int64),
+			})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
@@ -0,0 +1,1656 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/guests"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/promo"
+	"github.com/ashparshp/bookings/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MemoryRepo is a repository that keeps everything in memory, for tests that need the database to behave
+// like one: a reservation booked is found again, overlaps and cascades work as in the real schema and
+// missing rows are sql.ErrNoRows. It starts with the rooms, restrictions, policy and admin user the
+// migrations seed, and is safe for concurrent use. The contract tests hold it to the same behaviour as
+// the sqlite and postgres repositories.
+type MemoryRepo struct {
+	App *config.AppConfig
+
+	mu     sync.Mutex
+	errs   map[string]error
+	nextID map[string]int
+
+	rooms        map[int]models.Room
+	users        map[int]models.User
+	restrictions map[int]models.RoomRestriction
+	reservations map[int]models.Reservation
+	sessions     map[string]models.Session
+	emails       map[reservationEmail]time.Time
+	reviews      map[int]models.Review
+	promoCodes   map[int]models.PromoCode
+	redemptions  map[int]models.PromoRedemption
+	policies     map[int]models.CancellationPolicy
+	guests       map[int]models.Guest
+	preferences  map[int][]models.NotificationPreference
+	endpoints    map[int]models.WebhookEndpoint
+	deliveries   map[int]models.WebhookDelivery
+}
+
+// reservationEmail identifies an email sent about a reservation
+type reservationEmail struct {
+	reservationID int
+	kind          string
+}
+
+// seedAdminPassword is the hash of the admin user the migrations add
+const seedAdminPassword = "$2a$12$lMxZd9rMZa.9quC.pNGVZeAzVTCEJ3enTiPCARdts/hFI.90KypJu"
+
+// errForeignKey is returned for a row referring to one that does not exist, where a database would
+// report a foreign key violation
+var errForeignKey = errors.New("foreign key constraint failed")
+
+// errUnique is returned for a row that would break a unique index
+var errUnique = errors.New("unique constraint failed")
+
+// NewMemoryRepo returns an in-memory repository holding the seed data
+func NewMemoryRepo(a *config.AppConfig) *MemoryRepo {
+	m := &MemoryRepo{
+		App:          a,
+		errs:         make(map[string]error),
+		nextID:       make(map[string]int),
+		rooms:        make(map[int]models.Room),
+		users:        make(map[int]models.User),
+		restrictions: make(map[int]models.RoomRestriction),
+		reservations: make(map[int]models.Reservation),
+		sessions:     make(map[string]models.Session),
+		emails:       make(map[reservationEmail]time.Time),
+		reviews:      make(map[int]models.Review),
+		promoCodes:   make(map[int]models.PromoCode),
+		redemptions:  make(map[int]models.PromoRedemption),
+		policies:     make(map[int]models.CancellationPolicy),
+		guests:       make(map[int]models.Guest),
+		preferences:  make(map[int][]models.NotificationPreference),
+		endpoints:    make(map[int]models.WebhookEndpoint),
+		deliveries:   make(map[int]models.WebhookDelivery),
+	}
+
+	seeded := time.Date(2023, 5, 23, 23, 0, 0, 0, time.UTC)
+	policy := m.id("policies")
+	m.policies[policy] = models.CancellationPolicy{
+		ID: policy, Name: "Standard", Description: "Free until a week before arrival, half the price after that",
+		Tiers: []models.CancellationTier{{DaysBefore: 7}, {DaysBefore: 0, PenaltyPercent: 50}}, CreatedAt: seeded, UpdatedAt: seeded,
+	}
+	for _, r := range []models.Room{{RoomName: "General's Quaters", PriceCents: 12000}, {RoomName: "Major's Suite", PriceCents: 18000}} {
+		r.ID, r.CancellationPolicyID, r.CreatedAt, r.UpdatedAt = m.id("rooms"), policy, seeded, seeded
+		m.rooms[r.ID] = r
+	}
+	admin := m.id("users")
+	m.users[admin] = models.User{
+		ID: admin, FirstName: "ashparsh", LastName: "pandey", Email: "ashparsh@admin.com", Password: seedAdminPassword,
+		AccessLevel: 3, CreatedAt: seeded, UpdatedAt: seeded,
+	}
+	return m
+}
+
+var _ repository.DatabaseRepo = (*MemoryRepo)(nil)
+
+var databaseRepoType = reflect.TypeOf((*repository.DatabaseRepo)(nil)).Elem()
+
+// FailOn makes every call of the named repository method return err, until it is called again with a nil
+// err. It panics if DatabaseRepo has no such method, so a typo cannot make a test pass.
+func (m *MemoryRepo) FailOn(method string, err error) {
+	if _, ok := databaseRepoType.MethodByName(method); !ok {
+		panic("dbrepo: DatabaseRepo has no method " + method)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		delete(m.errs, method)
+	} else {
+		m.errs[method] = err
+	}
+}
+
+// AddUser adds a user with the password, which the repository interface has no method for, and returns
+// their id
+func (m *MemoryRepo) AddUser(u models.User, password string) (int, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, other := range m.users {
+		if other.Email == u.Email {
+			return 0, errUnique
+		}
+	}
+	u.ID, u.Password = m.id("users"), string(hash)
+	u.CreatedAt, u.UpdatedAt = time.Now(), time.Now()
+	m.users[u.ID] = u
+	return u.ID, nil
+}
+
+// AddRoom adds a room, which the repository interface has no method for, and returns its id
+func (m *MemoryRepo) AddRoom(r models.Room) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r.ID, r.CreatedAt, r.UpdatedAt = m.id("rooms"), time.Now(), time.Now()
+	m.rooms[r.ID] = r
+	return r.ID
+}
+
+// begin starts a call of method: it returns the context's error or the error injected for the method,
+// and otherwise takes the lock, which the caller releases
+func (m *MemoryRepo) begin(ctx context.Context, method string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	if err := m.errs[method]; err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// id returns the next id of a table, counting from 1 like a serial column
+func (m *MemoryRepo) id(table string) int {
+	m.nextID[table]++
+	return m.nextID[table]
+}
+
+// overlaps is the overlap test the queries use: a stay ending on the day another starts does not overlap it
+func overlaps(start, end time.Time, r models.RoomRestriction) bool {
+	return start.Before(r.EndDate) && end.After(r.StartDate)
+}
+
+// sortedIDs returns the keys of a table in order
+func sortedIDs[T any](table map[int]T) []int {
+	ids := make([]int, 0, len(table))
+	for id := range table {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (m *MemoryRepo) AllUsers(ctx context.Context) bool {
+	return true
+}
+
+// InsertReservation inserts a reservation, linked to the guest it was made for
+func (m *MemoryRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
+	if err := m.begin(ctx, "InsertReservation"); err != nil {
+		return 0, err
+	}
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[res.RoomID]; !ok {
+		return 0, errForeignKey
+	}
+	if _, ok := m.policies[res.CancellationPolicyID]; !ok && res.CancellationPolicyID != 0 {
+		return 0, errForeignKey
+	}
+
+	stored := models.Reservation{
+		ID: m.id("reservations"), FirstName: res.FirstName, LastName: res.LastName, Email: res.Email, Phone: res.Phone,
+		StartDate: models.Day(res.StartDate), EndDate: models.Day(res.EndDate), RoomID: res.RoomID, Locale: reservationLocale(res),
+		SubtotalCents: res.SubtotalCents, DiscountCents: res.DiscountCents, TotalCents: res.TotalCents,
+		CancellationPolicyID: res.CancellationPolicyID, GuestID: m.saveGuest(res), CreatedAt: time.Now(), UpdatedAt: time.Now(),
+	}
+	m.reservations[stored.ID] = stored
+	return stored.ID, nil
+}
+
+// saveGuest creates the guest a reservation is for, or updates them with the details they booked with this
+// time, and returns their id, zero for a reservation without an email
+func (m *MemoryRepo) saveGuest(res models.Reservation) int {
+	email := guests.NormalizeEmail(res.Email)
+	if email == "" {
+		return 0
+	}
+
+	for id, g := range m.guests {
+		if g.Email == email {
+			g.FirstName, g.LastName, g.Phone, g.UpdatedAt = res.FirstName, res.LastName, res.Phone, time.Now()
+			m.guests[id] = g
+			return id
+		}
+	}
+	g := models.Guest{ID: m.id("guests"), Email: email, FirstName: res.FirstName, LastName: res.LastName, Phone: res.Phone,
+		CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	m.guests[g.ID] = g
+	return g.ID
+}
+
+// InsertRoomRestriction inserts a room restriction
+func (m *MemoryRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error {
+	if err := m.begin(ctx, "InsertRoomRestriction"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if _, ok := m.reservations[r.ReservationID]; !ok {
+		return errForeignKey
+	}
+	return m.insertRestriction(r.RoomID, r.ReservationID, r.RestrictionID, r.StartDate, r.EndDate)
+}
+
+func (m *MemoryRepo) insertRestriction(roomID, reservationID, restrictionID int, start, end time.Time) error {
+	if _, ok := m.rooms[roomID]; !ok || (restrictionID != 1 && restrictionID != 2) {
+		return errForeignKey
+	}
+
+	r := models.RoomRestriction{ID: m.id("restrictions"), StartDate: models.Day(start), EndDate: models.Day(end), RoomID: roomID,
+		ReservationID: reservationID, RestrictionID: restrictionID, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	m.restrictions[r.ID] = r
+	return nil
+}
+
+// SearchAvailabilityByDatesByRoomID returns true if the room is free for the given dates
+func (m *MemoryRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	if err := m.begin(ctx, "SearchAvailabilityByDatesByRoomID"); err != nil {
+		return false, err
+	}
+	defer m.mu.Unlock()
+
+	for _, r := range m.restrictions {
+		if r.RoomID == roomID && overlaps(models.Day(start), models.Day(end), r) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// SearchAvailabilityForAllRooms returns the rooms free for the given dates
+func (m *MemoryRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
+	if err := m.begin(ctx, "SearchAvailabilityForAllRooms"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	busy := make(map[int]bool)
+	for _, r := range m.restrictions {
+		if overlaps(models.Day(start), models.Day(end), r) {
+			busy[r.RoomID] = true
+		}
+	}
+
+	var rooms []models.Room
+	for _, id := range sortedIDs(m.rooms) {
+		if !busy[id] {
+			rooms = append(rooms, models.Room{ID: id, RoomName: m.rooms[id].RoomName})
+		}
+	}
+	return rooms, nil
+}
+
+// RoomOccupancy returns every room with the restrictions on it between start and end
+func (m *MemoryRepo) RoomOccupancy(ctx context.Context, start, end time.Time) ([]models.RoomOccupancy, error) {
+	if err := m.begin(ctx, "RoomOccupancy"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	var rooms []models.RoomOccupancy
+	for _, id := range sortedIDs(m.rooms) {
+		o := models.RoomOccupancy{Room: models.Room{ID: id, RoomName: m.rooms[id].RoomName}}
+		for _, r := range m.roomRestrictions(id, start, end) {
+			o.Busy = append(o.Busy, models.RoomRestriction{ID: r.ID, StartDate: r.StartDate, EndDate: r.EndDate,
+				RoomID: r.RoomID, ReservationID: r.ReservationID, RestrictionID: r.RestrictionID})
+		}
+		rooms = append(rooms, o)
+	}
+	return rooms, nil
+}
+
+// roomRestrictions returns the restrictions on a room between start and end, by start date
+func (m *MemoryRepo) roomRestrictions(roomID int, start, end time.Time) []models.RoomRestriction {
+	var list []models.RoomRestriction
+	for _, id := range sortedIDs(m.restrictions) {
+		if r := m.restrictions[id]; r.RoomID == roomID && overlaps(models.Day(start), models.Day(end), r) {
+			list = append(list, r)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].StartDate.Before(list[j].StartDate) })
+	return list
+}
+
+// GetRoomByID returns a room by its ID
+func (m *MemoryRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	if err := m.begin(ctx, "GetRoomByID"); err != nil {
+		return models.Room{}, err
+	}
+	defer m.mu.Unlock()
+
+	room, ok := m.rooms[id]
+	if !ok {
+		return room, sql.ErrNoRows
+	}
+	return room, nil
+}
+
+// GetUserByID returns a user by its ID
+func (m *MemoryRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	if err := m.begin(ctx, "GetUserByID"); err != nil {
+		return models.User{}, err
+	}
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return u, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+// UpdateUser updates a user's names, email and access level
+func (m *MemoryRepo) UpdateUser(ctx context.Context, u models.User) error {
+	if err := m.begin(ctx, "UpdateUser"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[u.ID]
+	if !ok {
+		return nil
+	}
+	for id, other := range m.users {
+		if id != u.ID && other.Email == u.Email {
+			return errUnique
+		}
+	}
+	stored.FirstName, stored.LastName, stored.Email, stored.AccessLevel, stored.UpdatedAt = u.FirstName, u.LastName, u.Email, u.AccessLevel, time.Now()
+	m.users[u.ID] = stored
+	return nil
+}
+
+// AuthenticateUser checks if the user exists and verifies the password
+func (m *MemoryRepo) AuthenticateUser(ctx context.Context, email, testPassword string) (int, string, error) {
+	if err := m.begin(ctx, "AuthenticateUser"); err != nil {
+		return 0, "", err
+	}
+	var found *models.User
+	for _, u := range m.users {
+		if u.Email == email {
+			found = &u
+			break
+		}
+	}
+	// comparing hashes is slow, so it is done without holding the lock
+	m.mu.Unlock()
+
+	if found == nil {
+		return 0, "", sql.ErrNoRows
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(found.Password), []byte(testPassword))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, "", errors.New("incorrect password")
+	} else if err != nil {
+		return 0, "", err
+	}
+	return found.ID, found.Password, nil
+}
+
+// promoCodeOf is the code redeemed on a reservation, empty if none was
+func (m *MemoryRepo) promoCodeOf(reservationID int) string {
+	for _, r := range m.redemptions {
+		if r.ReservationID == reservationID {
+			return m.promoCodes[r.PromoCodeID].Code
+		}
+	}
+	return ""
+}
+
+// listReservation is a reservation with the columns the reservation lists select
+func (m *MemoryRepo) listReservation(res models.Reservation) models.Reservation {
+	return models.Reservation{
+		ID: res.ID, FirstName: res.FirstName, LastName: res.LastName, Email: res.Email, Phone: res.Phone,
+		StartDate: res.StartDate, EndDate: res.EndDate, RoomID: res.RoomID, CreatedAt: res.CreatedAt, UpdatedAt: res.UpdatedAt,
+		Processed: res.Processed, SubtotalCents: res.SubtotalCents, DiscountCents: res.DiscountCents, TotalCents: res.TotalCents,
+		PromoCode: m.promoCodeOf(res.ID), CancelledAt: res.CancelledAt,
+		Room: models.Room{ID: res.RoomID, RoomName: m.rooms[res.RoomID].RoomName},
+	}
+}
+
+// reservationsByStart returns the reservations for which keep is true, by arrival day
+func (m *MemoryRepo) reservationsByStart(keep func(models.Reservation) bool) []models.Reservation {
+	var list []models.Reservation
+	for _, id := range sortedIDs(m.reservations) {
+		if res := m.reservations[id]; keep(res) {
+			list = append(list, res)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].StartDate.Before(list[j].StartDate) })
+	return list
+}
+
+// AllReservations returns all reservations, by arrival day
+func (m *MemoryRepo) AllReservations(ctx context.Context) ([]models.Reservation, error) {
+	if err := m.begin(ctx, "AllReservations"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	var list []models.Reservation
+	for _, res := range m.reservationsByStart(func(models.Reservation) bool { return true }) {
+		list = append(list, m.listReservation(res))
+	}
+	return list, nil
+}
+
+// AllNewReservations returns the reservations that are neither processed nor cancelled, by arrival day
+func (m *MemoryRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
+	if err := m.begin(ctx, "AllNewReservations"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	var list []models.Reservation
+	for _, res := range m.reservationsByStart(func(r models.Reservation) bool { return r.Processed == 0 && r.CancelledAt.IsZero() }) {
+		res = m.listReservation(res)
+		res.Processed, res.CancelledAt = 0, time.Time{}
+		list = append(list, res)
+	}
+	return list, nil
+}
+
+// GetReservationByID returns a reservation by its ID
+func (m *MemoryRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	if err := m.begin(ctx, "GetReservationByID"); err != nil {
+		return models.Reservation{}, err
+	}
+	defer m.mu.Unlock()
+
+	res, ok := m.reservations[id]
+	if !ok {
+		return models.Reservation{}, sql.ErrNoRows
+	}
+	res.PromoCode = m.promoCodeOf(id)
+	res.Room = models.Room{ID: res.RoomID, RoomName: m.rooms[res.RoomID].RoomName}
+	return res, nil
+}
+
+// UpdateReservation updates a reservation's contact details, moving it to the guest with the new email
+func (m *MemoryRepo) UpdateReservation(ctx context.Context, u models.Reservation, id int) error {
+	if err := m.begin(ctx, "UpdateReservation"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	guestID := m.saveGuest(u)
+	res, ok := m.reservations[id]
+	if !ok {
+		return nil
+	}
+	res.FirstName, res.LastName, res.Email, res.Phone, res.UpdatedAt = u.FirstName, u.LastName, u.Email, u.Phone, time.Now()
+	if guestID != 0 {
+		res.GuestID = guestID
+	}
+	m.reservations[id] = res
+	return nil
+}
+
+// DeleteReservation deletes a reservation with its restriction, emails, review and promo code redemption
+func (m *MemoryRepo) DeleteReservation(ctx context.Context, id int) error {
+	if err := m.begin(ctx, "DeleteReservation"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	delete(m.reservations, id)
+	for rid, r := range m.restrictions {
+		if r.ReservationID == id {
+			delete(m.restrictions, rid)
+		}
+	}
+	for key := range m.emails {
+		if key.reservationID == id {
+			delete(m.emails, key)
+		}
+	}
+	for rid, rv := range m.reviews {
+		if rv.ReservationID == id {
+			delete(m.reviews, rid)
+		}
+	}
+	for rid, r := range m.redemptions {
+		if r.ReservationID == id {
+			delete(m.redemptions, rid)
+		}
+	}
+	return nil
+}
+
+// UpdateProcessedForReservation updates the processed status of a reservation
+func (m *MemoryRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
+	if err := m.begin(ctx, "UpdateProcessedForReservation"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if res, ok := m.reservations[id]; ok {
+		res.Processed = processed
+		m.reservations[id] = res
+	}
+	return nil
+}
+
+// AllRooms returns all rooms by name
+func (m *MemoryRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	if err := m.begin(ctx, "AllRooms"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	var rooms []models.Room
+	for _, id := range sortedIDs(m.rooms) {
+		rooms = append(rooms, m.rooms[id])
+	}
+	sort.SliceStable(rooms, func(i, j int) bool { return rooms[i].RoomName < rooms[j].RoomName })
+	return rooms, nil
+}
+
+// GetRestrictionsForRoomByDate returns the restrictions on a room between start and end
+func (m *MemoryRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	if err := m.begin(ctx, "GetRestrictionsForRoomByDate"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	return m.roomRestrictions(roomID, start, end), nil
+}
+
+// InsertBlockForRoom blocks a room for the day starting at startDate
+func (m *MemoryRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
+	if err := m.begin(ctx, "InsertBlockForRoom"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	return m.insertRestriction(id, 0, 2, startDate, startDate.AddDate(0, 0, 1))
+}
+
+// DeleteBlockByID deletes a block by its ID
+func (m *MemoryRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	if err := m.begin(ctx, "DeleteBlockByID"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	delete(m.restrictions, id)
+	return nil
+}
+
+// ListUsers returns all users ordered by last name, without their passwords
+func (m *MemoryRepo) ListUsers(ctx context.Context) ([]models.User, error) {
+	if err := m.begin(ctx, "ListUsers"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	var users []models.User
+	for _, id := range sortedIDs(m.users) {
+		u := m.users[id]
+		u.Password = ""
+		users = append(users, u)
+	}
+	sort.SliceStable(users, func(i, j int) bool {
+		if users[i].LastName != users[j].LastName {
+			return users[i].LastName < users[j].LastName
+		}
+		return users[i].FirstName < users[j].FirstName
+	})
+	return users, nil
+}
+
+// GetSession returns a stored session by its hashed token, or sql.ErrNoRows
+func (m *MemoryRepo) GetSession(ctx context.Context, token string) (models.Session, error) {
+	if err := m.begin(ctx, "GetSession"); err != nil {
+		return models.Session{}, err
+	}
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[token]
+	if !ok {
+		return models.Session{}, sql.ErrNoRows
+	}
+	s.Data = append([]byte(nil), s.Data...)
+	return s, nil
+}
+
+// SaveSession inserts a session or replaces its data, keeping the time it was created
+func (m *MemoryRepo) SaveSession(ctx context.Context, s models.Session) error {
+	if err := m.begin(ctx, "SaveSession"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[s.UserID]; !ok && s.UserID != 0 {
+		return errForeignKey
+	}
+	created := time.Now()
+	if old, ok := m.sessions[s.Token]; ok {
+		created = old.CreatedAt
+	}
+	s.Data, s.UserAgent, s.CreatedAt = append([]byte(nil), s.Data...), truncateUserAgent(s.UserAgent), created
+	m.sessions[s.Token] = s
+	return nil
+}
+
+// TouchSession records activity on a session without changing its data
+func (m *MemoryRepo) TouchSession(ctx context.Context, token, ip, userAgent string, at time.Time) error {
+	if err := m.begin(ctx, "TouchSession"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if s, ok := m.sessions[token]; ok {
+		s.IPAddress, s.UserAgent, s.LastActivity = ip, truncateUserAgent(userAgent), at
+		m.sessions[token] = s
+	}
+	return nil
+}
+
+// DeleteSession removes a session; deleting one that does not exist is not an error
+func (m *MemoryRepo) DeleteSession(ctx context.Context, token string) error {
+	if err := m.begin(ctx, "DeleteSession"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	delete(m.sessions, token)
+	return nil
+}
+
+// DeleteExpiredSessions removes sessions that expired before now and returns how many were removed
+func (m *MemoryRepo) DeleteExpiredSessions(ctx context.Context, now time.Time) (int64, error) {
+	if err := m.begin(ctx, "DeleteExpiredSessions"); err != nil {
+		return 0, err
+	}
+	defer m.mu.Unlock()
+
+	var n int64
+	for token, s := range m.sessions {
+		if s.Expiry.Before(now) {
+			delete(m.sessions, token)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ActiveSessionsForUser returns a user's unexpired sessions, most recently used first
+func (m *MemoryRepo) ActiveSessionsForUser(ctx context.Context, userID int, now time.Time) ([]models.Session, error) {
+	if err := m.begin(ctx, "ActiveSessionsForUser"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	var sessions []models.Session
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.Expiry.After(now) {
+			s.Data = nil
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastActivity.After(sessions[j].LastActivity) })
+	return sessions, nil
+}
+
+// ActiveSessionCounts returns the number of unexpired sessions of each user that has any
+func (m *MemoryRepo) ActiveSessionCounts(ctx context.Context, now time.Time) (map[int]int, error) {
+	if err := m.begin(ctx, "ActiveSessionCounts"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	counts := make(map[int]int)
+	for _, s := range m.sessions {
+		if s.UserID != 0 && s.Expiry.After(now) {
+			counts[s.UserID]++
+		}
+	}
+	return counts, nil
+}
+
+// DeleteUserSession removes one of a user's sessions; sessions of other users are left alone
+func (m *MemoryRepo) DeleteUserSession(ctx context.Context, userID int, token string) error {
+	if err := m.begin(ctx, "DeleteUserSession"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	if s, ok := m.sessions[token]; ok && s.UserID == userID {
+		delete(m.sessions, token)
+	}
+	return nil
+}
+
+// DeleteUserSessions removes all sessions of a user except exceptToken, which may be empty, and returns how many were removed
+func (m *MemoryRepo) DeleteUserSessions(ctx context.Context, userID int, exceptToken string) (int64, error) {
+	if err := m.begin(ctx, "DeleteUserSessions"); err != nil {
+		return 0, err
+	}
+	defer m.mu.Unlock()
+
+	var n int64
+	for token, s := range m.sessions {
+		if s.UserID == userID && token != exceptToken {
+			delete(m.sessions, token)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ArrivalsAwaitingEmail returns the reservations starting between from and to, inclusive, that have not
+// been sent the kind of email yet
+func (m *MemoryRepo) ArrivalsAwaitingEmail(ctx context.Context, kind string, from, to time.Time) ([]models.Reservation, error) {
+	if err := m.begin(ctx, "ArrivalsAwaitingEmail"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	return m.reservationsAwaitingEmail(func(r models.Reservation) time.Time { return r.StartDate }, kind, from, to), nil
+}
+
+// DeparturesAwaitingEmail returns the reservations ending between from and to, inclusive, that have not
+// been sent the kind of email yet
+func (m *MemoryRepo) DeparturesAwaitingEmail(ctx context.Context, kind string, from, to time.Time) ([]models.Reservation, error) {
+	if err := m.begin(ctx, "DeparturesAwaitingEmail"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	return m.reservationsAwaitingEmail(func(r models.Reservation) time.Time { return r.EndDate }, kind, from, to), nil
+}
+
+// reservationsAwaitingEmail lists the reservations whose date is between from and to and which have no
+// record of the kind of email
+func (m *MemoryRepo) reservationsAwaitingEmail(date func(models.Reservation) time.Time, kind string, from, to time.Time) []models.Reservation {
+	from, to = models.Day(from), models.Day(to)
+
+	var list []models.Reservation
+	for _, id := range sortedIDs(m.reservations) {
+		res := m.reservations[id]
+		d := date(res)
+		if d.Before(from) || d.After(to) || !res.CancelledAt.IsZero() || res.Email == "" {
+			continue
+		}
+		if _, sent := m.emails[reservationEmail{id, kind}]; sent {
+			continue
+		}
+		list = append(list, models.Reservation{
+			ID: res.ID, FirstName: res.FirstName, LastName: res.LastName, Email: res.Email, Phone: res.Phone,
+			StartDate: res.StartDate, EndDate: res.EndDate, RoomID: res.RoomID, Locale: res.Locale,
+			Room: models.Room{ID: res.RoomID, RoomName: m.rooms[res.RoomID].RoomName},
+		})
+	}
+	sort.SliceStable(list, func(i, j int) bool { return date(list[i]).Before(date(list[j])) })
+	return list
+}
+
+// RecordReservationEmail claims the kind of email for a reservation before it is sent. It returns false
+// if the email was already recorded, in which case it must not be sent again.
+func (m *MemoryRepo) RecordReservationEmail(ctx context.Context, reservationID int, kind string, at time.Time) (bool, error) {
+	if err := m.begin(ctx, "RecordReservationEmail"); err != nil {
+		return false, err
+	}
+	defer m.mu.Unlock()
+
+	if _, ok := m.reservations[reservationID]; !ok {
+		return false, errForeignKey
+	}
+	key := reservationEmail{reservationID, kind}
+	if _, sent := m.emails[key]; sent {
+		return false, nil
+	}
+	m.emails[key] = at
+	return true, nil
+}
+
+// InsertReview saves a new review, which waits for moderation. A reservation can only be reviewed once.
+func (m *MemoryRepo) InsertReview(ctx context.Context, rv models.Review) (int, error) {
+	if err := m.begin(ctx, "InsertReview"); err != nil {
+		return 0, err
+	}
+	defer m.mu.Unlock()
+
+	if _, ok := m.reservations[rv.ReservationID]; !ok {
+		return 0, errForeignKey
+	}
+	if _, ok := m.rooms[rv.RoomID]; !ok {
+		return 0, errForeignKey
+	}
+	for _, other := range m.reviews {
+		if other.ReservationID == rv.ReservationID {
+			return 0, errUnique
+		}
+	}
+
+	stored := models.Review{ID: m.id("reviews"), ReservationID: rv.ReservationID, RoomID: rv.RoomID, Rating: rv.Rating,
+		Body: rv.Body, Status: models.ReviewPending, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	m.reviews[stored.ID] = stored
+	return stored.ID, nil
+}
+
+// joinReview is a review with its room and the guest's reservation
+func (m *MemoryRepo) joinReview(rv models.Review) models.Review {
+	res := m.reservations[rv.ReservationID]
+	rv.Room = models.Room{ID: rv.RoomID, RoomName: m.rooms[rv.RoomID].RoomName}
+	rv.Reservation = models.Reservation{ID: res.ID, FirstName: res.FirstName, LastName: res.LastName, Email: res.Email,
+		StartDate: res.StartDate, EndDate: res.EndDate}
+	return rv
+}
+
+// reviewsNewestFirst returns the reviews for which keep is true, newest first
+func (m *MemoryRepo) reviewsNewestFirst(keep func(models.Review) bool) []models.Review {
+	var list []models.Review
+	for _, id := range sortedIDs(m.reviews) {
+		if rv := m.reviews[id]; keep(rv) {
+			list = append(list, m.joinReview(rv))
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.After(list[j].CreatedAt)
+		}
+		return list[i].ID > list[j].ID
+	})
+	return list
+}
+
+// GetReviewByID returns a review with its room and reservation
+func (m *MemoryRepo) GetReviewByID(ctx context.Context, id int) (models.Review, error) {
+	if err := m.begin(ctx, "GetReviewByID"); err != nil {
+		return models.Review{}, err
+	}
+	defer m.mu.Unlock()
+
+	rv, ok := m.reviews[id]
+	if !ok {
+		return models.Review{}, sql.ErrNoRows
+	}
+	return m.joinReview(rv), nil
+}
+
+// GetReviewByReservationID returns the review of a reservation, or sql.ErrNoRows if the guest has not
+// written one
+func (m *MemoryRepo) GetReviewByReservationID(ctx context.Context, reservationID int) (models.Review, error) {
+	if err := m.begin(ctx, "GetReviewByReservationID"); err != nil {
+		return models.Review{}, err
+	}
+	defer m.mu.Unlock()
+
+	for _, rv := range m.reviews {
+		if rv.ReservationID == reservationID {
+			return m.joinReview(rv), nil
+		}
+	}
+	return models.Review{}, sql.ErrNoRows
+}
+
+// AllReviews returns the reviews with status, or all reviews if status is empty, newest first
+func (m *MemoryRepo) AllReviews(ctx context.Context, status string) ([]models.Review, error) {
+	if err := m.begin(ctx, "AllReviews"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	return m.reviewsNewestFirst(func(rv models.Review) bool { return status == "" || rv.Status == status }), nil
+}
+
+// UpdateReviewStatus approves or hides a review on behalf of userID
+func (m *MemoryRepo) UpdateReviewStatus(ctx context.Context, id int, status string, userID int) error {
+	if err := m.begin(ctx, "UpdateReviewStatus"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	rv, ok := m.reviews[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	rv.Status, rv.ModeratedBy, rv.UpdatedAt = status, userID, time.Now()
+	m.reviews[id] = rv
+	return nil
+}
+
+// ReplyToReview sets the hotel's public reply to a review, an empty reply removes it
+func (m *MemoryRepo) ReplyToReview(ctx context.Context, id int, reply string, userID int, at time.Time) error {
+	if err := m.begin(ctx, "ReplyToReview"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	rv, ok := m.reviews[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	rv.Reply, rv.RepliedAt, rv.ModeratedBy, rv.UpdatedAt = reply, time.Time{}, userID, time.Now()
+	if reply != "" {
+		rv.RepliedAt = at
+	}
+	m.reviews[id] = rv
+	return nil
+}
+
+// ApprovedReviewsForRoom returns the reviews shown on a room's page, newest first
+func (m *MemoryRepo) ApprovedReviewsForRoom(ctx context.Context, roomID int) ([]models.Review, error) {
+	if err := m.begin(ctx, "ApprovedReviewsForRoom"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	return m.reviewsNewestFirst(func(rv models.Review) bool { return rv.RoomID == roomID && rv.Status == models.ReviewApproved }), nil
+}
+
+// RoomRating returns the average rating and number of approved reviews of a room
+func (m *MemoryRepo) RoomRating(ctx context.Context, roomID int) (float64, int, error) {
+	if err := m.begin(ctx, "RoomRating"); err != nil {
+		return 0, 0, err
+	}
+	defer m.mu.Unlock()
+
+	sum, count := 0, 0
+	for _, rv := range m.reviews {
+		if rv.RoomID == roomID && rv.Status == models.ReviewApproved {
+			sum += rv.Rating
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, 0, nil
+	}
+	return float64(sum) / float64(count), count, nil
+}
+
+// withUsage is a promo code with its redemptions counted, as promoCodeQuery selects it
+func (m *MemoryRepo) withUsage(p models.PromoCode) models.PromoCode {
+	p.Uses, p.DiscountCents = 0, 0
+	for _, r := range m.redemptions {
+		if r.PromoCodeID == p.ID {
+			p.Uses++
+			p.DiscountCents += r.DiscountCents
+		}
+	}
+	p.RoomIDs = append([]int(nil), p.RoomIDs...)
+	return p
+}
+
+// GetPromoCodeByCode returns the promo code with code, in any case, or sql.ErrNoRows if there is none
+func (m *MemoryRepo) GetPromoCodeByCode(ctx context.Context, code string) (models.PromoCode, error) {
+	if err := m.begin(ctx, "GetPromoCodeByCode"); err != nil {
+		return models.PromoCode{}, err
+	}
+	defer m.mu.Unlock()
+
+	code = promo.NormalizeCode(code)
+	for _, p := range m.promoCodes {
+		if p.Code == code {
+			return m.withUsage(p), nil
+		}
+	}
+	return models.PromoCode{}, sql.ErrNoRows
+}
+
+// AllPromoCodes returns all promo codes with their usage, active ones first, newest first
+func (m *MemoryRepo) AllPromoCodes(ctx context.Context) ([]models.PromoCode, error) {
+	if err := m.begin(ctx, "AllPromoCodes"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	var codes []models.PromoCode
+	for _, id := range sortedIDs(m.promoCodes) {
+		codes = append(codes, m.withUsage(m.promoCodes[id]))
+	}
+	sort.SliceStable(codes, func(i, j int) bool {
+		a, b := codes[i], codes[j]
+		switch {
+		case a.Active != b.Active:
+			return a.Active
+		case !a.CreatedAt.Equal(b.CreatedAt):
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+	return codes, nil
+}
+
+// dayOrZero is day for a date that may be left open
+func dayOrZero(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return models.Day(t)
+}
+
+// InsertPromoCode inserts a promo code with its room restrictions and returns its id
+func (m *MemoryRepo) InsertPromoCode(ctx context.Context, p models.PromoCode) (int, error) {
+	if err := m.begin(ctx, "InsertPromoCode"); err != nil {
+		return 0, err
+	}
+	defer m.mu.Unlock()
+
+	p.Code = promo.NormalizeCode(p.Code)
+	for _, other := range m.promoCodes {
+		if other.Code == p.Code {
+			return 0, errUnique
+		}
+	}
+	rooms := make(map[int]bool)
+	for _, id := range p.RoomIDs {
+		if _, ok := m.rooms[id]; !ok {
+			return 0, errForeignKey
+		}
+		if rooms[id] {
+			return 0, errUnique
+		}
+		rooms[id] = true
+	}
+
+	p.ID, p.Uses, p.DiscountCents = m.id("promo_codes"), 0, 0
+	p.BookingStart, p.BookingEnd = dayOrZero(p.BookingStart), dayOrZero(p.BookingEnd)
+	p.StayStart, p.StayEnd = dayOrZero(p.StayStart), dayOrZero(p.StayEnd)
+	p.RoomIDs = append([]int(nil), p.RoomIDs...)
+	sort.Ints(p.RoomIDs)
+	if len(p.RoomIDs) == 0 {
+		p.RoomIDs = nil
+	}
+	p.CreatedAt, p.UpdatedAt = time.Now(), time.Now()
+	m.promoCodes[p.ID] = p
+	return p.ID, nil
+}
+
+// SetPromoCodeActive enables or disables a promo code
+func (m *MemoryRepo) SetPromoCodeActive(ctx context.Context, id int, active bool) error {
+	if err := m.begin(ctx, "SetPromoCodeActive"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	p, ok := m.promoCodes[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	p.Active, p.UpdatedAt = active, time.Now()
+	m.promoCodes[id] = p
+	return nil
+}
+
+// promoCodeUses counts the redemptions of a promo code, in total and by the email address
+func (m *MemoryRepo) promoCodeUses(promoCodeID int, email string) (int, int) {
+	email = promo.NormalizeEmail(email)
+	total, byEmail := 0, 0
+	for _, r := range m.redemptions {
+		if r.PromoCodeID == promoCodeID {
+			total++
+			if r.Email == email {
+				byEmail++
+			}
+		}
+	}
+	return total, byEmail
+}
+
+// PromoCodeUses returns how often a promo code was redeemed, in total and by the email address
+func (m *MemoryRepo) PromoCodeUses(ctx context.Context, promoCodeID int, email string) (int, int, error) {
+	if err := m.begin(ctx, "PromoCodeUses"); err != nil {
+		return 0, 0, err
+	}
+	defer m.mu.Unlock()
+
+	total, byEmail := m.promoCodeUses(promoCodeID, email)
+	return total, byEmail, nil
+}
+
+// RedeemPromoCode records a promo code against a reservation and takes the discount off its total. It
+// returns false without changing anything if the code has meanwhile reached one of its usage limits.
+func (m *MemoryRepo) RedeemPromoCode(ctx context.Context, r models.PromoRedemption) (bool, error) {
+	if err := m.begin(ctx, "RedeemPromoCode"); err != nil {
+		return false, err
+	}
+	defer m.mu.Unlock()
+
+	p, ok := m.promoCodes[r.PromoCodeID]
+	if !ok {
+		return false, sql.ErrNoRows
+	}
+	uses, usesByEmail := m.promoCodeUses(p.ID, r.Email)
+	if !usageAllows(p.MaxUses, p.MaxUsesPerEmail, uses, usesByEmail) {
+		return false, nil
+	}
+
+	res, ok := m.reservations[r.ReservationID]
+	if !ok {
+		return false, errForeignKey
+	}
+	for _, other := range m.redemptions {
+		if other.ReservationID == r.ReservationID {
+			return false, errUnique
+		}
+	}
+
+	r.ID, r.Email, r.CreatedAt = m.id("promo_redemptions"), promo.NormalizeEmail(r.Email), time.Now()
+	m.redemptions[r.ID] = r
+	res.DiscountCents, res.TotalCents, res.UpdatedAt = r.DiscountCents, res.SubtotalCents-r.DiscountCents, time.Now()
+	m.reservations[res.ID] = res
+	return true, nil
+}
+
+// copyPolicy is a policy whose tiers the caller may change
+func copyPolicy(p models.CancellationPolicy) models.CancellationPolicy {
+	p.Tiers = append([]models.CancellationTier(nil), p.Tiers...)
+	return p
+}
+
+// GetCancellationPolicyByID returns a cancellation policy with its tiers, or sql.ErrNoRows
+func (m *MemoryRepo) GetCancellationPolicyByID(ctx context.Context, id int) (models.CancellationPolicy, error) {
+	if err := m.begin(ctx, "GetCancellationPolicyByID"); err != nil {
+		return models.CancellationPolicy{}, err
+	}
+	defer m.mu.Unlock()
+
+	p, ok := m.policies[id]
+	if !ok {
+		return models.CancellationPolicy{}, sql.ErrNoRows
+	}
+	return copyPolicy(p), nil
+}
+
+// AllCancellationPolicies returns all cancellation policies with their tiers, by name
+func (m *MemoryRepo) AllCancellationPolicies(ctx context.Context) ([]models.CancellationPolicy, error) {
+	if err := m.begin(ctx, "AllCancellationPolicies"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	var policies []models.CancellationPolicy
+	for _, id := range sortedIDs(m.policies) {
+		policies = append(policies, copyPolicy(m.policies[id]))
+	}
+	sort.SliceStable(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+	return policies, nil
+}
+
+// InsertCancellationPolicy inserts a cancellation policy with its tiers and returns its id
+func (m *MemoryRepo) InsertCancellationPolicy(ctx context.Context, p models.CancellationPolicy) (int, error) {
+	if err := m.begin(ctx, "InsertCancellationPolicy"); err != nil {
+		return 0, err
+	}
+	defer m.mu.Unlock()
+
+	days := make(map[int]bool)
+	for _, t := range p.Tiers {
+		if days[t.DaysBefore] {
+			return 0, errUnique
+		}
+		days[t.DaysBefore] = true
+	}
+
+	p = copyPolicy(p)
+	sort.SliceStable(p.Tiers, func(i, j int) bool { return p.Tiers[i].DaysBefore > p.Tiers[j].DaysBefore })
+	if len(p.Tiers) == 0 {
+		p.Tiers = nil
+	}
+	p.ID, p.CreatedAt, p.UpdatedAt = m.id("policies"), time.Now(), time.Now()
+	m.policies[p.ID] = p
+	return p.ID, nil
+}
+
+// SetRoomCancellationPolicy sets the policy new reservations of a room are booked under
+func (m *MemoryRepo) SetRoomCancellationPolicy(ctx context.Context, roomID, policyID int) error {
+	if err := m.begin(ctx, "SetRoomCancellationPolicy"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	room, ok := m.rooms[roomID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if _, ok := m.policies[policyID]; !ok {
+		return errForeignKey
+	}
+	room.CancellationPolicyID, room.UpdatedAt = policyID, time.Now()
+	m.rooms[roomID] = room
+	return nil
+}
+
+// CancelReservation records the cancellation of a reservation with what the guest was charged and refunded,
+// and frees its room. It returns sql.ErrNoRows if there is no such reservation or it was already cancelled.
+func (m *MemoryRepo) CancelReservation(ctx context.Context, id int, at time.Time, penaltyCents, refundCents int) error {
+	if err := m.begin(ctx, "CancelReservation"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	res, ok := m.reservations[id]
+	if !ok || !res.CancelledAt.IsZero() {
+		return sql.ErrNoRows
+	}
+	res.CancelledAt, res.PenaltyCents, res.RefundCents, res.UpdatedAt = at, penaltyCents, refundCents, time.Now()
+	m.reservations[id] = res
+
+	for rid, r := range m.restrictions {
+		if r.ReservationID == id {
+			delete(m.restrictions, rid)
+		}
+	}
+	return nil
+}
+
+// withStays is a guest with their stays counted, as guestQuery selects them
+func (m *MemoryRepo) withStays(g models.Guest) models.Guest {
+	g.Stays, g.LastStay = 0, time.Time{}
+	for _, res := range m.reservations {
+		if res.GuestID == g.ID && res.CancelledAt.IsZero() {
+			g.Stays++
+			if res.StartDate.After(g.LastStay) {
+				g.LastStay = res.StartDate
+			}
+		}
+	}
+	return g
+}
+
+// AllGuests returns the guests whose email or name contains search, all of them if it is empty, by name
+func (m *MemoryRepo) AllGuests(ctx context.Context, search string) ([]models.Guest, error) {
+	if err := m.begin(ctx, "AllGuests"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	search = strings.ToLower(strings.TrimSpace(search))
+	var list []models.Guest
+	for _, id := range sortedIDs(m.guests) {
+		g := m.guests[id]
+		if strings.Contains(g.Email, search) || strings.Contains(strings.ToLower(g.FirstName+" "+g.LastName), search) {
+			list = append(list, m.withStays(g))
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].LastName != list[j].LastName {
+			return list[i].LastName < list[j].LastName
+		}
+		return list[i].FirstName < list[j].FirstName
+	})
+	return list, nil
+}
+
+// GetGuestByID returns a guest, or sql.ErrNoRows if there is none
+func (m *MemoryRepo) GetGuestByID(ctx context.Context, id int) (models.Guest, error) {
+	if err := m.begin(ctx, "GetGuestByID"); err != nil {
+		return models.Guest{}, err
+	}
+	defer m.mu.Unlock()
+
+	g, ok := m.guests[id]
+	if !ok {
+		return models.Guest{}, sql.ErrNoRows
+	}
+	return m.withStays(g), nil
+}
+
+// ReservationsForGuest returns the reservations of a guest, including cancelled ones, latest arrival first
+func (m *MemoryRepo) ReservationsForGuest(ctx context.Context, guestID int) ([]models.Reservation, error) {
+	if err := m.begin(ctx, "ReservationsForGuest"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	var list []models.Reservation
+	for _, id := range sortedIDs(m.reservations) {
+		res := m.reservations[id]
+		if res.GuestID != guestID {
+			continue
+		}
+		list = append(list, models.Reservation{
+			ID: res.ID, FirstName: res.FirstName, LastName: res.LastName, Email: res.Email, Phone: res.Phone,
+			StartDate: res.StartDate, EndDate: res.EndDate, RoomID: res.RoomID, Locale: res.Locale,
+			SubtotalCents: res.SubtotalCents, DiscountCents: res.DiscountCents, TotalCents: res.TotalCents,
+			PromoCode: m.promoCodeOf(res.ID), CancelledAt: res.CancelledAt, PenaltyCents: res.PenaltyCents,
+			RefundCents: res.RefundCents, GuestID: res.GuestID, CreatedAt: res.CreatedAt,
+			Room: models.Room{ID: res.RoomID, RoomName: m.rooms[res.RoomID].RoomName},
+		})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if !list[i].StartDate.Equal(list[j].StartDate) {
+			return list[i].StartDate.After(list[j].StartDate)
+		}
+		return list[i].ID > list[j].ID
+	})
+	return list, nil
+}
+
+// UpdateGuestNotes replaces staff's notes on a guest. It returns sql.ErrNoRows if there is no such guest.
+func (m *MemoryRepo) UpdateGuestNotes(ctx context.Context, id int, notes string) error {
+	if err := m.begin(ctx, "UpdateGuestNotes"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	g, ok := m.guests[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	g.Notes, g.UpdatedAt = notes, time.Now()
+	m.guests[id] = g
+	return nil
+}
+
+// AnonymizeGuest erases the personal data of a guest from their profile, their reservations, the promo
+// codes they redeemed and the webhook deliveries about their reservations. It returns sql.ErrNoRows if there is no such guest or they were already anonymized.
+func (m *MemoryRepo) AnonymizeGuest(ctx context.Context, id int, at time.Time) error {
+	if err := m.begin(ctx, "AnonymizeGuest"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	g, ok := m.guests[id]
+	if !ok || !g.AnonymizedAt.IsZero() {
+		return sql.ErrNoRows
+	}
+
+	reservations := make(map[int]bool)
+	for rid, res := range m.reservations {
+		if res.GuestID == id {
+			reservations[rid] = true
+		}
+	}
+	// payloads are rewritten before anything is stored, so a broken one leaves the guest untouched as a
+	// rolled back transaction would
+	redacted := make(map[int]string)
+	for did, d := range m.deliveries {
+		if !strings.HasPrefix(d.Event, "reservation.") {
+			continue
+		}
+		payload, changed, err := redactWebhookPayload(d.Payload, reservations)
+		if err != nil {
+			return err
+		}
+		if changed {
+			redacted[did] = payload
+		}
+	}
+
+	g.Email, g.FirstName, g.LastName, g.Phone, g.Notes = guests.AnonymizedEmail(id), guests.AnonymizedFirstName, guests.AnonymizedLastName, "", ""
+	g.AnonymizedAt, g.UpdatedAt = at, time.Now()
+	m.guests[id] = g
+
+	for rid := range reservations {
+		res := m.reservations[rid]
+		res.FirstName, res.LastName, res.Email, res.Phone, res.UpdatedAt = guests.AnonymizedFirstName, guests.AnonymizedLastName, "", "", time.Now()
+		m.reservations[rid] = res
+		for pid, r := range m.redemptions {
+			if r.ReservationID == rid {
+				r.Email = ""
+				m.redemptions[pid] = r
+			}
+		}
+	}
+	for did, payload := range redacted {
+		d := m.deliveries[did]
+		d.Payload, d.UpdatedAt = payload, time.Now()
+		m.deliveries[did] = d
+	}
+	return nil
+}
+
+// NotificationPreferences returns the notification preferences of the guest with the email, by kind and
+// channel. There are none if the guest has not chosen any, or if there is no such guest.
+func (m *MemoryRepo) NotificationPreferences(ctx context.Context, email string) ([]models.NotificationPreference, error) {
+	if err := m.begin(ctx, "NotificationPreferences"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	email = guests.NormalizeEmail(email)
+	for id, g := range m.guests {
+		if g.Email == email {
+			return append([]models.NotificationPreference(nil), m.preferences[id]...), nil
+		}
+	}
+	return nil, nil
+}
+
+// SetNotificationPreferences replaces the notification preferences of a guest. It returns sql.ErrNoRows if
+// there is no such guest.
+func (m *MemoryRepo) SetNotificationPreferences(ctx context.Context, guestID int, prefs []models.NotificationPreference) error {
+	if err := m.begin(ctx, "SetNotificationPreferences"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	g, ok := m.guests[guestID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	list := append([]models.NotificationPreference(nil), prefs...)
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Kind != list[j].Kind {
+			return list[i].Kind < list[j].Kind
+		}
+		return list[i].Channel < list[j].Channel
+	})
+	for i := 1; i < len(list); i++ {
+		if list[i].Kind == list[i-1].Kind && list[i].Channel == list[i-1].Channel {
+			return errUnique
+		}
+	}
+
+	if len(list) == 0 {
+		delete(m.preferences, guestID)
+	} else {
+		m.preferences[guestID] = list
+	}
+	g.UpdatedAt = time.Now()
+	m.guests[guestID] = g
+	return nil
+}
+
+// copyEndpoint is an endpoint whose events the caller may change
+func copyEndpoint(e models.WebhookEndpoint) models.WebhookEndpoint {
+	e.Events = append([]string(nil), e.Events...)
+	return e
+}
+
+// AllWebhookEndpoints returns the webhook endpoints, active ones first, newest first
+func (m *MemoryRepo) AllWebhookEndpoints(ctx context.Context) ([]models.WebhookEndpoint, error) {
+	if err := m.begin(ctx, "AllWebhookEndpoints"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	var list []models.WebhookEndpoint
+	for _, id := range sortedIDs(m.endpoints) {
+		list = append(list, copyEndpoint(m.endpoints[id]))
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		switch {
+		case a.Active != b.Active:
+			return a.Active
+		case !a.CreatedAt.Equal(b.CreatedAt):
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+	return list, nil
+}
+
+// InsertWebhookEndpoint inserts a webhook endpoint and returns its id
+func (m *MemoryRepo) InsertWebhookEndpoint(ctx context.Context, e models.WebhookEndpoint) (int, error) {
+	if err := m.begin(ctx, "InsertWebhookEndpoint"); err != nil {
+		return 0, err
+	}
+	defer m.mu.Unlock()
+
+	e = copyEndpoint(e)
+	if len(e.Events) == 0 {
+		e.Events = nil
+	}
+	e.ID, e.CreatedAt, e.UpdatedAt = m.id("webhook_endpoints"), time.Now(), time.Now()
+	m.endpoints[e.ID] = e
+	return e.ID, nil
+}
+
+// SetWebhookEndpointActive enables or disables a webhook endpoint
+func (m *MemoryRepo) SetWebhookEndpointActive(ctx context.Context, id int, active bool) error {
+	if err := m.begin(ctx, "SetWebhookEndpointActive"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	e, ok := m.endpoints[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	e.Active, e.UpdatedAt = active, time.Now()
+	m.endpoints[id] = e
+	return nil
+}
+
+// QueueWebhookDeliveries queues payload for every active endpoint subscribed to event, due at, and returns
+// how many deliveries were queued
+func (m *MemoryRepo) QueueWebhookDeliveries(ctx context.Context, event, payload string, at time.Time) (int, error) {
+	if err := m.begin(ctx, "QueueWebhookDeliveries"); err != nil {
+		return 0, err
+	}
+	defer m.mu.Unlock()
+
+	n := 0
+	for _, id := range sortedIDs(m.endpoints) {
+		e := m.endpoints[id]
+		if !e.Active || !strings.Contains(","+joinWebhookEvents(e.Events)+",", ","+event+",") {
+			continue
+		}
+		d := models.WebhookDelivery{ID: m.id("webhook_deliveries"), EndpointID: id, Event: event, Payload: payload,
+			Status: models.WebhookPending, NextAttemptAt: at, CreatedAt: at, UpdatedAt: at}
+		m.deliveries[d.ID] = d
+		n++
+	}
+	return n, nil
+}
+
+// joinDelivery is a delivery with its endpoint, as webhookDeliveryQuery selects it
+func (m *MemoryRepo) joinDelivery(d models.WebhookDelivery) models.WebhookDelivery {
+	e := m.endpoints[d.EndpointID]
+	d.Endpoint = models.WebhookEndpoint{ID: e.ID, URL: e.URL, Secret: e.Secret, Active: e.Active}
+	return d
+}
+
+// DueWebhookDeliveries returns up to limit pending deliveries whose next attempt is due at now, oldest first.
+// Deliveries to disabled endpoints wait until the endpoint is enabled again.
+func (m *MemoryRepo) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	if err := m.begin(ctx, "DueWebhookDeliveries"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	var list []models.WebhookDelivery
+	for _, id := range sortedIDs(m.deliveries) {
+		d := m.deliveries[id]
+		if d.Status == models.WebhookPending && !d.NextAttemptAt.After(now) && m.endpoints[d.EndpointID].Active {
+			list = append(list, m.joinDelivery(d))
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].NextAttemptAt.Before(list[j].NextAttemptAt) })
+	return firstN(list, limit), nil
+}
+
+// firstN applies a LIMIT
+func firstN[T any](list []T, limit int) []T {
+	if limit >= 0 && len(list) > limit {
+		return list[:limit]
+	}
+	return list
+}
+
+// ClaimWebhookDelivery counts an attempt of a pending delivery that has been tried attempts times so far
+// and holds it until the given time. It returns sql.ErrNoRows if it was claimed first.
+func (m *MemoryRepo) ClaimWebhookDelivery(ctx context.Context, id, attempts int, until time.Time) error {
+	if err := m.begin(ctx, "ClaimWebhookDelivery"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	d, ok := m.deliveries[id]
+	if !ok || d.Status != models.WebhookPending || d.Attempts != attempts {
+		return sql.ErrNoRows
+	}
+	d.Attempts, d.NextAttemptAt, d.UpdatedAt = d.Attempts+1, until, time.Now()
+	m.deliveries[id] = d
+	return nil
+}
+
+// SaveWebhookAttempt stores the outcome of an attempt: the delivery's status, next attempt and the response
+func (m *MemoryRepo) SaveWebhookAttempt(ctx context.Context, d models.WebhookDelivery) error {
+	if err := m.begin(ctx, "SaveWebhookAttempt"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	stored, ok := m.deliveries[d.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	stored.Status, stored.NextAttemptAt, stored.LastStatusCode, stored.LastError = d.Status, d.NextAttemptAt, d.LastStatusCode, d.LastError
+	stored.DeliveredAt, stored.UpdatedAt = d.DeliveredAt, time.Now()
+	m.deliveries[d.ID] = stored
+	return nil
+}
+
+// WebhookDeliveries returns the latest limit deliveries with the status, or of any status if it is empty
+func (m *MemoryRepo) WebhookDeliveries(ctx context.Context, status string, limit int) ([]models.WebhookDelivery, error) {
+	if err := m.begin(ctx, "WebhookDeliveries"); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+
+	var list []models.WebhookDelivery
+	for _, id := range sortedIDs(m.deliveries) {
+		if d := m.deliveries[id]; status == "" || d.Status == status {
+			list = append(list, m.joinDelivery(d))
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.After(list[j].CreatedAt)
+		}
+		return list[i].ID > list[j].ID
+	})
+	return firstN(list, limit), nil
+}
+
+// RedeliverWebhook sends a delivery again from its first attempt, due at the given time
+func (m *MemoryRepo) RedeliverWebhook(ctx context.Context, id int, at time.Time) error {
+	if err := m.begin(ctx, "RedeliverWebhook"); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+
+	d, ok := m.deliveries[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	d.Status, d.Attempts, d.NextAttemptAt, d.UpdatedAt = models.WebhookPending, 0, at, time.Now()
+	m.deliveries[id] = d
+	return nil
+}
@@ -0,0 +1,95 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+func TestMemoryRepo_FailOn(t *testing.T) {
+	repo := NewMemoryRepo(&config.AppConfig{})
+	ctx := context.Background()
+	errDown := errors.New("database is down")
+
+	repo.FailOn("AllRooms", errDown)
+	if _, err := repo.AllRooms(ctx); !errors.Is(err, errDown) {
+		t.Errorf("expected the injected error, got %v", err)
+	}
+	if _, err := repo.GetRoomByID(ctx, 1); err != nil {
+		t.Errorf("expected other methods to work, got %v", err)
+	}
+
+	repo.FailOn("AllRooms", nil)
+	if rooms, err := repo.AllRooms(ctx); err != nil || len(rooms) != 2 {
+		t.Errorf("expected the rooms once the error is cleared, got %d and %v", len(rooms), err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a method DatabaseRepo does not have to panic")
+		}
+	}()
+	repo.FailOn("AllRoom", errDown)
+}
+
+func TestMemoryRepo_Concurrent(t *testing.T) {
+	repo := NewMemoryRepo(&config.AppConfig{})
+	ctx := context.Background()
+	start := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			day := start.AddDate(0, 0, i)
+			id, err := repo.InsertReservation(ctx, models.Reservation{FirstName: "Guest", Email: "guest@example.com",
+				StartDate: day, EndDate: day.AddDate(0, 0, 1), RoomID: 1 + i%2})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := repo.InsertRoomRestriction(ctx, models.RoomRestriction{StartDate: day, EndDate: day.AddDate(0, 0, 1),
+				RoomID: 1 + i%2, ReservationID: id, RestrictionID: 1}); err != nil {
+				t.Error(err)
+			}
+			repo.SearchAvailabilityForAllRooms(ctx, day, day.AddDate(0, 0, 1))
+		}(i)
+	}
+	wg.Wait()
+
+	all, err := repo.AllReservations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[int]bool)
+	for _, res := range all {
+		ids[res.ID] = true
+	}
+	if len(all) != 50 || len(ids) != 50 {
+		t.Errorf("expected 50 reservations with distinct ids, got %d with %d ids", len(all), len(ids))
+	}
+	if list, _ := repo.AllGuests(ctx, ""); len(list) != 1 || list[0].Stays != 50 {
+		t.Errorf("expected one guest with 50 stays, got %+v", list)
+	}
+}
+
+func TestMemoryRepo_ReturnsCopies(t *testing.T) {
+	repo := NewMemoryRepo(&config.AppConfig{})
+	ctx := context.Background()
+
+	policy, err := repo.GetCancellationPolicyByID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy.Tiers[0].PenaltyPercent = 100
+
+	if again, _ := repo.GetCancellationPolicyByID(ctx, 1); again.Tiers[0].PenaltyPercent != 0 {
+		t.Error("expected changing a returned policy not to change the stored one")
+	}
+}
@@ -2,37 +2,80 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/ashparshp/bookings/internal/guests"
 	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/promo"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func (m *postgresDBRepo) AllUsers() bool {
+func (m *postgresDBRepo) AllUsers(ctx context.Context) bool {
 	return true
 }
 
-// InsertReservation inserts a reservation into the database
-func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// InsertReservation inserts a reservation into the database, linked to the guest it was made for
+func (m *postgresDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	guestID, err := m.saveGuest(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
+
 	var newID int
-	stmt := `INSERT INTO reservations (first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+	stmt := `INSERT INTO reservations (first_name, last_name, email, phone, start_date, end_date, room_id, locale,
+		subtotal_cents, discount_cents, total_cents, cancellation_policy_id, guest_id, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) returning id`
 
-	err := m.DB.QueryRowContext(ctx, stmt, res.FirstName, res.LastName, res.Email, res.Phone, res.StartDate, res.EndDate, res.RoomID, time.Now(), time.Now()).Scan(&newID)
+	err = tx.QueryRowContext(ctx, stmt, res.FirstName, res.LastName, res.Email, res.Phone, res.StartDate, res.EndDate, res.RoomID, reservationLocale(res),
+		res.SubtotalCents, res.DiscountCents, res.TotalCents, nullID(res.CancellationPolicyID), guestID, time.Now(), time.Now()).Scan(&newID)
 	if err != nil {
 		return 0, err
 	}
 
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
 	return newID, nil
 }
 
+// saveGuest creates the guest a reservation is for, or updates them with the details they booked with this
+// time, and returns their id. A reservation without an email, such as an anonymized one, has no guest.
+func (m *postgresDBRepo) saveGuest(ctx context.Context, tx *sql.Tx, res models.Reservation) (any, error) {
+	email := guests.NormalizeEmail(res.Email)
+	if email == "" {
+		return nil, nil
+	}
+
+	var id int
+	stmt := `INSERT INTO guests (email, first_name, last_name, phone, notes, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, '', $5, $5)
+	ON CONFLICT (email) DO UPDATE SET first_name = EXCLUDED.first_name, last_name = EXCLUDED.last_name,
+		phone = EXCLUDED.phone, updated_at = EXCLUDED.updated_at
+	RETURNING id`
+
+	err := tx.QueryRowContext(ctx, stmt, email, res.FirstName, res.LastName, res.Phone, time.Now()).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
 // InsertRoomRestriction inserts a room restriction into the database
-func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
 	stmt := `INSERT INTO room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
@@ -47,8 +90,8 @@ func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
 }
 
 // SearchAvailabilityByDatesByRoomID returns true if there are available rooms for the given dates
-func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
 	query := `select count(id) from room_restrictions where room_id = $1 and $2 < end_date and $3 > start_date`
@@ -66,8 +109,8 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time,
 }
 
 // SearchAvailabilityForAllRooms returns a slice of available rooms for the given dates
-func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
 	var rooms []models.Room
@@ -98,15 +141,32 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 	return rooms, nil
 }
 
+// RoomOccupancy returns every room with the restrictions on it between start and end, in one query
+func (m *postgresDBRepo) RoomOccupancy(ctx context.Context, start, end time.Time) ([]models.RoomOccupancy, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `SELECT r.id, r.room_name, rr.id, rr.start_date, rr.end_date, rr.reservation_id, rr.restriction_id
+		FROM rooms r
+		LEFT JOIN room_restrictions rr ON rr.room_id = r.id AND rr.start_date < $2 AND rr.end_date > $1
+		ORDER BY r.id, rr.start_date`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return scanRoomOccupancy(rows)
+}
+
 // GetRoomByID returns a room by its ID
-func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
 	var room models.Room
-	query := `select id, room_name, created_at, updated_at from rooms where id = $1`
+	query := `select id, room_name, price_cents, COALESCE(cancellation_policy_id, 0), created_at, updated_at from rooms where id = $1`
 	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(&room.ID, &room.RoomName, &room.CreatedAt, &room.UpdatedAt)
+	err := row.Scan(&room.ID, &room.RoomName, &room.PriceCents, &room.CancellationPolicyID, &room.CreatedAt, &room.UpdatedAt)
 	if err != nil {
 		return room, err
 	}
@@ -115,8 +175,8 @@ func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
 }
 
 // GetUserByID returns a user by its ID
-func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
 	var user models.User
@@ -132,13 +192,13 @@ func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
 }
 
 // UpdateUser updates a user in the database
-func (m *postgresDBRepo) UpdateUser(u models.User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
-	stmt := `UPDATE users SET first_name = $1, last_name = $2, email = $3, access_level = $4, updated_at = $5`
+	stmt := `UPDATE users SET first_name = $1, last_name = $2, email = $3, access_level = $4, updated_at = $5 WHERE id = $6`
 
-	_, err := m.DB.ExecContext(ctx, stmt, u.FirstName, u.LastName, u.Email, u.AccessLevel, time.Now())
+	_, err := m.DB.ExecContext(ctx, stmt, u.FirstName, u.LastName, u.Email, u.AccessLevel, time.Now(), u.ID)
 	if err != nil {
 		return err
 	}
@@ -147,8 +207,8 @@ func (m *postgresDBRepo) UpdateUser(u models.User) error {
 }
 
 // AuthenticateUser checks if the user exists and verifies the password
-func (m *postgresDBRepo) AuthenticateUser(email, testPassword string) (int, string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) AuthenticateUser(ctx context.Context, email, testPassword string) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
 	var id int
@@ -172,8 +232,8 @@ func (m *postgresDBRepo) AuthenticateUser(email, testPassword string) (int, stri
 }
 
 // AllReservations returns all reservations from the database
-func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) AllReservations(ctx context.Context) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
 	var reservations []models.Reservation
@@ -183,9 +243,12 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 			r.id, r.first_name, r.last_name, r.email, r.phone, 
 			r.start_date, r.end_date, r.room_id, 
 			r.created_at, r.updated_at, r.processed,
+			r.subtotal_cents, r.discount_cents, r.total_cents, COALESCE(pc.code, ''), r.cancelled_at,
 			rm.id, rm.room_name
 		FROM reservations r
 		LEFT JOIN rooms rm ON r.room_id = rm.id
+		LEFT JOIN promo_redemptions pr ON pr.reservation_id = r.id
+		LEFT JOIN promo_codes pc ON pc.id = pr.promo_code_id
 		ORDER BY r.start_date ASC
 	`
 
@@ -197,6 +260,7 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 
 	for rows.Next() {
 		var res models.Reservation
+		var cancelledAt sql.NullTime
 		err := rows.Scan(
 			&res.ID,
 			&res.FirstName,
@@ -209,12 +273,18 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 			&res.CreatedAt,
 			&res.UpdatedAt,
 			&res.Processed,
+			&res.SubtotalCents,
+			&res.DiscountCents,
+			&res.TotalCents,
+			&res.PromoCode,
+			&cancelledAt,
 			&res.Room.ID,
 			&res.Room.RoomName,
 		)
 		if err != nil {
 			return nil, err
 		}
+		res.CancelledAt = cancelledAt.Time
 		reservations = append(reservations, res)
 	}
 
@@ -226,8 +296,8 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 }
 
 // AllNewReservations returns all new reservations that have not been processed
-func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
 	var reservations []models.Reservation
@@ -237,10 +307,13 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 			r.id, r.first_name, r.last_name, r.email, r.phone, 
 			r.start_date, r.end_date, r.room_id, 
 			r.created_at, r.updated_at,
+			r.subtotal_cents, r.discount_cents, r.total_cents, COALESCE(pc.code, ''),
 			rm.id, rm.room_name
 		FROM reservations r
 		LEFT JOIN rooms rm ON r.room_id = rm.id
-		WHERE processed = 0
+		LEFT JOIN promo_redemptions pr ON pr.reservation_id = r.id
+		LEFT JOIN promo_codes pc ON pc.id = pr.promo_code_id
+		WHERE processed = 0 AND r.cancelled_at IS NULL
 		ORDER BY r.start_date ASC
 	`
 
@@ -263,6 +336,10 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 			&res.RoomID,
 			&res.CreatedAt,
 			&res.UpdatedAt,
+			&res.SubtotalCents,
+			&res.DiscountCents,
+			&res.TotalCents,
+			&res.PromoCode,
 			&res.Room.ID,
 			&res.Room.RoomName,
 		)
@@ -280,19 +357,24 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 }
 
 // GetReservationByID returns a reservation by its ID
-func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
 	var res models.Reservation
+	var cancelledAt sql.NullTime
 	query := `
 		SELECT 
 			r.id, r.first_name, r.last_name, r.email, r.phone, 
 			r.start_date, r.end_date, r.room_id, 
-			r.created_at, r.updated_at, r.processed,
-			rm.id, rm.room_name
+			r.created_at, r.updated_at, r.processed, r.locale,
+			r.subtotal_cents, r.discount_cents, r.total_cents, COALESCE(pc.code, ''),
+			COALESCE(r.cancellation_policy_id, 0), r.cancelled_at, r.penalty_cents, r.refund_cents,
+			COALESCE(r.guest_id, 0), rm.id, rm.room_name
 		FROM reservations r
 		LEFT JOIN rooms rm ON r.room_id = rm.id
+		LEFT JOIN promo_redemptions pr ON pr.reservation_id = r.id
+		LEFT JOIN promo_codes pc ON pc.id = pr.promo_code_id
 		WHERE r.id = $1
 	`
 
@@ -309,9 +391,20 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 		&res.CreatedAt,
 		&res.UpdatedAt,
 		&res.Processed,
+		&res.Locale,
+		&res.SubtotalCents,
+		&res.DiscountCents,
+		&res.TotalCents,
+		&res.PromoCode,
+		&res.CancellationPolicyID,
+		&cancelledAt,
+		&res.PenaltyCents,
+		&res.RefundCents,
+		&res.GuestID,
 		&res.Room.ID,
 		&res.Room.RoomName,
 	)
+	res.CancelledAt = cancelledAt.Time
 	if err != nil {
 		return res, err
 	}
@@ -319,24 +412,36 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 	return res, nil
 }
 
-// UpdateReservation updates a reservation in the database
-func (m *postgresDBRepo) UpdateReservation(u models.Reservation, id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// UpdateReservation updates a reservation in the database, moving it to the guest with the new email
+func (m *postgresDBRepo) UpdateReservation(ctx context.Context, u models.Reservation, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
-	stmt := `UPDATE reservations SET first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5 WHERE id = $6`
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	guestID, err := m.saveGuest(ctx, tx, u)
+	if err != nil {
+		return err
+	}
+
+	stmt := `UPDATE reservations SET first_name = $1, last_name = $2, email = $3, phone = $4, guest_id = COALESCE($5, guest_id),
+		updated_at = $6 WHERE id = $7`
 
-	_, err := m.DB.ExecContext(ctx, stmt, u.FirstName, u.LastName, u.Email, u.Phone, time.Now(), id)
+	_, err = tx.ExecContext(ctx, stmt, u.FirstName, u.LastName, u.Email, u.Phone, guestID, time.Now(), id)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 // DeleteReservation deletes a reservation from the database
-func (m *postgresDBRepo) DeleteReservation(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
 	stmt := `DELETE FROM reservations WHERE id = $1`
@@ -350,8 +455,8 @@ func (m *postgresDBRepo) DeleteReservation(id int) error {
 }
 
 // UpdateProcessedForReservation updates the processed status of a reservation
-func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
 	stmt := `UPDATE reservations SET processed = $1 WHERE id = $2`
@@ -365,13 +470,13 @@ func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error
 }
 
 // AllRooms returns all rooms from the database
-func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
 	var rooms []models.Room
 
-	query := `SELECT id, room_name, created_at, updated_at FROM rooms ORDER BY room_name`
+	query := `SELECT id, room_name, price_cents, COALESCE(cancellation_policy_id, 0), created_at, updated_at FROM rooms ORDER BY room_name`
 
 	rows, err := m.DB.QueryContext(ctx, query)
 	if err != nil {
@@ -381,7 +486,7 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 
 	for rows.Next() {
 		var room models.Room
-		err := rows.Scan(&room.ID, &room.RoomName, &room.CreatedAt, &room.UpdatedAt)
+		err := rows.Scan(&room.ID, &room.RoomName, &room.PriceCents, &room.CancellationPolicyID, &room.CreatedAt, &room.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -396,8 +501,8 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 }
 
 // GetRestrictionsForRoomByDate returns room restrictions for a specific room and date
-func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
 	var restrictions []models.RoomRestriction
@@ -431,8 +536,8 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 }
 
 // InsertBlockForRoom inserts a block for a room in the database
-func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
 	stmt := `INSERT INTO room_restrictions (start_date, end_date, room_id, restriction_id, created_at, updated_at)
@@ -447,8 +552,8 @@ func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
 }
 
 // DeleteBlockByID deletes a block by its ID
-func (m *postgresDBRepo) DeleteBlockByID(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
 	defer cancel()
 
 	stmt := `DELETE FROM room_restrictions WHERE id = $1`
@@ -459,4 +564,908 @@ func (m *postgresDBRepo) DeleteBlockByID(id int) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+// ListUsers returns all users ordered by last name
+func (m *postgresDBRepo) ListUsers(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var users []models.User
+
+	query := `SELECT id, first_name, last_name, email, access_level, created_at, updated_at FROM users ORDER BY last_name, first_name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u models.User
+		err := rows.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.AccessLevel, &u.CreatedAt, &u.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// GetSession returns a stored session by its hashed token, or sql.ErrNoRows
+func (m *postgresDBRepo) GetSession(ctx context.Context, token string) (models.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var s models.Session
+	query := `SELECT token, COALESCE(user_id, 0), data, expiry, ip_address, user_agent, last_activity, created_at
+	FROM sessions WHERE token = $1`
+
+	err := m.DB.QueryRowContext(ctx, query, token).Scan(&s.Token, &s.UserID, &s.Data, &s.Expiry,
+		&s.IPAddress, &s.UserAgent, &s.LastActivity, &s.CreatedAt)
+	if err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// SaveSession inserts a session or replaces its data, keeping the time it was created
+func (m *postgresDBRepo) SaveSession(ctx context.Context, s models.Session) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `INSERT INTO sessions (token, user_id, data, expiry, ip_address, user_agent, last_activity, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+	ON CONFLICT (token) DO UPDATE SET user_id = EXCLUDED.user_id, data = EXCLUDED.data, expiry = EXCLUDED.expiry,
+		ip_address = EXCLUDED.ip_address, user_agent = EXCLUDED.user_agent, last_activity = EXCLUDED.last_activity,
+		updated_at = EXCLUDED.updated_at`
+
+	_, err := m.DB.ExecContext(ctx, stmt, s.Token, sessionUserID(s.UserID), s.Data, s.Expiry.UTC(),
+		s.IPAddress, truncateUserAgent(s.UserAgent), s.LastActivity.UTC(), time.Now().UTC())
+	return err
+}
+
+// TouchSession records activity on a session without changing its data
+func (m *postgresDBRepo) TouchSession(ctx context.Context, token, ip, userAgent string, at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `UPDATE sessions SET ip_address = $1, user_agent = $2, last_activity = $3 WHERE token = $4`
+
+	_, err := m.DB.ExecContext(ctx, stmt, ip, truncateUserAgent(userAgent), at.UTC(), token)
+	return err
+}
+
+// DeleteSession removes a session; deleting one that does not exist is not an error
+func (m *postgresDBRepo) DeleteSession(ctx context.Context, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE token = $1`, token)
+	return err
+}
+
+// DeleteExpiredSessions removes sessions that expired before now and returns how many were removed
+func (m *postgresDBRepo) DeleteExpiredSessions(ctx context.Context, now time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE expiry < $1`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ActiveSessionsForUser returns a user's unexpired sessions, most recently used first
+func (m *postgresDBRepo) ActiveSessionsForUser(ctx context.Context, userID int, now time.Time) ([]models.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var sessions []models.Session
+
+	query := `SELECT token, user_id, expiry, ip_address, user_agent, last_activity, created_at
+	FROM sessions WHERE user_id = $1 AND expiry > $2 ORDER BY last_activity DESC`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.Session
+		err := rows.Scan(&s.Token, &s.UserID, &s.Expiry, &s.IPAddress, &s.UserAgent, &s.LastActivity, &s.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// ActiveSessionCounts returns the number of unexpired sessions of each user that has any
+func (m *postgresDBRepo) ActiveSessionCounts(ctx context.Context, now time.Time) (map[int]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	counts := make(map[int]int)
+
+	query := `SELECT user_id, COUNT(*) FROM sessions WHERE user_id IS NOT NULL AND expiry > $1 GROUP BY user_id`
+
+	rows, err := m.DB.QueryContext(ctx, query, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, count int
+		if err := rows.Scan(&userID, &count); err != nil {
+			return nil, err
+		}
+		counts[userID] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// DeleteUserSession removes one of a user's sessions; sessions of other users are left alone
+func (m *postgresDBRepo) DeleteUserSession(ctx context.Context, userID int, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1 AND token = $2`, userID, token)
+	return err
+}
+
+// DeleteUserSessions removes all sessions of a user except exceptToken, which may be empty, and returns how many were removed
+func (m *postgresDBRepo) DeleteUserSessions(ctx context.Context, userID int, exceptToken string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1 AND token <> $2`, userID, exceptToken)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ArrivalsAwaitingEmail returns the reservations starting between from and to, inclusive, that have not
+// been sent the kind of email yet
+func (m *postgresDBRepo) ArrivalsAwaitingEmail(ctx context.Context, kind string, from, to time.Time) ([]models.Reservation, error) {
+	return m.reservationsAwaitingEmail(ctx, "start_date", kind, from, to)
+}
+
+// DeparturesAwaitingEmail returns the reservations ending between from and to, inclusive, that have not
+// been sent the kind of email yet
+func (m *postgresDBRepo) DeparturesAwaitingEmail(ctx context.Context, kind string, from, to time.Time) ([]models.Reservation, error) {
+	return m.reservationsAwaitingEmail(ctx, "end_date", kind, from, to)
+}
+
+// reservationsAwaitingEmail lists the reservations whose dateColumn is between from and to and which have
+// no record of the kind of email
+func (m *postgresDBRepo) reservationsAwaitingEmail(ctx context.Context, dateColumn, kind string, from, to time.Time) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := fmt.Sprintf(`
+		SELECT
+			r.id, r.first_name, r.last_name, r.email, r.phone,
+			r.start_date, r.end_date, r.room_id, r.locale,
+			rm.id, rm.room_name
+		FROM reservations r
+		LEFT JOIN rooms rm ON r.room_id = rm.id
+		WHERE r.%[1]s BETWEEN $1 AND $2
+		AND r.cancelled_at IS NULL
+		AND r.email <> ''
+		AND NOT EXISTS (
+			SELECT 1 FROM reservation_emails e WHERE e.reservation_id = r.id AND e.kind = $3
+		)
+		ORDER BY r.%[1]s, r.id
+	`, dateColumn)
+
+	rows, err := m.DB.QueryContext(ctx, query, from, to, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var res models.Reservation
+		err := rows.Scan(
+			&res.ID,
+			&res.FirstName,
+			&res.LastName,
+			&res.Email,
+			&res.Phone,
+			&res.StartDate,
+			&res.EndDate,
+			&res.RoomID,
+			&res.Locale,
+			&res.Room.ID,
+			&res.Room.RoomName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+// RecordReservationEmail claims the kind of email for a reservation before it is sent. It returns false
+// if the email was already recorded, e.g. by another instance, in which case it must not be sent again.
+func (m *postgresDBRepo) RecordReservationEmail(ctx context.Context, reservationID int, kind string, at time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `INSERT INTO reservation_emails (reservation_id, kind, sent_at, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (reservation_id, kind) DO NOTHING`
+
+	result, err := m.DB.ExecContext(ctx, stmt, reservationID, kind, at, time.Now(), time.Now())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// InsertReview saves a new review, which waits for moderation. A reservation can only be reviewed once.
+func (m *postgresDBRepo) InsertReview(ctx context.Context, rv models.Review) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var newID int
+	stmt := `INSERT INTO reviews (reservation_id, room_id, rating, body, status, reply, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, '', $6, $7) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt, rv.ReservationID, rv.RoomID, rv.Rating, rv.Body, models.ReviewPending, time.Now(), time.Now()).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// GetReviewByID returns a review with its room and reservation
+func (m *postgresDBRepo) GetReviewByID(ctx context.Context, id int) (models.Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	return scanReview(m.DB.QueryRowContext(ctx, reviewQuery+` WHERE rv.id = $1`, id))
+}
+
+// GetReviewByReservationID returns the review of a reservation, or sql.ErrNoRows if the guest has not
+// written one
+func (m *postgresDBRepo) GetReviewByReservationID(ctx context.Context, reservationID int) (models.Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	return scanReview(m.DB.QueryRowContext(ctx, reviewQuery+` WHERE rv.reservation_id = $1`, reservationID))
+}
+
+// AllReviews returns the reviews with status, or all reviews if status is empty, newest first
+func (m *postgresDBRepo) AllReviews(ctx context.Context, status string) ([]models.Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, reviewQuery+` WHERE ($1 = '' OR rv.status = $1) ORDER BY rv.created_at DESC, rv.id DESC`, status)
+	if err != nil {
+		return nil, err
+	}
+	return scanReviews(rows)
+}
+
+// UpdateReviewStatus approves or hides a review on behalf of userID
+func (m *postgresDBRepo) UpdateReviewStatus(ctx context.Context, id int, status string, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `UPDATE reviews SET status = $1, moderated_by = $2, updated_at = $3 WHERE id = $4`
+
+	result, err := m.DB.ExecContext(ctx, stmt, status, sessionUserID(userID), time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
+
+// ReplyToReview sets the hotel's public reply to a review, an empty reply removes it
+func (m *postgresDBRepo) ReplyToReview(ctx context.Context, id int, reply string, userID int, at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `UPDATE reviews SET reply = $1, replied_at = $2, moderated_by = $3, updated_at = $4 WHERE id = $5`
+
+	result, err := m.DB.ExecContext(ctx, stmt, reply, replyTime(reply, at), sessionUserID(userID), time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
+
+// ApprovedReviewsForRoom returns the reviews shown on a room's page, newest first
+func (m *postgresDBRepo) ApprovedReviewsForRoom(ctx context.Context, roomID int) ([]models.Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, reviewQuery+` WHERE rv.room_id = $1 AND rv.status = $2 ORDER BY rv.created_at DESC, rv.id DESC`, roomID, models.ReviewApproved)
+	if err != nil {
+		return nil, err
+	}
+	return scanReviews(rows)
+}
+
+// RoomRating returns the average rating and number of approved reviews of a room
+func (m *postgresDBRepo) RoomRating(ctx context.Context, roomID int) (float64, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var average float64
+	var count int
+	query := `SELECT COALESCE(AVG(rating), 0), COUNT(*) FROM reviews WHERE room_id = $1 AND status = $2`
+
+	err := m.DB.QueryRowContext(ctx, query, roomID, models.ReviewApproved).Scan(&average, &count)
+	if err != nil {
+		return 0, 0, err
+	}
+	return average, count, nil
+}
+
+// GetPromoCodeByCode returns the promo code with code, in any case, or sql.ErrNoRows if there is none
+func (m *postgresDBRepo) GetPromoCodeByCode(ctx context.Context, code string) (models.PromoCode, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	p, err := scanPromoCode(m.DB.QueryRowContext(ctx, promoCodeQuery+` WHERE pc.code = $1`, promo.NormalizeCode(code)))
+	if err != nil {
+		return p, err
+	}
+
+	codes := []models.PromoCode{p}
+	if err := loadPromoCodeRooms(ctx, m.DB, codes); err != nil {
+		return p, err
+	}
+	return codes[0], nil
+}
+
+// AllPromoCodes returns all promo codes with their usage, active ones first, newest first
+func (m *postgresDBRepo) AllPromoCodes(ctx context.Context) ([]models.PromoCode, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, promoCodeQuery+` ORDER BY pc.active DESC, pc.created_at DESC, pc.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := scanPromoCodes(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadPromoCodeRooms(ctx, m.DB, codes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// InsertPromoCode inserts a promo code with its room restrictions and returns its id
+func (m *postgresDBRepo) InsertPromoCode(ctx context.Context, p models.PromoCode) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+	stmt := `INSERT INTO promo_codes (code, description, kind, amount, booking_start, booking_end, stay_start, stay_end,
+		min_nights, max_uses, max_uses_per_email, active, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt, promo.NormalizeCode(p.Code), p.Description, p.Kind, p.Amount,
+		nullDate(p.BookingStart), nullDate(p.BookingEnd), nullDate(p.StayStart), nullDate(p.StayEnd),
+		p.MinNights, p.MaxUses, p.MaxUsesPerEmail, p.Active, time.Now(), time.Now()).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, roomID := range p.RoomIDs {
+		_, err := tx.ExecContext(ctx, `INSERT INTO promo_code_rooms (promo_code_id, room_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4)`, newID, roomID, time.Now(), time.Now())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return newID, tx.Commit()
+}
+
+// SetPromoCodeActive enables or disables a promo code
+func (m *postgresDBRepo) SetPromoCodeActive(ctx context.Context, id int, active bool) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE promo_codes SET active = $1, updated_at = $2 WHERE id = $3`, active, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
+
+// PromoCodeUses returns how often a promo code was redeemed, in total and by the email address
+func (m *postgresDBRepo) PromoCodeUses(ctx context.Context, promoCodeID int, email string) (int, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var total, byEmail int
+	query := `SELECT COUNT(*), COUNT(*) FILTER (WHERE email = $2) FROM promo_redemptions WHERE promo_code_id = $1`
+
+	err := m.DB.QueryRowContext(ctx, query, promoCodeID, promo.NormalizeEmail(email)).Scan(&total, &byEmail)
+	if err != nil {
+		return 0, 0, err
+	}
+	return total, byEmail, nil
+}
+
+// RedeemPromoCode records a promo code against a reservation and takes the discount off its total. It
+// returns false without changing anything if the code has meanwhile reached one of its usage limits; the
+// code's row stays locked until the redemption is saved, so concurrent bookings cannot both take the last use.
+func (m *postgresDBRepo) RedeemPromoCode(ctx context.Context, r models.PromoRedemption) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var maxUses, maxUsesPerEmail int
+	err = tx.QueryRowContext(ctx, `SELECT max_uses, max_uses_per_email FROM promo_codes WHERE id = $1 FOR UPDATE`,
+		r.PromoCodeID).Scan(&maxUses, &maxUsesPerEmail)
+	if err != nil {
+		return false, err
+	}
+
+	email := promo.NormalizeEmail(r.Email)
+	var uses, usesByEmail int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*), COUNT(*) FILTER (WHERE email = $2) FROM promo_redemptions WHERE promo_code_id = $1`,
+		r.PromoCodeID, email).Scan(&uses, &usesByEmail)
+	if err != nil {
+		return false, err
+	}
+	if !usageAllows(maxUses, maxUsesPerEmail, uses, usesByEmail) {
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO promo_redemptions (promo_code_id, reservation_id, email, discount_cents, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6)`, r.PromoCodeID, r.ReservationID, email, r.DiscountCents, time.Now(), time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE reservations SET discount_cents = $1, total_cents = subtotal_cents - $1, updated_at = $2
+	WHERE id = $3`, r.DiscountCents, time.Now(), r.ReservationID)
+	if err != nil {
+		return false, err
+	}
+	if err := requireOneRow(result); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// GetCancellationPolicyByID returns a cancellation policy with its tiers, or sql.ErrNoRows
+func (m *postgresDBRepo) GetCancellationPolicyByID(ctx context.Context, id int) (models.CancellationPolicy, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	p, err := scanCancellationPolicy(m.DB.QueryRowContext(ctx, cancellationPolicyQuery+` WHERE id = $1`, id))
+	if err != nil {
+		return p, err
+	}
+
+	policies := []models.CancellationPolicy{p}
+	if err := loadCancellationTiers(ctx, m.DB, policies); err != nil {
+		return p, err
+	}
+	return policies[0], nil
+}
+
+// AllCancellationPolicies returns all cancellation policies with their tiers, by name
+func (m *postgresDBRepo) AllCancellationPolicies(ctx context.Context) ([]models.CancellationPolicy, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, cancellationPolicyQuery+` ORDER BY name, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []models.CancellationPolicy
+	for rows.Next() {
+		p, err := scanCancellationPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := loadCancellationTiers(ctx, m.DB, policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// InsertCancellationPolicy inserts a cancellation policy with its tiers and returns its id
+func (m *postgresDBRepo) InsertCancellationPolicy(ctx context.Context, p models.CancellationPolicy) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+	err = tx.QueryRowContext(ctx, `INSERT INTO cancellation_policies (name, description, created_at, updated_at)
+	VALUES ($1, $2, $3, $4) returning id`, p.Name, p.Description, time.Now(), time.Now()).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, t := range p.Tiers {
+		_, err := tx.ExecContext(ctx, `INSERT INTO cancellation_policy_tiers (cancellation_policy_id, days_before, penalty_percent, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)`, newID, t.DaysBefore, t.PenaltyPercent, time.Now(), time.Now())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return newID, tx.Commit()
+}
+
+// SetRoomCancellationPolicy sets the policy new reservations of a room are booked under
+func (m *postgresDBRepo) SetRoomCancellationPolicy(ctx context.Context, roomID, policyID int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE rooms SET cancellation_policy_id = $1, updated_at = $2 WHERE id = $3`,
+		policyID, time.Now(), roomID)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
+
+// CancelReservation records the cancellation of a reservation with what the guest was charged and refunded,
+// and frees its room. It returns sql.ErrNoRows if there is no such reservation or it was already cancelled.
+func (m *postgresDBRepo) CancelReservation(ctx context.Context, id int, at time.Time, penaltyCents, refundCents int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE reservations SET cancelled_at = $1, penalty_cents = $2, refund_cents = $3, updated_at = $4
+	WHERE id = $5 AND cancelled_at IS NULL`, at, penaltyCents, refundCents, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if err := requireOneRow(result); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM room_restrictions WHERE reservation_id = $1`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// postgresGuestQuery is guestQuery with the latest arrival day formatted by postgres
+var postgresGuestQuery = fmt.Sprintf(guestQuery, `to_char(MAX(r.start_date), 'YYYY-MM-DD')`)
+
+// AllGuests returns the guests whose email or name contains search, all of them if it is empty, by name
+func (m *postgresDBRepo) AllGuests(ctx context.Context, search string) ([]models.Guest, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := postgresGuestQuery + ` WHERE g.email LIKE $1 OR lower(g.first_name || ' ' || g.last_name) LIKE $1
+		ORDER BY g.last_name, g.first_name, g.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, guestSearchPattern(search))
+	if err != nil {
+		return nil, err
+	}
+	return scanGuests(rows)
+}
+
+// GetGuestByID returns a guest, or sql.ErrNoRows if there is none
+func (m *postgresDBRepo) GetGuestByID(ctx context.Context, id int) (models.Guest, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	return scanGuest(m.DB.QueryRowContext(ctx, postgresGuestQuery+` WHERE g.id = $1`, id))
+}
+
+// ReservationsForGuest returns the reservations of a guest, including cancelled ones, latest arrival first
+func (m *postgresDBRepo) ReservationsForGuest(ctx context.Context, guestID int) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, guestReservationQuery+` WHERE r.guest_id = $1 ORDER BY r.start_date DESC, r.id DESC`, guestID)
+	if err != nil {
+		return nil, err
+	}
+	return scanGuestReservations(rows)
+}
+
+// UpdateGuestNotes replaces staff's notes on a guest. It returns sql.ErrNoRows if there is no such guest.
+func (m *postgresDBRepo) UpdateGuestNotes(ctx context.Context, id int, notes string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE guests SET notes = $1, updated_at = $2 WHERE id = $3`, notes, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
+
+// AnonymizeGuest erases the personal data of a guest from their profile, their reservations, the promo
+// codes they redeemed and the webhook deliveries about their reservations. Dates, rooms and amounts are kept, so occupancy and revenue figures do not change.
+// It returns sql.ErrNoRows if there is no such guest or they were already anonymized.
+func (m *postgresDBRepo) AnonymizeGuest(ctx context.Context, id int, at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE guests SET email = $1, first_name = $2, last_name = $3, phone = '', notes = '',
+		anonymized_at = $4, updated_at = $5 WHERE id = $6 AND anonymized_at IS NULL`,
+		guests.AnonymizedEmail(id), guests.AnonymizedFirstName, guests.AnonymizedLastName, at, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if err := requireOneRow(result); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE reservations SET first_name = $1, last_name = $2, email = '', phone = '', updated_at = $3
+		WHERE guest_id = $4`, guests.AnonymizedFirstName, guests.AnonymizedLastName, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE promo_redemptions SET email = '', updated_at = $1
+		WHERE reservation_id IN (SELECT id FROM reservations WHERE guest_id = $2)`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	err = redactWebhookDeliveries(ctx, tx, `SELECT id FROM reservations WHERE guest_id = $1`, id,
+		`UPDATE webhook_deliveries SET payload = $1, updated_at = $2 WHERE id = $3`, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// NotificationPreferences returns the notification preferences of the guest with the email, by kind and
+// channel. There are none if the guest has not chosen any, or if there is no such guest.
+func (m *postgresDBRepo) NotificationPreferences(ctx context.Context, email string) ([]models.NotificationPreference, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT p.kind, p.channel, p.enabled FROM guest_notification_preferences p
+		JOIN guests g ON g.id = p.guest_id WHERE g.email = $1 ORDER BY p.kind, p.channel`, guests.NormalizeEmail(email))
+	if err != nil {
+		return nil, err
+	}
+	return scanNotificationPreferences(rows)
+}
+
+// SetNotificationPreferences replaces the notification preferences of a guest. It returns sql.ErrNoRows if
+// there is no such guest.
+func (m *postgresDBRepo) SetNotificationPreferences(ctx context.Context, guestID int, prefs []models.NotificationPreference) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE guests SET updated_at = $1 WHERE id = $2`, time.Now(), guestID)
+	if err != nil {
+		return err
+	}
+	if err := requireOneRow(result); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM guest_notification_preferences WHERE guest_id = $1`, guestID); err != nil {
+		return err
+	}
+	for _, p := range prefs {
+		_, err := tx.ExecContext(ctx, `INSERT INTO guest_notification_preferences (guest_id, kind, channel, enabled, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`, guestID, p.Kind, p.Channel, p.Enabled, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AllWebhookEndpoints returns the webhook endpoints, active ones first, newest first
+func (m *postgresDBRepo) AllWebhookEndpoints(ctx context.Context) ([]models.WebhookEndpoint, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, webhookEndpointQuery+` ORDER BY active DESC, created_at DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookEndpoints(rows)
+}
+
+// InsertWebhookEndpoint inserts a webhook endpoint and returns its id
+func (m *postgresDBRepo) InsertWebhookEndpoint(ctx context.Context, e models.WebhookEndpoint) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var newID int
+	stmt := `INSERT INTO webhook_endpoints (url, secret, events, active, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt, e.URL, e.Secret, joinWebhookEvents(e.Events), e.Active,
+		time.Now(), time.Now()).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// SetWebhookEndpointActive enables or disables a webhook endpoint
+func (m *postgresDBRepo) SetWebhookEndpointActive(ctx context.Context, id int, active bool) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE webhook_endpoints SET active = $1, updated_at = $2 WHERE id = $3`, active, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
+
+// QueueWebhookDeliveries queues payload for every active endpoint subscribed to event, due at, and returns
+// how many deliveries were queued
+func (m *postgresDBRepo) QueueWebhookDeliveries(ctx context.Context, event, payload string, at time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `INSERT INTO webhook_deliveries (webhook_endpoint_id, event, payload, status, attempts, next_attempt_at, created_at, updated_at)
+	SELECT id, $1::text, $2::text, $3::text, 0, $4::timestamp, $4::timestamp, $4::timestamp FROM webhook_endpoints
+	WHERE active AND ',' || events || ',' LIKE '%,' || $1::text || ',%'`
+
+	result, err := m.DB.ExecContext(ctx, stmt, event, payload, models.WebhookPending, at)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// DueWebhookDeliveries returns up to limit pending deliveries whose next attempt is due at now, oldest first.
+// Deliveries to disabled endpoints wait until the endpoint is enabled again.
+func (m *postgresDBRepo) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, webhookDeliveryQuery+` WHERE d.status = $1 AND d.next_attempt_at <= $2 AND e.active
+		ORDER BY d.next_attempt_at, d.id LIMIT $3`, models.WebhookPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+// ClaimWebhookDelivery counts an attempt of a pending delivery that has been tried attempts times so far
+// and holds it until the given time, so no other instance picks it up meanwhile. It returns sql.ErrNoRows
+// if another instance claimed it first.
+func (m *postgresDBRepo) ClaimWebhookDelivery(ctx context.Context, id, attempts int, until time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = $1, updated_at = $2
+		WHERE id = $3 AND status = $4 AND attempts = $5`, until, time.Now(), id, models.WebhookPending, attempts)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
+
+// SaveWebhookAttempt stores the outcome of an attempt: the delivery's status, next attempt and the response
+func (m *postgresDBRepo) SaveWebhookAttempt(ctx context.Context, d models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE webhook_deliveries SET status = $1, next_attempt_at = $2, last_status_code = $3,
+		last_error = $4, delivered_at = $5, updated_at = $6 WHERE id = $7`,
+		d.Status, d.NextAttemptAt, d.LastStatusCode, d.LastError, nullTime(d.DeliveredAt), time.Now(), d.ID)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
+
+// WebhookDeliveries returns the latest limit deliveries with the status, or of any status if it is empty
+func (m *postgresDBRepo) WebhookDeliveries(ctx context.Context, status string, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, webhookDeliveryQuery+` WHERE ($1 = '' OR d.status = $1)
+		ORDER BY d.created_at DESC, d.id DESC LIMIT $2`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+// RedeliverWebhook sends a delivery again from its first attempt, due at the given time
+func (m *postgresDBRepo) RedeliverWebhook(ctx context.Context, id int, at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = $2, updated_at = $3
+		WHERE id = $4`, models.WebhookPending, at, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
@@ -0,0 +1,1536 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/guests"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/promo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// sqliteDateLayout is how date columns are stored, so that range comparisons work on the text values
+const sqliteDateLayout = "2006-01-02"
+
+// sqliteTimeLayout is how session timestamps are stored: fixed width and in UTC, so comparing the text
+// values compares the times
+const sqliteTimeLayout = "2006-01-02 15:04:05.000000000"
+
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// sqliteReplyTime is replyTime in the sqlite timestamp format
+func sqliteReplyTime(reply string, at time.Time) any {
+	if reply == "" {
+		return nil
+	}
+	return sqliteTime(at)
+}
+
+// sqliteNullDate is nullDate in the sqlite date format
+func sqliteNullDate(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format(sqliteDateLayout)
+}
+
+func (m *sqliteDBRepo) AllUsers(ctx context.Context) bool {
+	return true
+}
+
+// InsertReservation inserts a reservation into the database, linked to the guest it was made for
+func (m *sqliteDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	guestID, err := m.saveGuest(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `INSERT INTO reservations (first_name, last_name, email, phone, start_date, end_date, room_id, locale,
+		subtotal_cents, discount_cents, total_cents, cancellation_policy_id, guest_id, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := tx.ExecContext(ctx, stmt, res.FirstName, res.LastName, res.Email, res.Phone,
+		res.StartDate.Format(sqliteDateLayout), res.EndDate.Format(sqliteDateLayout), res.RoomID, reservationLocale(res),
+		res.SubtotalCents, res.DiscountCents, res.TotalCents, nullID(res.CancellationPolicyID), guestID, time.Now(), time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(newID), nil
+}
+
+// saveGuest creates the guest a reservation is for, or updates them with the details they booked with this
+// time, and returns their id. A reservation without an email, such as an anonymized one, has no guest.
+func (m *sqliteDBRepo) saveGuest(ctx context.Context, tx *sql.Tx, res models.Reservation) (any, error) {
+	email := guests.NormalizeEmail(res.Email)
+	if email == "" {
+		return nil, nil
+	}
+
+	now := sqliteTime(time.Now())
+	stmt := `INSERT INTO guests (email, first_name, last_name, phone, notes, created_at, updated_at)
+	VALUES (?, ?, ?, ?, '', ?, ?)
+	ON CONFLICT (email) DO UPDATE SET first_name = excluded.first_name, last_name = excluded.last_name,
+		phone = excluded.phone, updated_at = excluded.updated_at`
+
+	if _, err := tx.ExecContext(ctx, stmt, email, res.FirstName, res.LastName, res.Phone, now, now); err != nil {
+		return nil, err
+	}
+
+	var id int
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM guests WHERE email = ?`, email).Scan(&id); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// InsertRoomRestriction inserts a room restriction into the database
+func (m *sqliteDBRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `INSERT INTO room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := m.DB.ExecContext(ctx, stmt, r.StartDate.Format(sqliteDateLayout), r.EndDate.Format(sqliteDateLayout),
+		r.RoomID, r.ReservationID, r.RestrictionID, time.Now(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SearchAvailabilityByDatesByRoomID returns true if there are available rooms for the given dates
+func (m *sqliteDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `select count(id) from room_restrictions where room_id = ? and ? < end_date and ? > start_date`
+	var numRows int
+	row := m.DB.QueryRowContext(ctx, query, roomID, start.Format(sqliteDateLayout), end.Format(sqliteDateLayout))
+	err := row.Scan(&numRows)
+	if err != nil {
+		return false, err
+	}
+
+	if numRows == 0 {
+		return true, nil
+	}
+	return false, nil
+}
+
+// SearchAvailabilityForAllRooms returns a slice of available rooms for the given dates
+func (m *sqliteDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var rooms []models.Room
+
+	query := `select r.id, r.room_name from rooms r
+	where r.id not in
+	(select room_id from room_restrictions rr where ? < rr.end_date and ? > rr.start_date)`
+
+	rows, err := m.DB.QueryContext(ctx, query, start.Format(sqliteDateLayout), end.Format(sqliteDateLayout))
+	if err != nil {
+		return rooms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var room models.Room
+		err := rows.Scan(&room.ID, &room.RoomName)
+		if err != nil {
+			return rooms, err
+		}
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+
+	return rooms, nil
+}
+
+// RoomOccupancy returns every room with the restrictions on it between start and end, in one query
+func (m *sqliteDBRepo) RoomOccupancy(ctx context.Context, start, end time.Time) ([]models.RoomOccupancy, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	query := `SELECT r.id, r.room_name, rr.id, rr.start_date, rr.end_date, rr.reservation_id, rr.restriction_id
+		FROM rooms r
+		LEFT JOIN room_restrictions rr ON rr.room_id = r.id AND ? < rr.end_date AND ? > rr.start_date
+		ORDER BY r.id, rr.start_date`
+
+	rows, err := m.DB.QueryContext(ctx, query, start.Format(sqliteDateLayout), end.Format(sqliteDateLayout))
+	if err != nil {
+		return nil, err
+	}
+	return scanRoomOccupancy(rows)
+}
+
+// GetRoomByID returns a room by its ID
+func (m *sqliteDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var room models.Room
+	query := `select id, room_name, price_cents, COALESCE(cancellation_policy_id, 0), created_at, updated_at from rooms where id = ?`
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(&room.ID, &room.RoomName, &room.PriceCents, &room.CancellationPolicyID, &room.CreatedAt, &room.UpdatedAt)
+	if err != nil {
+		return room, err
+	}
+
+	return room, nil
+}
+
+// GetUserByID returns a user by its ID
+func (m *sqliteDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var user models.User
+	query := `select id, first_name, last_name, email, password, access_level, created_at, updated_at from users where id = ?`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+
+	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.Password, &user.AccessLevel, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
+// UpdateUser updates a user in the database
+func (m *sqliteDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `UPDATE users SET first_name = ?, last_name = ?, email = ?, access_level = ?, updated_at = ? WHERE id = ?`
+
+	_, err := m.DB.ExecContext(ctx, stmt, u.FirstName, u.LastName, u.Email, u.AccessLevel, time.Now(), u.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AuthenticateUser checks if the user exists and verifies the password
+func (m *sqliteDBRepo) AuthenticateUser(ctx context.Context, email, testPassword string) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var id int
+	var hashedPassword string
+
+	query := `SELECT id, password FROM users WHERE email = ?`
+	row := m.DB.QueryRowContext(ctx, query, email)
+
+	err := row.Scan(&id, &hashedPassword)
+	if err != nil {
+		return 0, "", err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, "", errors.New("incorrect password")
+	} else if err != nil {
+		return 0, "", err
+	}
+	return id, hashedPassword, nil
+}
+
+// AllReservations returns all reservations from the database
+func (m *sqliteDBRepo) AllReservations(ctx context.Context) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `
+		SELECT
+			r.id, r.first_name, r.last_name, r.email, r.phone,
+			r.start_date, r.end_date, r.room_id,
+			r.created_at, r.updated_at, r.processed,
+			r.subtotal_cents, r.discount_cents, r.total_cents, COALESCE(pc.code, ''), r.cancelled_at,
+			rm.id, rm.room_name
+		FROM reservations r
+		LEFT JOIN rooms rm ON r.room_id = rm.id
+		LEFT JOIN promo_redemptions pr ON pr.reservation_id = r.id
+		LEFT JOIN promo_codes pc ON pc.id = pr.promo_code_id
+		ORDER BY r.start_date ASC
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var res models.Reservation
+		var cancelledAt sql.NullTime
+		err := rows.Scan(
+			&res.ID,
+			&res.FirstName,
+			&res.LastName,
+			&res.Email,
+			&res.Phone,
+			&res.StartDate,
+			&res.EndDate,
+			&res.RoomID,
+			&res.CreatedAt,
+			&res.UpdatedAt,
+			&res.Processed,
+			&res.SubtotalCents,
+			&res.DiscountCents,
+			&res.TotalCents,
+			&res.PromoCode,
+			&cancelledAt,
+			&res.Room.ID,
+			&res.Room.RoomName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		res.CancelledAt = cancelledAt.Time
+		reservations = append(reservations, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+// AllNewReservations returns all new reservations that have not been processed
+func (m *sqliteDBRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `
+		SELECT
+			r.id, r.first_name, r.last_name, r.email, r.phone,
+			r.start_date, r.end_date, r.room_id,
+			r.created_at, r.updated_at,
+			r.subtotal_cents, r.discount_cents, r.total_cents, COALESCE(pc.code, ''),
+			rm.id, rm.room_name
+		FROM reservations r
+		LEFT JOIN rooms rm ON r.room_id = rm.id
+		LEFT JOIN promo_redemptions pr ON pr.reservation_id = r.id
+		LEFT JOIN promo_codes pc ON pc.id = pr.promo_code_id
+		WHERE processed = 0 AND r.cancelled_at IS NULL
+		ORDER BY r.start_date ASC
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var res models.Reservation
+		err := rows.Scan(
+			&res.ID,
+			&res.FirstName,
+			&res.LastName,
+			&res.Email,
+			&res.Phone,
+			&res.StartDate,
+			&res.EndDate,
+			&res.RoomID,
+			&res.CreatedAt,
+			&res.UpdatedAt,
+			&res.SubtotalCents,
+			&res.DiscountCents,
+			&res.TotalCents,
+			&res.PromoCode,
+			&res.Room.ID,
+			&res.Room.RoomName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+// GetReservationByID returns a reservation by its ID
+func (m *sqliteDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var res models.Reservation
+	var cancelledAt sql.NullTime
+	query := `
+		SELECT
+			r.id, r.first_name, r.last_name, r.email, r.phone,
+			r.start_date, r.end_date, r.room_id,
+			r.created_at, r.updated_at, r.processed, r.locale,
+			r.subtotal_cents, r.discount_cents, r.total_cents, COALESCE(pc.code, ''),
+			COALESCE(r.cancellation_policy_id, 0), r.cancelled_at, r.penalty_cents, r.refund_cents,
+			COALESCE(r.guest_id, 0), rm.id, rm.room_name
+		FROM reservations r
+		LEFT JOIN rooms rm ON r.room_id = rm.id
+		LEFT JOIN promo_redemptions pr ON pr.reservation_id = r.id
+		LEFT JOIN promo_codes pc ON pc.id = pr.promo_code_id
+		WHERE r.id = ?
+	`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&res.ID,
+		&res.FirstName,
+		&res.LastName,
+		&res.Email,
+		&res.Phone,
+		&res.StartDate,
+		&res.EndDate,
+		&res.RoomID,
+		&res.CreatedAt,
+		&res.UpdatedAt,
+		&res.Processed,
+		&res.Locale,
+		&res.SubtotalCents,
+		&res.DiscountCents,
+		&res.TotalCents,
+		&res.PromoCode,
+		&res.CancellationPolicyID,
+		&cancelledAt,
+		&res.PenaltyCents,
+		&res.RefundCents,
+		&res.GuestID,
+		&res.Room.ID,
+		&res.Room.RoomName,
+	)
+	res.CancelledAt = cancelledAt.Time
+	if err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
+
+// UpdateReservation updates a reservation in the database, moving it to the guest with the new email
+func (m *sqliteDBRepo) UpdateReservation(ctx context.Context, u models.Reservation, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	guestID, err := m.saveGuest(ctx, tx, u)
+	if err != nil {
+		return err
+	}
+
+	stmt := `UPDATE reservations SET first_name = ?, last_name = ?, email = ?, phone = ?, guest_id = COALESCE(?, guest_id),
+		updated_at = ? WHERE id = ?`
+
+	_, err = tx.ExecContext(ctx, stmt, u.FirstName, u.LastName, u.Email, u.Phone, guestID, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteReservation deletes a reservation from the database
+func (m *sqliteDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `DELETE FROM reservations WHERE id = ?`
+
+	_, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateProcessedForReservation updates the processed status of a reservation
+func (m *sqliteDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `UPDATE reservations SET processed = ? WHERE id = ?`
+
+	_, err := m.DB.ExecContext(ctx, stmt, processed, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AllRooms returns all rooms from the database
+func (m *sqliteDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var rooms []models.Room
+
+	query := `SELECT id, room_name, price_cents, COALESCE(cancellation_policy_id, 0), created_at, updated_at FROM rooms ORDER BY room_name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var room models.Room
+		err := rows.Scan(&room.ID, &room.RoomName, &room.PriceCents, &room.CancellationPolicyID, &room.CreatedAt, &room.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rooms, nil
+}
+
+// GetRestrictionsForRoomByDate returns room restrictions for a specific room and date
+func (m *sqliteDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	query := `SELECT id, start_date, end_date, room_id, coalesce(reservation_id, 0), restriction_id, created_at, updated_at
+		FROM room_restrictions
+		WHERE room_id = ? AND ? < end_date AND ? > start_date`
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID, start.Format(sqliteDateLayout), end.Format(sqliteDateLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var restriction models.RoomRestriction
+		err := rows.Scan(&restriction.ID, &restriction.StartDate, &restriction.EndDate,
+			&restriction.RoomID, &restriction.ReservationID,
+			&restriction.RestrictionID, &restriction.CreatedAt, &restriction.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		restrictions = append(restrictions, restriction)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+}
+
+// InsertBlockForRoom inserts a block for a room in the database
+func (m *sqliteDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `INSERT INTO room_restrictions (start_date, end_date, room_id, restriction_id, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?)`
+
+	_, err := m.DB.ExecContext(ctx, stmt, startDate.Format(sqliteDateLayout), startDate.AddDate(0, 0, 1).Format(sqliteDateLayout),
+		id, 2, time.Now(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteBlockByID deletes a block by its ID
+func (m *sqliteDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `DELETE FROM room_restrictions WHERE id = ?`
+
+	_, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListUsers returns all users ordered by last name
+func (m *sqliteDBRepo) ListUsers(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var users []models.User
+
+	query := `SELECT id, first_name, last_name, email, access_level, created_at, updated_at FROM users ORDER BY last_name, first_name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u models.User
+		err := rows.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.AccessLevel, &u.CreatedAt, &u.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// GetSession returns a stored session by its hashed token, or sql.ErrNoRows
+func (m *sqliteDBRepo) GetSession(ctx context.Context, token string) (models.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var s models.Session
+	query := `SELECT token, COALESCE(user_id, 0), data, expiry, ip_address, user_agent, last_activity, created_at
+	FROM sessions WHERE token = ?`
+
+	err := m.DB.QueryRowContext(ctx, query, token).Scan(&s.Token, &s.UserID, &s.Data, &s.Expiry,
+		&s.IPAddress, &s.UserAgent, &s.LastActivity, &s.CreatedAt)
+	if err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// SaveSession inserts a session or replaces its data, keeping the time it was created
+func (m *sqliteDBRepo) SaveSession(ctx context.Context, s models.Session) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `INSERT INTO sessions (token, user_id, data, expiry, ip_address, user_agent, last_activity, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (token) DO UPDATE SET user_id = EXCLUDED.user_id, data = EXCLUDED.data, expiry = EXCLUDED.expiry,
+		ip_address = EXCLUDED.ip_address, user_agent = EXCLUDED.user_agent, last_activity = EXCLUDED.last_activity,
+		updated_at = EXCLUDED.updated_at`
+
+	now := sqliteTime(time.Now())
+	_, err := m.DB.ExecContext(ctx, stmt, s.Token, sessionUserID(s.UserID), s.Data, sqliteTime(s.Expiry),
+		s.IPAddress, truncateUserAgent(s.UserAgent), sqliteTime(s.LastActivity), now, now)
+	return err
+}
+
+// TouchSession records activity on a session without changing its data
+func (m *sqliteDBRepo) TouchSession(ctx context.Context, token, ip, userAgent string, at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `UPDATE sessions SET ip_address = ?, user_agent = ?, last_activity = ? WHERE token = ?`
+
+	_, err := m.DB.ExecContext(ctx, stmt, ip, truncateUserAgent(userAgent), sqliteTime(at), token)
+	return err
+}
+
+// DeleteSession removes a session; deleting one that does not exist is not an error
+func (m *sqliteDBRepo) DeleteSession(ctx context.Context, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE token = ?`, token)
+	return err
+}
+
+// DeleteExpiredSessions removes sessions that expired before now and returns how many were removed
+func (m *sqliteDBRepo) DeleteExpiredSessions(ctx context.Context, now time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE expiry < ?`, sqliteTime(now))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ActiveSessionsForUser returns a user's unexpired sessions, most recently used first
+func (m *sqliteDBRepo) ActiveSessionsForUser(ctx context.Context, userID int, now time.Time) ([]models.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var sessions []models.Session
+
+	query := `SELECT token, user_id, expiry, ip_address, user_agent, last_activity, created_at
+	FROM sessions WHERE user_id = ? AND expiry > ? ORDER BY last_activity DESC`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, sqliteTime(now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.Session
+		err := rows.Scan(&s.Token, &s.UserID, &s.Expiry, &s.IPAddress, &s.UserAgent, &s.LastActivity, &s.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// ActiveSessionCounts returns the number of unexpired sessions of each user that has any
+func (m *sqliteDBRepo) ActiveSessionCounts(ctx context.Context, now time.Time) (map[int]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	counts := make(map[int]int)
+
+	query := `SELECT user_id, COUNT(*) FROM sessions WHERE user_id IS NOT NULL AND expiry > ? GROUP BY user_id`
+
+	rows, err := m.DB.QueryContext(ctx, query, sqliteTime(now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, count int
+		if err := rows.Scan(&userID, &count); err != nil {
+			return nil, err
+		}
+		counts[userID] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// DeleteUserSession removes one of a user's sessions; sessions of other users are left alone
+func (m *sqliteDBRepo) DeleteUserSession(ctx context.Context, userID int, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ? AND token = ?`, userID, token)
+	return err
+}
+
+// DeleteUserSessions removes all sessions of a user except exceptToken, which may be empty, and returns how many were removed
+func (m *sqliteDBRepo) DeleteUserSessions(ctx context.Context, userID int, exceptToken string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ? AND token <> ?`, userID, exceptToken)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ArrivalsAwaitingEmail returns the reservations starting between from and to, inclusive, that have not
+// been sent the kind of email yet
+func (m *sqliteDBRepo) ArrivalsAwaitingEmail(ctx context.Context, kind string, from, to time.Time) ([]models.Reservation, error) {
+	return m.reservationsAwaitingEmail(ctx, "start_date", kind, from, to)
+}
+
+// DeparturesAwaitingEmail returns the reservations ending between from and to, inclusive, that have not
+// been sent the kind of email yet
+func (m *sqliteDBRepo) DeparturesAwaitingEmail(ctx context.Context, kind string, from, to time.Time) ([]models.Reservation, error) {
+	return m.reservationsAwaitingEmail(ctx, "end_date", kind, from, to)
+}
+
+// reservationsAwaitingEmail lists the reservations whose dateColumn is between from and to and which have
+// no record of the kind of email
+func (m *sqliteDBRepo) reservationsAwaitingEmail(ctx context.Context, dateColumn, kind string, from, to time.Time) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := fmt.Sprintf(`
+		SELECT
+			r.id, r.first_name, r.last_name, r.email, r.phone,
+			r.start_date, r.end_date, r.room_id, r.locale,
+			rm.id, rm.room_name
+		FROM reservations r
+		LEFT JOIN rooms rm ON r.room_id = rm.id
+		WHERE r.%[1]s BETWEEN ? AND ?
+		AND r.cancelled_at IS NULL
+		AND r.email <> ''
+		AND NOT EXISTS (
+			SELECT 1 FROM reservation_emails e WHERE e.reservation_id = r.id AND e.kind = ?
+		)
+		ORDER BY r.%[1]s, r.id
+	`, dateColumn)
+
+	rows, err := m.DB.QueryContext(ctx, query, from.Format(sqliteDateLayout), to.Format(sqliteDateLayout), kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var res models.Reservation
+		err := rows.Scan(
+			&res.ID,
+			&res.FirstName,
+			&res.LastName,
+			&res.Email,
+			&res.Phone,
+			&res.StartDate,
+			&res.EndDate,
+			&res.RoomID,
+			&res.Locale,
+			&res.Room.ID,
+			&res.Room.RoomName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+// RecordReservationEmail claims the kind of email for a reservation before it is sent. It returns false
+// if the email was already recorded, e.g. by another instance, in which case it must not be sent again.
+func (m *sqliteDBRepo) RecordReservationEmail(ctx context.Context, reservationID int, kind string, at time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `INSERT INTO reservation_emails (reservation_id, kind, sent_at, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (reservation_id, kind) DO NOTHING`
+
+	result, err := m.DB.ExecContext(ctx, stmt, reservationID, kind, sqliteTime(at), sqliteTime(time.Now()), sqliteTime(time.Now()))
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// InsertReview saves a new review, which waits for moderation. A reservation can only be reviewed once.
+func (m *sqliteDBRepo) InsertReview(ctx context.Context, rv models.Review) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `INSERT INTO reviews (reservation_id, room_id, rating, body, status, reply, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, '', ?, ?)`
+
+	now := sqliteTime(time.Now())
+	result, err := m.DB.ExecContext(ctx, stmt, rv.ReservationID, rv.RoomID, rv.Rating, rv.Body, models.ReviewPending, now, now)
+	if err != nil {
+		return 0, err
+	}
+
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(newID), nil
+}
+
+// GetReviewByID returns a review with its room and reservation
+func (m *sqliteDBRepo) GetReviewByID(ctx context.Context, id int) (models.Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	return scanReview(m.DB.QueryRowContext(ctx, reviewQuery+` WHERE rv.id = ?`, id))
+}
+
+// GetReviewByReservationID returns the review of a reservation, or sql.ErrNoRows if the guest has not
+// written one
+func (m *sqliteDBRepo) GetReviewByReservationID(ctx context.Context, reservationID int) (models.Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	return scanReview(m.DB.QueryRowContext(ctx, reviewQuery+` WHERE rv.reservation_id = ?`, reservationID))
+}
+
+// AllReviews returns the reviews with status, or all reviews if status is empty, newest first
+func (m *sqliteDBRepo) AllReviews(ctx context.Context, status string) ([]models.Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, reviewQuery+` WHERE (? = '' OR rv.status = ?) ORDER BY rv.created_at DESC, rv.id DESC`, status, status)
+	if err != nil {
+		return nil, err
+	}
+	return scanReviews(rows)
+}
+
+// UpdateReviewStatus approves or hides a review on behalf of userID
+func (m *sqliteDBRepo) UpdateReviewStatus(ctx context.Context, id int, status string, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `UPDATE reviews SET status = ?, moderated_by = ?, updated_at = ? WHERE id = ?`
+
+	result, err := m.DB.ExecContext(ctx, stmt, status, sessionUserID(userID), sqliteTime(time.Now()), id)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
+
+// ReplyToReview sets the hotel's public reply to a review, an empty reply removes it
+func (m *sqliteDBRepo) ReplyToReview(ctx context.Context, id int, reply string, userID int, at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	stmt := `UPDATE reviews SET reply = ?, replied_at = ?, moderated_by = ?, updated_at = ? WHERE id = ?`
+
+	result, err := m.DB.ExecContext(ctx, stmt, reply, sqliteReplyTime(reply, at), sessionUserID(userID), sqliteTime(time.Now()), id)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
+
+// ApprovedReviewsForRoom returns the reviews shown on a room's page, newest first
+func (m *sqliteDBRepo) ApprovedReviewsForRoom(ctx context.Context, roomID int) ([]models.Review, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, reviewQuery+` WHERE rv.room_id = ? AND rv.status = ? ORDER BY rv.created_at DESC, rv.id DESC`, roomID, models.ReviewApproved)
+	if err != nil {
+		return nil, err
+	}
+	return scanReviews(rows)
+}
+
+// RoomRating returns the average rating and number of approved reviews of a room
+func (m *sqliteDBRepo) RoomRating(ctx context.Context, roomID int) (float64, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var average float64
+	var count int
+	query := `SELECT COALESCE(AVG(rating), 0), COUNT(*) FROM reviews WHERE room_id = ? AND status = ?`
+
+	err := m.DB.QueryRowContext(ctx, query, roomID, models.ReviewApproved).Scan(&average, &count)
+	if err != nil {
+		return 0, 0, err
+	}
+	return average, count, nil
+}
+
+// GetPromoCodeByCode returns the promo code with code, in any case, or sql.ErrNoRows if there is none
+func (m *sqliteDBRepo) GetPromoCodeByCode(ctx context.Context, code string) (models.PromoCode, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	p, err := scanPromoCode(m.DB.QueryRowContext(ctx, promoCodeQuery+` WHERE pc.code = ?`, promo.NormalizeCode(code)))
+	if err != nil {
+		return p, err
+	}
+
+	codes := []models.PromoCode{p}
+	if err := loadPromoCodeRooms(ctx, m.DB, codes); err != nil {
+		return p, err
+	}
+	return codes[0], nil
+}
+
+// AllPromoCodes returns all promo codes with their usage, active ones first, newest first
+func (m *sqliteDBRepo) AllPromoCodes(ctx context.Context) ([]models.PromoCode, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, promoCodeQuery+` ORDER BY pc.active DESC, pc.created_at DESC, pc.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := scanPromoCodes(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadPromoCodeRooms(ctx, m.DB, codes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// InsertPromoCode inserts a promo code with its room restrictions and returns its id
+func (m *sqliteDBRepo) InsertPromoCode(ctx context.Context, p models.PromoCode) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO promo_codes (code, description, kind, amount, booking_start, booking_end, stay_start, stay_end,
+		min_nights, max_uses, max_uses_per_email, active, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	now := sqliteTime(time.Now())
+	result, err := tx.ExecContext(ctx, stmt, promo.NormalizeCode(p.Code), p.Description, p.Kind, p.Amount,
+		sqliteNullDate(p.BookingStart), sqliteNullDate(p.BookingEnd), sqliteNullDate(p.StayStart), sqliteNullDate(p.StayEnd),
+		p.MinNights, p.MaxUses, p.MaxUsesPerEmail, p.Active, now, now)
+	if err != nil {
+		return 0, err
+	}
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, roomID := range p.RoomIDs {
+		_, err := tx.ExecContext(ctx, `INSERT INTO promo_code_rooms (promo_code_id, room_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?)`, newID, roomID, now, now)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return int(newID), tx.Commit()
+}
+
+// SetPromoCodeActive enables or disables a promo code
+func (m *sqliteDBRepo) SetPromoCodeActive(ctx context.Context, id int, active bool) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE promo_codes SET active = ?, updated_at = ? WHERE id = ?`, active, sqliteTime(time.Now()), id)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
+
+// PromoCodeUses returns how often a promo code was redeemed, in total and by the email address
+func (m *sqliteDBRepo) PromoCodeUses(ctx context.Context, promoCodeID int, email string) (int, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	var total, byEmail int
+	query := `SELECT COUNT(*), COALESCE(SUM(email = ?), 0) FROM promo_redemptions WHERE promo_code_id = ?`
+
+	err := m.DB.QueryRowContext(ctx, query, promo.NormalizeEmail(email), promoCodeID).Scan(&total, &byEmail)
+	if err != nil {
+		return 0, 0, err
+	}
+	return total, byEmail, nil
+}
+
+// RedeemPromoCode records a promo code against a reservation and takes the discount off its total. It
+// returns false without changing anything if the code has meanwhile reached one of its usage limits; sqlite
+// has a single writer, so the check and the insert cannot interleave with another booking's.
+func (m *sqliteDBRepo) RedeemPromoCode(ctx context.Context, r models.PromoRedemption) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var maxUses, maxUsesPerEmail int
+	err = tx.QueryRowContext(ctx, `SELECT max_uses, max_uses_per_email FROM promo_codes WHERE id = ?`,
+		r.PromoCodeID).Scan(&maxUses, &maxUsesPerEmail)
+	if err != nil {
+		return false, err
+	}
+
+	email := promo.NormalizeEmail(r.Email)
+	var uses, usesByEmail int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(SUM(email = ?), 0) FROM promo_redemptions WHERE promo_code_id = ?`,
+		email, r.PromoCodeID).Scan(&uses, &usesByEmail)
+	if err != nil {
+		return false, err
+	}
+	if !usageAllows(maxUses, maxUsesPerEmail, uses, usesByEmail) {
+		return false, nil
+	}
+
+	now := sqliteTime(time.Now())
+	_, err = tx.ExecContext(ctx, `INSERT INTO promo_redemptions (promo_code_id, reservation_id, email, discount_cents, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?)`, r.PromoCodeID, r.ReservationID, email, r.DiscountCents, now, now)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE reservations SET discount_cents = ?, total_cents = subtotal_cents - ?, updated_at = ?
+	WHERE id = ?`, r.DiscountCents, r.DiscountCents, now, r.ReservationID)
+	if err != nil {
+		return false, err
+	}
+	if err := requireOneRow(result); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// GetCancellationPolicyByID returns a cancellation policy with its tiers, or sql.ErrNoRows
+func (m *sqliteDBRepo) GetCancellationPolicyByID(ctx context.Context, id int) (models.CancellationPolicy, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	p, err := scanCancellationPolicy(m.DB.QueryRowContext(ctx, cancellationPolicyQuery+` WHERE id = ?`, id))
+	if err != nil {
+		return p, err
+	}
+
+	policies := []models.CancellationPolicy{p}
+	if err := loadCancellationTiers(ctx, m.DB, policies); err != nil {
+		return p, err
+	}
+	return policies[0], nil
+}
+
+// AllCancellationPolicies returns all cancellation policies with their tiers, by name
+func (m *sqliteDBRepo) AllCancellationPolicies(ctx context.Context) ([]models.CancellationPolicy, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, cancellationPolicyQuery+` ORDER BY name, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []models.CancellationPolicy
+	for rows.Next() {
+		p, err := scanCancellationPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := loadCancellationTiers(ctx, m.DB, policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// InsertCancellationPolicy inserts a cancellation policy with its tiers and returns its id
+func (m *sqliteDBRepo) InsertCancellationPolicy(ctx context.Context, p models.CancellationPolicy) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := sqliteTime(time.Now())
+	result, err := tx.ExecContext(ctx, `INSERT INTO cancellation_policies (name, description, created_at, updated_at)
+	VALUES (?, ?, ?, ?)`, p.Name, p.Description, now, now)
+	if err != nil {
+		return 0, err
+	}
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, t := range p.Tiers {
+		_, err := tx.ExecContext(ctx, `INSERT INTO cancellation_policy_tiers (cancellation_policy_id, days_before, penalty_percent, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)`, newID, t.DaysBefore, t.PenaltyPercent, now, now)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return int(newID), tx.Commit()
+}
+
+// SetRoomCancellationPolicy sets the policy new reservations of a room are booked under
+func (m *sqliteDBRepo) SetRoomCancellationPolicy(ctx context.Context, roomID, policyID int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE rooms SET cancellation_policy_id = ?, updated_at = ? WHERE id = ?`,
+		policyID, sqliteTime(time.Now()), roomID)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
+
+// CancelReservation records the cancellation of a reservation with what the guest was charged and refunded,
+// and frees its room. It returns sql.ErrNoRows if there is no such reservation or it was already cancelled.
+func (m *sqliteDBRepo) CancelReservation(ctx context.Context, id int, at time.Time, penaltyCents, refundCents int) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE reservations SET cancelled_at = ?, penalty_cents = ?, refund_cents = ?, updated_at = ?
+	WHERE id = ? AND cancelled_at IS NULL`, sqliteTime(at), penaltyCents, refundCents, sqliteTime(time.Now()), id)
+	if err != nil {
+		return err
+	}
+	if err := requireOneRow(result); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM room_restrictions WHERE reservation_id = ?`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// sqliteGuestQuery is guestQuery with the latest arrival day, which sqlite already stores as YYYY-MM-DD
+var sqliteGuestQuery = fmt.Sprintf(guestQuery, `MAX(r.start_date)`)
+
+// AllGuests returns the guests whose email or name contains search, all of them if it is empty, by name
+func (m *sqliteDBRepo) AllGuests(ctx context.Context, search string) ([]models.Guest, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	pattern := guestSearchPattern(search)
+	query := sqliteGuestQuery + ` WHERE g.email LIKE ? OR lower(g.first_name || ' ' || g.last_name) LIKE ?
+		ORDER BY g.last_name, g.first_name, g.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, pattern, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return scanGuests(rows)
+}
+
+// GetGuestByID returns a guest, or sql.ErrNoRows if there is none
+func (m *sqliteDBRepo) GetGuestByID(ctx context.Context, id int) (models.Guest, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	return scanGuest(m.DB.QueryRowContext(ctx, sqliteGuestQuery+` WHERE g.id = ?`, id))
+}
+
+// ReservationsForGuest returns the reservations of a guest, including cancelled ones, latest arrival first
+func (m *sqliteDBRepo) ReservationsForGuest(ctx context.Context, guestID int) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, guestReservationQuery+` WHERE r.guest_id = ? ORDER BY r.start_date DESC, r.id DESC`, guestID)
+	if err != nil {
+		return nil, err
+	}
+	return scanGuestReservations(rows)
+}
+
+// UpdateGuestNotes replaces staff's notes on a guest. It returns sql.ErrNoRows if there is no such guest.
+func (m *sqliteDBRepo) UpdateGuestNotes(ctx context.Context, id int, notes string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE guests SET notes = ?, updated_at = ? WHERE id = ?`, notes, sqliteTime(time.Now()), id)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
+
+// AnonymizeGuest erases the personal data of a guest from their profile, their reservations, the promo
+// codes they redeemed and the webhook deliveries about their reservations. Dates, rooms and amounts are kept, so occupancy and revenue figures do not change.
+// It returns sql.ErrNoRows if there is no such guest or they were already anonymized.
+func (m *sqliteDBRepo) AnonymizeGuest(ctx context.Context, id int, at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := sqliteTime(time.Now())
+	result, err := tx.ExecContext(ctx, `UPDATE guests SET email = ?, first_name = ?, last_name = ?, phone = '', notes = '',
+		anonymized_at = ?, updated_at = ? WHERE id = ? AND anonymized_at IS NULL`,
+		guests.AnonymizedEmail(id), guests.AnonymizedFirstName, guests.AnonymizedLastName, sqliteTime(at), now, id)
+	if err != nil {
+		return err
+	}
+	if err := requireOneRow(result); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE reservations SET first_name = ?, last_name = ?, email = '', phone = '', updated_at = ?
+		WHERE guest_id = ?`, guests.AnonymizedFirstName, guests.AnonymizedLastName, now, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE promo_redemptions SET email = '', updated_at = ?
+		WHERE reservation_id IN (SELECT id FROM reservations WHERE guest_id = ?)`, now, id)
+	if err != nil {
+		return err
+	}
+
+	err = redactWebhookDeliveries(ctx, tx, `SELECT id FROM reservations WHERE guest_id = ?`, id,
+		`UPDATE webhook_deliveries SET payload = ?, updated_at = ? WHERE id = ?`, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// NotificationPreferences returns the notification preferences of the guest with the email, by kind and
+// channel. There are none if the guest has not chosen any, or if there is no such guest.
+func (m *sqliteDBRepo) NotificationPreferences(ctx context.Context, email string) ([]models.NotificationPreference, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT p.kind, p.channel, p.enabled FROM guest_notification_preferences p
+		JOIN guests g ON g.id = p.guest_id WHERE g.email = ? ORDER BY p.kind, p.channel`, guests.NormalizeEmail(email))
+	if err != nil {
+		return nil, err
+	}
+	return scanNotificationPreferences(rows)
+}
+
+// SetNotificationPreferences replaces the notification preferences of a guest. It returns sql.ErrNoRows if
+// there is no such guest.
+func (m *sqliteDBRepo) SetNotificationPreferences(ctx context.Context, guestID int, prefs []models.NotificationPreference) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE guests SET updated_at = ? WHERE id = ?`, sqliteTime(time.Now()), guestID)
+	if err != nil {
+		return err
+	}
+	if err := requireOneRow(result); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM guest_notification_preferences WHERE guest_id = ?`, guestID); err != nil {
+		return err
+	}
+	for _, p := range prefs {
+		_, err := tx.ExecContext(ctx, `INSERT INTO guest_notification_preferences (guest_id, kind, channel, enabled, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)`, guestID, p.Kind, p.Channel, p.Enabled, sqliteTime(time.Now()), sqliteTime(time.Now()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// sqliteNullTime is nullTime in the sqlite timestamp format
+func sqliteNullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return sqliteTime(t)
+}
+
+// AllWebhookEndpoints returns the webhook endpoints, active ones first, newest first
+func (m *sqliteDBRepo) AllWebhookEndpoints(ctx context.Context) ([]models.WebhookEndpoint, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, webhookEndpointQuery+` ORDER BY active DESC, created_at DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookEndpoints(rows)
+}
+
+// InsertWebhookEndpoint inserts a webhook endpoint and returns its id
+func (m *sqliteDBRepo) InsertWebhookEndpoint(ctx context.Context, e models.WebhookEndpoint) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	now := sqliteTime(time.Now())
+	result, err := m.DB.ExecContext(ctx, `INSERT INTO webhook_endpoints (url, secret, events, active, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?)`, e.URL, e.Secret, joinWebhookEvents(e.Events), e.Active, now, now)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// SetWebhookEndpointActive enables or disables a webhook endpoint
+func (m *sqliteDBRepo) SetWebhookEndpointActive(ctx context.Context, id int, active bool) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE webhook_endpoints SET active = ?, updated_at = ? WHERE id = ?`, active, sqliteTime(time.Now()), id)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
+
+// QueueWebhookDeliveries queues payload for every active endpoint subscribed to event, due at, and returns
+// how many deliveries were queued
+func (m *sqliteDBRepo) QueueWebhookDeliveries(ctx context.Context, event, payload string, at time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	now := sqliteTime(at)
+	stmt := `INSERT INTO webhook_deliveries (webhook_endpoint_id, event, payload, status, attempts, next_attempt_at, created_at, updated_at)
+	SELECT id, ?, ?, ?, 0, ?, ?, ? FROM webhook_endpoints
+	WHERE active AND ',' || events || ',' LIKE '%,' || ? || ',%'`
+
+	result, err := m.DB.ExecContext(ctx, stmt, event, payload, models.WebhookPending, now, now, now, event)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// DueWebhookDeliveries returns up to limit pending deliveries whose next attempt is due at now, oldest first.
+// Deliveries to disabled endpoints wait until the endpoint is enabled again.
+func (m *sqliteDBRepo) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, webhookDeliveryQuery+` WHERE d.status = ? AND d.next_attempt_at <= ? AND e.active
+		ORDER BY d.next_attempt_at, d.id LIMIT ?`, models.WebhookPending, sqliteTime(now), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+// ClaimWebhookDelivery counts an attempt of a pending delivery that has been tried attempts times so far
+// and holds it until the given time. It returns sql.ErrNoRows if it was claimed first.
+func (m *sqliteDBRepo) ClaimWebhookDelivery(ctx context.Context, id, attempts int, until time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = ?, updated_at = ?
+		WHERE id = ? AND status = ? AND attempts = ?`, sqliteTime(until), sqliteTime(time.Now()), id, models.WebhookPending, attempts)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
+
+// SaveWebhookAttempt stores the outcome of an attempt: the delivery's status, next attempt and the response
+func (m *sqliteDBRepo) SaveWebhookAttempt(ctx context.Context, d models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE webhook_deliveries SET status = ?, next_attempt_at = ?, last_status_code = ?,
+		last_error = ?, delivered_at = ?, updated_at = ? WHERE id = ?`,
+		d.Status, sqliteTime(d.NextAttemptAt), d.LastStatusCode, d.LastError, sqliteNullTime(d.DeliveredAt), sqliteTime(time.Now()), d.ID)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
+
+// WebhookDeliveries returns the latest limit deliveries with the status, or of any status if it is empty
+func (m *sqliteDBRepo) WebhookDeliveries(ctx context.Context, status string, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, webhookDeliveryQuery+` WHERE (? = '' OR d.status = ?)
+		ORDER BY d.created_at DESC, d.id DESC LIMIT ?`, status, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhookDeliveries(rows)
+}
+
+// RedeliverWebhook sends a delivery again from its first attempt, due at the given time
+func (m *sqliteDBRepo) RedeliverWebhook(ctx context.Context, id int, at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(m.App))
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = ?, updated_at = ?
+		WHERE id = ?`, models.WebhookPending, sqliteTime(at), sqliteTime(time.Now()), id)
+	if err != nil {
+		return err
+	}
+	return requireOneRow(result)
+}
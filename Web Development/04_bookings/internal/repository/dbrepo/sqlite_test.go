@@ -0,0 +1,108 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/ashparshp/bookings"
+	"github.com/ashparshp/bookings/internal/driver"
+	"github.com/ashparshp/bookings/internal/migrate"
+)
+
+// The behaviour shared with the other repositories is tested in contract_test.go
+
+// sqlitePath is the file a sqlite test database was opened from
+func sqlitePath(t *testing.T, db *driver.DB) string {
+	t.Helper()
+	path := ""
+	if err := db.SQL.QueryRow(`SELECT file FROM pragma_database_list WHERE name = 'main'`).Scan(&path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSqliteDBRepo_LinksOldReservationsToGuests(t *testing.T) {
+	ctx := context.Background()
+	_, db := newSqliteTestRepo(t)
+	migrations, err := migrate.Load(bookings.Migrations(), migrate.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := migrate.NewSQLite(db.SQL, migrations)
+
+	// roll back to before there were guests, as a database made back then would be
+	for {
+		done, err := m.Down(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done[0].Name == "create_guests_table" {
+			break
+		}
+	}
+	if _, err := db.SQL.Exec(`INSERT INTO reservations (first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at)
+		VALUES ('Cleo', 'Ray', 'Cleo@Example.com ', '', '2024-01-01', '2024-01-03', 1, '2024-01-01', '2024-01-01')`); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopening the file brings it up to date, linking the reservation to a new guest
+	path := sqlitePath(t, db)
+	db.SQL.Close()
+	reopened, err := driver.ConnectSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.SQL.Close()
+
+	var guestID sql.NullInt64
+	var email string
+	err = reopened.SQL.QueryRow(`SELECT r.guest_id, g.email FROM reservations r JOIN guests g ON g.id = r.guest_id WHERE r.first_name = 'Cleo'`).Scan(&guestID, &email)
+	if err != nil || !guestID.Valid || email != "cleo@example.com" {
+		t.Errorf("expected the old reservation to be linked to a new guest, got %v, %q, %v", guestID, email, err)
+	}
+}
+
+func TestConnectSQLite_Unmigrated(t *testing.T) {
+	// a file the server created before sqlite databases were migrated has the tables but no schema_migration
+	_, db := newSqliteTestRepo(t)
+	path := sqlitePath(t, db)
+	if _, err := db.SQL.Exec(`DROP TABLE schema_migration`); err != nil {
+		t.Fatal(err)
+	}
+	db.SQL.Close()
+
+	reopened, err := driver.ConnectSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rooms, users, versions int
+	reopened.SQL.QueryRow(`SELECT COUNT(*) FROM rooms`).Scan(&rooms)
+	reopened.SQL.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&users)
+	reopened.SQL.QueryRow(`SELECT COUNT(*) FROM schema_migration`).Scan(&versions)
+	if rooms != 2 || users != 1 || versions == 0 {
+		t.Errorf("expected the migrations recorded without seeding again, got %d rooms, %d users and %d versions", rooms, users, versions)
+	}
+
+	// one older than any the migrations can take over is refused
+	if _, err := reopened.SQL.Exec(`DROP TABLE schema_migration; DROP TABLE guest_notification_preferences`); err != nil {
+		t.Fatal(err)
+	}
+	reopened.SQL.Close()
+	if db, err := driver.ConnectSQLite(path); err == nil {
+		db.SQL.Close()
+		t.Error("expected an error for a database too old to migrate")
+	}
+
+	// a new file is migrated from scratch
+	fresh, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "fresh.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fresh.SQL.Close()
+	fresh.SQL.QueryRow(`SELECT COUNT(*) FROM rooms`).Scan(&rooms)
+	if rooms != 2 {
+		t.Errorf("expected the seeded rooms, got %d", rooms)
+	}
+}
@@ -1,109 +1,823 @@
 package dbrepo
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/ashparshp/bookings/internal/models"
 )
 
-func (m *testDBRepo) AllUsers() bool {
+func (m *testDBRepo) AllUsers(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
 	return true
 }
 
 // InsertReservation inserts a reservation into the database
-func (m *testDBRepo) InsertReservation(res models.Reservation) (int, error) {
+func (m *testDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
 	return 1, nil
 }
 
 // InsertRoomRestriction inserts a room restriction into the database
-func (m *testDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
+func (m *testDBRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return nil
 }
 
 // SearchAvailabilityByDatesByRoomID returns true if there are available rooms for the given dates
-func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
+func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 	return false, nil
 }
 
 // SearchAvailabilityForAllRooms returns a slice of available rooms for the given dates
-func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+func (m *testDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	var rooms []models.Room
 	return rooms, nil
 }
 
+// RoomOccupancy returns General's Quarters booked for the whole period and Major's Suite free
+func (m *testDBRepo) RoomOccupancy(ctx context.Context, start, end time.Time) ([]models.RoomOccupancy, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if start.Year() > 2100 {
+		return nil, errors.New("some error")
+	}
+	rooms := []models.RoomOccupancy{
+		{
+			Room: models.Room{ID: 1, RoomName: "General's Quarters"},
+			Busy: []models.RoomRestriction{{ID: 1, StartDate: start, EndDate: end, RoomID: 1, ReservationID: 1, RestrictionID: 1}},
+		},
+		{Room: models.Room{ID: 2, RoomName: "Major's Suite"}},
+	}
+	return rooms, nil
+}
+
 // GetRoomByID returns a room by its ID
-func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
+func (m *testDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Room{}, err
+	}
 	var room models.Room
 	if id > 2 {
 		return room, errors.New("some error")
 	}
+	room.ID = id
+	room.PriceCents = 12000
+	room.CancellationPolicyID = 1
 	return room, nil
 }
 
 // GetUserByID returns a user by its ID
-func (m *testDBRepo) GetUserByID(id int) (models.User, error) {
-	var user models.User
+func (m *testDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return models.User{}, err
+	}
+	// user 1 is the seeded administrator
+	user := models.User{ID: id, AccessLevel: 1}
+	if id == 1 {
+		user.AccessLevel = 3
+	}
 	return user, nil
 }
 
 // UpdateUser updates a user in the database
-func (m *testDBRepo) UpdateUser(u models.User) error {
+func (m *testDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return nil
 }
 
 // AuthenticateUser authenticates a user by email and password
-func (m *testDBRepo) AuthenticateUser(email, testPassword string) (int, string, error) {
+func (m *testDBRepo) AuthenticateUser(ctx context.Context, email, testPassword string) (int, string, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, "", err
+	}
 	return 1, "", nil
 }
 
 // AllReservations returns all reservations
-func (m *testDBRepo) AllReservations() ([]models.Reservation, error) {
+func (m *testDBRepo) AllReservations(ctx context.Context) ([]models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	var reservations []models.Reservation
 	return reservations, nil
 }
 
 // AllNewReservations returns all new reservations
-func (m *testDBRepo) AllNewReservations() ([]models.Reservation, error) {
+func (m *testDBRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	var reservations []models.Reservation
 	return reservations, nil
 }
 
 // GetReservationByID returns a reservation by its ID
-func (m *testDBRepo) GetReservationByID(id int) (models.Reservation, error) {
-	var res models.Reservation
+func (m *testDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Reservation{}, err
+	}
+	// reservation 2 is a stay that has not ended yet, ids over 1000 do not exist
+	if id > 1000 {
+		return models.Reservation{}, errors.New("some error")
+	}
+	res := models.Reservation{
+		ID:        id,
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@example.com",
+		StartDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC),
+		RoomID:    1,
+		GuestID:   1,
+		Room:      models.Room{ID: 1, RoomName: "General's Quarters"},
+	}
+	if id == 2 {
+		res.StartDate = time.Now().AddDate(0, 0, 1)
+		res.EndDate = time.Now().AddDate(0, 0, 3)
+		res.SubtotalCents = 24000
+		res.TotalCents = 24000
+		res.CancellationPolicyID = 1
+	}
+	// reservation 4 was cancelled
+	if id == 4 {
+		res.TotalCents = 24000
+		res.CancellationPolicyID = 1
+		res.CancelledAt = time.Date(2019, 12, 30, 10, 0, 0, 0, time.UTC)
+		res.PenaltyCents = 12000
+		res.RefundCents = 12000
+	}
 	return res, nil
 }
 
 // UpdateReservation updates a reservation in the database
-func (m *testDBRepo) UpdateReservation(u models.Reservation, id int) error {
+func (m *testDBRepo) UpdateReservation(ctx context.Context, u models.Reservation, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return nil
 }
 
 // DeleteReservation deletes a reservation from the database
-func (m *testDBRepo) DeleteReservation(id int) error {
+func (m *testDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return nil
 }
 
 // UpdateProcessedForReservation updates the processed status for a reservation
-func (m *testDBRepo) UpdateProcessedForReservation(id, processed int) error {
+func (m *testDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return nil
 }
 
-func (m *testDBRepo) AllRooms() ([]models.Room, error) {
-	var rooms []models.Room
+func (m *testDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rooms := []models.Room{
+		{ID: 1, RoomName: "General's Quarters"},
+		{ID: 2, RoomName: "Major's Suite"},
+	}
 	return rooms, nil
 }
 
-func (m *testDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error){
+// GetRestrictionsForRoomByDate returns, for General's Quarters in January 2050, reservation 1 from the 10th
+// to the 12th and block 2 on the 20th
+func (m *testDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error){
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	var restrictions []models.RoomRestriction
+	if roomID == 1 && start.Year() == 2050 && start.Month() == time.January {
+		restrictions = []models.RoomRestriction{
+			{ID: 1, StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC), RoomID: 1, ReservationID: 1, RestrictionID: 1},
+			{ID: 2, StartDate: time.Date(2050, 1, 20, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2050, 1, 21, 0, 0, 0, 0, time.UTC), RoomID: 1, RestrictionID: 2},
+		}
+	}
 	return restrictions, nil
 }
 
-func (m *testDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+func (m *testDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *testDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return nil
+}
+func (m *testDBRepo) ListUsers(ctx context.Context) ([]models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	users := []models.User{
+		{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com", AccessLevel: 3},
+		{ID: 2, FirstName: "Staff", LastName: "User", Email: "staff@example.com", AccessLevel: 1},
+	}
+	return users, nil
+}
+
+func (m *testDBRepo) GetSession(ctx context.Context, token string) (models.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Session{}, err
+	}
+	return models.Session{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) SaveSession(ctx context.Context, s models.Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *testDBRepo) TouchSession(ctx context.Context, token, ip, userAgent string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *testDBRepo) DeleteSession(ctx context.Context, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *testDBRepo) DeleteExpiredSessions(ctx context.Context, now time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+func (m *testDBRepo) ActiveSessionsForUser(ctx context.Context, userID int, now time.Time) ([]models.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if userID > 2 {
+		return nil, errors.New("some error")
+	}
+	sessions := []models.Session{
+		{Token: "current", UserID: userID, IPAddress: "192.0.2.1", UserAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/605.1.15 Version/17.0 Safari/605.1.15", LastActivity: now},
+		{Token: "other", UserID: userID, IPAddress: "198.51.100.7", UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0 Safari/537.36", LastActivity: now.Add(-time.Hour)},
+	}
+	return sessions, nil
+}
+
+func (m *testDBRepo) ActiveSessionCounts(ctx context.Context, now time.Time) (map[int]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return map[int]int{1: 2}, nil
+}
+
+func (m *testDBRepo) DeleteUserSession(ctx context.Context, userID int, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *testDBRepo) DeleteUserSessions(ctx context.Context, userID int, exceptToken string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if userID > 2 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) ArrivalsAwaitingEmail(ctx context.Context, kind string, from, to time.Time) ([]models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return []models.Reservation{}, nil
+}
+
+func (m *testDBRepo) DeparturesAwaitingEmail(ctx context.Context, kind string, from, to time.Time) ([]models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return []models.Reservation{}, nil
+}
+
+func (m *testDBRepo) RecordReservationEmail(ctx context.Context, reservationID int, kind string, at time.Time) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (m *testDBRepo) InsertReview(ctx context.Context, rv models.Review) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// testReview returns the review the test repository knows for id
+func testReview(id int) models.Review {
+	return models.Review{
+		ID:            id,
+		ReservationID: 3,
+		RoomID:        1,
+		Rating:        5,
+		Body:          "Lovely view of the ocean",
+		Status:        models.ReviewPending,
+		Room:          models.Room{ID: 1, RoomName: "General's Quarters"},
+		Reservation:   models.Reservation{ID: 3, FirstName: "John", LastName: "Smith"},
+	}
+}
+
+func (m *testDBRepo) GetReviewByID(ctx context.Context, id int) (models.Review, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Review{}, err
+	}
+	if id > 2 {
+		return models.Review{}, sql.ErrNoRows
+	}
+	return testReview(id), nil
+}
+
+// GetReviewByReservationID knows a review for reservation 3 only
+func (m *testDBRepo) GetReviewByReservationID(ctx context.Context, reservationID int) (models.Review, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Review{}, err
+	}
+	if reservationID != 3 {
+		return models.Review{}, sql.ErrNoRows
+	}
+	return testReview(1), nil
+}
+
+func (m *testDBRepo) AllReviews(ctx context.Context, status string) ([]models.Review, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	approved := testReview(2)
+	approved.Status = models.ReviewApproved
+	approved.Reply = "Thank you, come again!"
+	reviews := []models.Review{testReview(1), approved}
+	if status == "" {
+		return reviews, nil
+	}
+	var filtered []models.Review
+	for _, rv := range reviews {
+		if rv.Status == status {
+			filtered = append(filtered, rv)
+		}
+	}
+	return filtered, nil
+}
+
+func (m *testDBRepo) UpdateReviewStatus(ctx context.Context, id int, status string, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id > 2 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *testDBRepo) ReplyToReview(ctx context.Context, id int, reply string, userID int, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id > 2 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ApprovedReviewsForRoom has reviews for room 1 only
+func (m *testDBRepo) ApprovedReviewsForRoom(ctx context.Context, roomID int) ([]models.Review, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if roomID != 1 {
+		return nil, nil
+	}
+	return m.AllReviews(ctx, models.ReviewApproved)
+}
+
+func (m *testDBRepo) RoomRating(ctx context.Context, roomID int) (float64, int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	if roomID != 1 {
+		return 0, 0, nil
+	}
+	return 4.5, 2, nil
+}
+
+// testPromoCodes are the codes the test repository knows: SUMMER applies to any stay, ROOM2 only to room 2,
+// OLD is inactive, LIMITED is used up and ERROR fails to redeem
+func testPromoCodes() []models.PromoCode {
+	return []models.PromoCode{
+		{ID: 1, Code: "SUMMER", Description: "Summer sale", Kind: models.PromoPercent, Amount: 10, Active: true, Uses: 3, DiscountCents: 7200},
+		{ID: 2, Code: "ROOM2", Kind: models.PromoFixed, Amount: 2500, RoomIDs: []int{2}, Active: true},
+		{ID: 3, Code: "OLD", Kind: models.PromoFixed, Amount: 1000},
+		{ID: 4, Code: "LIMITED", Kind: models.PromoPercent, Amount: 50, MaxUses: 1, Active: true, Uses: 1, DiscountCents: 6000},
+		{ID: 5, Code: "ERROR", Kind: models.PromoPercent, Amount: 5, Active: true},
+	}
+}
+
+// GetPromoCodeByCode returns one of testPromoCodes, or sql.ErrNoRows
+func (m *testDBRepo) GetPromoCodeByCode(ctx context.Context, code string) (models.PromoCode, error) {
+	if err := ctx.Err(); err != nil {
+		return models.PromoCode{}, err
+	}
+	for _, p := range testPromoCodes() {
+		if p.Code == strings.ToUpper(strings.TrimSpace(code)) {
+			return p, nil
+		}
+	}
+	return models.PromoCode{}, sql.ErrNoRows
+}
+
+// AllPromoCodes returns testPromoCodes
+func (m *testDBRepo) AllPromoCodes(ctx context.Context) ([]models.PromoCode, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return testPromoCodes(), nil
+}
+
+// InsertPromoCode fails for the code FAIL
+func (m *testDBRepo) InsertPromoCode(ctx context.Context, p models.PromoCode) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if p.Code == "FAIL" {
+		return 0, errors.New("some error")
+	}
+	return 6, nil
+}
+
+// SetPromoCodeActive fails for codes that do not exist
+func (m *testDBRepo) SetPromoCodeActive(ctx context.Context, id int, active bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id > len(testPromoCodes()) {
+		return sql.ErrNoRows
+	}
 	return nil
 }
 
-func (m *testDBRepo) DeleteBlockByID(id int) error {
+// PromoCodeUses returns the uses of testPromoCodes, none of them by the guest
+func (m *testDBRepo) PromoCodeUses(ctx context.Context, promoCodeID int, email string) (int, int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	for _, p := range testPromoCodes() {
+		if p.ID == promoCodeID {
+			return p.Uses, 0, nil
+		}
+	}
+	return 0, 0, nil
+}
+
+// RedeemPromoCode succeeds except for the code ERROR
+func (m *testDBRepo) RedeemPromoCode(ctx context.Context, r models.PromoRedemption) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if r.PromoCodeID == 5 {
+		return false, errors.New("some error")
+	}
+	return true, nil
+}
+
+// testCancellationPolicy is the only cancellation policy of the test repository, with id 1
+func testCancellationPolicy() models.CancellationPolicy {
+	return models.CancellationPolicy{
+		ID:    1,
+		Name:  "Standard",
+		Tiers: []models.CancellationTier{{DaysBefore: 7, PenaltyPercent: 0}, {DaysBefore: 0, PenaltyPercent: 50}},
+	}
+}
+
+// GetCancellationPolicyByID returns testCancellationPolicy, or sql.ErrNoRows for any other id
+func (m *testDBRepo) GetCancellationPolicyByID(ctx context.Context, id int) (models.CancellationPolicy, error) {
+	if err := ctx.Err(); err != nil {
+		return models.CancellationPolicy{}, err
+	}
+	if id != 1 {
+		return models.CancellationPolicy{}, sql.ErrNoRows
+	}
+	return testCancellationPolicy(), nil
+}
+
+// AllCancellationPolicies returns testCancellationPolicy
+func (m *testDBRepo) AllCancellationPolicies(ctx context.Context) ([]models.CancellationPolicy, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return []models.CancellationPolicy{testCancellationPolicy()}, nil
+}
+
+// InsertCancellationPolicy fails for a policy named FAIL
+func (m *testDBRepo) InsertCancellationPolicy(ctx context.Context, p models.CancellationPolicy) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if p.Name == "FAIL" {
+		return 0, errors.New("some error")
+	}
+	return 2, nil
+}
+
+// SetRoomCancellationPolicy returns sql.ErrNoRows for rooms other than 1 and 2
+func (m *testDBRepo) SetRoomCancellationPolicy(ctx context.Context, roomID, policyID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if roomID < 1 || roomID > 2 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CancelReservation returns sql.ErrNoRows for reservation 4, which is already cancelled
+func (m *testDBRepo) CancelReservation(ctx context.Context, id int, at time.Time, penaltyCents, refundCents int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id == 4 {
+		return sql.ErrNoRows
+	}
+	if id > 1000 {
+		return errors.New("some error")
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+// testGuest returns one of the guests of the test repository: 1 has stayed before, 2 has a stay that has
+// not ended yet and 3 was anonymized
+func testGuest(id int) models.Guest {
+	g := models.Guest{
+		ID:        id,
+		Email:     "john@example.com",
+		FirstName: "John",
+		LastName:  "Smith",
+		Phone:     "555-0100",
+		Notes:     "Prefers a quiet room",
+		CreatedAt: time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC),
+		Stays:     1,
+		LastStay:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	switch id {
+	case 2:
+		g.Email, g.FirstName, g.LastName, g.Notes = "jane@example.com", "Jane", "Doe", ""
+		g.LastStay = time.Now().AddDate(0, 0, 1)
+	case 3:
+		g.Email, g.FirstName, g.LastName, g.Phone, g.Notes = "anonymized-3@guests.invalid", "Anonymized", "Guest", "", ""
+		g.AnonymizedAt = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return g
+}
+
+// AllGuests returns the test guests, or an error when searching for FAIL
+func (m *testDBRepo) AllGuests(ctx context.Context, search string) ([]models.Guest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if search == "FAIL" {
+		return nil, errors.New("some error")
+	}
+	return []models.Guest{testGuest(1), testGuest(2), testGuest(3)}, nil
+}
+
+// GetGuestByID returns testGuest for ids 1 to 3, an error for ids over 1000 and sql.ErrNoRows otherwise
+func (m *testDBRepo) GetGuestByID(ctx context.Context, id int) (models.Guest, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Guest{}, err
+	}
+	if id > 1000 {
+		return models.Guest{}, errors.New("some error")
+	}
+	if id < 1 || id > 3 {
+		return models.Guest{}, sql.ErrNoRows
+	}
+	return testGuest(id), nil
+}
+
+// ReservationsForGuest returns a past stay and a cancelled one for guest 1, a stay that has not ended yet
+// for guest 2 and an anonymized stay for guest 3
+func (m *testDBRepo) ReservationsForGuest(ctx context.Context, guestID int) ([]models.Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	room := models.Room{ID: 1, RoomName: "General's Quarters"}
+	switch guestID {
+	case 1:
+		return []models.Reservation{
+			{ID: 4, FirstName: "John", LastName: "Smith", Email: "john@example.com", GuestID: 1, RoomID: 1, Room: room,
+				StartDate: time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC),
+				TotalCents: 24000, CancelledAt: time.Date(2019, 12, 30, 10, 0, 0, 0, time.UTC), PenaltyCents: 12000, RefundCents: 12000},
+			{ID: 3, FirstName: "John", LastName: "Smith", Email: "John@Example.com", GuestID: 1, RoomID: 1, Room: room,
+				StartDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC),
+				SubtotalCents: 24000, TotalCents: 24000, Locale: "en"},
+		}, nil
+	case 2:
+		return []models.Reservation{
+			{ID: 2, FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", GuestID: 2, RoomID: 1, Room: room,
+				StartDate: time.Now().AddDate(0, 0, 1), EndDate: time.Now().AddDate(0, 0, 3), TotalCents: 24000},
+		}, nil
+	case 3:
+		return []models.Reservation{
+			{ID: 5, FirstName: "Anonymized", LastName: "Guest", GuestID: 3, RoomID: 1, Room: room,
+				StartDate: time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2019, 6, 4, 0, 0, 0, 0, time.UTC), TotalCents: 36000},
+		}, nil
+	}
+	if guestID > 1000 {
+		return nil, errors.New("some error")
+	}
+	return nil, nil
+}
+
+// UpdateGuestNotes returns sql.ErrNoRows for guests other than 1 to 3
+func (m *testDBRepo) UpdateGuestNotes(ctx context.Context, id int, notes string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id < 1 || id > 3 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AnonymizeGuest returns sql.ErrNoRows for guest 3, which is already anonymized
+func (m *testDBRepo) AnonymizeGuest(ctx context.Context, id int, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id == 3 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// NotificationPreferences returns text messages on the day of check-in for john@example.com, an error for
+// fail@example.com and none for other guests
+func (m *testDBRepo) NotificationPreferences(ctx context.Context, email string) ([]models.NotificationPreference, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	switch email {
+	case "fail@example.com":
+		return nil, errors.New("some error")
+	case "john@example.com":
+		return []models.NotificationPreference{{Kind: models.NotifyCheckIn, Channel: models.ChannelSMS, Enabled: true}}, nil
+	}
+	return nil, nil
+}
+
+// SetNotificationPreferences returns sql.ErrNoRows for guests other than 1 to 3
+func (m *testDBRepo) SetNotificationPreferences(ctx context.Context, guestID int, prefs []models.NotificationPreference) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if guestID < 1 || guestID > 3 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// testWebhookEndpoints are an active endpoint subscribed to every event and a disabled one
+func testWebhookEndpoints() []models.WebhookEndpoint {
+	return []models.WebhookEndpoint{
+		{ID: 1, URL: "https://hooks.example.com/bookings", Secret: "test webhook secret", Active: true,
+			Events: []string{"reservation.created", "reservation.updated", "reservation.processed", "reservation.cancelled", "block.added", "block.removed"}},
+		{ID: 2, URL: "https://old.example.com/hook", Secret: "old webhook secret", Events: []string{"reservation.created"}},
+	}
+}
+
+// testWebhookDeliveries are a delivered, a failed and a pending delivery to the first endpoint
+func testWebhookDeliveries() []models.WebhookDelivery {
+	endpoint := testWebhookEndpoints()[0]
+	at := time.Date(2025, 7, 10, 9, 0, 0, 0, time.UTC)
+	return []models.WebhookDelivery{
+		{ID: 1, EndpointID: 1, Event: "reservation.created", Payload: `{"event":"reservation.created"}`, Status: models.WebhookDelivered,
+			Attempts: 1, LastStatusCode: 200, DeliveredAt: at, CreatedAt: at, Endpoint: endpoint},
+		{ID: 2, EndpointID: 1, Event: "block.added", Payload: `{"event":"block.added"}`, Status: models.WebhookFailed,
+			Attempts: 7, LastStatusCode: 500, LastError: "500 Internal Server Error", CreatedAt: at, Endpoint: endpoint},
+		{ID: 3, EndpointID: 1, Event: "reservation.updated", Payload: `{"event":"reservation.updated"}`, Status: models.WebhookPending,
+			Attempts: 2, LastError: "connection refused", NextAttemptAt: at.Add(30 * time.Minute), CreatedAt: at, Endpoint: endpoint},
+	}
+}
+
+// AllWebhookEndpoints returns testWebhookEndpoints
+func (m *testDBRepo) AllWebhookEndpoints(ctx context.Context) ([]models.WebhookEndpoint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return testWebhookEndpoints(), nil
+}
+
+// InsertWebhookEndpoint fails for endpoints on fail.example.com
+func (m *testDBRepo) InsertWebhookEndpoint(ctx context.Context, e models.WebhookEndpoint) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if strings.Contains(e.URL, "fail.example.com") {
+		return 0, errors.New("some error")
+	}
+	return 3, nil
+}
+
+// SetWebhookEndpointActive returns sql.ErrNoRows for endpoints that do not exist
+func (m *testDBRepo) SetWebhookEndpointActive(ctx context.Context, id int, active bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id < 1 || id > len(testWebhookEndpoints()) {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// QueueWebhookDeliveries queues every event for the one active endpoint
+func (m *testDBRepo) QueueWebhookDeliveries(ctx context.Context, event, payload string, at time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// DueWebhookDeliveries returns no deliveries
+func (m *testDBRepo) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// ClaimWebhookDelivery always succeeds
+func (m *testDBRepo) ClaimWebhookDelivery(ctx context.Context, id, attempts int, until time.Time) error {
+	return ctx.Err()
+}
+
+// SaveWebhookAttempt always succeeds
+func (m *testDBRepo) SaveWebhookAttempt(ctx context.Context, d models.WebhookDelivery) error {
+	return ctx.Err()
+}
+
+// WebhookDeliveries returns the testWebhookDeliveries with the status and fails for the status "FAIL"
+func (m *testDBRepo) WebhookDeliveries(ctx context.Context, status string, limit int) ([]models.WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if status == "FAIL" {
+		return nil, errors.New("some error")
+	}
+	var deliveries []models.WebhookDelivery
+	for _, d := range testWebhookDeliveries() {
+		if status == "" || d.Status == status {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+// RedeliverWebhook returns sql.ErrNoRows for deliveries that do not exist
+func (m *testDBRepo) RedeliverWebhook(ctx context.Context, id int, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if id < 1 || id > len(testWebhookDeliveries()) {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -1,30 +1,88 @@
 package repository
 
 import (
+	"context"
 	"time"
 
 	"github.com/ashparshp/bookings/internal/models"
 )
 type DatabaseRepo interface {
-	AllUsers() bool
-
-	InsertReservation(res models.Reservation) (int, error)
-	InsertRoomRestriction(r models.RoomRestriction) error
-	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
-	GetRoomByID(id int) (models.Room, error)
-	GetUserByID(id int) (models.User, error)
-	UpdateUser(u models.User) error
-	AuthenticateUser(email, testPassword string) (int, string, error)
-	AllReservations() ([]models.Reservation, error)
-	AllNewReservations() ([]models.Reservation, error)
-	GetReservationByID(id int) (models.Reservation, error)
-	UpdateReservation(u models.Reservation, id int) error
-	DeleteReservation(id int) error
-	UpdateProcessedForReservation(id, processed int) error
-	AllRooms() ([]models.Room, error)
-	GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
-	InsertBlockForRoom(id int, stratDate time.Time) error
-	DeleteBlockByID(id int) error
+	AllUsers(ctx context.Context) bool
+
+	InsertReservation(ctx context.Context, res models.Reservation) (int, error)
+	InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error
+	SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error)
+	SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error)
+	RoomOccupancy(ctx context.Context, start, end time.Time) ([]models.RoomOccupancy, error)
+	GetRoomByID(ctx context.Context, id int) (models.Room, error)
+	GetUserByID(ctx context.Context, id int) (models.User, error)
+	UpdateUser(ctx context.Context, u models.User) error
+	AuthenticateUser(ctx context.Context, email, testPassword string) (int, string, error)
+	AllReservations(ctx context.Context) ([]models.Reservation, error)
+	AllNewReservations(ctx context.Context) ([]models.Reservation, error)
+	GetReservationByID(ctx context.Context, id int) (models.Reservation, error)
+	UpdateReservation(ctx context.Context, u models.Reservation, id int) error
+	DeleteReservation(ctx context.Context, id int) error
+	UpdateProcessedForReservation(ctx context.Context, id, processed int) error
+	AllRooms(ctx context.Context) ([]models.Room, error)
+	GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+	InsertBlockForRoom(ctx context.Context, id int, stratDate time.Time) error
+	DeleteBlockByID(ctx context.Context, id int) error
+
+	ListUsers(ctx context.Context) ([]models.User, error)
+
+	GetSession(ctx context.Context, token string) (models.Session, error)
+	SaveSession(ctx context.Context, s models.Session) error
+	TouchSession(ctx context.Context, token, ip, userAgent string, at time.Time) error
+	DeleteSession(ctx context.Context, token string) error
+	DeleteExpiredSessions(ctx context.Context, now time.Time) (int64, error)
+	ActiveSessionsForUser(ctx context.Context, userID int, now time.Time) ([]models.Session, error)
+	ActiveSessionCounts(ctx context.Context, now time.Time) (map[int]int, error)
+	DeleteUserSession(ctx context.Context, userID int, token string) error
+	DeleteUserSessions(ctx context.Context, userID int, exceptToken string) (int64, error)
+
+	ArrivalsAwaitingEmail(ctx context.Context, kind string, from, to time.Time) ([]models.Reservation, error)
+	DeparturesAwaitingEmail(ctx context.Context, kind string, from, to time.Time) ([]models.Reservation, error)
+	RecordReservationEmail(ctx context.Context, reservationID int, kind string, at time.Time) (bool, error)
+
+	InsertReview(ctx context.Context, rv models.Review) (int, error)
+	GetReviewByID(ctx context.Context, id int) (models.Review, error)
+	GetReviewByReservationID(ctx context.Context, reservationID int) (models.Review, error)
+	AllReviews(ctx context.Context, status string) ([]models.Review, error)
+	UpdateReviewStatus(ctx context.Context, id int, status string, userID int) error
+	ReplyToReview(ctx context.Context, id int, reply string, userID int, at time.Time) error
+	ApprovedReviewsForRoom(ctx context.Context, roomID int) ([]models.Review, error)
+	RoomRating(ctx context.Context, roomID int) (average float64, count int, err error)
+
+	GetPromoCodeByCode(ctx context.Context, code string) (models.PromoCode, error)
+	AllPromoCodes(ctx context.Context) ([]models.PromoCode, error)
+	InsertPromoCode(ctx context.Context, p models.PromoCode) (int, error)
+	SetPromoCodeActive(ctx context.Context, id int, active bool) error
+	PromoCodeUses(ctx context.Context, promoCodeID int, email string) (total, byEmail int, err error)
+	RedeemPromoCode(ctx context.Context, r models.PromoRedemption) (bool, error)
+
+	GetCancellationPolicyByID(ctx context.Context, id int) (models.CancellationPolicy, error)
+	AllCancellationPolicies(ctx context.Context) ([]models.CancellationPolicy, error)
+	InsertCancellationPolicy(ctx context.Context, p models.CancellationPolicy) (int, error)
+	SetRoomCancellationPolicy(ctx context.Context, roomID, policyID int) error
+	CancelReservation(ctx context.Context, id int, at time.Time, penaltyCents, refundCents int) error
+
+	AllGuests(ctx context.Context, search string) ([]models.Guest, error)
+	GetGuestByID(ctx context.Context, id int) (models.Guest, error)
+	ReservationsForGuest(ctx context.Context, guestID int) ([]models.Reservation, error)
+	UpdateGuestNotes(ctx context.Context, id int, notes string) error
+	AnonymizeGuest(ctx context.Context, id int, at time.Time) error
+	NotificationPreferences(ctx context.Context, email string) ([]models.NotificationPreference, error)
+	SetNotificationPreferences(ctx context.Context, guestID int, prefs []models.NotificationPreference) error
+
+	AllWebhookEndpoints(ctx context.Context) ([]models.WebhookEndpoint, error)
+	InsertWebhookEndpoint(ctx context.Context, e models.WebhookEndpoint) (int, error)
+	SetWebhookEndpointActive(ctx context.Context, id int, active bool) error
+	QueueWebhookDeliveries(ctx context.Context, event, payload string, at time.Time) (int, error)
+	DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error)
+	ClaimWebhookDelivery(ctx context.Context, id, attempts int, until time.Time) error
+	SaveWebhookAttempt(ctx context.Context, d models.WebhookDelivery) error
+	WebhookDeliveries(ctx context.Context, status string, limit int) ([]models.WebhookDelivery, error)
+	RedeliverWebhook(ctx context.Context, id int, at time.Time) error
 }
 
@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSchedule_Next(t *testing.T) {
+	// a Wednesday
+	from := time.Date(2025, 1, 15, 9, 30, 20, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"0 9 * * *", time.Date(2025, 1, 16, 9, 0, 0, 0, time.UTC)},
+		{"45 9 * * *", time.Date(2025, 1, 15, 9, 45, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 1, 15, 9, 45, 0, 0, time.UTC)},
+		{"* * * * *", time.Date(2025, 1, 15, 9, 31, 0, 0, time.UTC)},
+		{"0 8-10/2 * * *", time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)},
+		{"0 7 * * mon-fri", time.Date(2025, 1, 16, 7, 0, 0, 0, time.UTC)},
+		{"0 7 * * sat,sun", time.Date(2025, 1, 18, 7, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// both day fields restricted: either one matches
+		{"0 0 1 * fri", time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)},
+		{"0 0 30 feb *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Next(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestSchedule_NextKeepsLocation(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	s, _ := Parse("0 9 * * *")
+
+	got := s.Next(time.Date(2025, 1, 15, 10, 0, 0, 0, loc))
+	if want := time.Date(2025, 1, 16, 9, 0, 0, 0, loc); !got.Equal(want) || got.Location() != loc {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := map[string]string{
+		"0 9 * *":       "5 fields",
+		"60 9 * * *":    "minute 60",
+		"0 24 * * *":    "hour 24",
+		"0 9 0 * *":     "day of month 0",
+		"0 9 * 13 *":    "month 13",
+		"0 9 * * 8":     "day of week 8",
+		"0 9 * * noday": `invalid value "noday"`,
+		"*/0 * * * *":   "invalid step",
+		"0 10-8 * * *":  "invalid range",
+	}
+	for spec, want := range tests {
+		_, err := Parse(spec)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%q): expected an error mentioning %q, got %v", spec, want, err)
+		}
+	}
+}
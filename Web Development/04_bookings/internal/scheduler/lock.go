@@ -0,0 +1,72 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+	"sync"
+)
+
+// PostgresLocker takes session level advisory locks, so a job runs on only one of the instances sharing
+// the database. The lock lives on a connection pinned for the length of the job and is released with it
+// even if the process dies.
+type PostgresLocker struct {
+	DB *sql.DB
+}
+
+// TryLock implements Locker with pg_try_advisory_lock
+func (l PostgresLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	conn, err := l.DB.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	key := lockKey(name)
+	var ok bool
+	if err := conn.QueryRowContext(ctx, "select pg_try_advisory_lock($1)", key).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	return func() {
+		// the job's context may be cancelled by now, the lock must still be released
+		conn.ExecContext(context.Background(), "select pg_advisory_unlock($1)", key)
+		conn.Close()
+	}, true, nil
+}
+
+// lockKey maps a job name to the 64 bit key of its advisory lock
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("bookings:job:" + name))
+	return int64(h.Sum64())
+}
+
+// LocalLocker only keeps a job from overlapping with itself within the process. It is for SQLite, where a
+// single instance owns the database file.
+type LocalLocker struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+// TryLock implements Locker
+func (l *LocalLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held == nil {
+		l.held = make(map[string]bool)
+	}
+	if l.held[name] {
+		return nil, false, nil
+	}
+	l.held[name] = true
+	return func() {
+		l.mu.Lock()
+		delete(l.held, name)
+		l.mu.Unlock()
+	}, true, nil
+}
@@ -0,0 +1,174 @@
+// Package scheduler runs background jobs on cron schedules inside the web process. Every run first takes
+// a lock named after the job, so when several instances of the site share a database only one of them
+// runs each job.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/logger"
+	"github.com/ashparshp/bookings/internal/metrics"
+)
+
+// Locker guarantees a job runs on one instance at a time. TryLock returns ok false without an error when
+// another instance holds the lock; unlock releases a lock that was taken.
+type Locker interface {
+	TryLock(ctx context.Context, name string) (unlock func(), ok bool, err error)
+}
+
+// Job is a named function run on a schedule
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler runs jobs when their schedules are due
+type Scheduler struct {
+	locker Locker
+	log    *slog.Logger
+	now    func() time.Time
+	jobs   []*Job
+
+	mu      sync.Mutex
+	running map[string]bool
+	wg      sync.WaitGroup
+}
+
+// New returns a scheduler taking its locks from locker and logging to log, or the default logger if nil
+func New(locker Locker, log *slog.Logger) *Scheduler {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &Scheduler{
+		locker:  locker,
+		log:     log,
+		now:     time.Now,
+		running: make(map[string]bool),
+	}
+}
+
+// Add registers run under name on the cron schedule spec
+func (s *Scheduler) Add(name, spec string, run func(ctx context.Context) error) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	s.jobs = append(s.jobs, &Job{Name: name, Schedule: schedule, Run: run})
+	return nil
+}
+
+// Run starts jobs as they become due until ctx is cancelled, then waits for the running ones to return.
+// A job that is still running when it is next due is skipped rather than started twice.
+func (s *Scheduler) Run(ctx context.Context) {
+	if len(s.jobs) == 0 {
+		return
+	}
+
+	next := make(map[*Job]time.Time, len(s.jobs))
+	for _, job := range s.jobs {
+		next[job] = job.Schedule.Next(s.now())
+	}
+
+	for {
+		var wake time.Time
+		for _, t := range next {
+			if !t.IsZero() && (wake.IsZero() || t.Before(wake)) {
+				wake = t
+			}
+		}
+		if wake.IsZero() {
+			s.log.Warn("no scheduled job will run again")
+			<-ctx.Done()
+			s.wg.Wait()
+			return
+		}
+
+		timer := time.NewTimer(wake.Sub(s.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.wg.Wait()
+			return
+		case <-timer.C:
+		}
+
+		now := s.now()
+		for _, job := range s.jobs {
+			if t := next[job]; !t.IsZero() && !t.After(now) {
+				s.start(ctx, job)
+				next[job] = job.Schedule.Next(now)
+			}
+		}
+	}
+}
+
+// start runs job in its own goroutine unless it is already running
+func (s *Scheduler) start(ctx context.Context, job *Job) {
+	s.mu.Lock()
+	if s.running[job.Name] {
+		s.mu.Unlock()
+		s.log.Warn("skipping job, the previous run has not finished", "job", job.Name)
+		return
+	}
+	s.running[job.Name] = true
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, job.Name)
+			s.mu.Unlock()
+		}()
+		s.RunJob(ctx, job)
+	}()
+}
+
+// RunJob runs job once under its lock, logging the outcome. The job's context carries a logger tagged
+// with its name. It returns false if the job did not run because another instance holds the lock or the
+// lock could not be taken.
+func (s *Scheduler) RunJob(ctx context.Context, job *Job) (ran bool) {
+	log := s.log.With("job", job.Name)
+
+	unlock, ok, err := s.locker.TryLock(ctx, job.Name)
+	if err != nil {
+		log.Error("cannot take job lock", "error", err)
+		metrics.JobRuns.Inc(job.Name, "failed")
+		return false
+	}
+	if !ok {
+		log.Info("job is running on another instance")
+		metrics.JobRuns.Inc(job.Name, "locked")
+		return false
+	}
+	defer unlock()
+
+	defer func() {
+		if p := recover(); p != nil {
+			log.Error("job panicked", "panic", p)
+			metrics.JobRuns.Inc(job.Name, "failed")
+			ran = true
+		}
+	}()
+
+	start := time.Now()
+	if err := job.Run(logger.NewContext(ctx, log)); err != nil {
+		log.Error("job failed", "duration", time.Since(start), "error", err)
+		metrics.JobRuns.Inc(job.Name, "failed")
+		return true
+	}
+	log.Info("job finished", "duration", time.Since(start))
+	metrics.JobRuns.Inc(job.Name, "ok")
+	return true
+}
+
+// Jobs returns the registered jobs
+func (s *Scheduler) Jobs() []*Job {
+	return s.jobs
+}
@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// heldLocker refuses every lock, as when another instance is running the job
+type heldLocker struct{}
+
+func (heldLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	return nil, false, nil
+}
+
+type failingLocker struct{}
+
+func (failingLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	return nil, false, errors.New("connection refused")
+}
+
+func TestScheduler_RunJob(t *testing.T) {
+	var runs int32
+	job := &Job{Name: "count", Run: func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}}
+
+	if !New(&LocalLocker{}, discard).RunJob(context.Background(), job) {
+		t.Error("expected the job to run under a free lock")
+	}
+	if New(heldLocker{}, discard).RunJob(context.Background(), job) {
+		t.Error("expected the job not to run while another instance holds the lock")
+	}
+	if New(failingLocker{}, discard).RunJob(context.Background(), job) {
+		t.Error("expected the job not to run when the lock cannot be taken")
+	}
+	if runs != 1 {
+		t.Errorf("expected 1 run, got %d", runs)
+	}
+
+	// failures and panics are contained and release the lock
+	locker := &LocalLocker{}
+	s := New(locker, discard)
+	s.RunJob(context.Background(), &Job{Name: "fail", Run: func(ctx context.Context) error { return errors.New("boom") }})
+	s.RunJob(context.Background(), &Job{Name: "panic", Run: func(ctx context.Context) error { panic("boom") }})
+	for _, name := range []string{"fail", "panic"} {
+		unlock, ok, _ := locker.TryLock(context.Background(), name)
+		if !ok {
+			t.Errorf("expected the %s job to release its lock", name)
+			continue
+		}
+		unlock()
+	}
+}
+
+func TestLocalLocker(t *testing.T) {
+	var l LocalLocker
+	unlock, ok, err := l.TryLock(context.Background(), "job")
+	if err != nil || !ok {
+		t.Fatalf("expected the lock, got %v, %v", ok, err)
+	}
+	if _, ok, _ := l.TryLock(context.Background(), "job"); ok {
+		t.Error("expected a held lock to be refused")
+	}
+	if _, ok, _ := l.TryLock(context.Background(), "other"); !ok {
+		t.Error("expected locks of other jobs to be independent")
+	}
+	unlock()
+	if _, ok, _ := l.TryLock(context.Background(), "job"); !ok {
+		t.Error("expected a released lock to be free again")
+	}
+}
+
+func TestScheduler_Run(t *testing.T) {
+	s := New(&LocalLocker{}, discard)
+	if err := s.Add("bad", "not a schedule", nil); err == nil {
+		t.Error("expected an invalid schedule to be rejected")
+	}
+
+	ran := make(chan struct{}, 10)
+	release := make(chan struct{})
+	var finished atomic.Bool
+	err := s.Add("every-minute", "* * * * *", func(ctx context.Context) error {
+		ran <- struct{}{}
+		<-release
+		finished.Store(true)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// shift the clock to just before a minute boundary, so the job is due almost at once
+	boundary := time.Now().Truncate(time.Minute).Add(time.Minute)
+	offset := boundary.Add(-20 * time.Millisecond).Sub(time.Now())
+	s.now = func() time.Time { return time.Now().Add(offset) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the job to run")
+	}
+
+	// a second start while the first run is going is skipped
+	s.start(ctx, s.jobs[0])
+	select {
+	case <-ran:
+		t.Error("expected the overlapping run to be skipped")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("expected Run to wait for the running job")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-done
+	if !finished.Load() {
+		t.Error("expected the job to finish before Run returned")
+	}
+}
@@ -0,0 +1,135 @@
+package security
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// maxReportViolations is how many violations of one report are read; a page breaking the policy in many
+// places reports a few of them, and a forged report cannot flood the log
+const maxReportViolations = 20
+
+// maxFieldLength bounds each field of a violation, as the report comes from the browser
+const maxFieldLength = 512
+
+// Violation is one breach of the Content-Security-Policy reported by a browser
+type Violation struct {
+	DocumentURL string
+	// Directive is the directive that was violated, such as script-src-elem
+	Directive  string
+	BlockedURL string
+	SourceFile string
+	Line       int
+	Column     int
+	// Sample is the start of the blocked inline script or style, if the policy asks for it
+	Sample string
+	// Disposition is "enforce" if the browser blocked the resource, "report" if it only reported it
+	Disposition string
+}
+
+// legacyReport is the body browsers send to a report-uri, as application/csp-report
+type legacyReport struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		BlockedURI         string `json:"blocked-uri"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+		ColumnNumber       int    `json:"column-number"`
+		ScriptSample       string `json:"script-sample"`
+		Disposition        string `json:"disposition"`
+	} `json:"csp-report"`
+}
+
+// reportingAPIReport is one report of the batches browsers send to a report-to group, as
+// application/reports+json
+type reportingAPIReport struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		BlockedURL         string `json:"blockedURL"`
+		SourceFile         string `json:"sourceFile"`
+		LineNumber         int    `json:"lineNumber"`
+		ColumnNumber       int    `json:"columnNumber"`
+		Sample             string `json:"sample"`
+		Disposition        string `json:"disposition"`
+	} `json:"body"`
+}
+
+// ParseReport reads the violations in a report, sent either to the report-uri directive or, as a batch of
+// reports of which only the csp-violation ones are kept, through the Reporting API
+func ParseReport(body []byte) ([]Violation, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, errors.New("empty report")
+	}
+
+	var violations []Violation
+	if body[0] == '[' {
+		var batch []reportingAPIReport
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return nil, err
+		}
+		for _, r := range batch {
+			if r.Type != "csp-violation" || len(violations) == maxReportViolations {
+				continue
+			}
+			violations = append(violations, Violation{
+				DocumentURL: r.Body.DocumentURL,
+				Directive:   r.Body.EffectiveDirective,
+				BlockedURL:  r.Body.BlockedURL,
+				SourceFile:  r.Body.SourceFile,
+				Line:        r.Body.LineNumber,
+				Column:      r.Body.ColumnNumber,
+				Sample:      r.Body.Sample,
+				Disposition: r.Body.Disposition,
+			})
+		}
+	} else {
+		var r legacyReport
+		if err := json.Unmarshal(body, &r); err != nil {
+			return nil, err
+		}
+		directive := r.Report.EffectiveDirective
+		if directive == "" {
+			directive = r.Report.ViolatedDirective
+		}
+		if directive == "" {
+			return nil, errors.New("not a violation report")
+		}
+		violations = append(violations, Violation{
+			DocumentURL: r.Report.DocumentURI,
+			Directive:   directive,
+			BlockedURL:  r.Report.BlockedURI,
+			SourceFile:  r.Report.SourceFile,
+			Line:        r.Report.LineNumber,
+			Column:      r.Report.ColumnNumber,
+			Sample:      r.Report.ScriptSample,
+			Disposition: r.Report.Disposition,
+		})
+	}
+
+	for i := range violations {
+		v := &violations[i]
+		for _, s := range []*string{&v.DocumentURL, &v.Directive, &v.BlockedURL, &v.SourceFile, &v.Sample, &v.Disposition} {
+			*s = truncate(*s)
+		}
+	}
+	return violations, nil
+}
+
+func truncate(s string) string {
+	if len(s) <= maxFieldLength {
+		return s
+	}
+	// cut on a rune boundary
+	for i := maxFieldLength; i > 0; i-- {
+		if s[i]&0xC0 != 0x80 {
+			return s[:i]
+		}
+	}
+	return ""
+}
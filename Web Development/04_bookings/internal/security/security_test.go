@@ -0,0 +1,120 @@
+package security
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/config"
+)
+
+func TestNewNonce(t *testing.T) {
+	a, b := NewNonce(), NewNonce()
+	if len(a) != 24 || a == b {
+		t.Errorf("expected distinct 128 bit nonces, got %q and %q", a, b)
+	}
+
+	ctx := NewContext(context.Background(), a)
+	if NonceFromContext(ctx) != a || NonceFromContext(context.Background()) != "" {
+		t.Error("expected the nonce to be carried by the context only")
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	year := config.SecurityConfig{CSP: config.CSPEnforce, HSTSMaxAge: 365 * 24 * time.Hour}
+
+	tests := []struct {
+		name       string
+		cfg        config.SecurityConfig
+		production bool
+		policy     string
+		hsts       string
+	}{
+		{"production", year, true, "Content-Security-Policy", "max-age=31536000; includeSubDomains"},
+		{"development", year, false, "Content-Security-Policy", ""},
+		{"report only", config.SecurityConfig{CSP: config.CSPReportOnly, HSTSMaxAge: time.Hour}, true, "Content-Security-Policy-Report-Only", "max-age=3600; includeSubDomains"},
+		{"off", config.SecurityConfig{CSP: config.CSPOff}, true, "", ""},
+	}
+
+	for _, tt := range tests {
+		h := http.Header{}
+		SetHeaders(h, tt.cfg, tt.production, "abc123")
+
+		for _, name := range []string{"Content-Security-Policy", "Content-Security-Policy-Report-Only"} {
+			policy := h.Get(name)
+			if name != tt.policy {
+				if policy != "" {
+					t.Errorf("%s: expected no %s header, got %q", tt.name, name, policy)
+				}
+				continue
+			}
+			if !strings.Contains(policy, "script-src 'self' 'nonce-abc123' ") || !strings.Contains(policy, "report-uri /csp-report") {
+				t.Errorf("%s: unexpected policy %q", tt.name, policy)
+			}
+		}
+		if (h.Get("Reporting-Endpoints") != "") != (tt.policy != "") {
+			t.Errorf("%s: expected a reporting endpoint only with a policy, got %q", tt.name, h.Get("Reporting-Endpoints"))
+		}
+		if got := h.Get("Strict-Transport-Security"); got != tt.hsts {
+			t.Errorf("%s: expected HSTS %q, got %q", tt.name, tt.hsts, got)
+		}
+		if h.Get("X-Frame-Options") != "DENY" || h.Get("X-Content-Type-Options") != "nosniff" ||
+			h.Get("Referrer-Policy") == "" || h.Get("Permissions-Policy") == "" {
+			t.Errorf("%s: expected the other security headers, got %v", tt.name, h)
+		}
+	}
+}
+
+func TestPolicy_NoUnsafeScripts(t *testing.T) {
+	for _, directive := range strings.Split(Policy("n"), "; ") {
+		if strings.HasPrefix(directive, "script-src") && strings.Contains(directive, "unsafe") {
+			t.Errorf("expected scripts to need a nonce, got %q", directive)
+		}
+	}
+}
+
+func TestParseReport(t *testing.T) {
+	legacy := `{"csp-report": {"document-uri": "https://example.com/about", "violated-directive": "script-src-elem",
+		"effective-directive": "script-src-elem", "blocked-uri": "inline", "source-file": "https://example.com/about",
+		"line-number": 228, "column-number": 1, "disposition": "report", "original-policy": "default-src 'self'"}}`
+	violations, err := ParseReport([]byte(legacy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Violation{DocumentURL: "https://example.com/about", Directive: "script-src-elem", BlockedURL: "inline",
+		SourceFile: "https://example.com/about", Line: 228, Column: 1, Disposition: "report"}
+	if len(violations) != 1 || violations[0] != want {
+		t.Errorf("unexpected violations %+v", violations)
+	}
+
+	batch := `[
+		{"type": "csp-violation", "url": "https://example.com/", "body": {"documentURL": "https://example.com/",
+			"effectiveDirective": "img-src", "blockedURL": "https://tracker.example.net/p.gif", "disposition": "enforce"}},
+		{"type": "deprecation", "body": {"id": "x"}}
+	]`
+	violations, err = ParseReport([]byte(batch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 1 || violations[0].Directive != "img-src" || violations[0].BlockedURL != "https://tracker.example.net/p.gif" {
+		t.Errorf("expected only the CSP violation of the batch, got %+v", violations)
+	}
+
+	// a forged report is cut down to size
+	long := `[` + strings.Repeat(`{"type": "csp-violation", "body": {"effectiveDirective": "`+strings.Repeat("é", 400)+`"}},`, 30)
+	violations, err = ParseReport([]byte(strings.TrimSuffix(long, ",") + `]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != maxReportViolations || len(violations[0].Directive) != maxFieldLength {
+		t.Errorf("expected %d violations with fields of %d bytes, got %d of %d", maxReportViolations, maxFieldLength, len(violations), len(violations[0].Directive))
+	}
+
+	for _, body := range []string{"", "not json", `{"csp-report": {}}`, `{"other": 1}`} {
+		if _, err := ParseReport([]byte(body)); err == nil {
+			t.Errorf("expected an error for %q", body)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Package seed generates demo data: rooms, staff, guests, and months of reservations and owner's blocks
+// around a given day. The same options always generate the same data, so a demo or a load test can be
+// repeated. Generate only builds the data; Write stores it.
+package seed
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+// Access levels of the generated users
+const (
+	StaffAccessLevel = 1
+	AdminAccessLevel = 3
+)
+
+// Password is the password of every generated user
+const Password = "password"
+
+// aheadDays is how far past Today reservations are generated. Fewer of those days are booked, as a stay
+// only exists once its lead time has passed.
+const aheadDays = 120
+
+// Options say what to generate
+type Options struct {
+	Seed   int64
+	Rooms  int
+	Admins int
+	Staff  int
+	// Months is how many months before Today reservations start
+	Months int
+	// Today is the day the data is generated around; every reservation was made before it
+	Today time.Time
+}
+
+// Dataset is generated data. The RoomID of reservations and blocks and the GuestID of reservations are
+// positions in Rooms and Guests counting from 1, as the real ids are only known once the data is written.
+type Dataset struct {
+	Rooms        []models.Room
+	Users        []models.User
+	Guests       []models.Guest
+	Reservations []models.Reservation
+	Blocks       []models.RoomRestriction
+}
+
+// Guests book stays of mostly one to four nights, sometimes a week or two
+var stayLengths = []struct{ nights, weight int }{
+	{1, 18}, {2, 24}, {3, 20}, {4, 12}, {5, 7}, {6, 4}, {7, 8}, {10, 3}, {14, 4},
+}
+
+var firstNames = []string{
+	"Olivia", "Liam", "Emma", "Noah", "Ava", "Lucas", "Sofia", "Mateo", "Mia", "Elijah", "Isabella", "Leo",
+	"Amelia", "Hugo", "Chloe", "Omar", "Priya", "Arjun", "Yuki", "Kenji", "Fatima", "Diego", "Lucia", "Marta",
+}
+
+var lastNames = []string{
+	"Smith", "Johnson", "Garcia", "Martinez", "Brown", "Davis", "Lopez", "Wilson", "Anderson", "Thomas",
+	"Moore", "Jackson", "Lee", "Perez", "Sharma", "Patel", "Tanaka", "Khan", "Rossi", "Novak", "Silva", "Kim",
+}
+
+var roomNames = []string{
+	"Colonel's Lodge", "Captain's Cabin", "Admiral's Retreat", "Lieutenant's Loft", "Commander's Den",
+	"Sergeant's Rest", "Brigadier's Billet", "Marshal's Manor", "Corporal's Corner", "Private's Post",
+}
+
+// Generate returns the dataset for o
+func Generate(o Options) Dataset {
+	r := rand.New(rand.NewSource(o.Seed))
+	today := time.Date(o.Today.Year(), o.Today.Month(), o.Today.Day(), 0, 0, 0, 0, time.UTC)
+	var d Dataset
+
+	for i := 0; i < o.Rooms; i++ {
+		name := roomNames[i%len(roomNames)]
+		if i >= len(roomNames) {
+			name = fmt.Sprintf("%s %d", name, i/len(roomNames)+1)
+		}
+		d.Rooms = append(d.Rooms, models.Room{RoomName: name, PriceCents: 7500 + 500*r.Intn(36)})
+	}
+
+	for i := 0; i < o.Admins+o.Staff; i++ {
+		u := models.User{FirstName: pick(r, firstNames), LastName: pick(r, lastNames), Password: Password}
+		if i < o.Admins {
+			u.AccessLevel, u.Email = AdminAccessLevel, fmt.Sprintf("admin%d@example.com", i+1)
+		} else {
+			u.AccessLevel, u.Email = StaffAccessLevel, fmt.Sprintf("staff%d@example.com", i-o.Admins+1)
+		}
+		u.CreatedAt = today.AddDate(0, -o.Months, -r.Intn(365))
+		u.UpdatedAt = u.CreatedAt
+		d.Users = append(d.Users, u)
+	}
+
+	start, end := today.AddDate(0, -o.Months, 0), today.AddDate(0, 0, aheadDays)
+	for i, room := range d.Rooms {
+		roomID := i + 1
+		for day := start; day.Before(end); {
+			if r.Float64() < 0.5 {
+				day = day.AddDate(0, 0, 1+r.Intn(5))
+			}
+
+			// the owner keeps a room for a few days now and then
+			if r.Float64() < 0.04 {
+				created := day.AddDate(0, 0, -1-r.Intn(30))
+				for n := 1 + r.Intn(3); n > 0 && day.Before(end); n-- {
+					d.Blocks = append(d.Blocks, models.RoomRestriction{
+						StartDate: day, EndDate: day.AddDate(0, 0, 1), RoomID: roomID, RestrictionID: 2,
+						CreatedAt: created, UpdatedAt: created,
+					})
+					day = day.AddDate(0, 0, 1)
+				}
+				continue
+			}
+
+			nights := stayLength(r)
+			checkout := day.AddDate(0, 0, nights)
+			created := day.AddDate(0, 0, -leadTime(r)).Add(time.Duration(7*60+r.Intn(15*60)) * time.Minute)
+			if checkout.After(end) {
+				break
+			}
+			// nobody has booked it yet
+			if !created.Before(today) {
+				day = day.AddDate(0, 0, 1)
+				continue
+			}
+
+			guestID := d.guest(r, created)
+			g := d.Guests[guestID-1]
+			res := models.Reservation{
+				FirstName: g.FirstName, LastName: g.LastName, Email: g.Email, Phone: g.Phone,
+				StartDate: day, EndDate: checkout, RoomID: roomID, GuestID: guestID,
+				CreatedAt: created, UpdatedAt: created, Locale: "en",
+				SubtotalCents: nights * room.PriceCents, TotalCents: nights * room.PriceCents,
+			}
+			if r.Float64() < 0.15 {
+				res.Locale = "es"
+			}
+			res.Processed = processed(r, res, today)
+			d.Reservations = append(d.Reservations, res)
+			day = checkout
+		}
+	}
+	return d
+}
+
+// guest returns the guest making a reservation at created: a new guest, or now and then a returning one
+func (d *Dataset) guest(r *rand.Rand, created time.Time) int {
+	if len(d.Guests) > 0 && r.Float64() < 0.2 {
+		return 1 + r.Intn(len(d.Guests))
+	}
+
+	first, last := pick(r, firstNames), pick(r, lastNames)
+	d.Guests = append(d.Guests, models.Guest{
+		Email:     fmt.Sprintf("%s.%s%d@example.com", strings.ToLower(first), strings.ToLower(last), len(d.Guests)+1),
+		FirstName: first,
+		LastName:  last,
+		Phone:     fmt.Sprintf("+1 555 %03d %04d", r.Intn(1000), r.Intn(10000)),
+		CreatedAt: created,
+		UpdatedAt: created,
+	})
+	return len(d.Guests)
+}
+
+// processed is whether staff have processed a reservation by today: nearly all past stays, most of the
+// upcoming ones, and few of those made in the last few days
+func processed(r *rand.Rand, res models.Reservation, today time.Time) int {
+	chance := 0.2
+	switch {
+	case res.EndDate.Before(today):
+		chance = 0.97
+	case res.CreatedAt.Before(today.AddDate(0, 0, -3)):
+		chance = 0.7
+	}
+	if r.Float64() < chance {
+		return 1
+	}
+	return 0
+}
+
+// leadTime is how many days before arrival a stay is booked: often within a few weeks, seldom months ahead
+func leadTime(r *rand.Rand) int {
+	return min(int(r.ExpFloat64()*21), 270)
+}
+
+func stayLength(r *rand.Rand) int {
+	total := 0
+	for _, s := range stayLengths {
+		total += s.weight
+	}
+	n := r.Intn(total)
+	for _, s := range stayLengths {
+		if n < s.weight {
+			return s.nights
+		}
+		n -= s.weight
+	}
+	return 1
+}
+
+func pick(r *rand.Rand, s []string) string {
+	return s[r.Intn(len(s))]
+}
@@ -0,0 +1,136 @@
+package seed
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/driver"
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+var testOptions = Options{
+	Seed:   42,
+	Rooms:  12,
+	Admins: 2,
+	Staff:  5,
+	Months: 6,
+	Today:  time.Date(2050, 6, 15, 0, 0, 0, 0, time.UTC),
+}
+
+func TestGenerate_Deterministic(t *testing.T) {
+	a, b := Generate(testOptions), Generate(testOptions)
+	if !reflect.DeepEqual(a, b) {
+		t.Error("expected the same options to generate the same data")
+	}
+
+	other := testOptions
+	other.Seed = 43
+	if reflect.DeepEqual(a.Reservations, Generate(other).Reservations) {
+		t.Error("expected another seed to generate other reservations")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	d := Generate(testOptions)
+	today := testOptions.Today
+
+	if len(d.Rooms) != 12 || d.Rooms[10].RoomName != "Colonel's Lodge 2" {
+		t.Errorf("expected 12 rooms with unique names, got %d", len(d.Rooms))
+	}
+	levels := map[int]int{}
+	for _, u := range d.Users {
+		levels[u.AccessLevel]++
+	}
+	if levels[AdminAccessLevel] != 2 || levels[StaffAccessLevel] != 5 {
+		t.Errorf("expected 2 admins and 5 staff, got %v", levels)
+	}
+
+	emails := map[string]bool{}
+	for _, g := range d.Guests {
+		if emails[g.Email] {
+			t.Errorf("guest email %s used twice", g.Email)
+		}
+		emails[g.Email] = true
+	}
+
+	// the restrictions of every room, reservations and blocks alike, may not overlap
+	byRoom := map[int][]models.RoomRestriction{}
+	var processed, past, future int
+	for _, res := range d.Reservations {
+		byRoom[res.RoomID] = append(byRoom[res.RoomID], models.RoomRestriction{StartDate: res.StartDate, EndDate: res.EndDate})
+		if !res.CreatedAt.Before(today) || res.CreatedAt.After(res.StartDate.AddDate(0, 0, 1)) {
+			t.Errorf("reservation for %s made on %s", res.StartDate, res.CreatedAt)
+		}
+		if res.TotalCents != d.Rooms[res.RoomID-1].PriceCents*int(res.EndDate.Sub(res.StartDate).Hours()/24) {
+			t.Errorf("unexpected total %d", res.TotalCents)
+		}
+		processed += res.Processed
+		if res.StartDate.Before(today) {
+			past++
+		} else {
+			future++
+		}
+	}
+	for _, b := range d.Blocks {
+		byRoom[b.RoomID] = append(byRoom[b.RoomID], b)
+	}
+	for room, list := range byRoom {
+		sort.Slice(list, func(i, j int) bool { return list[i].StartDate.Before(list[j].StartDate) })
+		for i := 1; i < len(list); i++ {
+			if list[i].StartDate.Before(list[i-1].EndDate) {
+				t.Errorf("room %d: %s overlaps the stay ending %s", room, list[i].StartDate, list[i-1].EndDate)
+			}
+		}
+	}
+
+	if past < 300 || future == 0 || len(d.Blocks) == 0 {
+		t.Errorf("expected months of past and upcoming stays and some blocks, got %d, %d and %d", past, future, len(d.Blocks))
+	}
+	if processed == 0 || processed == len(d.Reservations) {
+		t.Errorf("expected some reservations processed and some not, got %d of %d", processed, len(d.Reservations))
+	}
+	if len(d.Guests) >= len(d.Reservations) {
+		t.Error("expected some returning guests")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL.Close()
+
+	d := Generate(testOptions)
+	if err := Write(context.Background(), db.SQL, true, d); err != nil {
+		t.Fatal(err)
+	}
+
+	var reservations, restrictions, users int
+	db.SQL.QueryRow("SELECT COUNT(*) FROM reservations").Scan(&reservations)
+	db.SQL.QueryRow("SELECT COUNT(*) FROM room_restrictions").Scan(&restrictions)
+	db.SQL.QueryRow("SELECT COUNT(*) FROM users WHERE email LIKE '%@example.com'").Scan(&users)
+	if reservations != len(d.Reservations) || restrictions != len(d.Reservations)+len(d.Blocks) || users != 7 {
+		t.Errorf("expected the dataset written, got %d reservations, %d restrictions and %d users", reservations, restrictions, users)
+	}
+
+	// dates are stored the way the sqlite repository reads them
+	first := d.Reservations[0]
+	var found int
+	db.SQL.QueryRow("SELECT COUNT(*) FROM reservations WHERE start_date = ? AND guest_id IS NOT NULL", first.StartDate.Format(dateLayout)).Scan(&found)
+	if found == 0 {
+		t.Errorf("expected a reservation starting %s", first.StartDate.Format(dateLayout))
+	}
+
+	if err := Write(context.Background(), db.SQL, true, d); err == nil {
+		t.Error("expected writing the same users twice to fail")
+	}
+	db.SQL.QueryRow("SELECT COUNT(*) FROM reservations").Scan(&reservations)
+	if reservations != len(d.Reservations) {
+		t.Errorf("expected the failed write rolled back, got %d reservations", reservations)
+	}
+}
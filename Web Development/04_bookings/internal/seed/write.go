@@ -0,0 +1,92 @@
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dateLayout is how sqlite stores dates
+const dateLayout = "2006-01-02"
+
+// Write stores d in one transaction, so a dataset is written completely or not at all. It adds to what is
+// in the database; writing a dataset twice fails on the users' emails, which must be unique. sqlite says
+// whether db is a sqlite database, which stores dates as text.
+func Write(ctx context.Context, db *sql.DB, sqlite bool, d Dataset) error {
+	date := func(t time.Time) any {
+		if sqlite {
+			return t.Format(dateLayout)
+		}
+		return t
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	roomIDs := make([]int, len(d.Rooms))
+	for i, room := range d.Rooms {
+		err := tx.QueryRowContext(ctx, `INSERT INTO rooms (room_name, price_cents, created_at, updated_at)
+			VALUES ($1, $2, $3, $4) RETURNING id`, room.RoomName, room.PriceCents, now, now).Scan(&roomIDs[i])
+		if err != nil {
+			return fmt.Errorf("cannot insert room %s: %w", room.RoomName, err)
+		}
+	}
+
+	for _, u := range d.Users {
+		_, err := tx.ExecContext(ctx, `INSERT INTO users (first_name, last_name, email, password, access_level, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`, u.FirstName, u.LastName, u.Email, string(hash), u.AccessLevel, u.CreatedAt, u.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("cannot insert user %s: %w", u.Email, err)
+		}
+	}
+
+	guestIDs := make([]int, len(d.Guests))
+	for i, g := range d.Guests {
+		err := tx.QueryRowContext(ctx, `INSERT INTO guests (email, first_name, last_name, phone, notes, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, '', $5, $6) RETURNING id`, g.Email, g.FirstName, g.LastName, g.Phone, g.CreatedAt, g.UpdatedAt).Scan(&guestIDs[i])
+		if err != nil {
+			return fmt.Errorf("cannot insert guest %s: %w", g.Email, err)
+		}
+	}
+
+	for _, res := range d.Reservations {
+		roomID := roomIDs[res.RoomID-1]
+		var id int
+		err := tx.QueryRowContext(ctx, `INSERT INTO reservations (first_name, last_name, email, phone, start_date, end_date,
+			room_id, locale, subtotal_cents, discount_cents, total_cents, guest_id, processed, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING id`,
+			res.FirstName, res.LastName, res.Email, res.Phone, date(res.StartDate), date(res.EndDate), roomID, res.Locale,
+			res.SubtotalCents, res.DiscountCents, res.TotalCents, guestIDs[res.GuestID-1], res.Processed, res.CreatedAt, res.UpdatedAt).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("cannot insert reservation: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, 1, $5, $6)`, date(res.StartDate), date(res.EndDate), roomID, id, res.CreatedAt, res.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("cannot insert reservation restriction: %w", err)
+		}
+	}
+
+	for _, b := range d.Blocks {
+		_, err := tx.ExecContext(ctx, `INSERT INTO room_restrictions (start_date, end_date, room_id, restriction_id, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`, date(b.StartDate), date(b.EndDate), roomIDs[b.RoomID-1], b.RestrictionID, b.CreatedAt, b.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("cannot insert block: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,211 @@
+// Package sessionstore keeps scs sessions in the database, so restarts and deploys neither log staff out
+// nor lose guests' reservations in progress. Next to the session data it records who the session belongs
+// to and which device last used it, for the active sessions page.
+package sessionstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/ashparshp/bookings/internal/logger"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/repository"
+)
+
+// touchInterval is how stale the last activity of a session may get before a request updates it,
+// so that reading a session does not cost a write on every request
+const touchInterval = time.Minute
+
+// Store is an scs.CtxStore backed by the sessions table
+type Store struct {
+	repo  repository.DatabaseRepo
+	codec scs.Codec
+	now   func() time.Time
+}
+
+// New returns a store saving sessions through repo. The codec must be the session manager's, it is used
+// to find the user a session belongs to.
+func New(repo repository.DatabaseRepo, codec scs.Codec) *Store {
+	return &Store{
+		repo:  repo,
+		codec: codec,
+		now:   time.Now,
+	}
+}
+
+// HashToken returns the form in which a session token is stored when the session manager has
+// HashTokenInStore set, so a handler can recognise the current session in a list
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// Find implements scs.Store
+func (s *Store) Find(token string) ([]byte, bool, error) {
+	return s.FindCtx(context.Background(), token)
+}
+
+// Commit implements scs.Store
+func (s *Store) Commit(token string, b []byte, expiry time.Time) error {
+	return s.CommitCtx(context.Background(), token, b, expiry)
+}
+
+// Delete implements scs.Store
+func (s *Store) Delete(token string) error {
+	return s.DeleteCtx(context.Background(), token)
+}
+
+// FindCtx returns the data of an unexpired session and records the request as activity on it
+func (s *Store) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	sess, err := s.repo.GetSession(ctx, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := s.now()
+	if !sess.Expiry.After(now) {
+		return nil, false, nil
+	}
+
+	c := clientFromContext(ctx)
+	if c.ip != "" && (now.Sub(sess.LastActivity) >= touchInterval || c.ip != sess.IPAddress) {
+		// losing an activity update is not worth failing the request for
+		if err := s.repo.TouchSession(ctx, token, c.ip, c.userAgent, now); err != nil {
+			logger.FromContext(ctx).Warn("cannot record session activity", "error", err)
+		}
+	}
+
+	return sess.Data, true, nil
+}
+
+// CommitCtx saves the session data along with its user and the client that sent the request
+func (s *Store) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	c := clientFromContext(ctx)
+	return s.repo.SaveSession(ctx, models.Session{
+		Token:        token,
+		UserID:       s.userID(b),
+		Data:         b,
+		Expiry:       expiry,
+		IPAddress:    c.ip,
+		UserAgent:    c.userAgent,
+		LastActivity: s.now(),
+	})
+}
+
+// DeleteCtx removes a session, which is how scs destroys a session or renews its token
+func (s *Store) DeleteCtx(ctx context.Context, token string) error {
+	return s.repo.DeleteSession(ctx, token)
+}
+
+// userID returns the logged in user stored in encoded session data, or zero for a guest
+func (s *Store) userID(b []byte) int {
+	_, values, err := s.codec.Decode(b)
+	if err != nil {
+		return 0
+	}
+	id, _ := values["user_id"].(int)
+	return id
+}
+
+// Cleanup deletes expired sessions every interval until ctx is cancelled
+func (s *Store) Cleanup(ctx context.Context, interval time.Duration) {
+	log := logger.FromContext(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.repo.DeleteExpiredSessions(ctx, s.now())
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Error("cannot delete expired sessions", "error", err)
+				}
+				continue
+			}
+			if n > 0 {
+				log.Info("deleted expired sessions", "count", n)
+			}
+		}
+	}
+}
+
+type clientKey struct{}
+
+type client struct {
+	ip        string
+	userAgent string
+}
+
+// WithClient returns a copy of ctx carrying the address and user agent of the request's client,
+// which the store saves with the session
+func WithClient(ctx context.Context, r *http.Request) context.Context {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return context.WithValue(ctx, clientKey{}, client{ip: ip, userAgent: r.UserAgent()})
+}
+
+func clientFromContext(ctx context.Context) client {
+	c, _ := ctx.Value(clientKey{}).(client)
+	return c
+}
+
+// Device describes a user agent briefly, e.g. "Chrome on Windows"
+func Device(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	// order matters: Edge and Opera also claim to be Chrome, and Chrome claims to be Safari
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"CriOS/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	system := ""
+	for _, o := range []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, o.token) {
+			system = o.name
+			break
+		}
+	}
+
+	if system == "" {
+		return browser
+	}
+	return browser + " on " + system
+}
@@ -0,0 +1,175 @@
+package sessionstore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/driver"
+	"github.com/ashparshp/bookings/internal/repository"
+	"github.com/ashparshp/bookings/internal/repository/dbrepo"
+)
+
+func newRepo(t *testing.T) repository.DatabaseRepo {
+	t.Helper()
+
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.SQL.Close() })
+
+	return dbrepo.NewSqliteRepo(db.SQL, &config.AppConfig{DBDriver: "sqlite"})
+}
+
+// newManager returns a session manager as main configures it, around a fresh store on repo
+func newManager(repo repository.DatabaseRepo) (*scs.SessionManager, *Store) {
+	m := scs.New()
+	store := New(repo, m.Codec)
+	m.Store = store
+	m.HashTokenInStore = true
+	return m, store
+}
+
+// serve runs a request through the manager the way the SessionLoad middleware does
+func serve(m *scs.SessionManager, cookie *http.Cookie, h http.HandlerFunc) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.10:51234"
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0 Safari/537.36")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	rr := httptest.NewRecorder()
+	load := m.LoadAndSave(h)
+	load.ServeHTTP(rr, req.WithContext(WithClient(req.Context(), req)))
+	return rr
+}
+
+func TestStore_SurvivesRestart(t *testing.T) {
+	repo := newRepo(t)
+	m, _ := newManager(repo)
+
+	rr := serve(m, nil, func(w http.ResponseWriter, r *http.Request) {
+		m.Put(r.Context(), "user_id", 1)
+		m.Put(r.Context(), "flash", "Logged in successfully")
+	})
+	cookie := rr.Result().Cookies()[0]
+
+	// a new manager and store stand in for the restarted process
+	restarted, _ := newManager(repo)
+	var userID int
+	var token string
+	serve(restarted, cookie, func(w http.ResponseWriter, r *http.Request) {
+		userID = restarted.GetInt(r.Context(), "user_id")
+		token = restarted.Token(r.Context())
+	})
+	if userID != 1 {
+		t.Fatalf("expected the session to survive a restart, got user %d", userID)
+	}
+
+	sessions, err := repo.ActiveSessionsForUser(context.Background(), 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("expected one session for the user, got %d", len(sessions))
+	}
+	s := sessions[0]
+	if s.Token != HashToken(token) || s.Token == token {
+		t.Error("expected the token to be stored hashed")
+	}
+	if s.IPAddress != "192.0.2.10" || Device(s.UserAgent) != "Chrome on Windows" {
+		t.Errorf("expected the client to be recorded, got %q %q", s.IPAddress, s.UserAgent)
+	}
+
+	// revoking the row ends the session
+	if err := repo.DeleteUserSession(context.Background(), 1, s.Token); err != nil {
+		t.Fatal(err)
+	}
+	serve(restarted, cookie, func(w http.ResponseWriter, r *http.Request) {
+		userID = restarted.GetInt(r.Context(), "user_id")
+	})
+	if userID != 0 {
+		t.Error("expected a revoked session to be gone")
+	}
+}
+
+func TestStore_Expiry(t *testing.T) {
+	repo := newRepo(t)
+	_, store := newManager(repo)
+
+	if err := store.Commit("token", []byte("data"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := store.Find("token"); err != nil || !found {
+		t.Fatalf("expected the session to be found, got %v, %v", found, err)
+	}
+
+	store.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, found, err := store.Find("token"); err != nil || found {
+		t.Errorf("expected an expired session not to be found, got %v, %v", found, err)
+	}
+
+	if err := store.Delete("missing"); err != nil {
+		t.Errorf("deleting a missing session should not fail: %v", err)
+	}
+}
+
+func TestStore_Cleanup(t *testing.T) {
+	repo := newRepo(t)
+	_, store := newManager(repo)
+
+	if err := store.Commit("old", []byte("data"), time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Commit("fresh", []byte("data"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		store.Cleanup(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.After(2 * time.Second)
+	for {
+		if _, err := repo.GetSession(context.Background(), "old"); err != nil {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("expected the expired session to be cleaned up")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	cancel()
+	<-done
+	if _, err := repo.GetSession(context.Background(), "fresh"); err != nil {
+		t.Errorf("expected the unexpired session to be kept: %v", err)
+	}
+}
+
+func TestDevice(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36 Edg/120.0": "Edge on Windows",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/605.1.15 Version/17.0 Safari/605.1.15":    "Safari on macOS",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 CriOS/120.0 Mobile":    "Chrome on iPhone",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0":                            "Firefox on Linux",
+		"curl/8.4.0": "curl",
+		"":           "Unknown device",
+	}
+	for ua, want := range tests {
+		if got := Device(ua); got != want {
+			t.Errorf("Device(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/metrics"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/repository"
+)
+
+const (
+	// requestTimeout bounds a single attempt, so a slow endpoint cannot hold up the others
+	requestTimeout = 10 * time.Second
+	// claimTime is how long an attempt holds its delivery. It is longer than an attempt may take, so if
+	// the instance making it dies the delivery is only retried late, never sent twice at once.
+	claimTime = time.Minute
+	// batchSize is how many due deliveries are loaded at a time
+	batchSize = 50
+	// maxResponseBody is how much of a response is read, so the connection can be reused
+	maxResponseBody = 64 << 10
+)
+
+// DefaultPollInterval is how often Run looks for retries that have become due
+const DefaultPollInterval = 30 * time.Second
+
+// Dispatcher queues events for the subscribed endpoints and delivers them. Queued deliveries are stored,
+// so they survive restarts, and every attempt first claims its delivery, so several instances sharing a
+// database can all run a dispatcher without posting anything twice.
+type Dispatcher struct {
+	DB     repository.DatabaseRepo
+	Client *http.Client
+	// PollInterval is how often Run looks for due retries; new events are delivered straight away
+	PollInterval time.Duration
+
+	log  *slog.Logger
+	now  func() time.Time
+	wake chan struct{}
+}
+
+// NewDispatcher returns a dispatcher over db logging to log, or the default logger if nil
+func NewDispatcher(db repository.DatabaseRepo, log *slog.Logger) *Dispatcher {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &Dispatcher{
+		DB: db,
+		Client: &http.Client{
+			Timeout: requestTimeout,
+			// a redirect is answered like any other non 2xx status, endpoints are expected to be exact
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		PollInterval: DefaultPollInterval,
+		log:          log,
+		now:          time.Now,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Publish queues event with data for every active endpoint subscribed to it and wakes Run to deliver it
+func (d *Dispatcher) Publish(ctx context.Context, event string, data any) error {
+	if !IsEvent(event) {
+		return fmt.Errorf("unknown webhook event %q", event)
+	}
+
+	at := d.now()
+	body, err := json.Marshal(Envelope{Event: event, OccurredAt: at.UTC(), Data: data})
+	if err != nil {
+		return fmt.Errorf("cannot encode %s event: %w", event, err)
+	}
+
+	n, err := d.DB.QueueWebhookDeliveries(ctx, event, string(body), at)
+	if err != nil {
+		return fmt.Errorf("cannot queue %s event: %w", event, err)
+	}
+	if n > 0 {
+		d.Wake()
+	}
+	return nil
+}
+
+// Redeliver sends delivery id again, from its first attempt, as soon as Run gets to it
+func (d *Dispatcher) Redeliver(ctx context.Context, id int) error {
+	if err := d.DB.RedeliverWebhook(ctx, id, d.now()); err != nil {
+		return err
+	}
+	d.Wake()
+	return nil
+}
+
+// Wake makes Run look for due deliveries now instead of at its next poll
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers due deliveries until ctx is cancelled, when new events are published and every
+// PollInterval for retries. An attempt that has started when ctx is cancelled is finished first.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.DeliverDue(ctx); err != nil && ctx.Err() == nil {
+			d.log.Error("cannot deliver webhooks", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue makes an attempt at every delivery that is due, until none are left or ctx is cancelled
+func (d *Dispatcher) DeliverDue(ctx context.Context) error {
+	for ctx.Err() == nil {
+		due, err := d.DB.DueWebhookDeliveries(ctx, d.now(), batchSize)
+		if err != nil {
+			return fmt.Errorf("cannot load due webhook deliveries: %w", err)
+		}
+
+		for _, dl := range due {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err := d.attempt(context.WithoutCancel(ctx), dl); err != nil {
+				return err
+			}
+		}
+
+		if len(due) < batchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+// attempt posts dl to its endpoint once and records the outcome, scheduling a retry if it failed
+func (d *Dispatcher) attempt(ctx context.Context, dl models.WebhookDelivery) error {
+	log := d.log.With("delivery_id", dl.ID, "event", dl.Event, "endpoint_id", dl.EndpointID)
+
+	err := d.DB.ClaimWebhookDelivery(ctx, dl.ID, dl.Attempts, d.now().Add(claimTime))
+	if errors.Is(err, sql.ErrNoRows) {
+		// another instance is delivering it
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot claim webhook delivery %d: %w", dl.ID, err)
+	}
+	dl.Attempts++
+
+	code, sendErr := d.send(ctx, dl)
+	now := d.now()
+	dl.LastStatusCode = code
+	dl.LastError = ""
+
+	var result string
+	if sendErr == nil {
+		dl.Status = models.WebhookDelivered
+		dl.DeliveredAt = now
+		result = "delivered"
+		log.Info("webhook delivered", "status_code", code, "attempts", dl.Attempts)
+	} else {
+		dl.LastError = truncateError(sendErr.Error())
+		if delay, ok := RetryDelay(dl.Attempts); ok {
+			dl.NextAttemptAt = now.Add(delay)
+			result = "retry"
+			log.Warn("webhook delivery failed, will retry", "attempts", dl.Attempts, "retry_in", delay, "error", sendErr)
+		} else {
+			dl.Status = models.WebhookFailed
+			result = "failed"
+			log.Error("webhook delivery failed, giving up", "attempts", dl.Attempts, "error", sendErr)
+		}
+	}
+	metrics.WebhookDeliveries.Inc(dl.Event, result)
+
+	if err := d.DB.SaveWebhookAttempt(ctx, dl); err != nil {
+		return fmt.Errorf("cannot save webhook delivery %d: %w", dl.ID, err)
+	}
+	return nil
+}
+
+// send posts the payload of dl, signed with its endpoint's secret, and returns the response status. Any
+// status other than 2xx is an error.
+func (d *Dispatcher) send(ctx context.Context, dl models.WebhookDelivery) (int, error) {
+	body := []byte(dl.Payload)
+	timestamp := strconv.FormatInt(d.now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.Endpoint.URL, strings.NewReader(dl.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Bookings-Webhooks/1.0")
+	req.Header.Set(EventHeader, dl.Event)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(dl.ID))
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(dl.Endpoint.Secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
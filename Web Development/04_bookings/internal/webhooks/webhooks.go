@@ -0,0 +1,175 @@
+// Package webhooks tells other systems, such as a channel manager or a housekeeping app, about changes to
+// reservations and the calendar. An event is queued in the database for every endpoint subscribed to it and
+// posted as signed JSON; failed deliveries are retried with growing delays.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/models"
+)
+
+// Events endpoints can subscribe to
+const (
+	ReservationCreated   = "reservation.created"
+	ReservationUpdated   = "reservation.updated"
+	ReservationProcessed = "reservation.processed"
+	ReservationCancelled = "reservation.cancelled"
+	BlockAdded           = "block.added"
+	BlockRemoved         = "block.removed"
+)
+
+// Events lists every event, in the order they are offered to staff
+var Events = []string{
+	ReservationCreated,
+	ReservationUpdated,
+	ReservationProcessed,
+	ReservationCancelled,
+	BlockAdded,
+	BlockRemoved,
+}
+
+// IsEvent reports whether name is one of Events
+func IsEvent(name string) bool {
+	return slices.Contains(Events, name)
+}
+
+// Headers sent with every delivery. The delivery id stays the same when a delivery is retried or sent
+// again by staff, so receivers can use it to ignore repeats.
+const (
+	EventHeader     = "X-Bookings-Event"
+	DeliveryHeader  = "X-Bookings-Delivery"
+	TimestampHeader = "X-Bookings-Timestamp"
+	SignatureHeader = "X-Bookings-Signature"
+)
+
+// signaturePrefix names the algorithm in the signature header
+const signaturePrefix = "sha256="
+
+// Sign returns the signature header of a delivery: the HMAC-SHA256, keyed with the endpoint's secret, of
+// the timestamp header, a dot and the body. Signing the timestamp lets receivers refuse old deliveries
+// replayed by someone who captured one.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of the delivery, as a receiver checks it
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// NewSecret returns a random secret for a new endpoint
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// retryDelays are the waits after each failed attempt, about a day and a half in all. A delivery that
+// fails once more than there are delays is given up.
+var retryDelays = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+}
+
+// MaxAttempts is how often a delivery is tried before it is marked failed
+var MaxAttempts = len(retryDelays) + 1
+
+// RetryDelay returns how long to wait after a delivery failed for the attempts-th time, and false if it
+// should not be tried again
+func RetryDelay(attempts int) (time.Duration, bool) {
+	if attempts < 1 || attempts > len(retryDelays) {
+		return 0, false
+	}
+	return retryDelays[attempts-1], true
+}
+
+// Envelope is the JSON body of every delivery
+type Envelope struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+// Reservation is the data of the reservation events
+type Reservation struct {
+	ID           int        `json:"id"`
+	RoomID       int        `json:"room_id"`
+	RoomName     string     `json:"room_name,omitempty"`
+	StartDate    string     `json:"start_date"`
+	EndDate      string     `json:"end_date"`
+	FirstName    string     `json:"first_name"`
+	LastName     string     `json:"last_name"`
+	Email        string     `json:"email"`
+	Phone        string     `json:"phone"`
+	Language     string     `json:"language,omitempty"`
+	TotalCents   int        `json:"total_cents"`
+	Processed    bool       `json:"processed"`
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`
+	PenaltyCents int        `json:"penalty_cents,omitempty"`
+	RefundCents  int        `json:"refund_cents,omitempty"`
+}
+
+// NewReservation returns the event data of res
+func NewReservation(res models.Reservation) Reservation {
+	data := Reservation{
+		ID:           res.ID,
+		RoomID:       res.RoomID,
+		RoomName:     res.Room.RoomName,
+		StartDate:    res.StartDate.Format("2006-01-02"),
+		EndDate:      res.EndDate.Format("2006-01-02"),
+		FirstName:    res.FirstName,
+		LastName:     res.LastName,
+		Email:        res.Email,
+		Phone:        res.Phone,
+		Language:     res.Locale,
+		TotalCents:   res.TotalCents,
+		Processed:    res.Processed == 1,
+		PenaltyCents: res.PenaltyCents,
+		RefundCents:  res.RefundCents,
+	}
+	if !res.CancelledAt.IsZero() {
+		at := res.CancelledAt
+		data.CancelledAt = &at
+	}
+	return data
+}
+
+// Block is the data of the block events: a night a room was closed to bookings, or opened again. The id
+// is that of the removed block; it is not known when one is added.
+type Block struct {
+	ID     int    `json:"id,omitempty"`
+	RoomID int    `json:"room_id"`
+	Date   string `json:"date"`
+}
+
+// NewBlock returns the event data of a block of room on date
+func NewBlock(id, roomID int, date time.Time) Block {
+	return Block{ID: id, RoomID: roomID, Date: date.Format("2006-01-02")}
+}
+
+// maxErrorLength keeps a verbose error from a misbehaving endpoint out of the delivery log
+const maxErrorLength = 500
+
+func truncateError(s string) string {
+	if len(s) <= maxErrorLength {
+		return s
+	}
+	return strings.ToValidUTF8(s[:maxErrorLength], "")
+}
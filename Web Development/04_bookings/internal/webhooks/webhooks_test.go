@@ -0,0 +1,334 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ashparshp/bookings/internal/config"
+	"github.com/ashparshp/bookings/internal/driver"
+	"github.com/ashparshp/bookings/internal/models"
+	"github.com/ashparshp/bookings/internal/repository"
+	"github.com/ashparshp/bookings/internal/repository/dbrepo"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"reservation.created"}`)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1720602000." + string(body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := Sign("secret", "1720602000", body); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if !Verify("secret", "1720602000", body, want) {
+		t.Error("expected the signature to verify")
+	}
+	for name, ok := range map[string]bool{
+		"other secret":    Verify("other", "1720602000", body, want),
+		"other timestamp": Verify("secret", "1720602001", body, want),
+		"other body":      Verify("secret", "1720602000", []byte(`{}`), want),
+	} {
+		if ok {
+			t.Errorf("%s: expected the signature not to verify", name)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	var total time.Duration
+	for attempts := 1; attempts < MaxAttempts; attempts++ {
+		delay, ok := RetryDelay(attempts)
+		if !ok {
+			t.Fatalf("expected a retry after %d attempts", attempts)
+		}
+		if prev, _ := RetryDelay(attempts - 1); delay <= prev {
+			t.Errorf("expected the delay to grow after %d attempts, got %s", attempts, delay)
+		}
+		total += delay
+	}
+	if _, ok := RetryDelay(MaxAttempts); ok {
+		t.Errorf("expected no retry after %d attempts", MaxAttempts)
+	}
+	if total < 24*time.Hour {
+		t.Errorf("expected retries to span at least a day, got %s", total)
+	}
+}
+
+// receiver is an endpoint that records the deliveries it gets and answers with the next status in statuses,
+// repeating the last one
+type receiver struct {
+	*httptest.Server
+	t        *testing.T
+	secret   string
+	mu       sync.Mutex
+	statuses []int
+	got      []Envelope
+	ids      []string
+	received chan struct{}
+}
+
+func newReceiver(t *testing.T, secret string, statuses ...int) *receiver {
+	rc := &receiver{t: t, secret: secret, statuses: statuses, received: make(chan struct{}, 10)}
+	rc.Server = httptest.NewServer(http.HandlerFunc(rc.serve))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		rc.t.Errorf("cannot read delivery: %v", err)
+	}
+	if !Verify(rc.secret, r.Header.Get(TimestampHeader), body, r.Header.Get(SignatureHeader)) {
+		rc.t.Errorf("delivery signature %q does not verify", r.Header.Get(SignatureHeader))
+	}
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+		rc.t.Errorf("expected a JSON POST, got %s %s", r.Method, r.Header.Get("Content-Type"))
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		rc.t.Errorf("delivery is not JSON: %v", err)
+	}
+	if env.Event != r.Header.Get(EventHeader) {
+		rc.t.Errorf("expected the %s header to be %s, got %s", EventHeader, env.Event, r.Header.Get(EventHeader))
+	}
+
+	rc.mu.Lock()
+	rc.got = append(rc.got, env)
+	rc.ids = append(rc.ids, r.Header.Get(DeliveryHeader))
+	status := rc.statuses[0]
+	if len(rc.statuses) > 1 {
+		rc.statuses = rc.statuses[1:]
+	}
+	rc.mu.Unlock()
+
+	w.WriteHeader(status)
+	rc.received <- struct{}{}
+}
+
+func (rc *receiver) count() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.got)
+}
+
+// clock is a time the tests move forward by hand
+type clock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *clock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// newDispatcher returns a dispatcher over a fresh sqlite database with an endpoint to url subscribed to
+// every event, running on a clock the test controls
+func newDispatcher(t *testing.T, url, secret string) (*Dispatcher, repository.DatabaseRepo, *clock) {
+	t.Helper()
+
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.SQL.Close() })
+	repo := dbrepo.NewSqliteRepo(db.SQL, &config.AppConfig{DBDriver: "sqlite"})
+
+	_, err = repo.InsertWebhookEndpoint(context.Background(), models.WebhookEndpoint{URL: url, Secret: secret, Events: Events, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &clock{t: time.Date(2025, 7, 10, 9, 0, 0, 0, time.UTC)}
+	d := NewDispatcher(repo, nil)
+	d.now = c.now
+	return d, repo, c
+}
+
+// deliveries returns the delivery log, newest first
+func deliveries(t *testing.T, repo repository.DatabaseRepo) []models.WebhookDelivery {
+	t.Helper()
+	log, err := repo.WebhookDeliveries(context.Background(), "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return log
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	rc := newReceiver(t, "s3cret", http.StatusNoContent)
+	d, repo, _ := newDispatcher(t, rc.URL, "s3cret")
+	ctx := context.Background()
+
+	res := models.Reservation{ID: 7, FirstName: "Jane", LastName: "Doe", RoomID: 1, Room: models.Room{RoomName: "Major's Suite"},
+		StartDate: time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2025, 8, 3, 0, 0, 0, 0, time.UTC), TotalCents: 36000}
+	if err := d.Publish(ctx, ReservationCreated, NewReservation(res)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Publish(ctx, "reservation.exploded", nil); err == nil {
+		t.Error("expected an unknown event to be refused")
+	}
+
+	if err := d.DeliverDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rc.count() != 1 {
+		t.Fatalf("expected 1 delivery, got %d", rc.count())
+	}
+
+	data, _ := json.Marshal(rc.got[0].Data)
+	var got Reservation
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 7 || got.RoomName != "Major's Suite" || got.StartDate != "2025-08-01" || got.TotalCents != 36000 {
+		t.Errorf("unexpected reservation in the payload: %+v", got)
+	}
+
+	log := deliveries(t, repo)
+	if len(log) != 1 || log[0].Status != models.WebhookDelivered || log[0].LastStatusCode != http.StatusNoContent || log[0].Attempts != 1 {
+		t.Errorf("expected 1 delivered delivery, got %+v", log)
+	}
+	if rc.ids[0] != strconv.Itoa(log[0].ID) {
+		t.Errorf("expected delivery id %d in the header, got %s", log[0].ID, rc.ids[0])
+	}
+
+	// nothing is left to deliver
+	if err := d.DeliverDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rc.count() != 1 {
+		t.Errorf("expected a delivered event not to be sent again, got %d deliveries", rc.count())
+	}
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	rc := newReceiver(t, "s3cret", http.StatusInternalServerError, http.StatusOK)
+	d, repo, c := newDispatcher(t, rc.URL, "s3cret")
+	ctx := context.Background()
+
+	if err := d.Publish(ctx, BlockAdded, NewBlock(0, 1, c.now())); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeliverDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	log := deliveries(t, repo)
+	first, _ := RetryDelay(1)
+	if log[0].Status != models.WebhookPending || log[0].LastStatusCode != http.StatusInternalServerError || log[0].LastError == "" ||
+		!log[0].NextAttemptAt.Equal(c.now().Add(first)) {
+		t.Fatalf("expected a failed attempt to be retried after %s, got %+v", first, log[0])
+	}
+
+	// the retry is not due yet
+	c.advance(first - time.Second)
+	if err := d.DeliverDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rc.count() != 1 {
+		t.Fatalf("expected no retry before it is due, got %d attempts", rc.count())
+	}
+
+	c.advance(time.Second)
+	if err := d.DeliverDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	log = deliveries(t, repo)
+	if rc.count() != 2 || log[0].Status != models.WebhookDelivered || log[0].Attempts != 2 || log[0].LastError != "" {
+		t.Errorf("expected the retry to be delivered, got %d attempts and %+v", rc.count(), log[0])
+	}
+	if rc.ids[0] != rc.ids[1] {
+		t.Errorf("expected the retry to keep the delivery id, got %s and %s", rc.ids[0], rc.ids[1])
+	}
+}
+
+func TestDispatcher_GiveUpAndRedeliver(t *testing.T) {
+	rc := newReceiver(t, "s3cret", http.StatusServiceUnavailable)
+	d, repo, c := newDispatcher(t, rc.URL, "s3cret")
+	ctx := context.Background()
+
+	if err := d.Publish(ctx, ReservationCancelled, NewReservation(models.Reservation{ID: 3})); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < MaxAttempts+2; i++ {
+		if err := d.DeliverDue(ctx); err != nil {
+			t.Fatal(err)
+		}
+		c.advance(25 * time.Hour)
+	}
+
+	log := deliveries(t, repo)
+	if rc.count() != MaxAttempts || log[0].Status != models.WebhookFailed || log[0].Attempts != MaxAttempts {
+		t.Fatalf("expected the delivery to fail after %d attempts, got %d attempts and %+v", MaxAttempts, rc.count(), log[0])
+	}
+
+	rc.mu.Lock()
+	rc.statuses = []int{http.StatusOK}
+	rc.mu.Unlock()
+	if err := d.Redeliver(ctx, log[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeliverDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	log = deliveries(t, repo)
+	if log[0].Status != models.WebhookDelivered || log[0].Attempts != 1 {
+		t.Errorf("expected the redelivery to succeed on its first attempt, got %+v", log[0])
+	}
+	if rc.got[len(rc.got)-1].Event != ReservationCancelled {
+		t.Errorf("expected the redelivery to send the same payload, got %+v", rc.got[len(rc.got)-1])
+	}
+}
+
+func TestDispatcher_Run(t *testing.T) {
+	rc := newReceiver(t, "s3cret", http.StatusOK)
+	d, _, c := newDispatcher(t, rc.URL, "s3cret")
+	d.PollInterval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(ctx)
+	}()
+
+	// publishing wakes Run, there is no waiting for the next poll
+	if err := d.Publish(context.Background(), BlockRemoved, NewBlock(12, 2, c.now())); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-rc.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the event to be delivered straight away")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Run to return when its context is cancelled")
+	}
+}
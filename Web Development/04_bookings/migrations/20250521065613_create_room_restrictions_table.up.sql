@@ -0,0 +1,12 @@
+-- sqlite cannot add foreign keys or drop NOT NULL later, so the table is created as the postgres
+-- migrations leave it
+CREATE TABLE room_restrictions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    room_id INTEGER NOT NULL REFERENCES rooms (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    restriction_id INTEGER NOT NULL REFERENCES restrictions (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    reservation_id INTEGER REFERENCES reservations (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1 @@
+-- sqlite declares the foreign key with the reservations table
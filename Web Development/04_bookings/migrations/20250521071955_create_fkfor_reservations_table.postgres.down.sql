@@ -0,0 +1 @@
+ALTER TABLE reservations DROP CONSTRAINT reservations_rooms_id_fk;
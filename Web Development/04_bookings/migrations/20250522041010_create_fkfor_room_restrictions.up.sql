@@ -0,0 +1 @@
+-- sqlite declares the foreign keys with the room_restrictions table
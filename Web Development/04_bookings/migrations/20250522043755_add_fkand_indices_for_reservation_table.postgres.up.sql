@@ -0,0 +1,4 @@
+ALTER TABLE room_restrictions ADD CONSTRAINT room_restrictions_reservations_id_fk FOREIGN KEY (reservation_id) REFERENCES reservations (id) ON DELETE CASCADE ON UPDATE CASCADE;
+
+CREATE INDEX reservations_email_idx ON reservations (email);
+CREATE INDEX reservations_last_name_idx ON reservations (last_name);
@@ -0,0 +1,3 @@
+-- sqlite declares the foreign key with the room_restrictions table
+CREATE INDEX reservations_email_idx ON reservations (email);
+CREATE INDEX reservations_last_name_idx ON reservations (last_name);
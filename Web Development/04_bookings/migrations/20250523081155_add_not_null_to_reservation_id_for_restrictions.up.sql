@@ -0,0 +1 @@
+-- sqlite creates room_restrictions.reservation_id without NOT NULL
@@ -0,0 +1,3 @@
+INSERT INTO rooms (room_name, created_at, updated_at) VALUES
+('General''s Quaters', '2023-05-23 23:00:00', '2023-05-23 23:00:00'),
+('Major''s Suite', '2023-05-23 23:00:00', '2023-05-23 23:00:00');
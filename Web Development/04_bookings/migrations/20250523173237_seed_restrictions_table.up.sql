@@ -0,0 +1,3 @@
+INSERT INTO restrictions (restriction_name, created_at, updated_at) VALUES
+('Reservation', '2020-11-28 00:00:00', '2020-11-28 00:00:00'),
+('Owner''s Block', '2020-11-28 00:00:00', '2020-11-28 00:00:00');
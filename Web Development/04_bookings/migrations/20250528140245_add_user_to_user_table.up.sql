@@ -0,0 +1,2 @@
+INSERT INTO users (first_name, last_name, email, password, access_level, created_at, updated_at) VALUES
+('ashparsh', 'pandey', 'ashparsh@admin.com', '$2a$12$lMxZd9rMZa.9quC.pNGVZeAzVTCEJ3enTiPCARdts/hFI.90KypJu', 3, '2025-05-26 00:00:00', '2025-05-26 00:00:00');
@@ -0,0 +1,16 @@
+CREATE TABLE sessions (
+    token VARCHAR(64) PRIMARY KEY,
+    data BYTEA NOT NULL,
+    expiry TIMESTAMP NOT NULL,
+    user_id INTEGER,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    last_activity TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE sessions ADD CONSTRAINT sessions_users_id_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE;
+
+CREATE INDEX sessions_expiry_idx ON sessions (expiry);
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
@@ -0,0 +1,14 @@
+CREATE TABLE sessions (
+    token VARCHAR(64) PRIMARY KEY,
+    data BLOB NOT NULL,
+    expiry TIMESTAMP NOT NULL,
+    user_id INTEGER REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    last_activity TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX sessions_expiry_idx ON sessions (expiry);
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
@@ -0,0 +1,12 @@
+CREATE TABLE reservation_emails (
+    id SERIAL PRIMARY KEY,
+    reservation_id INTEGER NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    sent_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE reservation_emails ADD CONSTRAINT reservation_emails_reservations_id_fk FOREIGN KEY (reservation_id) REFERENCES reservations (id) ON DELETE CASCADE ON UPDATE CASCADE;
+
+CREATE UNIQUE INDEX reservation_emails_reservation_id_kind_idx ON reservation_emails (reservation_id, kind);
@@ -0,0 +1,10 @@
+CREATE TABLE reservation_emails (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    reservation_id INTEGER NOT NULL REFERENCES reservations (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    kind VARCHAR(32) NOT NULL,
+    sent_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX reservation_emails_reservation_id_kind_idx ON reservation_emails (reservation_id, kind);
@@ -0,0 +1,20 @@
+CREATE TABLE reviews (
+    id SERIAL PRIMARY KEY,
+    reservation_id INTEGER NOT NULL,
+    room_id INTEGER NOT NULL,
+    rating INTEGER NOT NULL,
+    body TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    reply TEXT NOT NULL DEFAULT '',
+    replied_at TIMESTAMP,
+    moderated_by INTEGER,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE reviews ADD CONSTRAINT reviews_reservations_id_fk FOREIGN KEY (reservation_id) REFERENCES reservations (id) ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE reviews ADD CONSTRAINT reviews_rooms_id_fk FOREIGN KEY (room_id) REFERENCES rooms (id) ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE reviews ADD CONSTRAINT reviews_users_id_fk FOREIGN KEY (moderated_by) REFERENCES users (id) ON DELETE SET NULL ON UPDATE CASCADE;
+
+CREATE UNIQUE INDEX reviews_reservation_id_idx ON reviews (reservation_id);
+CREATE INDEX reviews_room_id_status_idx ON reviews (room_id, status);
@@ -0,0 +1,16 @@
+CREATE TABLE reviews (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    reservation_id INTEGER NOT NULL REFERENCES reservations (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    room_id INTEGER NOT NULL REFERENCES rooms (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    rating INTEGER NOT NULL,
+    body TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    reply TEXT NOT NULL DEFAULT '',
+    replied_at TIMESTAMP,
+    moderated_by INTEGER REFERENCES users (id) ON DELETE SET NULL ON UPDATE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX reviews_reservation_id_idx ON reviews (reservation_id);
+CREATE INDEX reviews_room_id_status_idx ON reviews (room_id, status);
@@ -0,0 +1,4 @@
+ALTER TABLE reservations DROP COLUMN total_cents;
+ALTER TABLE reservations DROP COLUMN discount_cents;
+ALTER TABLE reservations DROP COLUMN subtotal_cents;
+ALTER TABLE rooms DROP COLUMN price_cents;
@@ -0,0 +1,4 @@
+ALTER TABLE rooms ADD COLUMN price_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE reservations ADD COLUMN subtotal_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE reservations ADD COLUMN discount_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE reservations ADD COLUMN total_cents INTEGER NOT NULL DEFAULT 0;
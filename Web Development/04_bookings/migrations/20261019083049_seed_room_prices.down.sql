@@ -0,0 +1 @@
+UPDATE rooms SET price_cents = 0;
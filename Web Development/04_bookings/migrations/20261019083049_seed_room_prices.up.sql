@@ -0,0 +1,2 @@
+UPDATE rooms SET price_cents = 12000 WHERE room_name = 'General''s Quaters';
+UPDATE rooms SET price_cents = 18000 WHERE room_name = 'Major''s Suite';
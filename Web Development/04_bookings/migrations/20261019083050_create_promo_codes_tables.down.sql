@@ -0,0 +1,3 @@
+DROP TABLE promo_redemptions;
+DROP TABLE promo_code_rooms;
+DROP TABLE promo_codes;
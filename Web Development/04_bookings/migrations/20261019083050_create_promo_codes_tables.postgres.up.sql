@@ -0,0 +1,48 @@
+CREATE TABLE promo_codes (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(32) NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    kind VARCHAR(16) NOT NULL,
+    amount INTEGER NOT NULL,
+    booking_start DATE,
+    booking_end DATE,
+    stay_start DATE,
+    stay_end DATE,
+    min_nights INTEGER NOT NULL DEFAULT 0,
+    max_uses INTEGER NOT NULL DEFAULT 0,
+    max_uses_per_email INTEGER NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX promo_codes_code_idx ON promo_codes (code);
+
+CREATE TABLE promo_code_rooms (
+    id SERIAL PRIMARY KEY,
+    promo_code_id INTEGER NOT NULL,
+    room_id INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE promo_code_rooms ADD CONSTRAINT promo_code_rooms_promo_codes_id_fk FOREIGN KEY (promo_code_id) REFERENCES promo_codes (id) ON DELETE CASCADE ON UPDATE CASCADE;
+ALTER TABLE promo_code_rooms ADD CONSTRAINT promo_code_rooms_rooms_id_fk FOREIGN KEY (room_id) REFERENCES rooms (id) ON DELETE CASCADE ON UPDATE CASCADE;
+
+CREATE UNIQUE INDEX promo_code_rooms_promo_code_id_room_id_idx ON promo_code_rooms (promo_code_id, room_id);
+
+CREATE TABLE promo_redemptions (
+    id SERIAL PRIMARY KEY,
+    promo_code_id INTEGER NOT NULL,
+    reservation_id INTEGER NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    discount_cents INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE promo_redemptions ADD CONSTRAINT promo_redemptions_promo_codes_id_fk FOREIGN KEY (promo_code_id) REFERENCES promo_codes (id) ON DELETE RESTRICT ON UPDATE CASCADE;
+ALTER TABLE promo_redemptions ADD CONSTRAINT promo_redemptions_reservations_id_fk FOREIGN KEY (reservation_id) REFERENCES reservations (id) ON DELETE CASCADE ON UPDATE CASCADE;
+
+CREATE UNIQUE INDEX promo_redemptions_reservation_id_idx ON promo_redemptions (reservation_id);
+CREATE INDEX promo_redemptions_promo_code_id_email_idx ON promo_redemptions (promo_code_id, email);
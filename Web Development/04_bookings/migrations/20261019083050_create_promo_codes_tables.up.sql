@@ -0,0 +1,42 @@
+CREATE TABLE promo_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code VARCHAR(32) NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    kind VARCHAR(16) NOT NULL,
+    amount INTEGER NOT NULL,
+    booking_start DATE,
+    booking_end DATE,
+    stay_start DATE,
+    stay_end DATE,
+    min_nights INTEGER NOT NULL DEFAULT 0,
+    max_uses INTEGER NOT NULL DEFAULT 0,
+    max_uses_per_email INTEGER NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX promo_codes_code_idx ON promo_codes (code);
+
+CREATE TABLE promo_code_rooms (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    promo_code_id INTEGER NOT NULL REFERENCES promo_codes (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    room_id INTEGER NOT NULL REFERENCES rooms (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX promo_code_rooms_promo_code_id_room_id_idx ON promo_code_rooms (promo_code_id, room_id);
+
+CREATE TABLE promo_redemptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    promo_code_id INTEGER NOT NULL REFERENCES promo_codes (id) ON DELETE RESTRICT ON UPDATE CASCADE,
+    reservation_id INTEGER NOT NULL REFERENCES reservations (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    discount_cents INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX promo_redemptions_reservation_id_idx ON promo_redemptions (reservation_id);
+CREATE INDEX promo_redemptions_promo_code_id_email_idx ON promo_redemptions (promo_code_id, email);
@@ -0,0 +1,7 @@
+ALTER TABLE reservations DROP COLUMN refund_cents;
+ALTER TABLE reservations DROP COLUMN penalty_cents;
+ALTER TABLE reservations DROP COLUMN cancelled_at;
+ALTER TABLE reservations DROP COLUMN cancellation_policy_id;
+ALTER TABLE rooms DROP COLUMN cancellation_policy_id;
+DROP TABLE cancellation_policy_tiers;
+DROP TABLE cancellation_policies;
@@ -0,0 +1,9 @@
+ALTER TABLE reservations DROP CONSTRAINT reservations_cancellation_policies_id_fk;
+ALTER TABLE reservations DROP COLUMN refund_cents;
+ALTER TABLE reservations DROP COLUMN penalty_cents;
+ALTER TABLE reservations DROP COLUMN cancelled_at;
+ALTER TABLE reservations DROP COLUMN cancellation_policy_id;
+ALTER TABLE rooms DROP CONSTRAINT rooms_cancellation_policies_id_fk;
+ALTER TABLE rooms DROP COLUMN cancellation_policy_id;
+DROP TABLE cancellation_policy_tiers;
+DROP TABLE cancellation_policies;
@@ -0,0 +1,29 @@
+CREATE TABLE cancellation_policies (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE cancellation_policy_tiers (
+    id SERIAL PRIMARY KEY,
+    cancellation_policy_id INTEGER NOT NULL,
+    days_before INTEGER NOT NULL,
+    penalty_percent INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE cancellation_policy_tiers ADD CONSTRAINT cancellation_policy_tiers_cancellation_policies_id_fk FOREIGN KEY (cancellation_policy_id) REFERENCES cancellation_policies (id) ON DELETE CASCADE ON UPDATE CASCADE;
+
+CREATE UNIQUE INDEX cancellation_policy_tiers_cancellation_policy_id_days_before_idx ON cancellation_policy_tiers (cancellation_policy_id, days_before);
+
+ALTER TABLE rooms ADD COLUMN cancellation_policy_id INTEGER;
+ALTER TABLE rooms ADD CONSTRAINT rooms_cancellation_policies_id_fk FOREIGN KEY (cancellation_policy_id) REFERENCES cancellation_policies (id) ON DELETE SET NULL ON UPDATE CASCADE;
+
+ALTER TABLE reservations ADD COLUMN cancellation_policy_id INTEGER;
+ALTER TABLE reservations ADD COLUMN cancelled_at TIMESTAMP;
+ALTER TABLE reservations ADD COLUMN penalty_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE reservations ADD COLUMN refund_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE reservations ADD CONSTRAINT reservations_cancellation_policies_id_fk FOREIGN KEY (cancellation_policy_id) REFERENCES cancellation_policies (id) ON DELETE RESTRICT ON UPDATE CASCADE;
@@ -0,0 +1,25 @@
+CREATE TABLE cancellation_policies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(255) NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE cancellation_policy_tiers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    cancellation_policy_id INTEGER NOT NULL REFERENCES cancellation_policies (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    days_before INTEGER NOT NULL,
+    penalty_percent INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX cancellation_policy_tiers_cancellation_policy_id_days_before_idx ON cancellation_policy_tiers (cancellation_policy_id, days_before);
+
+ALTER TABLE rooms ADD COLUMN cancellation_policy_id INTEGER REFERENCES cancellation_policies (id) ON DELETE SET NULL ON UPDATE CASCADE;
+
+ALTER TABLE reservations ADD COLUMN cancellation_policy_id INTEGER REFERENCES cancellation_policies (id) ON DELETE RESTRICT ON UPDATE CASCADE;
+ALTER TABLE reservations ADD COLUMN cancelled_at TIMESTAMP;
+ALTER TABLE reservations ADD COLUMN penalty_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE reservations ADD COLUMN refund_cents INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+UPDATE rooms SET cancellation_policy_id = NULL;
+UPDATE reservations SET cancellation_policy_id = NULL WHERE cancellation_policy_id = (SELECT id FROM cancellation_policies WHERE name = 'Standard');
+DELETE FROM cancellation_policies WHERE name = 'Standard';
@@ -0,0 +1,10 @@
+INSERT INTO cancellation_policies (name, description, created_at, updated_at)
+VALUES ('Standard', 'Free until a week before arrival, half the price after that', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
+
+INSERT INTO cancellation_policy_tiers (cancellation_policy_id, days_before, penalty_percent, created_at, updated_at)
+SELECT id, 7, 0, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP FROM cancellation_policies WHERE name = 'Standard';
+
+INSERT INTO cancellation_policy_tiers (cancellation_policy_id, days_before, penalty_percent, created_at, updated_at)
+SELECT id, 0, 50, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP FROM cancellation_policies WHERE name = 'Standard';
+
+UPDATE rooms SET cancellation_policy_id = (SELECT id FROM cancellation_policies WHERE name = 'Standard');
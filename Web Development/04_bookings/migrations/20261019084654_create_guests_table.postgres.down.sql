@@ -0,0 +1,4 @@
+DROP INDEX reservations_guest_id_idx;
+ALTER TABLE reservations DROP CONSTRAINT reservations_guests_id_fk;
+ALTER TABLE reservations DROP COLUMN guest_id;
+DROP TABLE guests;
@@ -0,0 +1,18 @@
+CREATE TABLE guests (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    first_name VARCHAR(255) NOT NULL DEFAULT '',
+    last_name VARCHAR(255) NOT NULL DEFAULT '',
+    phone VARCHAR(255) NOT NULL DEFAULT '',
+    notes TEXT NOT NULL DEFAULT '',
+    anonymized_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX guests_email_idx ON guests (email);
+
+ALTER TABLE reservations ADD COLUMN guest_id INTEGER;
+ALTER TABLE reservations ADD CONSTRAINT reservations_guests_id_fk FOREIGN KEY (guest_id) REFERENCES guests (id) ON DELETE SET NULL ON UPDATE CASCADE;
+
+CREATE INDEX reservations_guest_id_idx ON reservations (guest_id);
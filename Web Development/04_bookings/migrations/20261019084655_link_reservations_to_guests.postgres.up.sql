@@ -0,0 +1,7 @@
+INSERT INTO guests (email, first_name, last_name, phone, notes, created_at, updated_at)
+SELECT DISTINCT ON (lower(trim(email))) lower(trim(email)), first_name, last_name, phone, '', now(), now()
+FROM reservations
+WHERE trim(email) <> ''
+ORDER BY lower(trim(email)), created_at DESC, id DESC;
+
+UPDATE reservations r SET guest_id = g.id FROM guests g WHERE g.email = lower(trim(r.email));
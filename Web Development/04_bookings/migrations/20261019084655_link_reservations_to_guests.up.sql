@@ -0,0 +1,9 @@
+INSERT INTO guests (email, first_name, last_name, phone, notes, created_at, updated_at)
+SELECT lower(trim(r.email)), r.first_name, r.last_name, r.phone, '', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+FROM reservations r
+WHERE trim(r.email) <> ''
+AND r.id = (
+    SELECT id FROM reservations WHERE lower(trim(email)) = lower(trim(r.email)) ORDER BY created_at DESC, id DESC LIMIT 1
+);
+
+UPDATE reservations SET guest_id = (SELECT id FROM guests WHERE guests.email = lower(trim(reservations.email)));
@@ -0,0 +1,13 @@
+CREATE TABLE guest_notification_preferences (
+    id SERIAL PRIMARY KEY,
+    guest_id INTEGER NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    channel VARCHAR(16) NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE guest_notification_preferences ADD CONSTRAINT guest_notification_preferences_guests_id_fk FOREIGN KEY (guest_id) REFERENCES guests (id) ON DELETE CASCADE ON UPDATE CASCADE;
+
+CREATE UNIQUE INDEX guest_notification_preferences_guest_id_kind_channel_idx ON guest_notification_preferences (guest_id, kind, channel);
@@ -0,0 +1,11 @@
+CREATE TABLE guest_notification_preferences (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    guest_id INTEGER NOT NULL REFERENCES guests (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    kind VARCHAR(32) NOT NULL,
+    channel VARCHAR(16) NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX guest_notification_preferences_guest_id_kind_channel_idx ON guest_notification_preferences (guest_id, kind, channel);
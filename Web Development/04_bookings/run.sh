@@ -2,31 +2,46 @@
 
 if [ "$1" = "dev" ] || [ -z "$1" ]; then
     echo "Starting in development mode..."
-    go run $(find cmd/web -name "*.go" -not -name "*_test.go") \
+    DB_PASSWORD="${DB_PASSWORD:-postgres}" go run $(find cmd/web -name "*.go" -not -name "*_test.go") \
         -dbname=bookings \
         -dbuser=ashparsh \
-        -dbpassword=postgres \
         -production=false \
-        -cache=false \
+        -dev \
+        -mailhost=localhost \
+        -mailport=1025 \
+        -mailencryption=none \
+        -mailfrom=noreply@bookings.dev \
+        -mailfromname="Bookings Dev"
+fi
+
+if [ "$1" = "lite" ]; then
+    echo "Starting in development mode with sqlite..."
+    go run $(find cmd/web -name "*.go" -not -name "*_test.go") \
+        -dbdriver=sqlite \
+        -dbname=bookings.db \
+        -production=false \
+        -dev \
         -mailhost=localhost \
         -mailport=1025 \
-        -mailusername="" \
-        -mailpassword="" \
         -mailencryption=none \
         -mailfrom=noreply@bookings.dev \
         -mailfromname="Bookings Dev"
 fi
 
 if [ "$1" = "prod" ]; then
-    # Load environment variables from .env file if it exists
+    # Load environment variables from .env file if it exists, exporting them so
+    # secrets reach the application through its environment rather than its arguments
     if [ -f .env ]; then
+        set -a
         source .env
+        set +a
     fi
 
     # Check for required environment variables
-    if [ -z "$DB_PASSWORD" ] || [ -z "$MAIL_PASSWORD" ] || [ -z "$MAIL_USERNAME" ]; then
+    if { [ -z "$DB_PASSWORD" ] && [ -z "$DB_PASSWORD_FILE" ]; } || \
+       { [ -z "$MAIL_PASSWORD" ] && [ -z "$MAIL_PASSWORD_FILE" ]; } || [ -z "$MAIL_USERNAME" ]; then
         echo "Error: Required environment variables not set."
-        echo "Please set DB_PASSWORD, MAIL_USERNAME, and MAIL_PASSWORD in a .env file or export them."
+        echo "Please set DB_PASSWORD, MAIL_USERNAME, and MAIL_PASSWORD (or DB_PASSWORD_FILE / MAIL_PASSWORD_FILE) in a .env file or export them."
         exit 1
     fi
 
@@ -34,7 +49,6 @@ if [ "$1" = "prod" ]; then
     go run $(find cmd/web -name "*.go" -not -name "*_test.go") \
         -dbname=bookings_db_8szz \
         -dbuser=bookings_db_8szz_user \
-        -dbpassword="$DB_PASSWORD" \
         -dbhost=dpg-d0rhah15pdvs73e0csr0-a.singapore-postgres.render.com \
         -dbport=5432 \
         -dbssl=require \
@@ -42,8 +56,6 @@ if [ "$1" = "prod" ]; then
         -cache=true \
         -mailhost=smtp.gmail.com \
         -mailport=587 \
-        -mailusername="$MAIL_USERNAME" \
-        -mailpassword="$MAIL_PASSWORD" \
         -mailencryption=starttls \
         -mailfrom=noreply@bookings.com \
         -mailfromname="bookings"
@@ -61,6 +73,7 @@ if [ "$1" = "help" ] || [ "$1" = "-h" ] || [ "$1" = "--help" ]; then
     echo ""
     echo "Modes:"
     echo "  dev   - Development mode (default)"
+    echo "  lite  - Development mode with a local sqlite database"
     echo "  prod  - Production mode with Gmail SMTP"
     echo "  build - Build binary only"
     echo "  help  - Show this help"
@@ -68,6 +81,7 @@ if [ "$1" = "help" ] || [ "$1" = "-h" ] || [ "$1" = "--help" ]; then
     echo "Examples:"
     echo "  ./run.sh      # Run in development"
     echo "  ./run.sh dev  # Run in development"
+    echo "  ./run.sh lite # Run in development with sqlite"
     echo "  ./run.sh prod # Run in production"
     echo "  ./run.sh build # Build binary"
 fi
\ No newline at end of file